@@ -2,6 +2,7 @@ package battery
 
 import (
 	"log"
+	"math/rand"
 	"sync"
 	"time"
 )
@@ -21,49 +22,123 @@ type StateNotifier interface {
 // Profiler is a Guage that periodically polls an underlying
 // Guage.
 type Profiler struct {
-	g      Guage
-	change chan struct{}
-	stop   chan struct{}
+	// Jitter is the fraction of the polling interval by which each poll is
+	// randomly offset, so that many processes started at once do not all
+	// poll at the same time.  Jitter must be set before Start is called.
+	Jitter float64
+
+	g       Guage
+	clock   Clock
+	rand    func() float64
+	change  chan struct{}
+	refresh chan struct{}
+	stop    chan struct{}
+	stopped sync.Once
+	done    chan struct{}
 
 	mut     sync.RWMutex
+	started bool
+	paused  bool
 	metrics *Metrics
+	updated time.Time
+
+	// onAC is the last known power source and plugChanged is the time it
+	// was first observed.
+	onAC        *bool
+	plugChanged time.Time
 }
 
 // NewProfiler returns a new Profiler that periodically polls g.
 func NewProfiler(g Guage) *Profiler {
 	b := new(Profiler)
 	b.stop = make(chan struct{})
+	b.done = make(chan struct{})
+	b.refresh = make(chan struct{}, 1)
+	b.clock = SystemClock
+	b.rand = rand.New(rand.NewSource(time.Now().UnixNano())).Float64
 	b.g = g
 	return b
 }
 
 // Start begins polling the underlying Guage at the specified interval
 // and sends Metrics over c.
+//
+// If the wall clock jumps forward between polls, as when the system resumes
+// from suspension, the Guage is polled immediately.  Estimates of time
+// remaining are unreliable immediately after resuming so they are omitted
+// from Metrics until a later poll returns estimates that differ from those
+// made before the suspension.
 func (b *Profiler) Start(interval time.Duration, c chan<- *Metrics) {
+	b.mut.Lock()
+	b.started = true
+	b.mut.Unlock()
+	defer close(b.done)
+
 	watchStop := b.watchState()
 	defer watchStop()
 
-	tick := time.NewTicker(interval)
+	tick := NewJitterTicker(b.clock, interval, b.Jitter, b.rand)
 	defer tick.Stop()
 
+	// ticks may be late by as much as the jitter before a resume is detected.
+	resumeAfter := interval + interval/2 + time.Duration(b.Jitter*float64(interval))
+
 	refreshing := false
+	pending := false // another refresh is required after the current one
+	// while stale is not nil time estimates are unreliable and omitted.  The
+	// first skip polls after a resume are never trusted.
+	var stale *Metrics
+	skip := 0
 	refreshed := make(chan error, 1)
 	refresh := func() { refreshed <- b.refreshMetrics() }
 
 	refreshing = true
 	refresh()
 
+	// wall clock times are used to detect suspension because the monotonic
+	// clock does not advance while the system is suspended.
+	last := b.clock.Now().Round(0)
+
 	for {
 		// either stop or refresh the metrics and attempt to notify c
 		select {
 		case <-b.stop:
+			if refreshing {
+				<-refreshed
+			}
 			return
 		case <-b.change:
 			if !refreshing {
 				refreshing = true
 				go refresh()
 			}
-		case <-tick.C:
+		case <-b.refresh:
+			if !refreshing {
+				refreshing = true
+				go refresh()
+			}
+		case <-tick.C():
+			now := b.clock.Now().Round(0)
+			elapsed := now.Sub(last)
+			last = now
+			if elapsed > resumeAfter {
+				log.Printf("resume detected: %v since last poll", elapsed)
+				if stale == nil {
+					stale = b.batteryMetrics()
+				}
+				if stale == nil {
+					stale = &Metrics{}
+				}
+				skip = 1
+				if refreshing {
+					// the poll in progress began before the resume.
+					skip = 2
+					pending = true
+				}
+			}
+			if b.isPaused() {
+				continue
+			}
 			if !refreshing {
 				refreshing = true
 				go refresh()
@@ -73,6 +148,21 @@ func (b *Profiler) Start(interval time.Duration, c chan<- *Metrics) {
 			if err != nil {
 				log.Print(err)
 			}
+			if stale != nil && err == nil {
+				if skip > 0 {
+					skip--
+				} else if !sameRemaining(b.batteryMetrics(), stale) {
+					stale = nil
+				}
+			}
+			if stale != nil {
+				b.omitRemaining()
+			}
+			if pending {
+				pending = false
+				refreshing = true
+				go refresh()
+			}
 			select {
 			case c <- b.batteryMetrics():
 			default:
@@ -81,6 +171,31 @@ func (b *Profiler) Start(interval time.Duration, c chan<- *Metrics) {
 	}
 }
 
+// sameRemaining returns true if m1 and m2 have equal time estimates.
+func sameRemaining(m1, m2 *Metrics) bool {
+	return durEqual(m1.UntilEmpty, m2.UntilEmpty) && durEqual(m1.UntilFull, m2.UntilFull)
+}
+
+func durEqual(d1, d2 *time.Duration) bool {
+	if d1 == nil || d2 == nil {
+		return d1 == d2
+	}
+	return *d1 == *d2
+}
+
+// omitRemaining removes time estimates from the cached metrics.
+func (b *Profiler) omitRemaining() {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	if b.metrics == nil {
+		return
+	}
+	m := *b.metrics
+	m.UntilEmpty = nil
+	m.UntilFull = nil
+	b.metrics = &m
+}
+
 func (b *Profiler) watchState() func() {
 	if notf, ok := b.g.(StateNotifier); ok {
 		b.change = make(chan struct{})
@@ -89,9 +204,55 @@ func (b *Profiler) watchState() func() {
 	return func() {} // noop
 }
 
-// Stop prevents future poll events.
+// Refresh causes the Profiler to poll the underlying Guage immediately instead
+// of waiting for the next interval.  Refresh does not block and may be called
+// concurrently.  Requests made while a poll is pending are coalesced.
+func (b *Profiler) Refresh() {
+	select {
+	case b.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// Pause suspends periodic polling of the underlying Guage until Resume is
+// called, as while the metrics are not being displayed.  Refresh and battery
+// state changes continue to cause polls while the Profiler is paused.
+func (b *Profiler) Pause() {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	b.paused = true
+}
+
+// Resume resumes periodic polling after a call to Pause.  If the Profiler was
+// paused the underlying Guage is polled immediately because its metrics may
+// be out of date.
+func (b *Profiler) Resume() {
+	b.mut.Lock()
+	paused := b.paused
+	b.paused = false
+	b.mut.Unlock()
+	if paused {
+		b.Refresh()
+	}
+}
+
+func (b *Profiler) isPaused() bool {
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	return b.paused
+}
+
+// Stop prevents future poll events.  If the Profiler has been started Stop
+// waits for Start to return, including any poll in progress.  Stop may be
+// called more than once.
 func (b *Profiler) Stop() {
-	close(b.stop)
+	b.stopped.Do(func() { close(b.stop) })
+	b.mut.RLock()
+	started := b.started
+	b.mut.RUnlock()
+	if started {
+		<-b.done
+	}
 }
 
 func (b *Profiler) refreshMetrics() error {
@@ -99,12 +260,50 @@ func (b *Profiler) refreshMetrics() error {
 	if err != nil {
 		return err
 	}
+	now := b.clock.Now()
+
+	// the guage may return the same Metrics from each call so a copy is
+	// modified.
+	mc := *m
 	b.mut.Lock()
-	b.metrics = m
+	b.trackPower(&mc, now)
+	b.metrics = &mc
+	b.updated = now
 	b.mut.Unlock()
 	return nil
 }
 
+// trackPower records the time at which the power source of m was first
+// observed and sets m.SincePlug.  Metrics which do not determine the power
+// source, like those in the Unknown state, are not considered a change.  The
+// caller must hold b.mut.
+func (b *Profiler) trackPower(m *Metrics, now time.Time) {
+	onAC := m.OnAC
+	if onAC == nil {
+		onAC = InferOnAC(m.State)
+	}
+	if onAC != nil && (b.onAC == nil || *b.onAC != *onAC) {
+		b.onAC = new(bool)
+		*b.onAC = *onAC
+		b.plugChanged = now
+	}
+	if b.onAC == nil {
+		return
+	}
+	since := now.Sub(b.plugChanged)
+	m.SincePlug = &since
+}
+
+// LastUpdated returns the time the underlying Guage was last polled
+// successfully.  When polls fail the Profiler continues to report the last
+// metrics it received, which become stale.  LastUpdated returns the zero time
+// if no poll has succeeded.
+func (b *Profiler) LastUpdated() time.Time {
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	return b.updated
+}
+
 func (b *Profiler) batteryMetrics() *Metrics {
 	b.mut.RLock()
 	m := b.metrics
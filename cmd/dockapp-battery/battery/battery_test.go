@@ -0,0 +1,389 @@
+package battery
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countGuage is a Guage that counts the number of times it has been polled.
+type countGuage struct {
+	mut sync.Mutex
+	n   int
+}
+
+func (g *countGuage) BatteryMetrics() (*Metrics, error) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	g.n++
+	untilEmpty := time.Duration(g.n) * time.Minute
+	m := &Metrics{
+		Fraction:   float64(g.n) / 100,
+		State:      Discharging,
+		UntilEmpty: &untilEmpty,
+	}
+	return m, nil
+}
+
+// receiveMetrics waits for metrics to be sent over c.
+func receiveMetrics(c <-chan *Metrics) (*Metrics, bool) {
+	select {
+	case m := <-c:
+		return m, true
+	case <-time.After(time.Second):
+		return nil, false
+	}
+}
+
+func TestProfiler_Refresh(t *testing.T) {
+	g := &countGuage{}
+	p := NewProfiler(g)
+	c := make(chan *Metrics, 1)
+	go p.Start(time.Hour, c)
+	defer p.Stop()
+
+	m, ok := receiveMetrics(c)
+	if !ok {
+		t.Fatalf("no initial metrics")
+	}
+	if m.Fraction != 0.01 {
+		t.Errorf("initial fraction: %v", m.Fraction)
+	}
+
+	for i := 0; i < 3; i++ {
+		p.Refresh()
+		m, ok := receiveMetrics(c)
+		if !ok {
+			t.Fatalf("test %d: no metrics after refresh", i)
+		}
+		if m.Fraction != float64(i+2)/100 {
+			t.Errorf("test %d: fraction %v", i, m.Fraction)
+		}
+	}
+
+	// concurrent refreshes must not block.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.Refresh()
+		}()
+	}
+	wg.Wait()
+	if _, ok := receiveMetrics(c); !ok {
+		t.Fatalf("no metrics after concurrent refresh")
+	}
+}
+
+// estimateGuage is a Guage that returns a settable estimate of the time
+// until empty.
+type estimateGuage struct {
+	mut        sync.Mutex
+	untilEmpty time.Duration
+}
+
+func (g *estimateGuage) set(untilEmpty time.Duration) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	g.untilEmpty = untilEmpty
+}
+
+func (g *estimateGuage) BatteryMetrics() (*Metrics, error) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	untilEmpty := g.untilEmpty
+	m := &Metrics{
+		Fraction:   0.5,
+		State:      Discharging,
+		UntilEmpty: &untilEmpty,
+	}
+	return m, nil
+}
+
+func TestProfiler_resume(t *testing.T) {
+	clock := newFakeClock()
+	g := &estimateGuage{untilEmpty: 10 * time.Minute}
+	p := NewProfiler(g)
+	p.clock = clock
+	c := make(chan *Metrics, 1)
+	interval := time.Minute
+	go p.Start(interval, c)
+	defer p.Stop()
+
+	if _, ok := receiveMetrics(c); !ok {
+		t.Fatalf("no initial metrics")
+	}
+
+	for i, test := range []struct {
+		advance    time.Duration
+		untilEmpty time.Duration
+		remaining  bool
+	}{
+		{interval, 10 * time.Minute, true},
+		{2 * time.Hour, 10 * time.Minute, false}, // suspended
+		{interval, 10 * time.Minute, false},      // estimate from before suspending
+		{interval, 10 * time.Minute, false},
+		{interval, 20 * time.Minute, true},
+		{interval, 20 * time.Minute, true},
+		{2 * time.Hour, 30 * time.Minute, false}, // suspended
+		{interval, 30 * time.Minute, true},
+	} {
+		g.set(test.untilEmpty)
+		clock.Advance(test.advance)
+		m, ok := receiveMetrics(c)
+		if !ok {
+			t.Fatalf("test %d: no metrics", i)
+		}
+		if (m.UntilEmpty != nil) != test.remaining {
+			t.Errorf("test %d: remaining %v", i, durString(m.UntilEmpty))
+		}
+		if FormatRemaining(m) == "" {
+			t.Errorf("test %d: empty remaining", i)
+		}
+	}
+}
+
+// expectNoMetrics fails the test if metrics are sent over c.
+func expectNoMetrics(t *testing.T, c <-chan *Metrics) {
+	select {
+	case m := <-c:
+		t.Errorf("unexpected metrics: %v", m.Fraction)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestProfiler_Pause(t *testing.T) {
+	clock := newFakeClock()
+	g := &countGuage{}
+	p := NewProfiler(g)
+	p.clock = clock
+	c := make(chan *Metrics, 1)
+	interval := time.Minute
+	go p.Start(interval, c)
+	defer p.Stop()
+
+	if _, ok := receiveMetrics(c); !ok {
+		t.Fatalf("no initial metrics")
+	}
+
+	// resuming a running profiler does not poll.
+	p.Resume()
+	expectNoMetrics(t, c)
+
+	// ticks are ignored while paused.
+	p.Pause()
+	p.Pause()
+	for i := 0; i < 3; i++ {
+		clock.Advance(interval)
+		expectNoMetrics(t, c)
+	}
+
+	// explicit refreshes poll while paused.
+	p.Refresh()
+	m, ok := receiveMetrics(c)
+	if !ok {
+		t.Fatalf("no metrics after refresh")
+	}
+	if m.Fraction != 0.02 {
+		t.Errorf("refresh fraction: %v", m.Fraction)
+	}
+
+	// resuming polls immediately and then at each tick.
+	p.Resume()
+	for i := 0; i < 2; i++ {
+		m, ok := receiveMetrics(c)
+		if !ok {
+			t.Fatalf("test %d: no metrics after resume", i)
+		}
+		if m.Fraction != float64(i+3)/100 {
+			t.Errorf("test %d: fraction %v", i, m.Fraction)
+		}
+		clock.Advance(interval)
+	}
+}
+
+func TestProfiler_sincePlug(t *testing.T) {
+	onAC, onBattery := true, false
+	dur := func(d time.Duration) *time.Duration { return &d }
+	tests := []struct {
+		advance time.Duration
+		m       *Metrics
+		since   *time.Duration
+	}{
+		{0, &Metrics{State: Unknown}, nil},
+		{time.Minute, &Metrics{State: Discharging}, dur(0)},
+		{10 * time.Minute, &Metrics{State: Discharging}, dur(10 * time.Minute)},
+		{5 * time.Minute, &Metrics{State: Unknown}, dur(15 * time.Minute)},
+		{5 * time.Minute, &Metrics{State: PendingCharge}, dur(0)},
+		{5 * time.Minute, &Metrics{State: Charging}, dur(5 * time.Minute)},
+		{5 * time.Minute, &Metrics{State: PendingDischarge}, dur(10 * time.Minute)},
+		{time.Minute, &Metrics{State: Charging, OnAC: &onBattery}, dur(0)},
+		{time.Minute, &Metrics{State: Discharging}, dur(time.Minute)},
+		{time.Hour, &Metrics{State: Empty, OnAC: &onAC}, dur(0)},
+	}
+	g := &seqGuage{}
+	for _, test := range tests {
+		g.seq = append(g.seq, test.m)
+	}
+	clock := newFakeClock()
+	p := NewProfiler(g)
+	p.clock = clock
+	for i, test := range tests {
+		clock.Advance(test.advance)
+		err := p.refreshMetrics()
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		since := p.batteryMetrics().SincePlug
+		if (since == nil) != (test.since == nil) || since != nil && *since != *test.since {
+			t.Errorf("test %d: since plug %s (expected %s)", i, durString(since), durString(test.since))
+		}
+		if test.m.SincePlug != nil {
+			t.Errorf("test %d: guage metrics modified", i)
+		}
+	}
+}
+
+// waitGoroutines waits for the number of running goroutines to fall to n,
+// failing the test if it does not do so promptly.
+func waitGoroutines(t *testing.T, n int) {
+	timeout := time.After(time.Second)
+	for runtime.NumGoroutine() > n {
+		select {
+		case <-timeout:
+			t.Fatalf("%d goroutines running (expected %d)", runtime.NumGoroutine(), n)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+// gateGuage is a Guage that blocks each poll after the first until it is
+// released.
+type gateGuage struct {
+	countGuage
+	polling chan struct{}
+	release chan struct{}
+}
+
+func (g *gateGuage) BatteryMetrics() (*Metrics, error) {
+	m, err := g.countGuage.BatteryMetrics()
+	if m.Fraction > 0.01 {
+		g.polling <- struct{}{}
+		<-g.release
+	}
+	return m, err
+}
+
+func TestProfiler_temperature(t *testing.T) {
+	g := &seqGuage{seq: []*Metrics{
+		{State: Charging, Temperature: 35.5},
+		{State: Charging},
+	}}
+	p := NewProfiler(g)
+	p.clock = newFakeClock()
+	for i, expect := range []float64{35.5, 0} {
+		err := p.refreshMetrics()
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		temp := p.batteryMetrics().Temperature
+		if temp != expect {
+			t.Errorf("test %d: temperature %v (expected %v)", i, temp, expect)
+		}
+	}
+}
+
+func TestProfiler_Stop(t *testing.T) {
+	n := runtime.NumGoroutine()
+	p := NewProfiler(&countGuage{})
+	c := make(chan *Metrics, 1)
+	go p.Start(time.Hour, c)
+	if _, ok := receiveMetrics(c); !ok {
+		t.Fatalf("no initial metrics")
+	}
+	p.Stop()
+	p.Stop()
+	waitGoroutines(t, n)
+}
+
+func TestProfiler_Stop_polling(t *testing.T) {
+	n := runtime.NumGoroutine()
+	g := &gateGuage{
+		polling: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	p := NewProfiler(g)
+	c := make(chan *Metrics, 1)
+	go p.Start(time.Hour, c)
+	if _, ok := receiveMetrics(c); !ok {
+		t.Fatalf("no initial metrics")
+	}
+	p.Refresh()
+	<-g.polling
+
+	stopped := make(chan struct{})
+	go func() {
+		p.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		t.Fatalf("stopped during a poll")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(g.release)
+	<-stopped
+	waitGoroutines(t, n)
+}
+
+func TestProfiler_Stop_unstarted(t *testing.T) {
+	p := NewProfiler(&countGuage{})
+	p.Stop()
+}
+
+// failGuage is a Guage that fails after its first poll.
+type failGuage struct {
+	countGuage
+}
+
+func (g *failGuage) BatteryMetrics() (*Metrics, error) {
+	m, err := g.countGuage.BatteryMetrics()
+	if m.Fraction > 0.01 {
+		return nil, fmt.Errorf("poll failed")
+	}
+	return m, err
+}
+
+func TestProfiler_LastUpdated(t *testing.T) {
+	clock := newFakeClock()
+	p := NewProfiler(&failGuage{})
+	p.clock = clock
+	if !p.LastUpdated().IsZero() {
+		t.Errorf("updated before polling")
+	}
+	c := make(chan *Metrics, 1)
+	start := clock.Now()
+	go p.Start(time.Minute, c)
+	defer p.Stop()
+	if _, ok := receiveMetrics(c); !ok {
+		t.Fatalf("no initial metrics")
+	}
+	if !p.LastUpdated().Equal(start) {
+		t.Errorf("updated %v (expected %v)", p.LastUpdated(), start)
+	}
+
+	clock.Advance(time.Minute)
+	m, ok := receiveMetrics(c)
+	if !ok {
+		t.Fatalf("no metrics after failed poll")
+	}
+	if m.Fraction != 0.01 {
+		t.Errorf("fraction %v (expected cached 0.01)", m.Fraction)
+	}
+	if !p.LastUpdated().Equal(start) {
+		t.Errorf("updated %v after failed poll (expected %v)", p.LastUpdated(), start)
+	}
+}
@@ -0,0 +1,101 @@
+package battery
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a source of time.  Clock allows time dependent behavior to be
+// tested deterministically.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks at intervals.  See time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// SystemClock is a Clock that uses the time package.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTicker struct {
+	t *time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t systemTicker) Stop() {
+	t.t.Stop()
+}
+
+// NewJitterTicker returns a Ticker that delivers ticks from clock at random
+// intervals of d plus or minus at most the fraction jitter of d.  Each interval
+// is chosen with rand, which returns values in [0, 1) like rand.Float64.  Jitter
+// keeps processes started together from polling at the same time.  If jitter
+// is not positive the ticker delivers ticks at fixed intervals of d.
+func NewJitterTicker(clock Clock, d time.Duration, jitter float64, rand func() float64) Ticker {
+	if jitter <= 0 {
+		return clock.NewTicker(d)
+	}
+	t := &jitterTicker{
+		c:    make(chan time.Time, 1),
+		stop: make(chan struct{}),
+	}
+	go t.loop(clock, d, jitter, rand)
+	return t
+}
+
+// JitterInterval returns d offset by the fraction jitter of d, scaled by r in
+// [0, 1) so that the returned interval is in the range [d-jitter*d, d+jitter*d).
+func JitterInterval(d time.Duration, jitter float64, r float64) time.Duration {
+	return d + time.Duration((2*r-1)*jitter*float64(d))
+}
+
+type jitterTicker struct {
+	c       chan time.Time
+	stop    chan struct{}
+	stopped sync.Once
+}
+
+func (t *jitterTicker) loop(clock Clock, d time.Duration, jitter float64, rand func() float64) {
+	for {
+		select {
+		case <-t.stop:
+			return
+		case now := <-clock.After(JitterInterval(d, jitter, rand())):
+			// like time.Ticker, ticks are dropped for slow receivers.
+			select {
+			case t.c <- now:
+			default:
+			}
+		}
+	}
+}
+
+func (t *jitterTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *jitterTicker) Stop() {
+	t.stopped.Do(func() { close(t.stop) })
+}
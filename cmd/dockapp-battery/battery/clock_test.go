@@ -0,0 +1,185 @@
+package battery
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock whose time only changes when Advance is called.
+type fakeClock struct {
+	mut     sync.Mutex
+	now     time.Time
+	timers  []*fakeTimer
+	tickers []*fakeTicker
+}
+
+type fakeTimer struct {
+	c    chan time.Time
+	when time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	t := &fakeTimer{
+		c:    make(chan time.Time, 1),
+		when: c.now.Add(d),
+	}
+	c.timers = append(c.timers, t)
+	return t.c
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) Ticker {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	t := &fakeTicker{
+		clock: c,
+		c:     make(chan time.Time, 1),
+		d:     d,
+		next:  c.now.Add(d),
+	}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+// Advance moves the clock forward by d, firing any timers and delivering a
+// tick to any tickers that have come due.  Like time.Ticker, ticks are dropped for slow receivers so
+// at most one tick is delivered for each call to Advance.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.now = c.now.Add(d)
+	timers := c.timers[:0]
+	for _, t := range c.timers {
+		if t.when.After(c.now) {
+			timers = append(timers, t)
+			continue
+		}
+		t.c <- t.when
+	}
+	c.timers = timers
+	for _, t := range c.tickers {
+		if t.stopped || t.next.After(c.now) {
+			continue
+		}
+		select {
+		case t.c <- t.next:
+		default:
+		}
+		for !t.next.After(c.now) {
+			t.next = t.next.Add(t.d)
+		}
+	}
+}
+
+// waitTimers waits until n timers are pending.
+func (c *fakeClock) waitTimers(n int) {
+	for {
+		c.mut.Lock()
+		pending := len(c.timers)
+		c.mut.Unlock()
+		if pending >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// numTickers returns the number of tickers that have not been stopped.
+func (c *fakeClock) numTickers() int {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	var n int
+	for _, t := range c.tickers {
+		if !t.stopped {
+			n++
+		}
+	}
+	return n
+}
+
+type fakeTicker struct {
+	clock   *fakeClock
+	c       chan time.Time
+	d       time.Duration
+	next    time.Time
+	stopped bool
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTicker) Stop() {
+	t.clock.mut.Lock()
+	defer t.clock.mut.Unlock()
+	t.stopped = true
+}
+
+func TestJitterInterval(t *testing.T) {
+	const d = time.Minute
+	const jitter = 0.1
+	min := d - time.Duration(jitter*float64(d))
+	max := d + time.Duration(jitter*float64(d))
+	r := rand.New(rand.NewSource(1))
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		interval := JitterInterval(d, jitter, r.Float64())
+		if interval < min || interval > max {
+			t.Errorf("test %d: interval %v not in [%v, %v]", i, interval, min, max)
+		}
+		seen[interval] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("intervals do not vary")
+	}
+	if interval := JitterInterval(d, 0, 0.9); interval != d {
+		t.Errorf("interval without jitter: %v", interval)
+	}
+}
+
+func TestJitterTicker(t *testing.T) {
+	clock := newFakeClock()
+	r := []float64{0, 0.999, 0.5, 0.25}
+	var n int
+	rand := func() float64 {
+		x := r[n%len(r)]
+		n++
+		return x
+	}
+	const d = time.Minute
+	tick := NewJitterTicker(clock, d, 0.5, rand)
+	defer tick.Stop()
+	for i, interval := range []time.Duration{
+		30 * time.Second,
+		JitterInterval(d, 0.5, 0.999),
+		60 * time.Second,
+		45 * time.Second,
+	} {
+		clock.waitTimers(1)
+		clock.Advance(interval - 1)
+		select {
+		case <-tick.C():
+			t.Errorf("test %d: early tick", i)
+		default:
+		}
+		clock.Advance(1)
+		select {
+		case <-tick.C():
+		case <-time.After(time.Second):
+			t.Fatalf("test %d: no tick after %v", i, interval)
+		}
+	}
+}
@@ -2,12 +2,20 @@ package battery
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"log"
 	"math"
+	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
 )
 
 //go:generate stringer -type=State
@@ -16,9 +24,13 @@ import (
 // upower integer values.
 type State int
 
-// State values.
+// State values.  A battery in the PendingCharge state is connected to line
+// power but not charging, commonly because its charge has reached a
+// configured threshold (e.g. 80%).  The Unknown state is reported while the
+// state cannot be determined, as briefly after line power is connected.
 const (
-	Charging State = 1 + iota
+	Unknown State = iota
+	Charging
 	Discharging
 	Empty
 	FullyCharged
@@ -26,23 +38,204 @@ const (
 	PendingDischarge
 )
 
+// MarshalText implements the encoding.TextMarshaler interface.  A State is
+// encoded as its name (e.g. "Discharging").
+func (s State) MarshalText() ([]byte, error) {
+	if s < Unknown || s > PendingDischarge {
+		return nil, fmt.Errorf("invalid state %d", int(s))
+	}
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.  Text is
+// parsed with ParseState.
+func (s *State) UnmarshalText(text []byte) error {
+	state, err := ParseState(string(text))
+	if err != nil {
+		return err
+	}
+	*s = state
+	return nil
+}
+
+// ParseState returns the State named by s (e.g. "Discharging"), matched
+// without regard to case, or the State whose integer value is s (e.g. "2").
+func ParseState(s string) (State, error) {
+	for state := Unknown; state <= PendingDischarge; state++ {
+		if strings.EqualFold(s, state.String()) {
+			return state, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err == nil && State(n) >= Unknown && State(n) <= PendingDischarge {
+		return State(n), nil
+	}
+	return Unknown, fmt.Errorf("unknown state %q", s)
+}
+
 // Metrics describes the set state of the computer's battery.
 type Metrics struct {
 	Fraction   float64
 	State      State
 	UntilEmpty *time.Duration
 	UntilFull  *time.Duration
+
+	// OnAC is true when the computer is connected to line power.  OnAC is nil
+	// if the Guage cannot determine the power source.
+	OnAC *bool
+
+	// RawUntilEmpty and RawUntilFull hold the estimates reported by the
+	// battery when UntilEmpty and UntilFull have been smoothed.  They are nil
+	// if no smoothing has been applied.
+	RawUntilEmpty *time.Duration
+	RawUntilFull  *time.Duration
+
+	// Voltage is the instantaneous voltage of the battery in volts and
+	// Current is the instantaneous current flowing into or out of the battery
+	// in amperes.  Either is nil if the Guage cannot measure it.
+	Voltage *float64
+	Current *float64
+
+	// Power is the rate at which energy flows out of the battery in watts.
+	// Power is positive while discharging, negative while charging, and zero
+	// if the Guage cannot measure it.
+	Power float64
+
+	// EnergyFull is the energy stored by the battery when it is full in watt
+	// hours.  EnergyFull is zero if the Guage cannot measure it.
+	EnergyFull float64
+
+	// Temperature is the temperature of the battery in degrees Celsius.
+	// Temperature is zero if the Guage cannot measure it.
+	Temperature float64
+
+	// Health is the energy the battery stores when full as a fraction of the
+	// energy it was designed to store, from 0.0 to 1.0.  Health declines as
+	// the battery ages.  Health is zero if the Guage cannot measure it.
+	Health float64
+
+	// SincePlug is the time since the computer was connected to or
+	// disconnected from line power, as observed by a Profiler.  If no change
+	// has been observed SincePlug is the time since the power source was
+	// first determined.  SincePlug is nil if the power source is unknown.
+	SincePlug *time.Duration
+
+	// IconName is the name of the freedesktop icon depicting the battery's
+	// state and level (e.g. "battery-caution-charging-symbolic").  IconName
+	// is empty if the Guage does not name an icon.
+	IconName string
+}
+
+// String returns a legible summary of m for logging, containing the charge
+// percentage, the state, and the estimated times remaining.  Unknown times are
+// written as "nil".
+func (m *Metrics) String() string {
+	if m == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("%.1f%% %v untilEmpty=%s untilFull=%s",
+		m.Fraction*100, m.State, durString(m.UntilEmpty), durString(m.UntilFull))
+}
+
+// metricsJSON is the JSON encoding of Metrics.  Its fields are a superset of
+// those read by the exec backend, so that emitted metrics may be read back.
+type metricsJSON struct {
+	Fraction    float64  `json:"fraction"`
+	State       State    `json:"state"`
+	UntilEmpty  *float64 `json:"until_empty,omitempty"`
+	UntilFull   *float64 `json:"until_full,omitempty"`
+	OnAC        *bool    `json:"on_ac,omitempty"`
+	Voltage     *float64 `json:"voltage,omitempty"`
+	Current     *float64 `json:"current,omitempty"`
+	Power       float64  `json:"power,omitempty"`
+	EnergyFull  float64  `json:"energy_full,omitempty"`
+	Temperature float64  `json:"temperature,omitempty"`
+	Health      float64  `json:"health,omitempty"`
+	SincePlug   *float64 `json:"since_plug,omitempty"`
+	IconName    string   `json:"icon_name,omitempty"`
+}
+
+// MarshalJSON encodes m as a JSON object with snake case keys (e.g.
+// "until_empty").  The state is encoded as its name and durations are encoded
+// as seconds.  Unknown metrics are omitted.
+func (m *Metrics) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&metricsJSON{
+		Fraction:    m.Fraction,
+		State:       m.State,
+		UntilEmpty:  jsonSeconds(m.UntilEmpty),
+		UntilFull:   jsonSeconds(m.UntilFull),
+		OnAC:        m.OnAC,
+		Voltage:     m.Voltage,
+		Current:     m.Current,
+		Power:       m.Power,
+		EnergyFull:  m.EnergyFull,
+		Temperature: m.Temperature,
+		Health:      m.Health,
+		SincePlug:   jsonSeconds(m.SincePlug),
+		IconName:    m.IconName,
+	})
+}
+
+// jsonSeconds returns d in seconds, or nil if d is nil.
+func jsonSeconds(d *time.Duration) *float64 {
+	if d == nil {
+		return nil
+	}
+	s := d.Seconds()
+	return &s
+}
+
+// durString formats d, or returns "nil" if d is nil.
+func durString(d *time.Duration) string {
+	if d == nil {
+		return "nil"
+	}
+	return d.String()
+}
+
+// InferOnAC returns whether the computer is connected to line power based on
+// the battery state alone.  InferOnAC returns nil for states which do not
+// imply a power source.
+func InferOnAC(state State) *bool {
+	var onAC bool
+	switch state {
+	case Charging, FullyCharged, PendingCharge:
+		onAC = true
+	case Discharging, Empty:
+		onAC = false
+	default:
+		return nil
+	}
+	return &onAC
 }
 
-// MetricFormatter returns a readable string from Metrics.
-// TODO:
-// Modify to return a possible error.
+// MetricFormatter returns a readable string from Metrics.  Formatters which
+// can fail should also implement ErrorMetricFormatter.
 type MetricFormatter interface {
 	// Format renders m in a human digestable way, generally highlighting one
 	// metric in particular.
 	Format(m *Metrics) string
 }
 
+// ErrorMetricFormatter is a MetricFormatter that reports errors encountered
+// rendering Metrics, such as a template referencing a nonexistent field.
+type ErrorMetricFormatter interface {
+	MetricFormatter
+
+	// FormatError is like Format but returns any error encountered along
+	// with the text that was rendered.
+	FormatError(m *Metrics) (string, error)
+}
+
+// FormatMetrics renders m using f.  If f is an ErrorMetricFormatter any error
+// it encounters is returned.
+func FormatMetrics(f MetricFormatter, m *Metrics) (string, error) {
+	if ferr, ok := f.(ErrorMetricFormatter); ok {
+		return ferr.FormatError(m)
+	}
+	return f.Format(m), nil
+}
+
 // MaxMetricFormatter helps layout engines determine the size required to
 // graphically render Metrics.
 type MaxMetricFormatter interface {
@@ -51,6 +244,90 @@ type MaxMetricFormatter interface {
 	MaxFormattedWidth() string
 }
 
+// AlignedMetricFormatter is implemented by formatters that belong to a set of
+// formatters which should be rendered with a common width, so that rotating
+// between them does not shift the rendered text.
+type AlignedMetricFormatter interface {
+	// AlignedWidths returns strings approximating the width of each formatter
+	// in the set when formatting m, in the order of AlignedSet.  Layout
+	// engines should use the widest.  The strings are computed once for each
+	// Metrics, which must not be modified after they are formatted.
+	AlignedWidths(m *Metrics) []string
+
+	// AlignedSet returns the formatters in the set as they were given to
+	// AlignMetricFormatters, so that each width may be measured according to
+	// its formatter.
+	AlignedSet() []MetricFormatter
+
+	// Unaligned returns the formatter in the set which was aligned.
+	Unaligned() MetricFormatter
+}
+
+// AlignMetricFormatters returns formatters equivalent to f which implement
+// AlignedMetricFormatter for the set f.
+func AlignMetricFormatters(f ...MetricFormatter) []MetricFormatter {
+	set := &alignedSet{f: append([]MetricFormatter(nil), f...)}
+	aligned := make([]MetricFormatter, len(f))
+	for i := range f {
+		aligned[i] = &alignedMetricFormatter{f[i], set}
+	}
+	return aligned
+}
+
+type alignedMetricFormatter struct {
+	MetricFormatter
+	set *alignedSet
+}
+
+// alignedSet is shared by the formatters returned from AlignMetricFormatters.
+// It caches the widths of the set for the last Metrics formatted, which are
+// drawn many times between polls.
+type alignedSet struct {
+	f []MetricFormatter
+
+	mut    sync.Mutex
+	m      *Metrics
+	widths []string
+}
+
+func (s *alignedSet) alignedWidths(m *Metrics) []string {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.widths != nil && s.m == m {
+		return s.widths
+	}
+	widths := make([]string, len(s.f))
+	for i, f := range s.f {
+		if fmax, ok := f.(MaxMetricFormatter); ok {
+			widths[i] = fmax.MaxFormattedWidth()
+		} else {
+			widths[i] = f.Format(m)
+		}
+	}
+	s.m, s.widths = m, widths
+	return widths
+}
+
+// FormatError implements the ErrorMetricFormatter interface.
+func (f *alignedMetricFormatter) FormatError(m *Metrics) (string, error) {
+	return FormatMetrics(f.MetricFormatter, m)
+}
+
+// AlignedWidths implements the AlignedMetricFormatter interface.
+func (f *alignedMetricFormatter) AlignedWidths(m *Metrics) []string {
+	return f.set.alignedWidths(m)
+}
+
+// AlignedSet implements the AlignedMetricFormatter interface.
+func (f *alignedMetricFormatter) AlignedSet() []MetricFormatter {
+	return f.set.f
+}
+
+// Unaligned implements the AlignedMetricFormatter interface.
+func (f *alignedMetricFormatter) Unaligned() MetricFormatter {
+	return f.MetricFormatter
+}
+
 // MetricFormatFunc is a function that implements the MetricFormatter interface.
 type MetricFormatFunc func(*Metrics) string
 
@@ -59,25 +336,184 @@ func (fn MetricFormatFunc) Format(m *Metrics) string {
 	return fn(m)
 }
 
+// FormatError implements the ErrorMetricFormatter interface.  The returned
+// error is always nil.
+func (fn MetricFormatFunc) FormatError(m *Metrics) (string, error) {
+	return fn(m), nil
+}
+
 var batteryMetricTemplateFuncs = template.FuncMap{
-	"dur": func(d time.Duration) string {
-		return cleanDurationString(d)
+	"dur": func(d interface{}) (string, error) {
+		return formatTemplateDuration(d, cleanDurationString, "???")
 	},
-	"durShort": func(d time.Duration) string {
-		return shortDurationString(d)
+	"durShort": func(d interface{}) (string, error) {
+		return formatTemplateDuration(d, shortDurationString, "???")
+	},
+	"durDays": func(d interface{}) (string, error) {
+		return formatTemplateDuration(d, FormatDurationDays, "???")
+	},
+	"durColon": func(d interface{}) (string, error) {
+		return formatTemplateDuration(d, FormatDurationColon, "?:??")
 	},
 	"percent": func(fraction float64) string {
-		return fmt.Sprintf("%d%%", roundBiasLow(fraction*100))
+		return formatPercent(fraction)
+	},
+	"percentF": func(precision int, fraction float64) string {
+		return formatPercentF(precision, fraction)
+	},
+	"bar": func(fraction float64) string {
+		return FormatBar(fraction, DefaultBarBlocks)
 	},
+	"percentBar": func(fraction float64) string {
+		return PercentBar{}.Format(&Metrics{Fraction: fraction})
+	},
+	"eta": func(d interface{}) (string, error) {
+		return formatTemplateDuration(d, formatETA, UnknownETA)
+	},
+	"volts": func(x interface{}) (string, error) {
+		return formatTemplateFloat(x, "%.2fV")
+	},
+	"amps": func(x interface{}) (string, error) {
+		return formatTemplateFloat(x, "%.2fA")
+	},
+	"watts": func(w float64) string {
+		return formatPower(w)
+	},
+	"temp": func(c float64) string {
+		return formatTemperature(c)
+	},
+	"health": func(h float64) string {
+		return formatHealth(h)
+	},
+}
+
+// formatTemplateFloat formats a template argument x, either a float64 or a
+// pointer to one, using a format string for the locale given to SetLocale.  A
+// nil pointer is formatted as "?".
+func formatTemplateFloat(x interface{}, format string) (string, error) {
+	switch x := x.(type) {
+	case float64:
+		return printer.Sprintf(format, x), nil
+	case *float64:
+		if x == nil {
+			return "?", nil
+		}
+		return printer.Sprintf(format, *x), nil
+	default:
+		return "", fmt.Errorf("not a number: %v", x)
+	}
+}
+
+// formatTemplateDuration formats a template argument d, either a duration or
+// a pointer to one.  A nil pointer is formatted as unknown.
+func formatTemplateDuration(d interface{}, format func(time.Duration) string, unknown string) (string, error) {
+	switch d := d.(type) {
+	case time.Duration:
+		return format(d), nil
+	case *time.Duration:
+		if d == nil {
+			return unknown, nil
+		}
+		return format(*d), nil
+	default:
+		return "", fmt.Errorf("not a duration: %v", d)
+	}
+}
+
+// MetricsView is the data available to metric templates.  Values are accessed
+// by the lowercase keys documented for dockapp-battery (e.g. .fraction) and
+// time estimates, which may be unknown, are accessed safely through methods.
+//
+//	{{if .HasRemaining}}{{dur .Remaining}}{{end}}
+type MetricsView map[string]interface{}
+
+// NewMetricsView returns the template data for m.
+func NewMetricsView(m *Metrics) MetricsView {
+	remaining := m.UntilEmpty
+	switch m.State {
+	case Charging:
+		remaining = m.UntilFull
+	case Unknown:
+		// it is not known which estimate applies.
+		remaining = nil
+	}
+	var onAC interface{}
+	if m.OnAC != nil {
+		onAC = *m.OnAC
+	}
+	return MetricsView{
+		"fraction":    m.Fraction,
+		"state":       m.State,
+		"remaining":   remaining,
+		"untilFull":   m.UntilFull,
+		"untilEmpty":  m.UntilEmpty,
+		"onAC":        onAC,
+		"voltage":     m.Voltage,
+		"current":     m.Current,
+		"power":       m.Power,
+		"temperature": m.Temperature,
+		"health":      m.Health,
+		"sincePlug":   m.SincePlug,
+	}
+}
+
+// Remaining returns the time until the battery is full when charging and the
+// time until it is empty otherwise.  Remaining returns zero if the time is
+// unknown.
+func (v MetricsView) Remaining() time.Duration {
+	return v.duration("remaining")
+}
+
+// HasRemaining returns true if the time returned by Remaining is known.
+func (v MetricsView) HasRemaining() bool {
+	return v.hasDuration("remaining")
+}
+
+// UntilFull returns the time until the battery is full, or zero if the time
+// is unknown.
+func (v MetricsView) UntilFull() time.Duration {
+	return v.duration("untilFull")
+}
+
+// HasUntilFull returns true if the time returned by UntilFull is known.
+func (v MetricsView) HasUntilFull() bool {
+	return v.hasDuration("untilFull")
+}
+
+// UntilEmpty returns the time until the battery is empty, or zero if the time
+// is unknown.
+func (v MetricsView) UntilEmpty() time.Duration {
+	return v.duration("untilEmpty")
+}
+
+// HasUntilEmpty returns true if the time returned by UntilEmpty is known.
+func (v MetricsView) HasUntilEmpty() bool {
+	return v.hasDuration("untilEmpty")
+}
+
+func (v MetricsView) duration(key string) time.Duration {
+	d, _ := v[key].(*time.Duration)
+	if d == nil {
+		return 0
+	}
+	return *d
+}
+
+func (v MetricsView) hasDuration(key string) bool {
+	d, _ := v[key].(*time.Duration)
+	return d != nil
 }
 
 type templateMetricFormatter struct {
-	t   *template.Template
-	buf bytes.Buffer
+	t      *template.Template
+	buf    bytes.Buffer
+	max    string
+	hasMax bool
 }
 
 func newTemplateMetricFormatter(s string) (*templateMetricFormatter, error) {
-	t, err := template.New("batterymetric").Funcs(batteryMetricTemplateFuncs).Parse(s)
+	// referencing a nonexistent metric is an error rather than "<no value>".
+	t, err := template.New("batterymetric").Funcs(batteryMetricTemplateFuncs).Option("missingkey=error").Parse(s)
 	if err != nil {
 		return nil, err
 	}
@@ -85,61 +521,345 @@ func newTemplateMetricFormatter(s string) (*templateMetricFormatter, error) {
 	return f, nil
 }
 
+// Format implements the MetricFormatter interface.  Template errors are
+// logged.
 func (f *templateMetricFormatter) Format(m *Metrics) string {
-	f.buf.Truncate(0)
-	remaining := m.UntilEmpty
-	if m.State == Charging {
-		remaining = m.UntilFull
-	}
-	err := f.t.Execute(&f.buf, map[string]interface{}{
-		"fraction":   m.Fraction,
-		"state":      m.State,
-		"remaining":  remaining,
-		"untilFull":  m.UntilFull,
-		"untilEmpty": m.UntilEmpty,
-	})
+	s, err := f.FormatError(m)
 	if err != nil {
 		log.Printf("template: %v", err)
 	}
-	return strings.Join(strings.Fields(strings.TrimSpace(f.buf.String())), " ")
+	return s
 }
 
-// FormatMetricTemplate renders Metrics using the template string s.
-//
-// BUG:
-// Template errors can not be intercepted.  They are only logged.
+// FormatError implements the ErrorMetricFormatter interface.
+func (f *templateMetricFormatter) FormatError(m *Metrics) (string, error) {
+	f.buf.Truncate(0)
+	err := f.t.Execute(&f.buf, NewMetricsView(m))
+	return strings.Join(strings.Fields(strings.TrimSpace(f.buf.String())), " "), err
+}
+
+// MaxFormattedWidth implements the MaxMetricFormatter interface.  The template
+// is rendered with synthetic Metrics for each State, holding a full battery and
+// long estimates, and the result with the most characters is returned.
+func (f *templateMetricFormatter) MaxFormattedWidth() string {
+	if f.hasMax {
+		return f.max
+	}
+	for _, m := range maxWidthMetrics() {
+		s, _ := f.FormatError(m)
+		if utf8.RuneCountInString(s) > utf8.RuneCountInString(f.max) {
+			f.max = s
+		}
+	}
+	f.hasMax = true
+	return f.max
+}
+
+// maxWidthMetrics returns Metrics for each State whose values are formatted
+// about as wide as any a battery reports, along with Metrics for each State
+// whose optional values are all unknown, as templates may render them
+// differently.
+func maxWidthMetrics() []*Metrics {
+	var metrics []*Metrics
+	for state := Unknown; state <= PendingDischarge; state++ {
+		long := 99*time.Hour + 59*time.Minute
+		volts, amps := 99.99, -99.99
+		onAC := false
+		metrics = append(metrics, &Metrics{
+			Fraction:    1,
+			State:       state,
+			UntilEmpty:  &long,
+			UntilFull:   &long,
+			OnAC:        &onAC,
+			Voltage:     &volts,
+			Current:     &amps,
+			Power:       -999.9,
+			EnergyFull:  999.9,
+			Temperature: -99.9,
+			Health:      1,
+			SincePlug:   &long,
+		}, &Metrics{
+			Fraction: 1,
+			State:    state,
+		})
+	}
+	return metrics
+}
+
+// FormatMetricTemplate renders Metrics using the template string s.  The
+// returned MetricFormatter is an ErrorMetricFormatter so that errors executing
+// the template may be intercepted, otherwise they are logged.  It is also a
+// MaxMetricFormatter so that text does not shift as the metrics change.
 func FormatMetricTemplate(s string) (MetricFormatter, error) {
 	return newTemplateMetricFormatter(s)
 }
 
+// TemplateErrorString is rendered by formatters from FormatMetricTemplateStrict
+// in place of a template which fails to execute.
+const TemplateErrorString = "!ERR"
+
+// FormatMetricTemplateStrict is like FormatMetricTemplate but the returned
+// MetricFormatter renders TemplateErrorString when the template fails to
+// execute, so that a broken template is visible where it is drawn.  Each
+// distinct error is logged once.  The returned MetricFormatter is not an
+// ErrorMetricFormatter.
+func FormatMetricTemplateStrict(s string) (MetricFormatter, error) {
+	f, err := newTemplateMetricFormatter(s)
+	if err != nil {
+		return nil, err
+	}
+	return &strictTemplateMetricFormatter{t: f}, nil
+}
+
+type strictTemplateMetricFormatter struct {
+	t *templateMetricFormatter
+
+	// logged holds the errors which have been logged, because templates are
+	// formatted on every draw.
+	mut    sync.Mutex
+	logged map[string]bool
+}
+
+// Format implements the MetricFormatter interface.
+func (f *strictTemplateMetricFormatter) Format(m *Metrics) string {
+	s, err := f.t.FormatError(m)
+	if err != nil {
+		f.logError(err)
+		return TemplateErrorString
+	}
+	return s
+}
+
+func (f *strictTemplateMetricFormatter) logError(err error) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if f.logged[err.Error()] {
+		return
+	}
+	if f.logged == nil {
+		f.logged = make(map[string]bool)
+	}
+	f.logged[err.Error()] = true
+	log.Printf("template: %v", err)
+}
+
+// MaxFormattedWidth implements the MaxMetricFormatter interface.
+func (f *strictTemplateMetricFormatter) MaxFormattedWidth() string {
+	return f.t.MaxFormattedWidth()
+}
+
 // SimpleMetricsFormat is a simple MetricsFormatter.
 func SimpleMetricsFormat(m *Metrics) string {
+	if m.UntilEmpty == nil {
+		return fmt.Sprintf("%2d%%", roundBiasLow(m.Fraction*100))
+	}
 	return fmt.Sprintf("%2d%% %s", roundBiasLow(m.Fraction*100), cleanDurationString(*m.UntilEmpty))
 }
 
-// FormatPercent renders the battery level as an integral percentage.
+// FormatPercent renders the battery level as an integral percentage.  The
+// percentage is formatted according to the locale given to SetLocale.
 func FormatPercent(m *Metrics) string {
-	return fmt.Sprintf("%d%%", roundBiasLow(m.Fraction*100))
+	return formatPercent(m.Fraction)
+}
+
+var printer = message.NewPrinter(language.English)
+
+// SetLocale sets the locale used to format numbers, which affects the digits
+// used and the placement of percent signs.  SetLocale is not safe to call
+// concurrently with formatting and should be called during initialization.
+// The default locale is English.
+func SetLocale(tag language.Tag) {
+	printer = message.NewPrinter(tag)
+}
+
+func formatPercent(fraction float64) string {
+	return formatPercentF(0, fraction)
+}
+
+// formatPercentF formats fraction as a percentage with precision decimal
+// places.
+func formatPercentF(precision int, fraction float64) string {
+	if precision < 0 {
+		precision = 0
+	}
+	scale := math.Pow10(precision)
+	percent := float64(roundBiasLow(fraction*100*scale)) / scale
+	return printer.Sprint(number.Percent(percent/100,
+		number.MinFractionDigits(precision),
+		number.MaxFractionDigits(precision)))
+}
+
+// PercentFormatter is a MetricFormatter that renders the battery level as a
+// percentage with a fixed number of decimal places (e.g. "85.3%").
+// PercentFormatter implements MaxMetricFormatter so the rendered text has a
+// stable width.
+type PercentFormatter struct {
+	// Precision is the number of decimal places displayed.  A Precision of
+	// zero is equivalent to FormatPercent.
+	Precision int
+}
+
+// Format implements the MetricFormatter interface.
+func (f PercentFormatter) Format(m *Metrics) string {
+	return formatPercentF(f.Precision, m.Fraction)
+}
+
+// MaxFormattedWidth implements the MaxMetricFormatter interface.
+func (f PercentFormatter) MaxFormattedWidth() string {
+	return formatPercentF(f.Precision, 1)
+}
+
+// Glyphs used to render bars.
+const (
+	BarFull  = "▮"
+	BarEmpty = "▯"
+)
+
+// DefaultBarBlocks is the number of blocks in a bar when none is specified.
+const DefaultBarBlocks = 10
+
+// FormatBar renders fraction as a bar of n blocks, each of which is either
+// BarFull or BarEmpty.
+func FormatBar(fraction float64, n int) string {
+	full := roundBiasLow(fraction * float64(n))
+	if full < 0 {
+		full = 0
+	}
+	if full > n {
+		full = n
+	}
+	return strings.Repeat(BarFull, full) + strings.Repeat(BarEmpty, n-full)
+}
+
+// PercentBar is a MetricFormatter that renders the battery level as an
+// integral percentage followed by a bar (e.g. "85% ▮▮▮▮▮▮▮▮▯▯").  PercentBar
+// implements MaxMetricFormatter so the rendered text has a stable width.
+type PercentBar struct {
+	// Blocks is the number of blocks in the bar.  If Blocks is zero
+	// DefaultBarBlocks is used.
+	Blocks int
+}
+
+func (f PercentBar) blocks() int {
+	if f.Blocks <= 0 {
+		return DefaultBarBlocks
+	}
+	return f.Blocks
+}
+
+// Format implements the MetricFormatter interface.
+func (f PercentBar) Format(m *Metrics) string {
+	return FormatPercent(m) + " " + FormatBar(m.Fraction, f.blocks())
+}
+
+// MaxFormattedWidth implements the MaxMetricFormatter interface.
+func (f PercentBar) MaxFormattedWidth() string {
+	return formatPercent(1) + " " + strings.Repeat(BarFull, f.blocks())
+}
+
+// RemainingText holds the text displayed by FormatRemaining in place of a
+// time.
+type RemainingText struct {
+	Full    string
+	Empty   string
+	Unknown string
+}
+
+// DefaultRemainingText is the RemainingText used unless SetRemainingText is
+// called.
+var DefaultRemainingText = RemainingText{
+	Full:    "Full",
+	Empty:   "Empty",
+	Unknown: "???",
+}
+
+var remainingText = DefaultRemainingText
+
+// SetRemainingText sets the text displayed by FormatRemaining and FormatETA
+// (e.g. "⚡" for a full battery).  Empty fields of t leave the text in
+// DefaultRemainingText.  Like SetLocale, SetRemainingText is not safe to call
+// concurrently with formatting and should be called during initialization.
+func SetRemainingText(t RemainingText) {
+	if t.Full == "" {
+		t.Full = DefaultRemainingText.Full
+	}
+	if t.Empty == "" {
+		t.Empty = DefaultRemainingText.Empty
+	}
+	if t.Unknown == "" {
+		t.Unknown = DefaultRemainingText.Unknown
+	}
+	remainingText = t
 }
 
 // FormatRemaining returns a human readable string describing the time until
 // the battery is empty/full.  If the battery is empty then "Empty" is
-// returned.  If the battery is full then "Full" is returned.
+// returned.  If the battery is full then "Full" is returned.  If the battery
+// has stopped charging at a charge threshold then "At limit" is returned.  If
+// the time remaining is unknown then "???" is returned.  The text for full,
+// empty, and unknown batteries may be changed with SetRemainingText and the
+// style of the time remaining with SetDurationStyle.
 func FormatRemaining(m *Metrics) string {
 	switch m.State {
 	case Charging:
-		return cleanDurationString(*m.UntilFull) + " left"
+		if m.UntilFull == nil {
+			return remainingText.Unknown
+		}
+		return durationStyle.Format(*m.UntilFull) + " left"
+	case Discharging:
+		if m.UntilEmpty == nil {
+			return remainingText.Unknown
+		}
+		return durationStyle.Format(*m.UntilEmpty) + " left"
+	case FullyCharged:
+		return remainingText.Full
+	case PendingCharge:
+		return "At limit"
+	case Empty:
+		return remainingText.Empty
+	default:
+		return remainingText.Unknown
+	}
+}
+
+// UnknownETA is displayed in place of an ETA when the time remaining is
+// unknown.
+const UnknownETA = "--:--"
+
+// etaClock is the source of the current time for ETAs.
+var etaClock = SystemClock
+
+// FormatETA returns the wall clock time at which the battery will be full or
+// empty (e.g. "full by 14:30").  If the battery is full or empty then the
+// text set by SetRemainingText is returned ("Full" or "Empty" by default).  If
+// the battery is neither charging nor discharging, or the time remaining is
+// unknown, then UnknownETA is returned.
+func FormatETA(m *Metrics) string {
+	switch m.State {
+	case Charging:
+		if m.UntilFull == nil {
+			return UnknownETA
+		}
+		return "full by " + formatETA(*m.UntilFull)
 	case Discharging:
-		return cleanDurationString(*m.UntilEmpty) + " left"
+		if m.UntilEmpty == nil {
+			return UnknownETA
+		}
+		return "empty by " + formatETA(*m.UntilEmpty)
 	case FullyCharged:
-		return "Full"
+		return remainingText.Full
 	case Empty:
-		return "Empty"
+		return remainingText.Empty
 	default:
-		return "???"
+		return UnknownETA
 	}
 }
 
+// formatETA returns the time of day d from now.
+func formatETA(d time.Duration) string {
+	return etaClock.Now().Add(d).Format("15:04")
+}
+
 func shortDurationString(d time.Duration) string {
 	d = (d / time.Minute) * time.Minute
 	if d == 0 {
@@ -164,31 +884,210 @@ func cleanDurationString(d time.Duration) string {
 	return s
 }
 
+// FormatDurationDays renders d with minute precision like the dur template
+// function but counts whole days separately once d is a day or longer (e.g.
+// "1d4h" instead of "28h").  Zero components are omitted (e.g. "2d" instead of
+// "2d0h").
+func FormatDurationDays(d time.Duration) string {
+	const day = 24 * time.Hour
+	if d < day {
+		return cleanDurationString(d)
+	}
+	days := d / day
+	s := fmt.Sprintf("%dd", days)
+	if rem := (d % day / time.Minute) * time.Minute; rem > 0 {
+		s += cleanDurationString(rem)
+	}
+	return s
+}
+
+// FormatDurationColon renders d as hours and minutes separated by a colon
+// (e.g. "1:23").
+func FormatDurationColon(d time.Duration) string {
+	minutes := int64(d / time.Minute)
+	return fmt.Sprintf("%d:%02d", minutes/60, minutes%60)
+}
+
+// DurationStyle is a style of rendering durations.
+type DurationStyle int
+
+// DurationStyle values accepted by ParseDurationStyle.
+const (
+	DurationClean DurationStyle = iota // minute precision (e.g. "1h23m")
+	DurationShort                      // variable precision (e.g. "1h")
+	DurationDays                       // minute precision counting days (e.g. "1d4h")
+	DurationColon                      // hours and minutes (e.g. "1:23")
+)
+
+// ParseDurationStyle returns the DurationStyle named s, one of "clean",
+// "short", "days" or "colon".
+func ParseDurationStyle(s string) (DurationStyle, error) {
+	switch s {
+	case "clean":
+		return DurationClean, nil
+	case "short":
+		return DurationShort, nil
+	case "days":
+		return DurationDays, nil
+	case "colon":
+		return DurationColon, nil
+	default:
+		return DurationClean, fmt.Errorf("unknown duration style %q", s)
+	}
+}
+
+// Format renders d in the style.
+func (style DurationStyle) Format(d time.Duration) string {
+	switch style {
+	case DurationShort:
+		return shortDurationString(d)
+	case DurationDays:
+		return FormatDurationDays(d)
+	case DurationColon:
+		return FormatDurationColon(d)
+	default:
+		return cleanDurationString(d)
+	}
+}
+
+var durationStyle = DurationClean
+
+// SetDurationStyle sets the style of the time remaining rendered by
+// FormatRemaining.  Like SetLocale, SetDurationStyle is not safe to call
+// concurrently with formatting and should be called during initialization.
+// The default style is DurationClean.
+func SetDurationStyle(style DurationStyle) {
+	durationStyle = style
+}
+
 // roundBiasLow rounds x to an integer with a bias toward -Inf.
 func roundBiasLow(x float64) int {
 	return int(math.Ceil(x - 0.5))
 }
 
+// FormatPowerSource returns "AC" when the computer is connected to line power
+// and "Battery" when it is not.  If the power source is unknown "?" is
+// returned.
+func FormatPowerSource(m *Metrics) string {
+	if m.OnAC == nil {
+		return "?"
+	}
+	if *m.OnAC {
+		return "AC"
+	}
+	return "Battery"
+}
+
+// FormatPower renders the power flowing out of the battery in watts (e.g.
+// "12.3W"), which is negative while charging.  If the power is unknown "—" is
+// returned.
+func FormatPower(m *Metrics) string {
+	return formatPower(m.Power)
+}
+
+func formatPower(w float64) string {
+	if w == 0 {
+		return "—"
+	}
+	return printer.Sprintf("%.1fW", w)
+}
+
+// FormatTemperature renders the temperature of the battery in degrees Celsius
+// (e.g. "31.5°C").  If the temperature is unknown "—°C" is returned.
+func FormatTemperature(m *Metrics) string {
+	return formatTemperature(m.Temperature)
+}
+
+func formatTemperature(c float64) string {
+	if c == 0 {
+		return "—°C"
+	}
+	return printer.Sprintf("%.1f°C", c)
+}
+
+// FormatHealth renders the health of the battery as an integer percent (e.g.
+// "87%").  If the health is unknown "—" is returned.
+func FormatHealth(m *Metrics) string {
+	return formatHealth(m.Health)
+}
+
+func formatHealth(h float64) string {
+	if h == 0 {
+		return "—"
+	}
+	return formatPercent(h)
+}
+
 // FormatState returns the string representation of a battery's state.
 func FormatState(m *Metrics) string {
 	return m.State.String()
 }
 
-// RotateMetricsFormat sends an f over c every interval.
-func RotateMetricsFormat(interval time.Duration, c chan<- MetricFormatter, f ...MetricFormatter) {
-	tick := time.NewTicker(interval)
-	defer tick.Stop()
+// RotateMetricsFormat sends an f over c every interval until stop is closed.
+// When only one formatter is given it is sent over c once and
+// RotateMetricsFormat returns.
+func RotateMetricsFormat(interval time.Duration, c chan<- MetricFormatter, stop <-chan struct{}, f ...MetricFormatter) {
+	rotateMetricsFormat(SystemClock, interval, c, nil, stop, f...)
+}
+
+// RotateCommand changes the rotation of formatters by
+// RotateMetricsFormatControl.
+type RotateCommand int
+
+// Commands which change the rotation of formatters.
+const (
+	// RotateAdvance sends the next formatter immediately.  The next
+	// formatter is sent by the timer a full interval later.
+	RotateAdvance RotateCommand = iota
+	// RotatePause stops the timer from advancing the formatter, or starts it
+	// again if it was stopped.
+	RotatePause
+)
+
+// RotateMetricsFormatControl is like RotateMetricsFormat but the rotation is
+// also changed by commands received over control.
+func RotateMetricsFormatControl(interval time.Duration, c chan<- MetricFormatter, control <-chan RotateCommand, stop <-chan struct{}, f ...MetricFormatter) {
+	rotateMetricsFormat(SystemClock, interval, c, control, stop, f...)
+}
+
+func rotateMetricsFormat(clock Clock, interval time.Duration, c chan<- MetricFormatter, control <-chan RotateCommand, stop <-chan struct{}, f ...MetricFormatter) {
+	if len(f) == 1 {
+		// there is nothing to rotate so a ticker would only cause needless
+		// wakeups.
+		select {
+		case c <- f[0]:
+		case <-stop:
+		}
+		return
+	}
+
+	tick := clock.NewTicker(interval)
+	defer func() { tick.Stop() }()
 	var i int
-	first := make(chan struct{})
-	close(first)
+	var paused bool
 	_c := c
 	for {
 		select {
+		case <-stop:
+			return
 		case _c <- f[i]:
 			_c = nil
-		case <-tick.C:
+		case <-tick.C():
+			if paused {
+				continue
+			}
 			i = (i + 1) % len(f)
 			_c = c
+		case cmd := <-control:
+			switch cmd {
+			case RotateAdvance:
+				i = (i + 1) % len(f)
+				_c = c
+				tick.Stop()
+				tick = clock.NewTicker(interval)
+			case RotatePause:
+				paused = !paused
+			}
 		}
 	}
 }
@@ -0,0 +1,1012 @@
+package battery
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/language"
+)
+
+func boolPtr(x bool) *bool {
+	return &x
+}
+
+func TestInferOnAC(t *testing.T) {
+	for i, test := range []struct {
+		state State
+		onAC  *bool
+	}{
+		{Charging, boolPtr(true)},
+		{FullyCharged, boolPtr(true)},
+		{PendingCharge, boolPtr(true)},
+		{Discharging, boolPtr(false)},
+		{Empty, boolPtr(false)},
+		{PendingDischarge, nil},
+		{Unknown, nil},
+	} {
+		onAC := InferOnAC(test.state)
+		if (onAC == nil) != (test.onAC == nil) {
+			t.Errorf("test %d: %v (expected %v)", i, onAC, test.onAC)
+		} else if onAC != nil && *onAC != *test.onAC {
+			t.Errorf("test %d: %v (expected %v)", i, *onAC, *test.onAC)
+		}
+	}
+}
+
+func TestFormatPowerSource(t *testing.T) {
+	for i, test := range []struct {
+		state State
+		s     string
+	}{
+		{Charging, "AC"},
+		{FullyCharged, "AC"},
+		{Discharging, "Battery"},
+		{PendingDischarge, "?"},
+	} {
+		m := &Metrics{State: test.state, OnAC: InferOnAC(test.state)}
+		s := FormatPowerSource(m)
+		if s != test.s {
+			t.Errorf("test %d: %q (expected %q)", i, s, test.s)
+		}
+	}
+}
+
+func TestState_MarshalText(t *testing.T) {
+	for i, test := range []struct {
+		state State
+		text  string
+	}{
+		{Unknown, "Unknown"},
+		{Charging, "Charging"},
+		{Discharging, "Discharging"},
+		{Empty, "Empty"},
+		{FullyCharged, "FullyCharged"},
+		{PendingCharge, "PendingCharge"},
+		{PendingDischarge, "PendingDischarge"},
+	} {
+		text, err := test.state.MarshalText()
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		if string(text) != test.text {
+			t.Errorf("test %d: %q (expected %q)", i, text, test.text)
+		}
+		var state State
+		err = state.UnmarshalText(text)
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+		}
+		if state != test.state {
+			t.Errorf("test %d: unmarshaled %v (expected %v)", i, state, test.state)
+		}
+		p, err := json.Marshal(test.state)
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+		}
+		if string(p) != `"`+test.text+`"` {
+			t.Errorf("test %d: json %s", i, p)
+		}
+	}
+	if _, err := State(42).MarshalText(); err == nil {
+		t.Errorf("invalid state marshaled")
+	}
+	var state State
+	for i, text := range []string{"Full", "", "State(42)"} {
+		if err := state.UnmarshalText([]byte(text)); err == nil {
+			t.Errorf("unknown %d: %q unmarshaled as %v", i, text, state)
+		}
+	}
+	if err := state.UnmarshalText([]byte("charging")); err != nil || state != Charging {
+		t.Errorf("case insensitive: %v %v", state, err)
+	}
+}
+
+func TestParseState(t *testing.T) {
+	for i, test := range []struct {
+		s     string
+		state State
+		err   bool
+	}{
+		{"Unknown", Unknown, false},
+		{"Charging", Charging, false},
+		{"Discharging", Discharging, false},
+		{"Empty", Empty, false},
+		{"FullyCharged", FullyCharged, false},
+		{"PendingCharge", PendingCharge, false},
+		{"PendingDischarge", PendingDischarge, false},
+		{"fullycharged", FullyCharged, false},
+		{"DISCHARGING", Discharging, false},
+		{"pendingCharge", PendingCharge, false},
+		{"0", Unknown, false},
+		{"2", Discharging, false},
+		{"6", PendingDischarge, false},
+		{"7", Unknown, true},
+		{"-1", Unknown, true},
+		{"Full", Unknown, true},
+		{"", Unknown, true},
+	} {
+		state, err := ParseState(test.s)
+		if (err != nil) != test.err {
+			t.Errorf("test %d: err %v (expected error %v)", i, err, test.err)
+			continue
+		}
+		if state != test.state {
+			t.Errorf("test %d: %v (expected %v)", i, state, test.state)
+		}
+	}
+}
+
+func TestMetrics_MarshalJSON(t *testing.T) {
+	untilEmpty := 2*time.Hour + 30*time.Minute
+	sincePlug := 10 * time.Minute
+	volts := 11.87
+	onAC := false
+	for i, test := range []struct {
+		m    *Metrics
+		json string
+	}{
+		{
+			&Metrics{Fraction: 0.5},
+			`{"fraction":0.5,"state":"Unknown"}`,
+		},
+		{
+			&Metrics{
+				Fraction:    0.85,
+				State:       Discharging,
+				UntilEmpty:  &untilEmpty,
+				OnAC:        &onAC,
+				Voltage:     &volts,
+				Power:       12.5,
+				EnergyFull:  50,
+				Temperature: 31.5,
+				Health:      0.9,
+				SincePlug:   &sincePlug,
+				IconName:    "battery-full-symbolic",
+			},
+			`{"fraction":0.85,"state":"Discharging","until_empty":9000,"on_ac":false,"voltage":11.87,"power":12.5,"energy_full":50,"temperature":31.5,"health":0.9,"since_plug":600,"icon_name":"battery-full-symbolic"}`,
+		},
+	} {
+		p, err := json.Marshal(test.m)
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		if string(p) != test.json {
+			t.Errorf("test %d: %s (expected %s)", i, p, test.json)
+		}
+	}
+}
+
+func TestFormatMetricTemplate_onAC(t *testing.T) {
+	f, err := FormatMetricTemplate(`{{if eq .onAC nil}}?{{else if .onAC}}plug{{else}}batt{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range []struct {
+		onAC *bool
+		s    string
+	}{
+		{nil, "?"},
+		{boolPtr(true), "plug"},
+		{boolPtr(false), "batt"},
+	} {
+		s := f.Format(&Metrics{OnAC: test.onAC})
+		if s != test.s {
+			t.Errorf("test %d: %q (expected %q)", i, s, test.s)
+		}
+	}
+}
+
+func TestFormatMetricTemplate_view(t *testing.T) {
+	hour := time.Hour
+	volts, amps := 11.87, 1.25
+	for i, test := range []struct {
+		tmpl string
+		m    *Metrics
+		s    string
+	}{
+		{`{{if .HasRemaining}}{{dur .Remaining}}{{else}}none{{end}}`, &Metrics{State: Discharging, UntilEmpty: &hour}, "1h"},
+		{`{{if .HasRemaining}}{{dur .Remaining}}{{else}}none{{end}}`, &Metrics{State: Discharging}, "none"},
+		{`{{if .HasRemaining}}{{dur .Remaining}}{{else}}none{{end}}`, &Metrics{State: Charging, UntilEmpty: &hour}, "none"},
+		{`{{.HasUntilFull}} {{.HasUntilEmpty}}`, &Metrics{UntilFull: &hour}, "true false"},
+		{`{{durShort .UntilFull}}`, &Metrics{UntilFull: &hour}, "1h"},
+		{`{{dur .remaining}}`, &Metrics{State: Discharging, UntilEmpty: &hour}, "1h"},
+		{`{{dur .remaining}}`, &Metrics{State: Discharging}, "???"},
+		{`{{durShort .untilFull}}`, &Metrics{}, "???"},
+		{`{{percent .fraction}}`, &Metrics{Fraction: 0.5}, "50%"},
+		{`{{volts .voltage}} {{amps .current}}`, &Metrics{Voltage: &volts, Current: &amps}, "11.87V 1.25A"},
+		{`{{volts .voltage}} {{amps .current}}`, &Metrics{}, "? ?"},
+		{`{{if .voltage}}{{volts .voltage}}{{else}}none{{end}}`, &Metrics{}, "none"},
+		{`{{watts .power}}`, &Metrics{Power: 12.34}, "12.3W"},
+		{`{{watts .power}}`, &Metrics{Power: -20}, "-20.0W"},
+		{`{{watts .power}}`, &Metrics{}, "—"},
+	} {
+		f, err := FormatMetricTemplate(test.tmpl)
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		s := f.Format(test.m)
+		if s != test.s {
+			t.Errorf("test %d: %q (expected %q)", i, s, test.s)
+		}
+	}
+}
+
+func TestFormatMetrics_error(t *testing.T) {
+	for i, test := range []struct {
+		tmpl string
+		err  bool
+	}{
+		{`{{percent .fraction}}`, false},
+		{`{{.doesnotexist.field}}`, true},
+		{`{{dur .fraction}}`, true},
+	} {
+		f, err := FormatMetricTemplate(test.tmpl)
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		for j, f := range append([]MetricFormatter{f}, AlignMetricFormatters(f)...) {
+			_, err = FormatMetrics(f, &Metrics{Fraction: 0.5})
+			if test.err && err == nil {
+				t.Errorf("test %d: formatter %d: expected error", i, j)
+			}
+			if !test.err && err != nil {
+				t.Errorf("test %d: formatter %d: %v", i, j, err)
+			}
+		}
+	}
+
+	s, err := FormatMetrics(MetricFormatFunc(FormatPercent), &Metrics{Fraction: 0.5})
+	if err != nil {
+		t.Errorf("func: %v", err)
+	}
+	if s != "50%" {
+		t.Errorf("func: %q (expected %q)", s, "50%")
+	}
+}
+
+func TestFormatPower(t *testing.T) {
+	for i, test := range []struct {
+		power float64
+		s     string
+	}{
+		{7.25, "7.2W"},
+		{-15, "-15.0W"},
+		{0, "—"},
+	} {
+		s := FormatPower(&Metrics{Power: test.power})
+		if s != test.s {
+			t.Errorf("test %d: %q (expected %q)", i, s, test.s)
+		}
+	}
+}
+
+func TestFormatTemperature(t *testing.T) {
+	for i, test := range []struct {
+		temp float64
+		s    string
+	}{
+		{31.5, "31.5°C"},
+		{-2, "-2.0°C"},
+		{0, "—°C"},
+	} {
+		s := FormatTemperature(&Metrics{Temperature: test.temp})
+		if s != test.s {
+			t.Errorf("test %d: %q (expected %q)", i, s, test.s)
+		}
+		f, err := FormatMetricTemplate("{{temp .temperature}}")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err = FormatMetrics(f, &Metrics{Temperature: test.temp})
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+		}
+		if s != test.s {
+			t.Errorf("test %d: template %q (expected %q)", i, s, test.s)
+		}
+	}
+}
+
+func TestFormatHealth(t *testing.T) {
+	for i, test := range []struct {
+		health float64
+		s      string
+	}{
+		{0.87, "87%"},
+		{1, "100%"},
+		{0, "—"},
+	} {
+		m := &Metrics{Fraction: 0.5, Health: test.health}
+		s := FormatHealth(m)
+		if s != test.s {
+			t.Errorf("test %d: %q (expected %q)", i, s, test.s)
+		}
+		f, err := FormatMetricTemplate("{{percent .fraction}} {{health .health}}")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err = FormatMetrics(f, m)
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+		}
+		if s != "50% "+test.s {
+			t.Errorf("test %d: template %q (expected %q)", i, s, "50% "+test.s)
+		}
+	}
+}
+
+func TestFormatBar(t *testing.T) {
+	for i, test := range []struct {
+		fraction float64
+		n        int
+		s        string
+	}{
+		{0, 4, "▯▯▯▯"},
+		{0.5, 4, "▮▮▯▯"},
+		{1, 4, "▮▮▮▮"},
+		{1.5, 2, "▮▮"},
+		{-1, 2, "▯▯"},
+	} {
+		s := FormatBar(test.fraction, test.n)
+		if s != test.s {
+			t.Errorf("test %d: %q (expected %q)", i, s, test.s)
+		}
+	}
+}
+
+func TestPercentBar(t *testing.T) {
+	f := PercentBar{}
+	max := f.MaxFormattedWidth()
+	if max != "100% ▮▮▮▮▮▮▮▮▮▮" {
+		t.Errorf("max: %q", max)
+	}
+	for i, fraction := range []float64{0, 0.05, 0.5, 0.85, 1} {
+		s := f.Format(&Metrics{Fraction: fraction})
+		if utf8.RuneCountInString(s) > utf8.RuneCountInString(max) {
+			t.Errorf("test %d: %q wider than %q", i, s, max)
+		}
+	}
+	s := f.Format(&Metrics{Fraction: 0.85})
+	if s != "85% ▮▮▮▮▮▮▮▮▯▯" {
+		t.Errorf("format: %q", s)
+	}
+
+	f = PercentBar{Blocks: 4}
+	if f.MaxFormattedWidth() != "100% ▮▮▮▮" {
+		t.Errorf("max: %q", f.MaxFormattedWidth())
+	}
+}
+
+func TestFormatPercent_locale(t *testing.T) {
+	defer SetLocale(language.English)
+	for i, test := range []struct {
+		tag language.Tag
+		s   string
+	}{
+		{language.English, "85%"},
+		{language.Turkish, "%85"},
+		{language.French, "85\u00a0%"},
+		{language.Persian, "۸۵٪"},
+	} {
+		SetLocale(test.tag)
+		s := FormatPercent(&Metrics{Fraction: 0.85})
+		if s != test.s {
+			t.Errorf("test %d: %q (expected %q)", i, s, test.s)
+		}
+	}
+}
+
+func TestPercentFormatter(t *testing.T) {
+	for i, test := range []struct {
+		precision int
+		fraction  float64
+		s         string
+		max       string
+	}{
+		{0, 0.853, "85%", "100%"},
+		{1, 0.853, "85.3%", "100.0%"},
+		{2, 0.853, "85.30%", "100.00%"},
+		{1, 0, "0.0%", "100.0%"},
+		{1, 0.9994, "99.9%", "100.0%"},
+		{1, 0.9995, "99.9%", "100.0%"},
+		{1, 0.9996, "100.0%", "100.0%"},
+		{2, 0.99994, "99.99%", "100.00%"},
+		{2, 1, "100.00%", "100.00%"},
+	} {
+		f := PercentFormatter{Precision: test.precision}
+		s := f.Format(&Metrics{Fraction: test.fraction})
+		if s != test.s {
+			t.Errorf("test %d: %q (expected %q)", i, s, test.s)
+		}
+		if max := f.MaxFormattedWidth(); max != test.max {
+			t.Errorf("test %d: max width %q (expected %q)", i, max, test.max)
+		}
+		tmpl := fmt.Sprintf("{{percentF %d .fraction}}", test.precision)
+		ft, err := FormatMetricTemplate(tmpl)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		if s := ft.Format(&Metrics{Fraction: test.fraction}); s != test.s {
+			t.Errorf("test %d: template %q (expected %q)", i, s, test.s)
+		}
+	}
+}
+
+// stringFormatter is a MetricFormatter that always renders the same string.
+type stringFormatter string
+
+func (f stringFormatter) Format(m *Metrics) string {
+	return string(f)
+}
+
+// receiveFormatter waits for a formatter to be sent over c.
+func receiveFormatter(c <-chan MetricFormatter) (MetricFormatter, bool) {
+	select {
+	case f := <-c:
+		return f, true
+	case <-time.After(time.Second):
+		return nil, false
+	}
+}
+
+// expectNoFormatter fails the test if a formatter is sent over c.
+func expectNoFormatter(t *testing.T, c <-chan MetricFormatter) {
+	select {
+	case f := <-c:
+		t.Errorf("unexpected formatter: %q", f.Format(nil))
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestRotateMetricsFormat(t *testing.T) {
+	clock := newFakeClock()
+	c := make(chan MetricFormatter)
+	interval := 5 * time.Second
+	go rotateMetricsFormat(clock, interval, c, nil, nil, stringFormatter("a"), stringFormatter("b"), stringFormatter("c"))
+
+	// the first formatter is available without the clock advancing.
+	f, ok := receiveFormatter(c)
+	if !ok {
+		t.Fatalf("first formatter not sent")
+	}
+	if f.Format(nil) != "a" {
+		t.Errorf("first formatter: %q", f.Format(nil))
+	}
+	expectNoFormatter(t, c)
+
+	for i, expect := range []string{"b", "c", "a", "b"} {
+		clock.Advance(interval)
+		f, ok := receiveFormatter(c)
+		if !ok {
+			t.Fatalf("test %d: formatter not sent", i)
+		}
+		if f.Format(nil) != expect {
+			t.Errorf("test %d: %q (expected %q)", i, f.Format(nil), expect)
+		}
+		expectNoFormatter(t, c)
+	}
+}
+
+func TestRotateMetricsFormat_control(t *testing.T) {
+	clock := newFakeClock()
+	c := make(chan MetricFormatter)
+	control := make(chan RotateCommand)
+	interval := 5 * time.Second
+	go rotateMetricsFormat(clock, interval, c, control, nil, stringFormatter("a"), stringFormatter("b"), stringFormatter("c"))
+	if _, ok := receiveFormatter(c); !ok {
+		t.Fatalf("first formatter not sent")
+	}
+	for i, test := range []struct {
+		advance time.Duration
+		cmd     *RotateCommand
+		expect  string
+	}{
+		{3 * time.Second, nil, ""},
+		{0, rotateCommand(RotateAdvance), "b"},
+		{3 * time.Second, nil, ""}, // the timer restarted
+		{2 * time.Second, nil, "c"},
+		{0, rotateCommand(RotatePause), ""},
+		{interval, nil, ""},
+		{interval, nil, ""},
+		{0, rotateCommand(RotateAdvance), "a"},
+		{interval, nil, ""},
+		{0, rotateCommand(RotatePause), ""},
+		{interval, nil, "b"},
+	} {
+		if test.cmd != nil {
+			control <- *test.cmd
+		}
+		clock.Advance(test.advance)
+		if test.expect == "" {
+			expectNoFormatter(t, c)
+			continue
+		}
+		f, ok := receiveFormatter(c)
+		if !ok {
+			t.Fatalf("test %d: formatter not sent", i)
+		}
+		if f.Format(nil) != test.expect {
+			t.Errorf("test %d: %q (expected %q)", i, f.Format(nil), test.expect)
+		}
+	}
+}
+
+func TestRotateMetricsFormat_stop(t *testing.T) {
+	for i, f := range [][]MetricFormatter{
+		{stringFormatter("a")},
+		{stringFormatter("a"), stringFormatter("b")},
+	} {
+		clock := newFakeClock()
+		c := make(chan MetricFormatter)
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			rotateMetricsFormat(clock, time.Second, c, nil, stop, f...)
+		}()
+		if len(f) > 1 {
+			if _, ok := receiveFormatter(c); !ok {
+				t.Fatalf("test %d: first formatter not sent", i)
+			}
+		}
+		// the formatter awaiting a receiver is abandoned.
+		clock.Advance(time.Second)
+		close(stop)
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("test %d: did not return after stop", i)
+		}
+		if n := clock.numTickers(); n != 0 {
+			t.Errorf("test %d: %d tickers running", i, n)
+		}
+		clock.Advance(time.Second)
+		expectNoFormatter(t, c)
+	}
+}
+
+func rotateCommand(cmd RotateCommand) *RotateCommand {
+	return &cmd
+}
+
+func TestRotateMetricsFormat_single(t *testing.T) {
+	clock := newFakeClock()
+	c := make(chan MetricFormatter)
+	interval := 5 * time.Second
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		rotateMetricsFormat(clock, interval, c, nil, nil, stringFormatter("a"))
+	}()
+
+	f, ok := receiveFormatter(c)
+	if !ok {
+		t.Fatalf("formatter not sent")
+	}
+	if f.Format(nil) != "a" {
+		t.Errorf("formatter: %q", f.Format(nil))
+	}
+	for i := 0; i < 3; i++ {
+		clock.Advance(interval)
+		expectNoFormatter(t, c)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("rotation did not return")
+	}
+	if n := clock.numTickers(); n != 0 {
+		t.Errorf("%d tickers created", n)
+	}
+}
+
+func TestAlignMetricFormatters(t *testing.T) {
+	f := AlignMetricFormatters(stringFormatter("a"), PercentBar{Blocks: 2}, stringFormatter("ccc"))
+	if len(f) != 3 {
+		t.Fatalf("%d formatters", len(f))
+	}
+	m := &Metrics{Fraction: 0.5}
+	for i, expect := range []string{"a", "50% ▮▯", "ccc"} {
+		s := f[i].Format(m)
+		if s != expect {
+			t.Errorf("test %d: %q (expected %q)", i, s, expect)
+		}
+		fa, ok := f[i].(AlignedMetricFormatter)
+		if !ok {
+			t.Errorf("test %d: not an AlignedMetricFormatter", i)
+			continue
+		}
+		widths := fa.AlignedWidths(m)
+		expectWidths := []string{"a", "100% ▮▮", "ccc"}
+		if len(widths) != len(expectWidths) {
+			t.Errorf("test %d: widths %q", i, widths)
+			continue
+		}
+		for j := range widths {
+			if widths[j] != expectWidths[j] {
+				t.Errorf("test %d: width %d %q (expected %q)", i, j, widths[j], expectWidths[j])
+			}
+		}
+	}
+}
+
+// countFormatter is a MetricFormatter that counts the times it formats.
+type countFormatter struct {
+	n int
+}
+
+func (f *countFormatter) Format(m *Metrics) string {
+	f.n++
+	return "n"
+}
+
+func TestAlignMetricFormatters_cache(t *testing.T) {
+	count := &countFormatter{}
+	f := AlignMetricFormatters(count, stringFormatter("a"))
+	fa := f[1].(AlignedMetricFormatter)
+	if fa.Unaligned() != stringFormatter("a") {
+		t.Errorf("unaligned %v", fa.Unaligned())
+	}
+	if set := fa.AlignedSet(); len(set) != 2 || set[0] != count {
+		t.Errorf("set %v", set)
+	}
+	m1, m2 := &Metrics{Fraction: 0.5}, &Metrics{Fraction: 0.5}
+	for i, test := range []struct {
+		m *Metrics
+		n int
+	}{
+		{m1, 1},
+		{m1, 1},
+		{m2, 2},
+		{m2, 2},
+		{m1, 3},
+	} {
+		f[i%2].(AlignedMetricFormatter).AlignedWidths(test.m)
+		if count.n != test.n {
+			t.Errorf("test %d: formatted %d times (expected %d)", i, count.n, test.n)
+		}
+	}
+}
+
+func TestState_String(t *testing.T) {
+	for i, test := range []struct {
+		state State
+		s     string
+	}{
+		{Charging, "Charging"},
+		{Discharging, "Discharging"},
+		{Empty, "Empty"},
+		{FullyCharged, "FullyCharged"},
+		{PendingCharge, "PendingCharge"},
+		{PendingDischarge, "PendingDischarge"},
+		{Unknown, "Unknown"},
+		{State(7), "State(7)"},
+		{State(-1), "State(-1)"},
+	} {
+		s := test.state.String()
+		if s != test.s {
+			t.Errorf("test %d: %q (expected %q)", i, s, test.s)
+		}
+	}
+}
+
+func TestFormatRemaining(t *testing.T) {
+	untilEmpty := 2 * time.Hour
+	untilFull := 30 * time.Minute
+	for i, test := range []struct {
+		state State
+		s     string
+	}{
+		{Charging, "30m left"},
+		{Discharging, "2h left"},
+		{FullyCharged, "Full"},
+		{Empty, "Empty"},
+		{PendingCharge, "At limit"},
+		{PendingDischarge, "???"},
+		{Unknown, "???"},
+	} {
+		m := &Metrics{State: test.state, UntilEmpty: &untilEmpty, UntilFull: &untilFull}
+		s := FormatRemaining(m)
+		if s != test.s {
+			t.Errorf("test %d: %q (expected %q)", i, s, test.s)
+		}
+	}
+}
+
+func TestSetDurationStyle(t *testing.T) {
+	defer SetDurationStyle(DurationClean)
+	d := time.Hour + 23*time.Minute
+	for i, test := range []struct {
+		name  string
+		state State
+		s     string
+	}{
+		{"clean", Discharging, "1h23m left"},
+		{"short", Discharging, "1h left"},
+		{"days", Discharging, "1h23m left"},
+		{"colon", Discharging, "1:23 left"},
+		{"colon", Charging, "1:23 left"},
+		{"colon", FullyCharged, "Full"},
+		{"colon", Empty, "Empty"},
+		{"short", FullyCharged, "Full"},
+	} {
+		style, err := ParseDurationStyle(test.name)
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		SetDurationStyle(style)
+		s := FormatRemaining(&Metrics{State: test.state, UntilEmpty: &d, UntilFull: &d})
+		if s != test.s {
+			t.Errorf("test %d: %q (expected %q)", i, s, test.s)
+		}
+	}
+	if _, err := ParseDurationStyle("long"); err == nil {
+		t.Errorf("unknown style parsed")
+	}
+}
+
+func TestFormatDurationColon(t *testing.T) {
+	for i, test := range []struct {
+		d time.Duration
+		s string
+	}{
+		{0, "0:00"},
+		{time.Hour + 23*time.Minute + 30*time.Second, "1:23"},
+		{5 * time.Minute, "0:05"},
+		{28 * time.Hour, "28:00"},
+	} {
+		s := FormatDurationColon(test.d)
+		if s != test.s {
+			t.Errorf("test %d: %q (expected %q)", i, s, test.s)
+		}
+	}
+}
+
+func TestSetRemainingText(t *testing.T) {
+	defer SetRemainingText(DefaultRemainingText)
+	for i, test := range []struct {
+		text RemainingText
+		m    *Metrics
+		s    string
+	}{
+		{RemainingText{Full: "100%"}, &Metrics{State: FullyCharged}, "100%"},
+		{RemainingText{Full: "100%"}, &Metrics{State: Empty}, "Empty"},
+		{RemainingText{Empty: "0%"}, &Metrics{State: Empty}, "0%"},
+		{RemainingText{Unknown: "?"}, &Metrics{State: Discharging}, "?"},
+		{RemainingText{Unknown: "?"}, &Metrics{State: FullyCharged}, "Full"},
+	} {
+		SetRemainingText(test.text)
+		s := FormatRemaining(test.m)
+		if s != test.s {
+			t.Errorf("test %d: %q (expected %q)", i, s, test.s)
+		}
+	}
+
+	SetRemainingText(RemainingText{Full: "⚡"})
+	if s := FormatETA(&Metrics{State: FullyCharged}); s != "⚡" {
+		t.Errorf("eta: %q (expected %q)", s, "⚡")
+	}
+}
+
+func TestNewMetricsView_unknown(t *testing.T) {
+	untilEmpty := 2 * time.Hour
+	m := &Metrics{State: Unknown, Fraction: 0.5, UntilEmpty: &untilEmpty}
+	v := NewMetricsView(m)
+	if v.HasRemaining() {
+		t.Errorf("remaining: %v", v.Remaining())
+	}
+	f, err := FormatMetricTemplate(`{{.state}} {{if .HasRemaining}}{{dur .Remaining}}{{else}}?{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := f.Format(m); s != "Unknown ?" {
+		t.Errorf("template: %q (expected %q)", s, "Unknown ?")
+	}
+}
+
+func TestMetrics_String(t *testing.T) {
+	untilEmpty := 2*time.Hour + 30*time.Minute
+	untilFull := 45 * time.Minute
+	for i, test := range []struct {
+		m *Metrics
+		s string
+	}{
+		{&Metrics{Fraction: 0.85, State: Discharging, UntilEmpty: &untilEmpty}, "85.0% Discharging untilEmpty=2h30m0s untilFull=nil"},
+		{&Metrics{Fraction: 0.125, State: Charging, UntilEmpty: &untilEmpty, UntilFull: &untilFull}, "12.5% Charging untilEmpty=2h30m0s untilFull=45m0s"},
+		{&Metrics{Fraction: 1, State: FullyCharged}, "100.0% FullyCharged untilEmpty=nil untilFull=nil"},
+		{&Metrics{State: Unknown}, "0.0% Unknown untilEmpty=nil untilFull=nil"},
+		{nil, "<nil>"},
+	} {
+		s := test.m.String()
+		if s != test.s {
+			t.Errorf("test %d: %q (expected %q)", i, s, test.s)
+		}
+		if s := fmt.Sprint(test.m); s != test.s {
+			t.Errorf("test %d: sprint %q (expected %q)", i, s, test.s)
+		}
+	}
+}
+
+func TestFormatETA(t *testing.T) {
+	clock := newFakeClock()
+	defer func(c Clock) { etaClock = c }(etaClock)
+	etaClock = clock
+
+	durPtr := func(d time.Duration) *time.Duration { return &d }
+	for i, test := range []struct {
+		m *Metrics
+		s string
+	}{
+		{&Metrics{State: Charging, UntilFull: durPtr(2*time.Hour + 30*time.Minute)}, "full by 14:30"},
+		{&Metrics{State: Discharging, UntilEmpty: durPtr(45 * time.Minute)}, "empty by 12:45"},
+		{&Metrics{State: Discharging, UntilEmpty: durPtr(13 * time.Hour)}, "empty by 01:00"},
+		{&Metrics{State: Charging}, UnknownETA},
+		{&Metrics{State: Discharging}, UnknownETA},
+		{&Metrics{State: FullyCharged}, "Full"},
+		{&Metrics{State: Empty}, "Empty"},
+		{&Metrics{State: PendingCharge}, UnknownETA},
+		{&Metrics{State: Unknown, UntilEmpty: durPtr(45 * time.Minute)}, UnknownETA},
+	} {
+		s := FormatETA(test.m)
+		if s != test.s {
+			t.Errorf("test %d: %q (expected %q)", i, s, test.s)
+		}
+	}
+}
+
+func TestFormatDurationDays(t *testing.T) {
+	for i, test := range []struct {
+		d time.Duration
+		s string
+	}{
+		{90 * time.Minute, "1h30m"},
+		{25 * time.Hour, "1d1h"},
+		{48 * time.Hour, "2d"},
+		{26*time.Hour + 30*time.Minute, "1d2h30m"},
+		{24*time.Hour + 30*time.Minute, "1d30m"},
+		{24*time.Hour + 30*time.Second, "1d"},
+		{0, "0m"},
+	} {
+		s := FormatDurationDays(test.d)
+		if s != test.s {
+			t.Errorf("test %d: %q (expected %q)", i, s, test.s)
+		}
+	}
+	f, err := FormatMetricTemplate("{{durDays .remaining}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := 28 * time.Hour
+	s := f.Format(&Metrics{State: Discharging, UntilEmpty: &d})
+	if s != "1d4h" {
+		t.Errorf("template: %q (expected %q)", s, "1d4h")
+	}
+}
+
+func TestFormatMetricTemplateStrict(t *testing.T) {
+	for i, test := range []struct {
+		tmpl     string
+		s        string
+		parseErr bool
+	}{
+		{`{{percent .fraction}}`, "50%", false},
+		{`{{.doesnotexist}}`, TemplateErrorString, false},
+		{`{{dur .fraction}}`, TemplateErrorString, false},
+		{`{{percent .fraction`, "", true},
+	} {
+		f, err := FormatMetricTemplateStrict(test.tmpl)
+		if (err != nil) != test.parseErr {
+			t.Errorf("test %d: err %v (expected error %v)", i, err, test.parseErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if _, ok := f.(ErrorMetricFormatter); ok {
+			t.Errorf("test %d: strict formatter is an ErrorMetricFormatter", i)
+		}
+		s, err := FormatMetrics(f, &Metrics{Fraction: 0.5})
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+		}
+		if s != test.s {
+			t.Errorf("test %d: %q (expected %q)", i, s, test.s)
+		}
+	}
+}
+
+func TestFormatMetricTemplateStrict_log(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	f, err := FormatMetricTemplateStrict(`{{dur .fraction}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		f.Format(&Metrics{Fraction: 0.5})
+	}
+	n := strings.Count(buf.String(), "\n")
+	if n != 1 {
+		t.Errorf("%d lines logged (expected 1)", n)
+	}
+}
+
+func TestFormatMetricTemplate_max(t *testing.T) {
+	minute, hours := time.Minute, 12*time.Hour+34*time.Minute
+	volts, amps := 11.87, 1.25
+	var metrics []*Metrics
+	for _, fraction := range []float64{0, 0.09, 0.5, 1} {
+		for _, state := range []State{Unknown, Charging, Discharging, FullyCharged, PendingDischarge} {
+			metrics = append(metrics,
+				&Metrics{Fraction: fraction, State: state},
+				&Metrics{Fraction: fraction, State: state, UntilEmpty: &minute, UntilFull: &hours, Voltage: &volts, Current: &amps, Power: 12.5, Temperature: 31.5, Health: 0.87},
+			)
+		}
+	}
+	for i, tmpl := range []string{
+		`{{percent .fraction}}`,
+		`{{percentF 1 .fraction}} {{.state}}`,
+		`{{if .HasRemaining}}{{dur .Remaining}}{{else}}{{.state}}{{end}}`,
+		`{{percent .fraction}} {{durShort .remaining}} {{volts .voltage}} {{amps .current}}`,
+		`{{watts .power}} {{temp .temperature}} {{health .health}}`,
+	} {
+		f, err := FormatMetricTemplate(tmpl)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		fmax, ok := f.(MaxMetricFormatter)
+		if !ok {
+			t.Fatalf("test %d: not a MaxMetricFormatter", i)
+		}
+		max := fmax.MaxFormattedWidth()
+		for j, m := range metrics {
+			s := f.Format(m)
+			if utf8.RuneCountInString(s) > utf8.RuneCountInString(max) {
+				t.Errorf("test %d: metrics %d: %q is wider than max %q", i, j, s, max)
+			}
+		}
+	}
+}
+
+func TestFormatMetricTemplate_eta(t *testing.T) {
+	clock := newFakeClock()
+	defer func(c Clock) { etaClock = c }(etaClock)
+	etaClock = clock
+
+	f, err := FormatMetricTemplate(`{{eta .remaining}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hour := time.Hour
+	for i, test := range []struct {
+		m *Metrics
+		s string
+	}{
+		{&Metrics{State: Discharging, UntilEmpty: &hour}, "13:00"},
+		{&Metrics{State: Charging, UntilFull: &hour}, "13:00"},
+		{&Metrics{State: Discharging}, UnknownETA},
+	} {
+		s := f.Format(test.m)
+		if s != test.s {
+			t.Errorf("test %d: %q (expected %q)", i, s, test.s)
+		}
+	}
+	clock.Advance(time.Hour)
+	if s := f.Format(&Metrics{State: Discharging, UntilEmpty: &hour}); s != "14:00" {
+		t.Errorf("%q after advancing the clock (expected %q)", s, "14:00")
+	}
+}
@@ -0,0 +1,96 @@
+package battery
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MockGuage is a Guage that reports scripted metrics, so that drawing may be
+// exercised in tests and demos without a battery.  MockGuage implements
+// StateNotifier and sends notifications when Notify is called.
+type MockGuage struct {
+	// Metrics are returned in order by successive calls to BatteryMetrics.
+	// The last Metrics is repeated once the sequence is exhausted.
+	Metrics []*Metrics
+
+	// If Func is not nil BatteryMetrics returns the result of calling Func
+	// with the number of previous calls instead of returning Metrics.
+	Func func(n int) (*Metrics, error)
+
+	mut    sync.Mutex
+	n      int
+	notify chan<- struct{}
+}
+
+// NewMockGuage returns a MockGuage that reports each of m in turn.
+func NewMockGuage(m ...*Metrics) *MockGuage {
+	return &MockGuage{Metrics: m}
+}
+
+// BatteryMetrics implements the Guage interface.  A copy of the scripted
+// metrics is returned so that callers may not modify the script.
+func (g *MockGuage) BatteryMetrics() (*Metrics, error) {
+	g.mut.Lock()
+	n := g.n
+	g.n++
+	g.mut.Unlock()
+	if g.Func != nil {
+		return g.Func(n)
+	}
+	if len(g.Metrics) == 0 {
+		return nil, fmt.Errorf("mock: no metrics")
+	}
+	if n >= len(g.Metrics) {
+		n = len(g.Metrics) - 1
+	}
+	m := *g.Metrics[n]
+	return &m, nil
+}
+
+// Calls returns the number of times BatteryMetrics has been called.
+func (g *MockGuage) Calls() int {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	return g.n
+}
+
+// BatteryStateChange implements the StateNotifier interface.
+func (g *MockGuage) BatteryStateChange(notf chan<- struct{}) (stop func()) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	g.notify = notf
+	return func() {
+		g.mut.Lock()
+		defer g.mut.Unlock()
+		g.notify = nil
+	}
+}
+
+// Notify sends a notification that the battery state has changed, as a real
+// Guage does when line power is connected.  Notify blocks until the
+// notification is received and returns false if nothing is watching the
+// state of g.
+func (g *MockGuage) Notify() bool {
+	g.mut.Lock()
+	notf := g.notify
+	g.mut.Unlock()
+	if notf == nil {
+		return false
+	}
+	notf <- struct{}{}
+	return true
+}
+
+// MockDrain returns a function for MockGuage.Func that simulates a battery
+// draining from fraction start by step each call until it is empty.
+func MockDrain(start, step float64) func(n int) (*Metrics, error) {
+	return func(n int) (*Metrics, error) {
+		m := &Metrics{Fraction: start - float64(n)*step, State: Discharging}
+		if m.Fraction <= 0 {
+			m.Fraction = 0
+			m.State = Empty
+		}
+		m.OnAC = InferOnAC(m.State)
+		return m, nil
+	}
+}
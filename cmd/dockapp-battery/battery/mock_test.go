@@ -0,0 +1,75 @@
+package battery
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMockGuage_Profiler(t *testing.T) {
+	script := []*Metrics{
+		{Fraction: 0.5, State: Charging},
+		{Fraction: 1, State: FullyCharged},
+		{Fraction: 0.95, State: Discharging},
+		{Fraction: 0.9, State: Discharging},
+	}
+	g := NewMockGuage(script...)
+	p := NewProfiler(g)
+	c := make(chan *Metrics, 1)
+	go p.Start(time.Hour, c)
+	defer p.Stop()
+
+	for i, expect := range script {
+		if i > 0 {
+			// state changes are notified and other polls are refreshed.
+			if expect.State != script[i-1].State {
+				if !g.Notify() {
+					t.Fatalf("test %d: state change not watched", i)
+				}
+			} else {
+				p.Refresh()
+			}
+		}
+		m, ok := receiveMetrics(c)
+		if !ok {
+			t.Fatalf("test %d: no metrics", i)
+		}
+		if m.Fraction != expect.Fraction || m.State != expect.State {
+			t.Errorf("test %d: %v (expected %v)", i, m, expect)
+		}
+	}
+	if n := g.Calls(); n != len(script) {
+		t.Errorf("%d calls (expected %d)", n, len(script))
+	}
+
+	// the last metrics repeat once the script is exhausted.
+	p.Refresh()
+	m, ok := receiveMetrics(c)
+	if !ok {
+		t.Fatalf("no metrics after the script")
+	}
+	if m.Fraction != 0.9 {
+		t.Errorf("after the script: %v", m)
+	}
+}
+
+func TestMockDrain(t *testing.T) {
+	g := &MockGuage{Func: MockDrain(0.3, 0.1)}
+	for i, test := range []struct {
+		fraction float64
+		state    State
+	}{
+		{0.3, Discharging},
+		{0.2, Discharging},
+		{0.1, Discharging},
+		{0, Empty},
+		{0, Empty},
+	} {
+		m, err := g.BatteryMetrics()
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		if m.Fraction < test.fraction-1e-9 || m.Fraction > test.fraction+1e-9 || m.State != test.state {
+			t.Errorf("test %d: %v (expected %v %v)", i, m, test.fraction, test.state)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package battery
+
+import (
+	"fmt"
+	"time"
+)
+
+// MultiGuage is a Guage that combines the metrics of several batteries, like
+// the internal and external packs of some laptops, into the metrics of a
+// single battery.
+//
+// The combined Fraction is weighted by the EnergyFull of each battery when all
+// of them report it, otherwise each battery is weighted equally.  The combined
+// State is Charging if any battery is charging, otherwise Discharging if any
+// battery is discharging.  Batteries in other states are combined as described
+// by CombineStates.  Time estimates are derived from the total energy and power
+// when they are known, otherwise the estimates of each battery are summed
+// because packs discharge and charge one after another.  The combined
+// Temperature is that of the hottest battery and the combined Health is that
+// of the least healthy.
+type MultiGuage struct {
+	g []Guage
+}
+
+// NewMultiGuage returns a MultiGuage that combines the metrics of g.
+func NewMultiGuage(g ...Guage) *MultiGuage {
+	return &MultiGuage{g: g}
+}
+
+// BatteryMetrics implements the Guage interface.  If any underlying Guage
+// returns an error BatteryMetrics returns it.
+func (g *MultiGuage) BatteryMetrics() (*Metrics, error) {
+	ms := make([]*Metrics, len(g.g))
+	for i, g := range g.g {
+		m, err := g.BatteryMetrics()
+		if err != nil {
+			return nil, fmt.Errorf("battery %d: %v", i, err)
+		}
+		ms[i] = m
+	}
+	return CombineMetrics(ms...), nil
+}
+
+// BatteryStateChange implements the StateNotifier interface by relaying
+// notifications from each underlying Guage which is a StateNotifier.
+func (g *MultiGuage) BatteryStateChange(notifications chan<- struct{}) (stop func()) {
+	done := make(chan struct{})
+	var stops []func()
+	for _, g := range g.g {
+		notf, ok := g.(StateNotifier)
+		if !ok {
+			continue
+		}
+		// each Guage has its own channel because a StateNotifier may close
+		// the channel it is given.
+		c := make(chan struct{})
+		stops = append(stops, notf.BatteryStateChange(c))
+		go relayStateChange(c, notifications, done)
+	}
+	return func() {
+		close(done)
+		for _, stop := range stops {
+			stop()
+		}
+	}
+}
+
+func relayStateChange(c <-chan struct{}, notifications chan<- struct{}, done <-chan struct{}) {
+	for {
+		select {
+		case _, ok := <-c:
+			if !ok {
+				return
+			}
+			select {
+			case notifications <- struct{}{}:
+			case <-done:
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// CombineMetrics returns the metrics of a single battery equivalent to the
+// batteries described by m.  See MultiGuage.
+func CombineMetrics(m ...*Metrics) *Metrics {
+	if len(m) == 1 {
+		return m[0]
+	}
+	combined := &Metrics{}
+	states := make([]State, len(m))
+	weighted := true
+	for i, m := range m {
+		states[i] = m.State
+		combined.Power += m.Power
+		combined.EnergyFull += m.EnergyFull
+		if m.Temperature > combined.Temperature {
+			combined.Temperature = m.Temperature
+		}
+		if m.Health > 0 && (combined.Health == 0 || m.Health < combined.Health) {
+			combined.Health = m.Health
+		}
+		if m.EnergyFull <= 0 {
+			weighted = false
+		}
+	}
+	combined.State = CombineStates(states...)
+
+	var energy float64 // watt hours stored
+	n := float64(len(m))
+	for _, m := range m {
+		if weighted {
+			energy += m.Fraction * m.EnergyFull
+		} else {
+			combined.Fraction += m.Fraction / n
+		}
+	}
+	if weighted {
+		combined.Fraction = energy / combined.EnergyFull
+	} else {
+		combined.EnergyFull = 0
+	}
+
+	switch {
+	case weighted && combined.State == Discharging && combined.Power > 0:
+		combined.UntilEmpty = hours(energy / combined.Power)
+	case weighted && combined.State == Charging && combined.Power < 0:
+		combined.UntilFull = hours((combined.EnergyFull - energy) / -combined.Power)
+	default:
+		combined.UntilEmpty = sumDurations(m, func(m *Metrics) *time.Duration { return m.UntilEmpty })
+		combined.UntilFull = sumDurations(m, func(m *Metrics) *time.Duration { return m.UntilFull })
+	}
+
+	for _, m := range m {
+		if m.OnAC == nil {
+			continue
+		}
+		if combined.OnAC == nil || *m.OnAC {
+			onAC := *m.OnAC
+			combined.OnAC = &onAC
+		}
+	}
+	return combined
+}
+
+// CombineStates returns the state of a single battery equivalent to batteries
+// in the given states.  Charging takes precedence over Discharging, which
+// takes precedence over PendingCharge and then PendingDischarge.  Otherwise
+// batteries that are all Empty or all FullyCharged, ignoring those in an
+// Unknown state, are Empty or FullyCharged.
+func CombineStates(states ...State) State {
+	for _, precedent := range []State{Charging, Discharging, PendingCharge, PendingDischarge} {
+		for _, state := range states {
+			if state == precedent {
+				return precedent
+			}
+		}
+	}
+	combined := Unknown
+	for _, state := range states {
+		if state == Unknown {
+			continue
+		}
+		if combined != Unknown && state != combined {
+			return Unknown
+		}
+		combined = state
+	}
+	return combined
+}
+
+// hours returns a duration of h hours.
+func hours(h float64) *time.Duration {
+	d := time.Duration(h * float64(time.Hour))
+	return &d
+}
+
+// sumDurations returns the sum of the durations of m returned by fn, or nil if
+// none are known.
+func sumDurations(m []*Metrics, fn func(*Metrics) *time.Duration) *time.Duration {
+	var sum *time.Duration
+	for _, m := range m {
+		d := fn(m)
+		if d == nil {
+			continue
+		}
+		if sum == nil {
+			sum = new(time.Duration)
+		}
+		*sum += *d
+	}
+	return sum
+}
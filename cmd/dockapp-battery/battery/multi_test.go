@@ -0,0 +1,173 @@
+package battery
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+// fakeGuage is a Guage that always returns the same metrics or error.
+type fakeGuage struct {
+	m   *Metrics
+	err error
+}
+
+func (g *fakeGuage) BatteryMetrics() (*Metrics, error) {
+	return g.m, g.err
+}
+
+// notifyGuage is a fakeGuage that is a StateNotifier.
+type notifyGuage struct {
+	fakeGuage
+	notf chan<- struct{}
+}
+
+func (g *notifyGuage) BatteryStateChange(notf chan<- struct{}) (stop func()) {
+	g.notf = notf
+	return func() {}
+}
+
+func TestMultiGuage(t *testing.T) {
+	dur := func(d time.Duration) *time.Duration { return &d }
+	onAC, onBattery := true, false
+	for i, test := range []struct {
+		a, b       *Metrics
+		fraction   float64
+		state      State
+		untilEmpty *time.Duration
+		untilFull  *time.Duration
+		onAC       *bool
+	}{
+		// unweighted
+		{
+			&Metrics{Fraction: 0.2, State: Discharging, UntilEmpty: dur(time.Hour)},
+			&Metrics{Fraction: 0.6, State: Unknown},
+			0.4, Discharging, dur(time.Hour), nil, nil,
+		},
+		{
+			&Metrics{Fraction: 0.2, State: Discharging, UntilEmpty: dur(time.Hour), OnAC: &onBattery},
+			&Metrics{Fraction: 0.6, State: Discharging, UntilEmpty: dur(2 * time.Hour), OnAC: &onBattery},
+			0.4, Discharging, dur(3 * time.Hour), nil, &onBattery,
+		},
+		// weighted by energy
+		{
+			&Metrics{Fraction: 0.5, State: Discharging, EnergyFull: 20, Power: 10, OnAC: &onBattery},
+			&Metrics{Fraction: 1, State: FullyCharged, EnergyFull: 60},
+			0.875, Discharging, dur(7 * time.Hour), nil, &onBattery,
+		},
+		{
+			&Metrics{Fraction: 0.5, State: Charging, EnergyFull: 20, Power: -10, OnAC: &onAC},
+			&Metrics{Fraction: 0.5, State: PendingCharge, EnergyFull: 60, OnAC: &onAC},
+			0.5, Charging, nil, dur(4 * time.Hour), &onAC,
+		},
+		{
+			&Metrics{Fraction: 1, State: FullyCharged, EnergyFull: 20, OnAC: &onBattery},
+			&Metrics{Fraction: 0.5, State: Discharging, EnergyFull: 20, UntilEmpty: dur(time.Hour), OnAC: &onAC},
+			0.75, Discharging, dur(time.Hour), nil, &onAC,
+		},
+		{
+			&Metrics{Fraction: 1, State: FullyCharged, EnergyFull: 20},
+			&Metrics{Fraction: 1, State: FullyCharged, EnergyFull: 30},
+			1, FullyCharged, nil, nil, nil,
+		},
+	} {
+		g := NewMultiGuage(&fakeGuage{m: test.a}, &fakeGuage{m: test.b})
+		m, err := g.BatteryMetrics()
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		if math.Abs(m.Fraction-test.fraction) > 1e-9 {
+			t.Errorf("test %d: fraction %v (expected %v)", i, m.Fraction, test.fraction)
+		}
+		if m.State != test.state {
+			t.Errorf("test %d: state %v (expected %v)", i, m.State, test.state)
+		}
+		if durString(m.UntilEmpty) != durString(test.untilEmpty) {
+			t.Errorf("test %d: until empty %s (expected %s)", i, durString(m.UntilEmpty), durString(test.untilEmpty))
+		}
+		if durString(m.UntilFull) != durString(test.untilFull) {
+			t.Errorf("test %d: until full %s (expected %s)", i, durString(m.UntilFull), durString(test.untilFull))
+		}
+		if (m.OnAC == nil) != (test.onAC == nil) || m.OnAC != nil && *m.OnAC != *test.onAC {
+			t.Errorf("test %d: onAC %v (expected %v)", i, m.OnAC, test.onAC)
+		}
+	}
+}
+
+func TestCombineMetrics_condition(t *testing.T) {
+	m := CombineMetrics(
+		&Metrics{Fraction: 1, State: FullyCharged, Temperature: 30},
+		&Metrics{Fraction: 1, State: FullyCharged, Temperature: 42.5},
+		&Metrics{Fraction: 1, State: FullyCharged},
+	)
+	if m.Temperature != 42.5 {
+		t.Errorf("temperature %v (expected the hottest battery)", m.Temperature)
+	}
+
+	m = CombineMetrics(
+		&Metrics{Fraction: 1, State: FullyCharged, Health: 0.9},
+		&Metrics{Fraction: 1, State: FullyCharged},
+		&Metrics{Fraction: 1, State: FullyCharged, Health: 0.75},
+	)
+	if m.Health != 0.75 {
+		t.Errorf("health %v (expected the least healthy battery)", m.Health)
+	}
+}
+
+func TestMultiGuage_error(t *testing.T) {
+	g := NewMultiGuage(&fakeGuage{m: &Metrics{}}, &fakeGuage{err: fmt.Errorf("unplugged")})
+	_, err := g.BatteryMetrics()
+	if err == nil || err.Error() != "battery 1: unplugged" {
+		t.Errorf("error: %v", err)
+	}
+}
+
+func TestMultiGuage_BatteryStateChange(t *testing.T) {
+	a := &notifyGuage{}
+	b := &notifyGuage{}
+	g := NewMultiGuage(a, &fakeGuage{}, b)
+	c := make(chan struct{})
+	stop := g.BatteryStateChange(c)
+	defer stop()
+	for i, notf := range []chan<- struct{}{a.notf, b.notf} {
+		notf <- struct{}{}
+		select {
+		case <-c:
+		case <-time.After(time.Second):
+			t.Errorf("notifier %d: not relayed", i)
+		}
+	}
+	close(a.notf)
+	b.notf <- struct{}{}
+	select {
+	case <-c:
+	case <-time.After(time.Second):
+		t.Errorf("not relayed after close")
+	}
+}
+
+func TestCombineStates(t *testing.T) {
+	for i, test := range []struct {
+		states []State
+		state  State
+	}{
+		{[]State{Discharging, Charging}, Charging},
+		{[]State{FullyCharged, Discharging}, Discharging},
+		{[]State{Unknown, Discharging}, Discharging},
+		{[]State{FullyCharged, PendingCharge}, PendingCharge},
+		{[]State{PendingDischarge, Empty}, PendingDischarge},
+		{[]State{FullyCharged, FullyCharged}, FullyCharged},
+		{[]State{Unknown, FullyCharged}, FullyCharged},
+		{[]State{Empty, Empty}, Empty},
+		{[]State{Empty, FullyCharged}, Unknown},
+		{[]State{Unknown, Unknown}, Unknown},
+		{nil, Unknown},
+	} {
+		state := CombineStates(test.states...)
+		if state != test.state {
+			t.Errorf("test %d: %v (expected %v)", i, state, test.state)
+		}
+	}
+}
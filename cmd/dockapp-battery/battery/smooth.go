@@ -0,0 +1,78 @@
+package battery
+
+import (
+	"sync"
+	"time"
+)
+
+// SmoothGuage is a Guage that smooths the time estimates of an underlying
+// Guage using an exponential moving average, which keeps displayed estimates
+// from jumping between polls.  The unsmoothed estimates are retained in the
+// RawUntilEmpty and RawUntilFull fields of the Metrics returned.
+//
+// The average is reset when the battery state changes, or when the underlying
+// Guage stops providing an estimate.
+type SmoothGuage struct {
+	g Guage
+
+	// Smoothing is the weight, from 0.0 to 1.0, given to the previous average
+	// when a new estimate is received.  A Smoothing of zero disables
+	// smoothing.
+	Smoothing float64
+
+	mut        sync.Mutex
+	state      State
+	untilEmpty *time.Duration
+	untilFull  *time.Duration
+}
+
+// NewSmoothGuage returns a SmoothGuage that smooths the estimates of g.
+func NewSmoothGuage(g Guage, smoothing float64) *SmoothGuage {
+	return &SmoothGuage{g: g, Smoothing: smoothing}
+}
+
+// BatteryMetrics implements the Guage interface.
+func (g *SmoothGuage) BatteryMetrics() (*Metrics, error) {
+	m, err := g.g.BatteryMetrics()
+	if err != nil {
+		return nil, err
+	}
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	if m.State != g.state {
+		g.state = m.State
+		g.untilEmpty = nil
+		g.untilFull = nil
+	}
+	smooth := *m
+	smooth.RawUntilEmpty = m.UntilEmpty
+	smooth.RawUntilFull = m.UntilFull
+	g.untilEmpty = g.average(g.untilEmpty, m.UntilEmpty)
+	g.untilFull = g.average(g.untilFull, m.UntilFull)
+	smooth.UntilEmpty = g.untilEmpty
+	smooth.UntilFull = g.untilFull
+	return &smooth, nil
+}
+
+// average returns the moving average avg updated with estimate x.
+func (g *SmoothGuage) average(avg, x *time.Duration) *time.Duration {
+	if x == nil {
+		return nil
+	}
+	if avg == nil {
+		d := *x
+		return &d
+	}
+	k := g.Smoothing
+	d := time.Duration(k*float64(*avg) + (1-k)*float64(*x))
+	return &d
+}
+
+// BatteryStateChange implements the StateNotifier interface by forwarding
+// notifications from the underlying Guage, if it is a StateNotifier.
+func (g *SmoothGuage) BatteryStateChange(notifications chan<- struct{}) (stop func()) {
+	if notf, ok := g.g.(StateNotifier); ok {
+		return notf.BatteryStateChange(notifications)
+	}
+	return func() {}
+}
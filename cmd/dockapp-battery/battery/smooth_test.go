@@ -0,0 +1,59 @@
+package battery
+
+import (
+	"testing"
+	"time"
+)
+
+// seqGuage is a Guage that returns a sequence of metrics.
+type seqGuage struct {
+	seq []*Metrics
+}
+
+func (g *seqGuage) BatteryMetrics() (*Metrics, error) {
+	m := g.seq[0]
+	g.seq = g.seq[1:]
+	return m, nil
+}
+
+func TestSmoothGuage(t *testing.T) {
+	min := func(n float64) *time.Duration {
+		d := time.Duration(n * float64(time.Minute))
+		return &d
+	}
+	discharging := func(n float64) *Metrics {
+		return &Metrics{State: Discharging, UntilEmpty: min(n)}
+	}
+	for i, test := range []struct {
+		smoothing float64
+		seq       []*Metrics
+		expect    []*time.Duration
+	}{
+		// noisy estimates are averaged.
+		{0.5, []*Metrics{discharging(120), discharging(40), discharging(110), discharging(90)}, []*time.Duration{min(120), min(80), min(95), min(92.5)}},
+		// no smoothing reports estimates as is.
+		{0, []*Metrics{discharging(120), discharging(40), discharging(110)}, []*time.Duration{min(120), min(40), min(110)}},
+		// a state change resets the average.
+		{0.5, []*Metrics{discharging(120), {State: Charging, UntilFull: min(30)}, discharging(40)}, []*time.Duration{min(120), nil, min(40)}},
+		// a missing estimate resets the average.
+		{0.5, []*Metrics{discharging(120), {State: Discharging}, discharging(40)}, []*time.Duration{min(120), nil, min(40)}},
+	} {
+		g := NewSmoothGuage(&seqGuage{append([]*Metrics(nil), test.seq...)}, test.smoothing)
+		for j, expect := range test.expect {
+			raw := test.seq[j]
+			m, err := g.BatteryMetrics()
+			if err != nil {
+				t.Fatalf("test %d: poll %d: %v", i, j, err)
+			}
+			if (m.UntilEmpty == nil) != (expect == nil) || (expect != nil && *m.UntilEmpty != *expect) {
+				t.Errorf("test %d: poll %d: until empty %v (expected %v)", i, j, durString(m.UntilEmpty), durString(expect))
+			}
+			if m.RawUntilEmpty != raw.UntilEmpty {
+				t.Errorf("test %d: poll %d: raw until empty %v (expected %v)", i, j, durString(m.RawUntilEmpty), durString(raw.UntilEmpty))
+			}
+			if raw.State == Charging && (m.UntilFull == nil || *m.UntilFull != *raw.UntilFull) {
+				t.Errorf("test %d: poll %d: until full %v (expected %v)", i, j, durString(m.UntilFull), durString(raw.UntilFull))
+			}
+		}
+	}
+}
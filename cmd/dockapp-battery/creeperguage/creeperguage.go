@@ -3,6 +3,7 @@ package creeperguage
 import (
 	"fmt"
 	"log"
+	"math"
 	"time"
 
 	"github.com/TheCreeper/go-upower"
@@ -14,12 +15,24 @@ import (
 // CreeperBatteryGuage is a BatteryGuage implementation that uses github.com/TheCreeper/go-upower
 type CreeperBatteryGuage struct {
 	dev dbus.ObjectPath
+	ac  dbus.ObjectPath
 	sig chan *dbus.Signal
 }
 
 // NewCreeperBatteryGuage detects batteries on the system and returs a
-// CreeperBatteryGuage that reads its metrics.
+// CreeperBatteryGuage that reads the metrics of the first.
 func NewCreeperBatteryGuage() (*CreeperBatteryGuage, error) {
+	guages, err := NewCreeperBatteryGuages()
+	if err != nil {
+		return nil, err
+	}
+	return guages[0], nil
+}
+
+// NewCreeperBatteryGuages detects batteries on the system and returns a
+// CreeperBatteryGuage for each of them, which may be combined with a
+// battery.MultiGuage.
+func NewCreeperBatteryGuages() ([]*CreeperBatteryGuage, error) {
 	batts, err := getBatteries()
 	if err != nil {
 		return nil, err
@@ -28,11 +41,24 @@ func NewCreeperBatteryGuage() (*CreeperBatteryGuage, error) {
 		return nil, fmt.Errorf("no batteries")
 	}
 
-	g := &CreeperBatteryGuage{
-		dev: batts[0],
+	// the power source is inferred from the battery state when there is no
+	// line power device.
+	var ac dbus.ObjectPath
+	acs, err := getLinePower()
+	if err != nil {
+		log.Printf("upower: line power: %v", err)
+	} else if len(acs) > 0 {
+		ac = acs[0]
 	}
 
-	return g, nil
+	guages := make([]*CreeperBatteryGuage, len(batts))
+	for i, batt := range batts {
+		guages[i] = &CreeperBatteryGuage{
+			dev: batt,
+			ac:  ac,
+		}
+	}
+	return guages, nil
 }
 
 // BatteryMetrics implements the BatteryGuage interface.
@@ -55,10 +81,34 @@ func (g *CreeperBatteryGuage) BatteryMetrics() (*battery.Metrics, error) {
 	}
 
 	m := &battery.Metrics{
-		State:      battery.State(state),
+		State:      upowerState(state),
 		Fraction:   percent / 100,
-		UntilEmpty: &untilEmpty,
-		UntilFull:  &untilFull,
+		UntilEmpty: remaining(untilEmpty),
+		UntilFull:  remaining(untilFull),
+	}
+
+	// not all batteries report their voltage or rate of energy flow, in which
+	// case they are left unknown.
+	voltage, _ := propFloat64(g.dev, "org.freedesktop.UPower.Voltage")
+	rate, _ := propFloat64(g.dev, "org.freedesktop.UPower.EnergyRate")
+	m.Voltage, m.Current = electrical(voltage, rate)
+	m.Power = power(rate, m.State)
+	m.EnergyFull, _ = propFloat64(g.dev, "org.freedesktop.UPower.EnergyFull")
+	m.Temperature, _ = propFloat64(g.dev, "org.freedesktop.UPower.Temperature")
+	capacity, _ := propFloat64(g.dev, "org.freedesktop.UPower.Capacity")
+	m.Health = math.Min(capacity/100, 1)
+
+	// the icon is optional and older versions of upower do not provide it.
+	m.IconName, _ = propString(g.dev, "org.freedesktop.UPower.IconName")
+
+	if g.ac != "" {
+		online, err := propBool(g.ac, "org.freedesktop.UPower.Online")
+		if err != nil {
+			return nil, fmt.Errorf("online: %v", err)
+		}
+		m.OnAC = &online
+	} else {
+		m.OnAC = battery.InferOnAC(m.State)
 	}
 
 	return m, nil
@@ -68,17 +118,10 @@ func (g *CreeperBatteryGuage) BatteryMetrics() (*battery.Metrics, error) {
 func (g *CreeperBatteryGuage) BatteryStateChange(notf chan<- struct{}) (stop func()) {
 	_done := make(chan struct{})
 
-	if g.sig == nil {
-		sig, err := device.SignalChanged()
-		if err != nil {
-			close(notf)
-			return func() {}
-		}
-		g.sig = sig
-	}
-
+	// the subscription is made by the goroutine so that upower being
+	// unavailable at startup is retried like a lost connection.
 	go func() {
-		if !g.reconnect() {
+		if !g.reconnect(_done) {
 			return
 		}
 		var relay chan<- struct{}
@@ -88,7 +131,7 @@ func (g *CreeperBatteryGuage) BatteryStateChange(notf chan<- struct{}) (stop fun
 				if !ok {
 					log.Printf("upower: state channel closed")
 
-					if g.reconnect() {
+					if g.reconnect(_done) {
 						continue
 					}
 					return
@@ -108,14 +151,107 @@ func (g *CreeperBatteryGuage) BatteryStateChange(notf chan<- struct{}) (stop fun
 	return func() { close(_done) }
 }
 
-func (g *CreeperBatteryGuage) reconnect() (ok bool) {
-	var err error
-	g.sig, err = device.SignalChanged()
-	if err != nil {
-		log.Printf("upower: %v", err)
-		return false
+// Delays between attempts to reconnect to upower double from minBackoff up to
+// maxBackoff.
+const (
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+// signalChanged subscribes to upower device signals.
+var signalChanged = device.SignalChanged
+
+// reconnect subscribes to upower device signals, retrying with exponential
+// backoff while upower is unavailable.  reconnect returns false if done is
+// closed before it succeeds.
+func (g *CreeperBatteryGuage) reconnect(done <-chan struct{}) (ok bool) {
+	return retry(done, minBackoff, maxBackoff, time.After, func() error {
+		sig, err := signalChanged()
+		if err != nil {
+			return err
+		}
+		g.sig = sig
+		return nil
+	})
+}
+
+// retry calls connect until it succeeds.  After each failure, which is logged,
+// retry waits for a delay that starts at min and doubles up to max.  Delays
+// are timed with after.  retry returns false if done is closed while waiting.
+func retry(done <-chan struct{}, min, max time.Duration, after func(time.Duration) <-chan time.Time, connect func() error) bool {
+	delay := min
+	for {
+		err := connect()
+		if err == nil {
+			return true
+		}
+		log.Printf("upower: %v (retrying in %v)", err, delay)
+		select {
+		case <-after(delay):
+		case <-done:
+			return false
+		}
+		delay *= 2
+		if delay > max {
+			delay = max
+		}
 	}
-	return true
+}
+
+// upowerState returns the battery.State corresponding to the upower device
+// state x.  Upower reports a battery held at a charge threshold as "pending
+// charge".
+func upowerState(x uint32) battery.State {
+	switch x {
+	case 0:
+		return battery.Unknown
+	case 1:
+		return battery.Charging
+	case 2:
+		return battery.Discharging
+	case 3:
+		return battery.Empty
+	case 4:
+		return battery.FullyCharged
+	case 5:
+		return battery.PendingCharge
+	case 6:
+		return battery.PendingDischarge
+	default:
+		return battery.Unknown
+	}
+}
+
+// electrical returns the voltage and current of a battery with the given
+// voltage and rate of energy flow in watts, as reported by upower.  Upower
+// reports unknown values as zero, which are returned as nil.  The current is
+// unknown when the voltage is.
+func electrical(voltage, rate float64) (v, i *float64) {
+	if voltage <= 0 {
+		return nil, nil
+	}
+	current := rate / voltage
+	return &voltage, &current
+}
+
+// remaining returns the time remaining until a battery is empty or full, as
+// reported by upower.  Upower reports an unknown time as zero, which is
+// returned as nil.
+func remaining(d time.Duration) *time.Duration {
+	if d <= 0 {
+		return nil
+	}
+	return &d
+}
+
+// power returns the power flowing out of a battery in the given state with the
+// given rate of energy flow in watts, as reported by upower.  Upower reports
+// the rate without a sign so it is negated while charging.
+func power(rate float64, state battery.State) float64 {
+	if state == battery.Charging {
+		return -rate
+	}
+	return rate
 }
 
 func getBatteries() ([]dbus.ObjectPath, error) {
@@ -132,14 +268,56 @@ func getBatteries() ([]dbus.ObjectPath, error) {
 	return batts, nil
 }
 
+func getLinePower() ([]dbus.ObjectPath, error) {
+	devs, err := upower.EnumerateDevices()
+	if err != nil {
+		return nil, err
+	}
+	var acs []dbus.ObjectPath
+	for _, dev := range devs {
+		if isDeviceType(dev, device.LinePower) {
+			acs = append(acs, dev)
+		}
+	}
+	return acs, nil
+}
+
 func isBattery(path dbus.ObjectPath) bool {
+	return isDeviceType(path, device.Battery)
+}
+
+func isDeviceType(path dbus.ObjectPath, typ uint32) bool {
 	log.Print(path)
 	x, err := propUint32(path, "org.freedesktop.UPower.Type")
 	if err != nil {
 		log.Print(err)
 		return false
 	}
-	return x == device.Battery
+	return x == typ
+}
+
+func propBool(path dbus.ObjectPath, prop string) (bool, error) {
+	v, err := device.GetProperty(path, prop)
+	if err != nil {
+		return false, err
+	}
+	x, ok := v.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("not bool")
+	}
+	return x, nil
+}
+
+func propString(path dbus.ObjectPath, prop string) (string, error) {
+	v, err := device.GetProperty(path, prop)
+	if err != nil {
+		return "", err
+	}
+	x, ok := v.Value().(string)
+	if !ok {
+		return "", fmt.Errorf("not string")
+	}
+	return x, nil
 }
 
 func propFloat64(path dbus.ObjectPath, prop string) (float64, error) {
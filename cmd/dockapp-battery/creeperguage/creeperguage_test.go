@@ -0,0 +1,204 @@
+package creeperguage
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/battery"
+	"github.com/godbus/dbus"
+)
+
+func TestUpowerState(t *testing.T) {
+	for i, test := range []struct {
+		x     uint32
+		state battery.State
+	}{
+		{1, battery.Charging},
+		{2, battery.Discharging},
+		{3, battery.Empty},
+		{4, battery.FullyCharged},
+		{5, battery.PendingCharge},
+		{6, battery.PendingDischarge},
+		{0, battery.Unknown},
+		{7, battery.Unknown},
+	} {
+		state := upowerState(test.x)
+		if state != test.state {
+			t.Errorf("test %d: %v (expected %v)", i, state, test.state)
+		}
+	}
+}
+
+func TestElectrical(t *testing.T) {
+	for i, test := range []struct {
+		voltage float64
+		rate    float64
+		v       *float64
+		i       *float64
+	}{
+		{12, 6, floatPtr(12), floatPtr(0.5)},
+		{12, 0, floatPtr(12), floatPtr(0)},
+		{0, 6, nil, nil},
+		{0, 0, nil, nil},
+	} {
+		v, c := electrical(test.voltage, test.rate)
+		if !floatEq(v, test.v) {
+			t.Errorf("test %d: voltage %v (expected %v)", i, v, test.v)
+		}
+		if !floatEq(c, test.i) {
+			t.Errorf("test %d: current %v (expected %v)", i, c, test.i)
+		}
+	}
+}
+
+func TestPower(t *testing.T) {
+	for i, test := range []struct {
+		rate  float64
+		state battery.State
+		power float64
+	}{
+		{6, battery.Discharging, 6},
+		{6, battery.Charging, -6},
+		{0, battery.Charging, 0},
+		{0, battery.FullyCharged, 0},
+	} {
+		p := power(test.rate, test.state)
+		if p != test.power {
+			t.Errorf("test %d: power %v (expected %v)", i, p, test.power)
+		}
+	}
+}
+
+func TestRemaining(t *testing.T) {
+	for i, test := range []struct {
+		d      time.Duration
+		remain *time.Duration
+	}{
+		{2 * time.Hour, durPtr(2 * time.Hour)},
+		{time.Second, durPtr(time.Second)},
+		{0, nil},
+	} {
+		remain := remaining(test.d)
+		if (remain == nil) != (test.remain == nil) || remain != nil && *remain != *test.remain {
+			t.Errorf("test %d: %v (expected %v)", i, remain, test.remain)
+		}
+	}
+}
+
+func durPtr(d time.Duration) *time.Duration {
+	return &d
+}
+
+func floatPtr(x float64) *float64 {
+	return &x
+}
+
+func floatEq(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func TestRetry(t *testing.T) {
+	for i, test := range []struct {
+		min      time.Duration
+		failures int
+		delays   []time.Duration
+	}{
+		{100 * time.Millisecond, 0, nil},
+		{100 * time.Millisecond, 1, []time.Duration{100 * time.Millisecond}},
+		{100 * time.Millisecond, 4, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond}},
+		{time.Second, 5, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}},
+	} {
+		var delays []time.Duration
+		after := func(d time.Duration) <-chan time.Time {
+			delays = append(delays, d)
+			c := make(chan time.Time, 1)
+			c <- time.Time{}
+			return c
+		}
+		var calls int
+		connect := func() error {
+			calls++
+			if calls <= test.failures {
+				return fmt.Errorf("upower unavailable")
+			}
+			return nil
+		}
+		if !retry(nil, test.min, 5*time.Second, after, connect) {
+			t.Errorf("test %d: retry failed", i)
+		}
+		if calls != test.failures+1 {
+			t.Errorf("test %d: %d calls (expected %d)", i, calls, test.failures+1)
+		}
+		if !reflect.DeepEqual(delays, test.delays) {
+			t.Errorf("test %d: delays %v (expected %v)", i, delays, test.delays)
+		}
+	}
+}
+
+func TestRetry_done(t *testing.T) {
+	done := make(chan struct{})
+	after := func(d time.Duration) <-chan time.Time {
+		// the delay never elapses so retry returns only when done is
+		// closed.
+		close(done)
+		return nil
+	}
+	connect := func() error { return fmt.Errorf("upower unavailable") }
+	result := make(chan bool, 1)
+	go func() { result <- retry(done, minBackoff, maxBackoff, after, connect) }()
+	select {
+	case ok := <-result:
+		if ok {
+			t.Errorf("retry succeeded")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("retry did not return when done was closed")
+	}
+}
+
+func TestCreeperBatteryGuage_BatteryStateChange(t *testing.T) {
+	defer func(fn func() (chan *dbus.Signal, error)) { signalChanged = fn }(signalChanged)
+	sig := make(chan *dbus.Signal, 1)
+	calls := make(chan int, 2)
+	var n int
+	signalChanged = func() (chan *dbus.Signal, error) {
+		n++
+		calls <- n
+		if n == 1 {
+			return nil, fmt.Errorf("upower unavailable")
+		}
+		return sig, nil
+	}
+
+	g := &CreeperBatteryGuage{dev: "/battery"}
+	notf := make(chan struct{})
+	stop := g.BatteryStateChange(notf)
+	defer stop()
+
+	for i := 1; i <= 2; i++ {
+		select {
+		case <-calls:
+		case <-time.After(time.Second):
+			t.Fatalf("subscription %d not attempted", i)
+		}
+	}
+	sig <- &dbus.Signal{Path: "/battery"}
+	select {
+	case _, ok := <-notf:
+		if !ok {
+			t.Fatalf("notification channel closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no notification")
+	}
+	select {
+	case <-calls:
+		t.Errorf("extra subscription")
+	default:
+	}
+}
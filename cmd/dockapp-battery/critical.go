@@ -0,0 +1,174 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/battery"
+)
+
+// CriticalAction runs a command, like suspending the system, when a
+// discharging battery reaches a critical level.  The command runs at most once
+// each time the battery discharges, after a confirmation window during which
+// the action may be canceled.  Connecting line power rearms the action and
+// cancels an action awaiting confirmation.
+type CriticalAction struct {
+	// Fraction is the level of charge at or below which the action is
+	// taken.
+	Fraction float64
+
+	// Command is the name and arguments of the command run.
+	Command []string
+
+	// Confirm is the time the action waits for Cancel before running
+	// Command.
+	Confirm time.Duration
+
+	// If Changed is not nil it is called when the action begins or stops
+	// waiting for confirmation, so that its Notice can be displayed.
+	Changed func()
+
+	clock battery.Clock
+	run   func(name string, args ...string) ([]byte, error)
+	logf  func(format string, v ...interface{})
+
+	mut     sync.Mutex
+	fired   bool          // the action has been taken this discharge cycle
+	pending chan struct{} // closed to cancel the action awaiting confirmation
+}
+
+// NewCriticalAction returns a CriticalAction that runs command once the
+// battery discharges to fraction.
+func NewCriticalAction(fraction float64, command []string, confirm time.Duration, logf func(format string, v ...interface{})) *CriticalAction {
+	return &CriticalAction{
+		Fraction: fraction,
+		Command:  command,
+		Confirm:  confirm,
+		clock:    battery.SystemClock,
+		run:      runCommand,
+		logf:     logf,
+	}
+}
+
+// runCommand runs the named command and returns its combined output.
+func runCommand(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).CombinedOutput()
+}
+
+// Update examines m and begins waiting for confirmation if the battery has
+// discharged to a critical level for the first time since it was last
+// charging.
+func (a *CriticalAction) Update(m *battery.Metrics) {
+	if m == nil {
+		return
+	}
+	onAC := m.OnAC
+	if onAC == nil {
+		onAC = battery.InferOnAC(m.State)
+	}
+
+	a.mut.Lock()
+	changed := a.update(m, onAC)
+	a.mut.Unlock()
+	if changed {
+		a.changed()
+	}
+}
+
+// update is called by Update holding a.mut and returns true if the action
+// began or stopped awaiting confirmation.
+func (a *CriticalAction) update(m *battery.Metrics, onAC *bool) bool {
+	if onAC != nil && *onAC {
+		a.fired = false
+		if a.pending == nil {
+			return false
+		}
+		a.logf("critical: line power connected, %q canceled", a.commandString())
+		a.stop()
+		return true
+	}
+	if a.fired || m.State != battery.Discharging || m.Fraction > a.Fraction {
+		return false
+	}
+	a.fired = true
+	a.pending = make(chan struct{})
+	a.logf("critical: battery at %.1f%%, running %q in %v unless canceled", m.Fraction*100, a.commandString(), a.Confirm)
+	go a.confirm(a.pending, a.clock.After(a.Confirm))
+	return true
+}
+
+// confirm runs the command when timeout fires unless cancel is closed first.
+func (a *CriticalAction) confirm(cancel chan struct{}, timeout <-chan time.Time) {
+	select {
+	case <-cancel:
+		return
+	case <-timeout:
+	}
+
+	a.mut.Lock()
+	select {
+	case <-cancel:
+		// canceled while the timer fired.
+		a.mut.Unlock()
+		return
+	default:
+	}
+	a.pending = nil
+	a.mut.Unlock()
+	a.changed()
+
+	a.logf("critical: running %q", a.commandString())
+	out, err := a.run(a.Command[0], a.Command[1:]...)
+	if err != nil {
+		a.logf("critical: %q failed: %v %q", a.commandString(), err, strings.TrimSpace(string(out)))
+		return
+	}
+	a.logf("critical: %q succeeded", a.commandString())
+}
+
+// Cancel cancels an action that is awaiting confirmation.  The action is not
+// taken again until the battery has been charging.  Cancel returns false if
+// no action was awaiting confirmation.
+func (a *CriticalAction) Cancel() bool {
+	a.mut.Lock()
+	pending := a.pending != nil
+	if pending {
+		a.logf("critical: %q canceled", a.commandString())
+		a.stop()
+	}
+	a.mut.Unlock()
+	if pending {
+		a.changed()
+	}
+	return pending
+}
+
+// stop cancels the pending action.  The caller must hold a.mut.
+func (a *CriticalAction) stop() {
+	close(a.pending)
+	a.pending = nil
+}
+
+// Notice returns a message to display while the action awaits confirmation,
+// or an empty string.
+func (a *CriticalAction) Notice() string {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+	if a.pending == nil {
+		return ""
+	}
+	return filepath.Base(a.Command[len(a.Command)-1]) + "?"
+}
+
+func (a *CriticalAction) changed() {
+	if a.Changed != nil {
+		a.Changed()
+	}
+}
+
+func (a *CriticalAction) commandString() string {
+	return strings.Join(a.Command, " ")
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/battery"
+)
+
+func TestCriticalAction(t *testing.T) {
+	const confirm = 30 * time.Second
+	clock := &fakeClock{now: time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)}
+	ran := make(chan string, 10)
+	var changed int
+	a := NewCriticalAction(0.05, []string{"systemctl", "suspend"}, confirm, func(format string, v ...interface{}) {
+		t.Logf(format, v...)
+	})
+	a.clock = clock
+	a.run = func(name string, args ...string) ([]byte, error) {
+		ran <- strings.Join(append([]string{name}, args...), " ")
+		return nil, fmt.Errorf("exit status 1")
+	}
+	a.Changed = func() { changed++ }
+
+	onAC := true
+	for i, test := range []struct {
+		m       *battery.Metrics
+		cancel  bool
+		advance bool
+		notice  string
+		ran     bool
+		changed int
+	}{
+		{m: testMetrics(0.5, battery.Discharging)},
+		{m: testMetrics(0.05, battery.Discharging), notice: "suspend?", changed: 1},
+		{advance: true, ran: true, changed: 2},
+		{m: testMetrics(0.04, battery.Discharging), changed: 2}, // once per cycle
+		{m: testMetrics(0.04, battery.Unknown), changed: 2},     // not rearmed
+		{m: testMetrics(0.04, battery.Discharging), changed: 2}, // still once
+		{m: testMetrics(0.06, battery.Charging), changed: 2},    // rearmed
+		{m: testMetrics(0.05, battery.Discharging), notice: "suspend?", changed: 3},
+		{cancel: true, changed: 4},
+		{advance: true, changed: 4},
+		{m: testMetrics(0.03, battery.Discharging), changed: 4},
+		{m: &battery.Metrics{Fraction: 0.03, State: battery.Unknown, OnAC: &onAC}, changed: 4},
+		{m: testMetrics(0.02, battery.Discharging), notice: "suspend?", changed: 5},
+		{m: testMetrics(0.02, battery.PendingCharge), changed: 6}, // plugged in
+		{advance: true, changed: 6},
+		{m: testMetrics(0.02, battery.Empty), changed: 6}, // not discharging
+	} {
+		if test.m != nil {
+			a.Update(test.m)
+		}
+		if test.cancel && !a.Cancel() {
+			t.Errorf("test %d: nothing canceled", i)
+		}
+		if test.advance {
+			clock.Advance(confirm)
+		}
+		if test.ran {
+			select {
+			case cmd := <-ran:
+				if cmd != "systemctl suspend" {
+					t.Errorf("test %d: ran %q", i, cmd)
+				}
+			case <-time.After(time.Second):
+				t.Errorf("test %d: command not run", i)
+			}
+		} else {
+			select {
+			case cmd := <-ran:
+				t.Errorf("test %d: unexpected command %q", i, cmd)
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		if notice := a.Notice(); notice != test.notice {
+			t.Errorf("test %d: notice %q (expected %q)", i, notice, test.notice)
+		}
+		if changed != test.changed {
+			t.Errorf("test %d: changed %d times (expected %d)", i, changed, test.changed)
+		}
+	}
+	if a.Cancel() {
+		t.Errorf("canceled with nothing pending")
+	}
+}
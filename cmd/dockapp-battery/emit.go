@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/battery"
+)
+
+// emitFormats are the formats accepted by the -emit flag.
+var emitFormats = map[string]func(io.Writer, <-chan *battery.Metrics) error{
+	"json": emitJSON,
+}
+
+// parseEmit returns the emitter for the format named by s.  An empty format
+// emits nothing and a nil emitter is returned.
+func parseEmit(s string) (func(io.Writer, <-chan *battery.Metrics) error, error) {
+	if s == "" {
+		return nil, nil
+	}
+	emit, ok := emitFormats[s]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q", s)
+	}
+	return emit, nil
+}
+
+// emitJSON writes each metrics received from c to w as a line of JSON until c
+// is closed.
+func emitJSON(w io.Writer, c <-chan *battery.Metrics) error {
+	enc := json.NewEncoder(w)
+	for m := range c {
+		err := enc.Encode(m)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/battery"
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/execguage"
+)
+
+func TestEmitJSON(t *testing.T) {
+	untilEmpty := 2*time.Hour + 30*time.Minute
+	c := make(chan *battery.Metrics, 2)
+	c <- &battery.Metrics{Fraction: 0.85, State: battery.Discharging, UntilEmpty: &untilEmpty}
+	c <- &battery.Metrics{Fraction: 1, State: battery.FullyCharged}
+	close(c)
+	var buf bytes.Buffer
+	err := emitJSON(&buf, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("%d lines emitted: %q", len(lines), buf.String())
+	}
+
+	// emitted lines are read by the exec backend.
+	for i, test := range []struct {
+		fraction float64
+		state    battery.State
+	}{
+		{0.85, battery.Discharging},
+		{1, battery.FullyCharged},
+	} {
+		m, err := execguage.ParseMetrics([]byte(lines[i]))
+		if err != nil {
+			t.Errorf("line %d: %v", i, err)
+			continue
+		}
+		if m.Fraction != test.fraction || m.State != test.state {
+			t.Errorf("line %d: %v (expected %v %v)", i, m, test.fraction, test.state)
+		}
+	}
+}
+
+func TestParseEmit(t *testing.T) {
+	for i, test := range []struct {
+		s    string
+		emit bool
+		err  bool
+	}{
+		{"", false, false},
+		{"json", true, false},
+		{"xml", false, true},
+	} {
+		emit, err := parseEmit(test.s)
+		if (err != nil) != test.err {
+			t.Errorf("test %d: err %v (expected error %v)", i, err, test.err)
+			continue
+		}
+		if (emit != nil) != test.emit {
+			t.Errorf("test %d: emitter %v (expected %v)", i, emit != nil, test.emit)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+/*
+Package execguage provides a battery.Guage that reads metrics printed by an
+external command, so that batteries which cannot be read through upower can be
+displayed without writing Go.
+
+The command prints a JSON object on its own line each time it measures the
+battery.  Only the fraction is required.  Times are given in seconds and the
+state is one of the names of battery.State, case insensitively, or "full".
+
+	{"fraction": 0.85, "state": "Discharging", "until_empty": 9000, "until_full": null}
+*/
+package execguage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/battery"
+)
+
+// ExternalGuage is a battery.Guage that runs a command and reports the last
+// metrics it printed.  The command is restarted when it exits.  Lines which
+// cannot be parsed are logged and ignored.
+type ExternalGuage struct {
+	// RestartDelay is the time waited before restarting the command after
+	// it exits.  RestartDelay must be set before Start is called.
+	RestartDelay time.Duration
+
+	name string
+	args []string
+	logf func(format string, v ...interface{})
+
+	stop    chan struct{}
+	stopped sync.Once
+	done    chan struct{}
+
+	mut     sync.Mutex
+	started bool
+	cmd     *exec.Cmd
+	metrics *battery.Metrics
+	err     error
+	notify  chan<- struct{}
+}
+
+// New returns an ExternalGuage that runs the named command with the given
+// arguments once Start is called.
+func New(name string, args ...string) *ExternalGuage {
+	return &ExternalGuage{
+		RestartDelay: 5 * time.Second,
+		name:         name,
+		args:         args,
+		logf:         log.Printf,
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+		err:          fmt.Errorf("exec: no metrics received"),
+	}
+}
+
+// Start runs the command and returns any error starting it.  If the command
+// starts it is restarted each time it exits until Stop is called.
+func (g *ExternalGuage) Start() error {
+	g.mut.Lock()
+	g.started = true
+	g.mut.Unlock()
+	wait, err := g.startCommand()
+	if err != nil {
+		close(g.done)
+		return err
+	}
+	go g.loop(wait)
+	return nil
+}
+
+// Stop kills the command and prevents it from being restarted.  Stop waits
+// for the command to exit and may be called more than once.
+func (g *ExternalGuage) Stop() {
+	g.stopped.Do(func() { close(g.stop) })
+	g.mut.Lock()
+	started := g.started
+	if g.cmd != nil {
+		g.cmd.Process.Kill()
+	}
+	g.mut.Unlock()
+	if started {
+		<-g.done
+	}
+}
+
+func (g *ExternalGuage) loop(wait func() error) {
+	defer close(g.done)
+	for {
+		err := wait()
+		g.mut.Lock()
+		g.cmd = nil
+		g.metrics = nil
+		g.err = fmt.Errorf("exec: %s exited: %v", g.name, err)
+		g.mut.Unlock()
+
+		select {
+		case <-g.stop:
+			return
+		default:
+		}
+		g.logf("exec: %s exited (%v), restarting in %v", g.name, err, g.RestartDelay)
+
+		for {
+			select {
+			case <-g.stop:
+				return
+			case <-time.After(g.RestartDelay):
+			}
+			wait, err = g.startCommand()
+			if err == nil {
+				break
+			}
+			g.logf("exec: %v", err)
+		}
+	}
+}
+
+// startCommand starts the command and returns a function that reads its
+// output until it exits.
+func (g *ExternalGuage) startCommand() (wait func() error, err error) {
+	cmd := exec.Command(g.name, g.args...)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	// the command must not start once Stop has killed the previous one.
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	select {
+	case <-g.stop:
+		return nil, fmt.Errorf("exec: stopped")
+	default:
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("exec: %v", err)
+	}
+	g.cmd = cmd
+
+	wait = func() error {
+		scanner := bufio.NewScanner(stdout)
+		for n := 1; scanner.Scan(); n++ {
+			m, err := ParseMetrics(scanner.Bytes())
+			if err != nil {
+				g.logf("exec: %s: line %d: %v", g.name, n, err)
+				continue
+			}
+			g.setMetrics(m)
+		}
+		return cmd.Wait()
+	}
+	return wait, nil
+}
+
+func (g *ExternalGuage) setMetrics(m *battery.Metrics) {
+	g.mut.Lock()
+	g.metrics = m
+	g.err = nil
+	notify := g.notify
+	g.mut.Unlock()
+	if notify != nil {
+		select {
+		case notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// BatteryMetrics implements the battery.Guage interface.  BatteryMetrics
+// returns an error if the command has not printed metrics since it was last
+// started.
+func (g *ExternalGuage) BatteryMetrics() (*battery.Metrics, error) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	return g.metrics, g.err
+}
+
+// BatteryStateChange implements the battery.StateNotifier interface.  A
+// notification is sent each time the command prints metrics, unless the
+// previous notification has not been received.
+func (g *ExternalGuage) BatteryStateChange(notf chan<- struct{}) (stop func()) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	g.notify = notf
+	return func() {
+		g.mut.Lock()
+		defer g.mut.Unlock()
+		g.notify = nil
+	}
+}
+
+// record is a line of output from the command.
+type record struct {
+	Fraction   *float64 `json:"fraction"`
+	State      string   `json:"state"`
+	UntilEmpty *float64 `json:"until_empty"`
+	UntilFull  *float64 `json:"until_full"`
+	OnAC       *bool    `json:"on_ac"`
+}
+
+// ParseMetrics parses a line of JSON output from a command.
+func ParseMetrics(line []byte) (*battery.Metrics, error) {
+	var r record
+	err := json.Unmarshal(line, &r)
+	if err != nil {
+		return nil, err
+	}
+	if r.Fraction == nil {
+		return nil, fmt.Errorf("missing fraction")
+	}
+	if *r.Fraction < 0 || *r.Fraction > 1 {
+		return nil, fmt.Errorf("fraction %v is not in the range [0, 1]", *r.Fraction)
+	}
+	state, err := parseState(r.State)
+	if err != nil {
+		return nil, err
+	}
+	m := &battery.Metrics{
+		Fraction:   *r.Fraction,
+		State:      state,
+		UntilEmpty: seconds(r.UntilEmpty),
+		UntilFull:  seconds(r.UntilFull),
+		OnAC:       r.OnAC,
+	}
+	if m.OnAC == nil {
+		m.OnAC = battery.InferOnAC(m.State)
+	}
+	return m, nil
+}
+
+// parseState returns the battery.State named by s.  An empty string is
+// Unknown.
+func parseState(s string) (battery.State, error) {
+	if s == "" {
+		return battery.Unknown, nil
+	}
+	if strings.EqualFold(s, "full") {
+		return battery.FullyCharged, nil
+	}
+	var state battery.State
+	err := state.UnmarshalText([]byte(s))
+	return state, err
+}
+
+// seconds returns a duration of s seconds, or nil if s is nil or not
+// positive.
+func seconds(s *float64) *time.Duration {
+	if s == nil || *s <= 0 {
+		return nil
+	}
+	d := time.Duration(*s * float64(time.Second))
+	return &d
+}
@@ -0,0 +1,203 @@
+package execguage
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/battery"
+)
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func durPtr(d time.Duration) *time.Duration {
+	return &d
+}
+
+func TestParseMetrics(t *testing.T) {
+	for i, test := range []struct {
+		line string
+		m    *battery.Metrics
+	}{
+		{`{"fraction": 0.85, "state": "Discharging", "until_empty": 9000, "until_full": null}`, &battery.Metrics{
+			Fraction:   0.85,
+			State:      battery.Discharging,
+			UntilEmpty: durPtr(150 * time.Minute),
+			OnAC:       boolPtr(false),
+		}},
+		{`{"fraction": 0.5, "state": "charging", "until_full": 90.5}`, &battery.Metrics{
+			Fraction:  0.5,
+			State:     battery.Charging,
+			UntilFull: durPtr(90*time.Second + 500*time.Millisecond),
+			OnAC:      boolPtr(true),
+		}},
+		{`{"fraction": 1, "state": "full", "until_empty": 0}`, &battery.Metrics{
+			Fraction: 1,
+			State:    battery.FullyCharged,
+			OnAC:     boolPtr(true),
+		}},
+		{`{"fraction": 0.2, "on_ac": true}`, &battery.Metrics{
+			Fraction: 0.2,
+			State:    battery.Unknown,
+			OnAC:     boolPtr(true),
+		}},
+		{`{"fraction": 0.2, "state": "PendingDischarge"}`, &battery.Metrics{
+			Fraction: 0.2,
+			State:    battery.PendingDischarge,
+		}},
+		{`{"state": "Charging"}`, nil},
+		{`{"fraction": 1.5}`, nil},
+		{`{"fraction": -0.1}`, nil},
+		{`{"fraction": 0.5, "state": "Exploding"}`, nil},
+		{`{"fraction": "85%"}`, nil},
+		{`85%`, nil},
+		{``, nil},
+	} {
+		m, err := ParseMetrics([]byte(test.line))
+		if test.m == nil {
+			if err == nil {
+				t.Errorf("test %d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(m, test.m) {
+			t.Errorf("test %d: %v (expected %v)", i, m, test.m)
+		}
+	}
+}
+
+// TestHelperProcess is not a real test.  It is run as the command of an
+// ExternalGuage, printing each argument following "--" on its own line and
+// sleeping if the last argument is "sleep".
+func TestHelperProcess(t *testing.T) {
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return
+	}
+	defer os.Exit(0)
+	for _, arg := range args[1:] {
+		if arg == "sleep" {
+			time.Sleep(time.Hour)
+		}
+		fmt.Println(arg)
+	}
+}
+
+// helperGuage returns an ExternalGuage that runs TestHelperProcess with the
+// given lines.
+func helperGuage(t *testing.T, lines ...string) (g *ExternalGuage, logs chan string) {
+	args := append([]string{"-test.run=TestHelperProcess", "--"}, lines...)
+	g = New(os.Args[0], args...)
+	logs = make(chan string, 100)
+	g.logf = func(format string, v ...interface{}) {
+		logs <- fmt.Sprintf(format, v...)
+	}
+	return g, logs
+}
+
+// waitFraction waits for notifications from g until its metrics have the
+// given fraction.
+func waitFraction(t *testing.T, g *ExternalGuage, notf <-chan struct{}, fraction float64) {
+	timeout := time.After(5 * time.Second)
+	for {
+		m, _ := g.BatteryMetrics()
+		if m != nil && m.Fraction == fraction {
+			return
+		}
+		select {
+		case <-notf:
+		case <-timeout:
+			t.Fatalf("fraction %v not received", fraction)
+		}
+	}
+}
+
+func TestExternalGuage(t *testing.T) {
+	g, logs := helperGuage(t,
+		`{"fraction": 0.5, "state": "Discharging"}`,
+		`garbage`,
+		`{"fraction": 0.4, "state": "Discharging"}`,
+		"sleep",
+	)
+	_, err := g.BatteryMetrics()
+	if err == nil {
+		t.Errorf("metrics before start")
+	}
+	notf := make(chan struct{}, 1)
+	stop := g.BatteryStateChange(notf)
+	defer stop()
+	err = g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case s := <-logs:
+		if s != fmt.Sprintf("exec: %s: line 2: invalid character 'g' looking for beginning of value", g.name) {
+			t.Errorf("log: %q", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("malformed line not logged")
+	}
+	waitFraction(t, g, notf, 0.4)
+
+	done := make(chan struct{})
+	go func() {
+		g.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("stop did not return")
+	}
+	g.Stop()
+	select {
+	case s := <-logs:
+		t.Errorf("unexpected log: %q", s)
+	default:
+	}
+}
+
+func TestExternalGuage_restart(t *testing.T) {
+	g, logs := helperGuage(t, `{"fraction": 0.5, "state": "Charging"}`)
+	g.RestartDelay = 10 * time.Millisecond
+	notf := make(chan struct{}, 1)
+	g.BatteryStateChange(notf)
+	err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Stop()
+	for i := 0; i < 3; i++ {
+		select {
+		case <-notf:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("restart %d: no metrics received", i)
+		}
+		select {
+		case <-logs:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("restart %d: exit not logged", i)
+		}
+	}
+}
+
+func TestExternalGuage_notFound(t *testing.T) {
+	g := New("/nonexistent/dockapp-battery-guage")
+	err := g.Start()
+	if err == nil {
+		t.Errorf("expected error")
+	}
+	g.Stop()
+}
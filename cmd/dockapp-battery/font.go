@@ -1,17 +1,23 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/golang/freetype"
 	"github.com/golang/freetype/truetype"
 	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
 )
 
 // ReadFaceFile parses the contents of path as a truetype font.
@@ -24,17 +30,40 @@ func ReadFaceFile(path string, opt *truetype.Options) (font.Face, error) {
 	return face, nil
 }
 
-// ReadFontFile parses the contents of path as a truetype font.
+// ReadFontFile parses the contents of path as a truetype font.  The path must
+// have a ".ttf", ".ttf.gz" or ".otf" extension.  OpenType fonts must have
+// truetype outlines.
 func ReadFontFile(path string) (*truetype.Font, error) {
-	if ext := filepath.Ext(path); ext != ".ttf" {
-		return nil, fmt.Errorf("cannot %s file as a font", ext)
+	if !strings.HasSuffix(path, ".ttf") && !strings.HasSuffix(path, ".ttf.gz") && !strings.HasSuffix(path, ".otf") {
+		return nil, fmt.Errorf("cannot %s file as a font", filepath.Ext(path))
 	}
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
-	return ReadFont(f)
+	ttf, err := ReadFont(f)
+	if err != nil && strings.HasSuffix(path, ".otf") {
+		return nil, fmt.Errorf("%s: %v (only opentype fonts with truetype outlines are supported)", path, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return ttf, nil
+}
+
+// fontExts are the extensions of font files searched for in the font search
+// locations.
+var fontExts = []string{".ttf", ".otf"}
+
+// hasFontExt returns true if name ends in one of fontExts.
+func hasFontExt(name string) bool {
+	for _, ext := range fontExts {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
 }
 
 // ReadFace parses the data read from r as a truetype font.
@@ -47,17 +76,46 @@ func ReadFace(r io.Reader, opt *truetype.Options) (font.Face, error) {
 	return face, nil
 }
 
-// ReadFont parses the data read from r as a truetype font.
+// ReadFont parses the data read from r as a truetype font.  Gzip compressed
+// data is decompressed transparently.
 func ReadFont(r io.Reader) (*truetype.Font, error) {
 	ttfraw, err := ioutil.ReadAll(r)
 	if err != nil {
 		return nil, fmt.Errorf("read: %v", err)
 	}
+	if bytes.HasPrefix(ttfraw, gzipMagic) {
+		ttfraw, err = gunzip(ttfraw)
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %v", err)
+		}
+	}
 	font, err := freetype.ParseFont(ttfraw)
+	if err != nil {
+		return nil, fmt.Errorf("parse: %v", err)
+	}
+	return font, nil
+}
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+func gunzip(p []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(p))
 	if err != nil {
 		return nil, err
 	}
-	return font, err
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// DefaultFontName is the family and style name of the font embedded in the
+// program.
+const DefaultFontName = "Go Bold"
+
+// ReadDefaultFont parses the font embedded in the program, Go Bold from
+// golang.org/x/image/font/gofont.  The default font is available even when no
+// fonts are installed on the system.
+func ReadDefaultFont() (*truetype.Font, error) {
+	return ReadFont(bytes.NewReader(gobold.TTF))
 }
 
 // systemFontGlobs is a set of location glob prefixes used to search for fonts
@@ -66,13 +124,83 @@ var systemFontGlobs = []string{
 	"/usr/share/fonts/truetype/*", // Ubuntu 14.04, Debian???
 }
 
-// LocateFont does its best to locate truetype fonts on the local system.
-// LocateFont can accept absolute paths, full basenames, or (relative) glob
-// patterns.  Glob patterns passed to LocateFont are assumed to end in "*.ttf"
-// and the suffix may be omitted from the name argument.
+// fontGlobs returns the location glob prefixes used to search for fonts.  In
+// addition to systemFontGlobs the font directories of the XDG base directory
+// specification are searched.
+func fontGlobs() []string {
+	var dirs []string
+	datahome := os.Getenv("XDG_DATA_HOME")
+	home := os.Getenv("HOME")
+	if datahome == "" && home != "" {
+		datahome = filepath.Join(home, ".local/share")
+	}
+	if datahome != "" {
+		dirs = append(dirs, filepath.Join(datahome, "fonts"))
+	}
+	if home != "" {
+		dirs = append(dirs, filepath.Join(home, ".fonts"))
+	}
+	datadirs := os.Getenv("XDG_DATA_DIRS")
+	if datadirs == "" {
+		datadirs = "/usr/local/share:/usr/share"
+	}
+	for _, dir := range filepath.SplitList(datadirs) {
+		if dir != "" {
+			dirs = append(dirs, filepath.Join(dir, "fonts"))
+		}
+	}
+
+	globs := append([]string(nil), systemFontGlobs...)
+	for _, dir := range dirs {
+		globs = append(globs, dir, filepath.Join(dir, "*"))
+	}
+	return globs
+}
+
+// FontName returns a human readable name for ttf composed of its family and
+// style names (e.g. "DejaVu Sans Bold").
+func FontName(ttf *truetype.Font) string {
+	family := ttf.Name(truetype.NameIDFontFamily)
+	style := ttf.Name(truetype.NameIDFontSubfamily)
+	if style == "" || style == "Regular" {
+		return family
+	}
+	return family + " " + style
+}
+
+// ListFonts returns the paths of all truetype and opentype fonts found in the
+// font search locations.  The returned paths are sorted and unique.
+func ListFonts() []string {
+	seen := make(map[string]bool)
+	var paths []string
+	for _, base := range fontGlobs() {
+		for _, ext := range fontExts {
+			files, err := filepath.Glob(filepath.Join(base, "*"+ext))
+			if err != nil {
+				log.Printf("glob: %v", err)
+				continue
+			}
+			for _, file := range files {
+				if !seen[file] {
+					seen[file] = true
+					paths = append(paths, file)
+				}
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// LocateFont does its best to locate truetype and opentype fonts on the local
+// system.  LocateFont can accept absolute paths, full basenames, (relative)
+// glob patterns, or font names composed of a family and style.  Glob patterns
+// passed to LocateFont are assumed to end in "*.ttf" or "*.otf" and the suffix
+// may be omitted from the name argument.  Truetype fonts are preferred.
 //		LocateFont("/usr/share/fonts/truetype/freefont/FreeMonoBold.ttf")
 //		LocateFont("Ubuntu-B.ttf")
 //		LocateFont("DejaVuSans-Bold")
+//		LocateFont("DejaVu Sans Bold")
 func LocateFont(name string) (string, error) {
 	if filepath.IsAbs(name) {
 		_, err := os.Stat(name)
@@ -81,22 +209,251 @@ func LocateFont(name string) (string, error) {
 		}
 		return name, nil
 	}
-	for _, base := range systemFontGlobs {
-		namepat := name
-		if !strings.HasSuffix(name, ".ttf") {
-			namepat += "*.ttf"
+	path, err := locateFontGlob(name)
+	if err == nil || !strings.Contains(name, " ") {
+		return path, err
+	}
+
+	// the name may be a family name or a family name followed by a style.
+	if path, ok := findFontByName(name, ""); ok {
+		return path, nil
+	}
+	if i := strings.LastIndex(name, " "); i >= 0 {
+		if path, ok := findFontByName(name[:i], name[i+1:]); ok {
+			return path, nil
 		}
-		pat := filepath.Join(base, namepat)
-		files, err := filepath.Glob(pat)
+	}
+	return "", err
+}
+
+// FontCache memoizes the fonts parsed from files, keyed by their absolute
+// path, so that a font used in several places is only read once.  FontCache
+// is safe to use from multiple goroutines.
+type FontCache struct {
+	mut   sync.Mutex
+	fonts map[string]*truetype.Font
+	read  func(path string) (*truetype.Font, error)
+}
+
+// NewFontCache returns an empty FontCache.
+func NewFontCache() *FontCache {
+	return &FontCache{
+		fonts: make(map[string]*truetype.Font),
+		read:  ReadFontFile,
+	}
+}
+
+// ReadFontFile is like the ReadFontFile function but returns the font parsed
+// when path was previously read.  Errors are not cached.
+func (c *FontCache) ReadFontFile(path string) (*truetype.Font, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if ttf, ok := c.fonts[abs]; ok {
+		return ttf, nil
+	}
+	ttf, err := c.read(abs)
+	if err != nil {
+		return nil, err
+	}
+	c.fonts[abs] = ttf
+	return ttf, nil
+}
+
+// LoadFont locates the named font with LocateFont, or LocateFontFC when
+// dockapp-battery uses fontconfig, and reads it through c.
+func (c *FontCache) LoadFont(name string) (*truetype.Font, error) {
+	path, err := locateFont(name)
+	if err != nil {
+		return nil, fmt.Errorf("%v %q", err, name)
+	}
+	return c.ReadFontFile(path)
+}
+
+// fontCache is the FontCache used by LoadFont.
+var fontCache = NewFontCache()
+
+// LoadFont locates and parses the named font, reading each font file at most
+// once.
+func LoadFont(name string) (*truetype.Font, error) {
+	return fontCache.LoadFont(name)
+}
+
+// locateFont is the function used by LoadFont to locate fonts.
+var locateFont = LocateFont
+
+// fcMatch is the fontconfig command used by LocateFontFC.
+var fcMatch = "fc-match"
+
+// LocateFontFC locates a font using fontconfig's fc-match command, which
+// accepts font names like "DejaVu Sans Bold" as well as fontconfig patterns
+// like "DejaVu Sans:bold".  If fc-match is not installed, fails, or does not
+// match a truetype or opentype font file LocateFontFC falls back to
+// LocateFont.
+func LocateFontFC(name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return LocateFont(name)
+	}
+	path, err := locateFontFC(name)
+	if err != nil {
+		log.Printf("fontconfig: %v", err)
+		return LocateFont(name)
+	}
+	return path, nil
+}
+
+// locateFontFC returns the file matched by fc-match for name.
+func locateFontFC(name string) (string, error) {
+	bin, err := exec.LookPath(fcMatch)
+	if err != nil {
+		return "", err
+	}
+	out, err := exec.Command(bin, "--format=%{file}", name).Output()
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", fcMatch, err)
+	}
+	path := strings.TrimSpace(string(out))
+	if !hasFontExt(path) {
+		return "", fmt.Errorf("%q matched unsupported font %q", name, path)
+	}
+	_, err = os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// LocateFontByName locates a font using the family and style names read from
+// the name table of each candidate font.  An empty style matches a font's
+// regular face.  If no font matches the family and style LocateFontByName
+// falls back to a LocateFont glob search using a file name derived from family
+// and style (e.g. "DejaVuSans-Bold").
+func LocateFontByName(family, style string) (string, error) {
+	if path, ok := findFontByName(family, style); ok {
+		return path, nil
+	}
+	stem := strings.Replace(family, " ", "", -1)
+	if style != "" {
+		stem += "-" + strings.Replace(style, " ", "", -1)
+	}
+	return locateFontGlob(stem)
+}
+
+// findFontByName returns the path of the font that best matches family and
+// style.  Fonts which match the family but not the style are only returned if
+// no font matches both.
+func findFontByName(family, style string) (path string, ok bool) {
+	return fontIndex.find(family, style)
+}
+
+// fontIndex is the index searched by findFontByName.
+var fontIndex = newFontNameIndex()
+
+// fontNameIndex holds the names of the fonts returned by ListFonts.  Font files
+// are read once, when a font is first located by name, instead of for every
+// lookup.
+type fontNameIndex struct {
+	once  sync.Once
+	read  func(path string) (*truetype.Font, error)
+	paths []string
+	names []fontNames
+}
+
+func newFontNameIndex() *fontNameIndex {
+	return &fontNameIndex{read: ReadFontFile}
+}
+
+func (idx *fontNameIndex) build() {
+	for _, file := range ListFonts() {
+		ttf, err := idx.read(file)
 		if err != nil {
-			log.Printf("glob: %v", err)
 			continue
 		}
-		if len(files) > 1 {
-			log.Printf("ambiguous font name: %q", name)
+		idx.paths = append(idx.paths, file)
+		idx.names = append(idx.names, readFontNames(ttf))
+	}
+}
+
+func (idx *fontNameIndex) find(family, style string) (path string, ok bool) {
+	idx.once.Do(idx.build)
+	var best int
+	for i, names := range idx.names {
+		score := names.match(family, style)
+		if score > best {
+			best = score
+			path = idx.paths[i]
+		}
+	}
+	return path, best > 0
+}
+
+// fontNames holds the family and style names of a font, followed by its
+// preferred family and style names.
+type fontNames [2]struct{ family, style string }
+
+func readFontNames(ttf *truetype.Font) fontNames {
+	var names fontNames
+	for i, ids := range [][2]truetype.NameID{
+		{truetype.NameIDFontFamily, truetype.NameIDFontSubfamily},
+		{truetype.NameIDPreferredFamily, truetype.NameIDPreferredSubfamily},
+	} {
+		names[i].family = ttf.Name(ids[0])
+		names[i].style = ttf.Name(ids[1])
+	}
+	return names
+}
+
+// match returns a score describing how well names match family and style.  A
+// score of zero means the family does not match.
+func (names fontNames) match(family, style string) int {
+	var score int
+	for _, name := range names {
+		if !strings.EqualFold(name.family, family) {
+			continue
+		}
+		if strings.EqualFold(name.style, style) || style == "" && isRegularStyle(name.style) {
+			return 2
+		}
+		score = 1
+	}
+	return score
+}
+
+func isRegularStyle(style string) bool {
+	switch strings.ToLower(style) {
+	case "", "regular", "book", "normal", "roman":
+		return true
+	}
+	return false
+}
+
+// locateFontGlob searches the font locations for files matching the glob
+// pattern name.
+func locateFontGlob(name string) (string, error) {
+	namepats := []string{name}
+	if !hasFontExt(name) {
+		namepats = nil
+		for _, ext := range fontExts {
+			namepats = append(namepats, name+"*"+ext)
 		}
-		if len(files) > 0 {
-			return files[0], nil
+	}
+	for _, base := range fontGlobs() {
+		for _, namepat := range namepats {
+			pat := filepath.Join(base, namepat)
+			files, err := filepath.Glob(pat)
+			if err != nil {
+				log.Printf("glob: %v", err)
+				continue
+			}
+			if len(files) > 1 {
+				log.Printf("ambiguous font name: %q", name)
+			}
+			if len(files) > 0 {
+				return files[0], nil
+			}
 		}
 	}
 	return "", fmt.Errorf("no font found")
@@ -0,0 +1,546 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// withFontDir writes files to a temporary directory and restricts the font
+// search locations to that directory until the returned function is called.
+func withFontDir(t *testing.T, files map[string][]byte) (dir string, cleanup func()) {
+	dir, err := ioutil.TempDir("", "dockapp-battery-fonts-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644)
+		if err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+	}
+
+	globs, index := systemFontGlobs, fontIndex
+	systemFontGlobs = []string{dir}
+	fontIndex = newFontNameIndex()
+	env := make(map[string]string)
+	for _, k := range []string{"HOME", "XDG_DATA_HOME", "XDG_DATA_DIRS"} {
+		env[k] = os.Getenv(k)
+		os.Setenv(k, dir)
+	}
+	return dir, func() {
+		systemFontGlobs, fontIndex = globs, index
+		for k, v := range env {
+			os.Setenv(k, v)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestLocateFontByName(t *testing.T) {
+	dir, cleanup := withFontDir(t, map[string][]byte{
+		"Go-Regular.ttf": goregular.TTF,
+		"Go-Bold.ttf":    gobold.TTF,
+		"Go-Italic.ttf":  goitalic.TTF,
+	})
+	defer cleanup()
+
+	for i, test := range []struct {
+		family string
+		style  string
+		file   string
+	}{
+		{"Go", "", "Go-Regular.ttf"},
+		{"Go", "Regular", "Go-Regular.ttf"},
+		{"go", "bold", "Go-Bold.ttf"},
+		{"Go", "Italic", "Go-Italic.ttf"},
+	} {
+		path, err := LocateFontByName(test.family, test.style)
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		if path != filepath.Join(dir, test.file) {
+			t.Errorf("test %d: %q (expected %q)", i, path, test.file)
+		}
+	}
+
+	// a family match falls back to any face in the family.
+	path, err := LocateFontByName("Go", "Bold Italic")
+	if err != nil {
+		t.Errorf("fallback: %v", err)
+	} else if filepath.Dir(path) != dir {
+		t.Errorf("fallback: %q", path)
+	}
+
+	_, err = LocateFontByName("DejaVu Sans", "Bold")
+	if err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestFontNameIndex(t *testing.T) {
+	_, cleanup := withFontDir(t, map[string][]byte{
+		"Go-Regular.ttf": goregular.TTF,
+		"Go-Bold.ttf":    gobold.TTF,
+	})
+	defer cleanup()
+
+	var reads int
+	idx := newFontNameIndex()
+	idx.read = func(path string) (*truetype.Font, error) {
+		reads++
+		return ReadFontFile(path)
+	}
+	for i, name := range []string{"Go", "Go", "DejaVu Sans"} {
+		idx.find(name, "")
+		if reads != 2 {
+			t.Errorf("test %d: %d fonts read (expected 2)", i, reads)
+		}
+	}
+}
+
+func TestFontGlobs(t *testing.T) {
+	defer func(globs []string) { systemFontGlobs = globs }(systemFontGlobs)
+	systemFontGlobs = []string{"/sys/fonts"}
+	env := make(map[string]string)
+	for _, k := range []string{"HOME", "XDG_DATA_HOME", "XDG_DATA_DIRS"} {
+		env[k] = os.Getenv(k)
+	}
+	defer func() {
+		for k, v := range env {
+			os.Setenv(k, v)
+		}
+	}()
+
+	for i, test := range []struct {
+		home, datahome, datadirs string
+		globs                    []string
+	}{
+		{"", "", "", []string{
+			"/sys/fonts",
+			"/usr/local/share/fonts", "/usr/local/share/fonts/*",
+			"/usr/share/fonts", "/usr/share/fonts/*",
+		}},
+		{"/home/u", "", "/data", []string{
+			"/sys/fonts",
+			"/home/u/.local/share/fonts", "/home/u/.local/share/fonts/*",
+			"/home/u/.fonts", "/home/u/.fonts/*",
+			"/data/fonts", "/data/fonts/*",
+		}},
+		{"/home/u", "/xdg", "/a::/b", []string{
+			"/sys/fonts",
+			"/xdg/fonts", "/xdg/fonts/*",
+			"/home/u/.fonts", "/home/u/.fonts/*",
+			"/a/fonts", "/a/fonts/*",
+			"/b/fonts", "/b/fonts/*",
+		}},
+	} {
+		os.Setenv("HOME", test.home)
+		os.Setenv("XDG_DATA_HOME", test.datahome)
+		os.Setenv("XDG_DATA_DIRS", test.datadirs)
+		globs := fontGlobs()
+		if !reflect.DeepEqual(globs, test.globs) {
+			t.Errorf("test %d: %q (expected %q)", i, globs, test.globs)
+		}
+	}
+}
+
+func TestFontName(t *testing.T) {
+	for i, test := range []struct {
+		ttf  []byte
+		name string
+	}{
+		{goregular.TTF, "Go"},
+		{gobold.TTF, "Go Bold"},
+		{goitalic.TTF, "Go Italic"},
+	} {
+		ttf, err := truetype.Parse(test.ttf)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		name := FontName(ttf)
+		if name != test.name {
+			t.Errorf("test %d: %q (expected %q)", i, name, test.name)
+		}
+	}
+}
+
+func TestListFonts(t *testing.T) {
+	dir, cleanup := withFontDir(t, map[string][]byte{
+		"b.ttf": gobold.TTF,
+		"a.ttf": goregular.TTF,
+		"c.txt": []byte("not a font"),
+	})
+	defer cleanup()
+
+	// fonts in subdirectories of the XDG font directories are found, and
+	// duplicated search locations do not duplicate fonts.
+	sub := filepath.Join(dir, "fonts", "truetype")
+	err := os.MkdirAll(sub, 0755)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(sub, "c.ttf"), goitalic.TTF, 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	systemFontGlobs = append(systemFontGlobs, dir)
+
+	paths := ListFonts()
+	expect := []string{
+		filepath.Join(dir, "a.ttf"),
+		filepath.Join(dir, "b.ttf"),
+		filepath.Join(sub, "c.ttf"),
+	}
+	if !reflect.DeepEqual(paths, expect) {
+		t.Errorf("fonts: %q (expected %q)", paths, expect)
+	}
+
+	var buf bytes.Buffer
+	printFonts(&buf)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	expectLines := []string{
+		"Go → " + expect[0],
+		"Go Bold → " + expect[1],
+		"Go Italic → " + expect[2],
+	}
+	if !reflect.DeepEqual(lines, expectLines) {
+		t.Errorf("printed: %q (expected %q)", lines, expectLines)
+	}
+}
+
+func TestLocateFont_name(t *testing.T) {
+	dir, cleanup := withFontDir(t, map[string][]byte{
+		"a.ttf": goregular.TTF,
+		"b.ttf": gobold.TTF,
+	})
+	defer cleanup()
+
+	for i, test := range []struct {
+		name string
+		file string
+	}{
+		{"a", "a.ttf"},
+		{"b.ttf", "b.ttf"},
+		{"Go Bold", "b.ttf"},
+		{"Go Regular", "a.ttf"},
+	} {
+		path, err := LocateFont(test.name)
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		if path != filepath.Join(dir, test.file) {
+			t.Errorf("test %d: %q (expected %q)", i, path, test.file)
+		}
+	}
+}
+
+func TestReadDefaultFont(t *testing.T) {
+	ttf, err := ReadDefaultFont()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if FontName(ttf) != DefaultFontName {
+		t.Errorf("name: %q (expected %q)", FontName(ttf), DefaultFontName)
+	}
+}
+
+func TestReadFont_error(t *testing.T) {
+	garbage := []byte("this is not a truetype font")
+	_, err := ReadFont(bytes.NewReader(garbage))
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if !strings.Contains(err.Error(), "parse") {
+		t.Errorf("undescriptive error: %v", err)
+	}
+
+	dir, cleanup := withFontDir(t, map[string][]byte{
+		"garbage.ttf": garbage,
+	})
+	defer cleanup()
+	path := filepath.Join(dir, "garbage.ttf")
+	_, err = ReadFontFile(path)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if !strings.Contains(err.Error(), path) {
+		t.Errorf("error does not contain path: %v", err)
+	}
+}
+
+func TestReadFont_gzip(t *testing.T) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write(goregular.TTF)
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ttf, err := ReadFont(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if FontName(ttf) != "Go" {
+		t.Errorf("name: %q", FontName(ttf))
+	}
+
+	dir, cleanup := withFontDir(t, map[string][]byte{
+		"Go-Regular.ttf.gz": buf.Bytes(),
+	})
+	defer cleanup()
+	ttf, err = ReadFontFile(filepath.Join(dir, "Go-Regular.ttf.gz"))
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	if FontName(ttf) != "Go" {
+		t.Errorf("name: %q", FontName(ttf))
+	}
+}
+
+// withFCMatch replaces fc-match with a shell script printing output until the
+// returned function is called.
+func withFCMatch(t *testing.T, output string) (cleanup func()) {
+	dir, err := ioutil.TempDir("", "dockapp-battery-fc-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(dir, "fc-match")
+	err = ioutil.WriteFile(script, []byte("#!/bin/sh\necho '"+output+"'\n"), 0755)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	fcMatchOrig := fcMatch
+	fcMatch = script
+	return func() {
+		fcMatch = fcMatchOrig
+		os.RemoveAll(dir)
+	}
+}
+
+func TestLocateFontFC(t *testing.T) {
+	dir, cleanup := withFontDir(t, map[string][]byte{
+		"a.ttf": goregular.TTF,
+		"b.otf": gobold.TTF,
+		"c.pfb": goitalic.TTF,
+	})
+	defer cleanup()
+
+	for i, test := range []struct {
+		output string
+		name   string
+		file   string
+	}{
+		{filepath.Join(dir, "b.otf"), "a", "b.otf"},
+		{filepath.Join(dir, "a.ttf"), "Go Bold", "a.ttf"},
+		// unusable matches fall back to the glob search.
+		{filepath.Join(dir, "c.pfb"), "a", "a.ttf"},
+		{filepath.Join(dir, "missing.ttf"), "a", "a.ttf"},
+		{"", "Go Regular", "a.ttf"},
+	} {
+		cleanupFC := withFCMatch(t, test.output)
+		path, err := LocateFontFC(test.name)
+		cleanupFC()
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		if path != filepath.Join(dir, test.file) {
+			t.Errorf("test %d: %q (expected %q)", i, path, test.file)
+		}
+	}
+
+	// without fontconfig fonts are located by LocateFont.
+	fcMatchOrig := fcMatch
+	fcMatch = filepath.Join(dir, "no-fc-match")
+	defer func() { fcMatch = fcMatchOrig }()
+	path, err := LocateFontFC("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filepath.Join(dir, "a.ttf") {
+		t.Errorf("fallback %q", path)
+	}
+}
+
+func TestLocateFontFC_system(t *testing.T) {
+	_, err := exec.LookPath("fc-match")
+	if err != nil {
+		t.Skip("fontconfig is not installed")
+	}
+	path, err := locateFontFC("sans")
+	if err != nil {
+		t.Skip(err)
+	}
+	if _, err := ReadFontFile(path); err != nil {
+		t.Errorf("%q: %v", path, err)
+	}
+}
+
+func TestReadFontFile_otf(t *testing.T) {
+	dir, cleanup := withFontDir(t, map[string][]byte{
+		"a.otf":       goregular.TTF,
+		"garbage.otf": []byte("this is not an opentype font"),
+		"garbage.pfb": goregular.TTF,
+	})
+	defer cleanup()
+
+	ttf, err := ReadFontFile(filepath.Join(dir, "a.otf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if FontName(ttf) != "Go" {
+		t.Errorf("name: %q", FontName(ttf))
+	}
+
+	_, err = ReadFontFile(filepath.Join(dir, "garbage.otf"))
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if !strings.Contains(err.Error(), "parse") || !strings.Contains(err.Error(), "truetype outlines") {
+		t.Errorf("undescriptive error: %v", err)
+	}
+
+	_, err = ReadFontFile(filepath.Join(dir, "garbage.pfb"))
+	if err == nil || !strings.Contains(err.Error(), ".pfb") {
+		t.Errorf("unsupported extension: %v", err)
+	}
+}
+
+func TestLocateFont_otf(t *testing.T) {
+	dir, cleanup := withFontDir(t, map[string][]byte{
+		"a.otf":  goregular.TTF,
+		"ab.ttf": gobold.TTF,
+		"c.otf":  goitalic.TTF,
+	})
+	defer cleanup()
+
+	for i, test := range []struct {
+		name string
+		file string
+	}{
+		{"a", "ab.ttf"},
+		{"a.otf", "a.otf"},
+		{"c", "c.otf"},
+		{"Go Italic", "c.otf"},
+	} {
+		path, err := LocateFont(test.name)
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		if path != filepath.Join(dir, test.file) {
+			t.Errorf("test %d: %q (expected %q)", i, path, test.file)
+		}
+	}
+
+	paths := ListFonts()
+	if len(paths) != 3 {
+		t.Errorf("fonts: %q", paths)
+	}
+}
+
+func TestParseTextStyle(t *testing.T) {
+	_, cleanup := withFontDir(t, map[string][]byte{
+		"a.ttf": goregular.TTF,
+	})
+	defer cleanup()
+
+	for i, test := range []struct {
+		spec string
+		font bool
+		size float64
+		err  bool
+	}{
+		{"a", true, 0, false},
+		{"a:12", true, 12, false},
+		{"missing", false, 0, false},
+		{"missing:9", false, 9, false},
+		{"a:big", false, 0, true},
+	} {
+		style, err := parseTextStyle(test.spec)
+		if (err != nil) != test.err {
+			t.Errorf("test %d: err %v (expected error %v)", i, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if (style.Font != nil) != test.font {
+			t.Errorf("test %d: font %v (expected font %v)", i, style.Font != nil, test.font)
+		}
+		if style.FontSize != test.size {
+			t.Errorf("test %d: size %v (expected %v)", i, style.FontSize, test.size)
+		}
+	}
+}
+
+func TestFontCache(t *testing.T) {
+	dir, cleanup := withFontDir(t, map[string][]byte{
+		"a.ttf":       goregular.TTF,
+		"b.ttf":       gobold.TTF,
+		"garbage.ttf": []byte("this is not a truetype font"),
+	})
+	defer cleanup()
+
+	reads := make(map[string]int)
+	c := NewFontCache()
+	c.read = func(path string) (*truetype.Font, error) {
+		reads[path]++
+		return ReadFontFile(path)
+	}
+
+	a1, err := c.LoadFont("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a2, err := c.ReadFontFile(filepath.Join(dir, "a.ttf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a1 != a2 {
+		t.Errorf("font read again")
+	}
+	b, err := c.LoadFont("Go Bold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b == a1 {
+		t.Errorf("distinct fonts are identical")
+	}
+	for i := 0; i < 2; i++ {
+		_, err = c.LoadFont("garbage")
+		if err == nil {
+			t.Errorf("expected error")
+		}
+	}
+	_, err = c.LoadFont("missing")
+	if err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("error does not name the font: %v", err)
+	}
+	expect := map[string]int{
+		filepath.Join(dir, "a.ttf"):       1,
+		filepath.Join(dir, "b.ttf"):       1,
+		filepath.Join(dir, "garbage.ttf"): 2,
+	}
+	if !reflect.DeepEqual(reads, expect) {
+		t.Errorf("reads %v (expected %v)", reads, expect)
+	}
+}
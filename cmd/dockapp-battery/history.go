@@ -0,0 +1,75 @@
+package main
+
+import (
+	"image"
+	"image/draw"
+	"math"
+	"sync"
+
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/battery"
+)
+
+// History is a sparkline of recent battery charge fractions drawn in Rect.
+// Each column of Rect is one sample, with the newest sample in the rightmost
+// column.  Samples older than the width of Rect scroll off the left edge.
+// History is safe to use from multiple goroutines.
+type History struct {
+	Rect image.Rectangle
+
+	mut     sync.Mutex
+	samples []float64 // a ring buffer
+	next    int       // index of the next sample
+	full    bool
+}
+
+// NewHistory returns an empty History drawn in r.
+func NewHistory(r image.Rectangle) *History {
+	return &History{
+		Rect:    r,
+		samples: make([]float64, r.Dx()),
+	}
+}
+
+// Add records fraction as the newest sample.
+func (h *History) Add(fraction float64) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	if len(h.samples) == 0 {
+		return
+	}
+	h.samples[h.next] = fraction
+	h.next = (h.next + 1) % len(h.samples)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// Samples returns the recorded samples, oldest first.
+func (h *History) Samples() []float64 {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	if !h.full {
+		return append([]float64(nil), h.samples[:h.next]...)
+	}
+	return append(append([]float64(nil), h.samples[h.next:]...), h.samples[:h.next]...)
+}
+
+// drawHistory draws the sparkline of app.History in the color of the battery's
+// energy.
+func (app *App) drawHistory(img draw.Image, metrics *battery.Metrics) {
+	r := app.History.Rect
+	fill := image.NewUniform(app.energyColor(metrics))
+	samples := app.History.Samples()
+	x := r.Max.X - len(samples)
+	for i, f := range samples {
+		if f < 0 {
+			f = 0
+		}
+		if f > 1 {
+			f = 1
+		}
+		h := int(math.Floor(f*float64(r.Dy()) + 0.5))
+		col := image.Rect(x+i, r.Max.Y-h, x+i+1, r.Max.Y)
+		draw.Draw(img, col, fill, image.ZP, draw.Over)
+	}
+}
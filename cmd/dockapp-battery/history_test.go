@@ -0,0 +1,68 @@
+package main
+
+import (
+	"image"
+	"reflect"
+	"testing"
+
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/battery"
+)
+
+func TestHistory(t *testing.T) {
+	h := NewHistory(image.Rect(0, 0, 3, 10))
+	for i, test := range []struct {
+		add     float64
+		samples []float64
+	}{
+		{0.9, []float64{0.9}},
+		{0.8, []float64{0.9, 0.8}},
+		{0.7, []float64{0.9, 0.8, 0.7}},
+		{0.6, []float64{0.8, 0.7, 0.6}},
+		{0.5, []float64{0.7, 0.6, 0.5}},
+		{0.4, []float64{0.6, 0.5, 0.4}},
+		{0.3, []float64{0.5, 0.4, 0.3}},
+	} {
+		h.Add(test.add)
+		samples := h.Samples()
+		if !reflect.DeepEqual(samples, test.samples) {
+			t.Errorf("test %d: %v (expected %v)", i, samples, test.samples)
+		}
+	}
+
+	empty := NewHistory(image.Rectangle{})
+	empty.Add(0.5)
+	if samples := empty.Samples(); len(samples) != 0 {
+		t.Errorf("empty: %v", samples)
+	}
+}
+
+func TestApp_history(t *testing.T) {
+	layout := testLayout(t)
+	layout.hideText = true
+	layout.battRect = image.Rectangle{}
+	app := NewApp(layout)
+	r := image.Rect(10, 0, 20, 10)
+	app.History = NewHistory(r)
+	for _, f := range []float64{1, 0.5, 0} {
+		app.History.Add(f)
+	}
+	m := testMetrics(0.5, battery.Discharging)
+	img, err := app.Render(m, battery.MetricFormatFunc(battery.FormatPercent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range []struct {
+		x      int
+		height int
+	}{
+		{16, 0}, // no sample
+		{17, 10},
+		{18, 5},
+		{19, 0},
+	} {
+		col := image.Rect(test.x, r.Min.Y, test.x+1, r.Max.Y)
+		if n := countColor(img, col, defaultGreen); n != test.height {
+			t.Errorf("test %d: column %d height %d (expected %d)", i, test.x, n, test.height)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// IconTheme locates icons in a freedesktop icon theme.  Only PNG icons are
+// supported, icons which are only available as SVG images are not found.
+type IconTheme struct {
+	Name string
+
+	// Dirs are the base directories searched for themes, and for icons that
+	// do not belong to any theme.
+	Dirs []string
+
+	mut   sync.Mutex
+	cache map[iconKey]*iconResult
+}
+
+type iconKey struct {
+	name string
+	size int
+}
+
+type iconResult struct {
+	img image.Image
+	err error
+}
+
+// NewIconTheme returns an IconTheme that searches the standard icon
+// directories for the named theme.
+func NewIconTheme(name string) *IconTheme {
+	return &IconTheme{
+		Name: name,
+		Dirs: IconDirs(),
+	}
+}
+
+// IconDirs returns the base directories in which icon themes are installed,
+// in order of precedence.
+func IconDirs() []string {
+	var dirs []string
+	if home := os.Getenv("HOME"); home != "" {
+		dirs = append(dirs, filepath.Join(home, ".icons"))
+	}
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" && os.Getenv("HOME") != "" {
+		dataHome = filepath.Join(os.Getenv("HOME"), ".local", "share")
+	}
+	if dataHome != "" {
+		dirs = append(dirs, filepath.Join(dataHome, "icons"))
+	}
+	dataDirs := os.Getenv("XDG_DATA_DIRS")
+	if dataDirs == "" {
+		dataDirs = "/usr/local/share:/usr/share"
+	}
+	for _, dir := range filepath.SplitList(dataDirs) {
+		dirs = append(dirs, filepath.Join(dir, "icons"))
+	}
+	return append(dirs, "/usr/share/pixmaps")
+}
+
+// Icon returns the named icon with the size closest to size, preferring
+// icons which are larger than size.  Icons are searched for in the theme,
+// the themes it inherits, and finally the "hicolor" theme.  If no PNG image
+// of a symbolic icon exists the corresponding full color icon is used.
+// Results are cached so Icon may be called each time a window is drawn.
+func (t *IconTheme) Icon(name string, size int) (image.Image, error) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	key := iconKey{name, size}
+	if r, ok := t.cache[key]; ok {
+		return r.img, r.err
+	}
+	img, err := t.lookup(name, size)
+	if err != nil {
+		log.Printf("icon: %v", err)
+	}
+	if t.cache == nil {
+		t.cache = make(map[iconKey]*iconResult)
+	}
+	t.cache[key] = &iconResult{img, err}
+	return img, err
+}
+
+func (t *IconTheme) lookup(name string, size int) (image.Image, error) {
+	names := []string{name}
+	if strings.HasSuffix(name, "-symbolic") {
+		names = append(names, strings.TrimSuffix(name, "-symbolic"))
+	}
+	themes := t.themes()
+	for _, name := range names {
+		for _, theme := range themes {
+			path, ok := t.find(theme, name, size)
+			if ok {
+				return readPNG(path)
+			}
+		}
+		for _, dir := range t.Dirs {
+			path := filepath.Join(dir, name+".png")
+			if _, err := os.Stat(path); err == nil {
+				return readPNG(path)
+			}
+		}
+	}
+	return nil, fmt.Errorf("%q not found in theme %q", name, t.Name)
+}
+
+// find returns the path to the PNG image of the named icon in theme which is
+// closest to size.
+func (t *IconTheme) find(theme, name string, size int) (path string, ok bool) {
+	var bestSize int
+	for _, dir := range t.Dirs {
+		// themes place icons in either "size/context" or "context/size"
+		// subdirectories, or directly in a size directory.
+		var matches []string
+		for _, pattern := range []string{"*/*/" + name + ".png", "*/" + name + ".png"} {
+			m, _ := filepath.Glob(filepath.Join(dir, theme, pattern))
+			matches = append(matches, m...)
+		}
+		for _, match := range matches {
+			s, err := pngSize(match)
+			if err != nil {
+				continue
+			}
+			if !ok || betterIconSize(s, bestSize, size) {
+				path, bestSize, ok = match, s, true
+			}
+		}
+	}
+	return path, ok
+}
+
+// betterIconSize returns true if an icon of size s is a better fit for size
+// than an icon of size best.  Icons at least as large as size are preferred
+// because they are scaled down without losing detail.
+func betterIconSize(s, best, size int) bool {
+	if (s >= size) != (best >= size) {
+		return s >= size
+	}
+	if s >= size {
+		return s < best
+	}
+	return s > best
+}
+
+// themes returns the names of the themes searched for icons, in order.
+func (t *IconTheme) themes() []string {
+	var themes []string
+	seen := make(map[string]bool)
+	var visit func(theme string)
+	visit = func(theme string) {
+		if theme == "" || seen[theme] {
+			return
+		}
+		seen[theme] = true
+		themes = append(themes, theme)
+		for _, parent := range t.inherits(theme) {
+			visit(parent)
+		}
+	}
+	visit(t.Name)
+	visit("hicolor")
+	return themes
+}
+
+// inherits returns the themes inherited by theme according to the first
+// index.theme file found for it.
+func (t *IconTheme) inherits(theme string) []string {
+	for _, dir := range t.Dirs {
+		f, err := os.Open(filepath.Join(dir, theme, "index.theme"))
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+		var section string
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if strings.HasPrefix(line, "[") {
+				section = line
+				continue
+			}
+			if section != "[Icon Theme]" || !strings.HasPrefix(line, "Inherits=") {
+				continue
+			}
+			var parents []string
+			for _, parent := range strings.Split(strings.TrimPrefix(line, "Inherits="), ",") {
+				parents = append(parents, strings.TrimSpace(parent))
+			}
+			return parents
+		}
+		return nil
+	}
+	return nil
+}
+
+// pngSize returns the larger dimension of the PNG image at path.
+func pngSize(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	cfg, err := png.DecodeConfig(f)
+	if err != nil {
+		return 0, err
+	}
+	if cfg.Width > cfg.Height {
+		return cfg.Width, nil
+	}
+	return cfg.Height, nil
+}
+
+func readPNG(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v %q", err, path)
+	}
+	return img, nil
+}
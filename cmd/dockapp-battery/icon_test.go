@@ -0,0 +1,128 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/battery"
+)
+
+var iconBlue = color.RGBA{B: 0xff, A: 0xff}
+
+// writeIcon writes a square PNG image of the given size, filled with
+// iconBlue, to path.
+func writeIcon(t *testing.T, path string, size int) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), image.NewUniform(iconBlue), image.ZP, draw.Src)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	err = png.Encode(f, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testIconTheme returns an IconTheme named "test", which inherits "parent",
+// in a temporary directory which must be removed by the caller.
+func testIconTheme(t *testing.T) (theme *IconTheme, dir string) {
+	dir, err := ioutil.TempDir("", "dockapp-battery-icons-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeIcon(t, filepath.Join(dir, "hicolor", "16x16", "status", "battery-full.png"), 16)
+	writeIcon(t, filepath.Join(dir, "hicolor", "48x48", "status", "battery-full.png"), 48)
+	writeIcon(t, filepath.Join(dir, "hicolor", "64x64", "status", "battery-low.png"), 64)
+	writeIcon(t, filepath.Join(dir, "parent", "status", "32", "battery-low.png"), 32)
+	writeIcon(t, filepath.Join(dir, "test", "22x22", "status", "battery-good.png"), 22)
+	writeIcon(t, filepath.Join(dir, "battery-empty.png"), 8)
+	index := "[Icon Theme]\nName=Test\nInherits=parent\n"
+	err = ioutil.WriteFile(filepath.Join(dir, "test", "index.theme"), []byte(index), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &IconTheme{Name: "test", Dirs: []string{dir}}, dir
+}
+
+func TestIconTheme(t *testing.T) {
+	theme, dir := testIconTheme(t)
+	defer os.RemoveAll(dir)
+	for i, test := range []struct {
+		name    string
+		size    int
+		iconLen int
+	}{
+		{"battery-good", 20, 22},
+		{"battery-good", 48, 22},
+		{"battery-good-symbolic", 20, 22},
+		{"battery-low", 20, 32},    // inherited
+		{"battery-full", 20, 48},   // hicolor
+		{"battery-full", 10, 16},   // smallest larger than size
+		{"battery-full", 100, 48},  // largest
+		{"battery-empty", 20, 8},   // unthemed
+		{"battery-missing", 20, 0}, // not found
+		{"battery-missing", 20, 0}, // cached
+	} {
+		icon, err := theme.Icon(test.name, test.size)
+		if test.iconLen == 0 {
+			if err == nil {
+				t.Errorf("test %d: %q found", i, test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		if n := icon.Bounds().Dx(); n != test.iconLen {
+			t.Errorf("test %d: icon width %d (expected %d)", i, n, test.iconLen)
+		}
+	}
+}
+
+func TestApp_icon(t *testing.T) {
+	theme, dir := testIconTheme(t)
+	defer os.RemoveAll(dir)
+	f := battery.MetricFormatFunc(battery.FormatPercent)
+	for i, test := range []struct {
+		icons    *IconTheme
+		iconName string
+		drawn    bool
+	}{
+		{theme, "battery-good", true},
+		{theme, "battery-missing", false},
+		{theme, "", false},
+		{nil, "battery-good", false},
+	} {
+		layout := testLayout(t)
+		layout.hideText = true
+		app := NewApp(layout)
+		app.Icons = test.icons
+		m := testMetrics(0.5, battery.Discharging)
+		m.IconName = test.iconName
+		img, err := app.Render(m, f)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		blue := countColor(img, layout.battRect, iconBlue)
+		green := countColor(img, layout.battRect, defaultGreen)
+		if test.drawn && (blue == 0 || green != 0) {
+			t.Errorf("test %d: icon not drawn", i)
+		}
+		if !test.drawn && (blue != 0 || green == 0) {
+			t.Errorf("test %d: battery not drawn", i)
+		}
+	}
+}
@@ -17,6 +17,11 @@ Templates are written using the Go text/template language.
 
 	http://godoc.org/text/template
 
+A template which fails to render, like one referencing a variable that does not
+exist, is logged and the charge percentage is displayed in its place.
+With the -template.strict flag "!ERR" is displayed instead, so that a broken
+template is noticed immediately.
+
 Templates are evaluated with the following variables available.
 
 	fraction    The fraction of total capacity available as a floating point number
@@ -25,25 +30,230 @@ Templates are evaluated with the following variables available.
 	remaining   When charging the time until full, when discharging the time until empty
 	untilFull   The time until the battery is full
 	untilEmpty  The time until the battery is empty
+	onAC        True when connected to line power, false on battery, nil when unknown
+	voltage     The voltage of the battery in volts, nil when unknown
+	current     The current flowing into or out of the battery in amperes, nil when unknown
+	power       The power drawn from the battery in watts, negative while charging, zero when unknown
+	temperature The temperature of the battery in degrees Celsius, zero when unknown
+	health      The capacity of the battery as a fraction of its design capacity, zero when unknown
+	sincePlug   The time since line power was connected or disconnected, nil when unknown
+
+The sincePlug time is measured from the last time the power source was seen to
+change.  Until it changes the time is measured from when dockapp-battery first
+determined the power source.
+
+	dockapp-battery '{{if .onAC}}plugged in{{else}}on battery{{end}} {{durShort .sincePlug}}'
+
+The battery may not report the time remaining, in which case the remaining,
+untilFull, and untilEmpty variables render as "???".  Methods allow templates
+to test whether times are known before rendering them.
+
+	Remaining     The time remaining, or zero when unknown
+	HasRemaining  True when the time remaining is known
+	UntilFull     The time until the battery is full, or zero when unknown
+	HasUntilFull  True when the time until full is known
+	UntilEmpty    The time until the battery is empty, or zero when unknown
+	HasUntilEmpty True when the time until empty is known
+
+	dockapp-battery '{{if .HasRemaining}}{{durShort .Remaining}}{{else}}{{.state}}{{end}}'
+
+Numbers are formatted according to the locale given with the -locale flag,
+which affects the digits used and the placement of percent signs.
+
+	dockapp-battery -locale=fr '{{percent .fraction}}'
+
+The text displayed in place of the time remaining when the battery is full or
+empty, or when the time is unknown, is set with the -text.full, -text.empty,
+and -text.unknown flags.
+
+	dockapp-battery -text.full=⚡ -text.unknown=-
+
+The time remaining is displayed with minute precision (e.g. "1h23m").  The
+-text.durationstyle flag selects "short" (e.g. "1h"), "days" (e.g. "1d4h") or
+"colon" (e.g. "1:23") instead.
+
+	dockapp-battery -text.durationstyle=colon
 
 Several functions are defined for templates to facilitate rendering of
 durations.
 
 	dur       Render a duration with minute precision (e.g. "4h3m" instead of "4h3m15s")
 	durShort  Render a duration with variable precision (e.g. "4h" instead of "4h3m")
+	durDays   Render a duration with minute precision counting whole days (e.g. "1d4h" instead of "28h")
+	durColon  Render a duration as hours and minutes (e.g. "1:23")
+	eta       Render the time of day a duration from now (e.g. "14:30"), or "--:--" when unknown
+
+Functions are also defined for rendering the fraction of capacity available.
+
+	percent     Render a fraction as an integer percent (e.g. "85%")
+	percentF    Render a fraction as a percent with a given precision (e.g. {{percentF 1 .fraction}} renders "85.3%")
+	bar         Render a fraction as a bar (e.g. "▮▮▮▮▮▮▮▮▯▯")
+	percentBar  Render a fraction as a percent followed by a bar (e.g. "85% ▮▮▮▮▮▮▮▮▯▯")
+
+Functions for rendering electrical measurements render "?" when the battery
+does not report them.
+
+	volts       Render a voltage (e.g. "11.87V")
+	amps        Render a current (e.g. "1.25A")
+	watts       Render a power (e.g. "12.3W"), or "—" when unknown
+	temp        Render a temperature (e.g. "31.5°C"), or "—°C" when unknown
+	health      Render a battery's health as a percent (e.g. "87%"), or "—" when unknown
+
+Clicking the window with the left mouse button displays the next template
+immediately.  Clicking with the right mouse button pauses the rotation of
+templates, and clicking with it again resumes the rotation.
+
+The width of the rendered text changes as the displayed template rotates.  The
+-text.pad flag keeps the position of the text stable by laying out each template
+as if it were as wide as the widest one.
+
+Rather than giving each geometry the -layout=compact flag derives the battery
+and text geometries from the window, placing a square battery on the left and
+text in the remaining space.  The -layout.ratio flag sets the fraction of the
+window width given to the battery.
+
+	dockapp-battery -window.geometry=80x20 -layout=compact
+
+The text box may be hidden entirely with the -text.hidden flag.  Unless a
+battery geometry is given the battery graphic fills the window.
+
+	dockapp-battery -window.geometry=40x20 -text.hidden
+
+Conversely, the battery graphic may be hidden with the -battery.hidden flag.
+Unless a text geometry is given the text box fills the window.
+
+	dockapp-battery -window.geometry=60x20 -battery.hidden '{{percent .fraction}}'
+
+With a compositing manager running the -window.transparent flag leaves the
+window background transparent so the dock shows through behind the battery and
+text.
+
+	dockapp-battery -window.transparent
+
+Estimates of the time remaining reported by the battery can vary widely
+between polls.  Displayed estimates are a moving average, which is reset when
+the battery starts or stops charging.  The -smoothing flag sets the weight
+given to previous estimates, with zero displaying estimates as reported.
+
+	dockapp-battery -smoothing=0.8
+
+A sparkline of recent charge is drawn in the rectangle given by the
+-history.geometry flag.  Each column of the rectangle is one poll of the
+battery, with the newest on the right, so a steep slope shows the battery
+draining faster than usual.
+
+	dockapp-battery -window.geometry=160x20 -text.geometry=97x20+20+0 -history.geometry=40x20+118+0
+
+The battery is drawn with square corners by default.  The -battery.round flag
+draws the body of the battery with smooth, anti-aliased rounded corners of the
+radius given by -battery.radius.
+
+	dockapp-battery -battery.round -battery.radius=4
+
+The cap of the battery is drawn on the left and energy drains toward it.  The
+-battery.mirror flag flips the battery horizontally, putting the cap on the
+right, which may suit a dock on the right side of the screen.
+
+	dockapp-battery -battery.mirror
+
+Tall, narrow dock slots may stand the battery upright with -battery.vertical,
+putting the cap on top so that energy drains from the top downward.  The
+battery geometry should be taller than it is wide.  Combined with
+-battery.mirror the cap is on the bottom.
+
+	dockapp-battery -window.geometry=24x64 -battery.geometry=18x40+3+2 -text.geometry=24x20+0+44 -battery.vertical
+
+Upower names an icon depicting the state and level of the battery.  The
+-icon.theme flag draws that icon from the named freedesktop icon theme in
+place of the battery graphic.  Only PNG icons are supported.  When the icon is
+missing from the theme, or only available as an SVG image, the battery graphic
+is drawn instead.
+
+	dockapp-battery -icon.theme=Adwaita
+
+The default colors of the battery are hard to distinguish for people with
+red-green color blindness.  The -palette flag selects a blue and orange palette
+instead.
+
+	dockapp-battery -palette=cb
+
+A discharging battery is drawn in red once it falls to 15% of its capacity and
+in a brighter red at 5%.  Older batteries may warn earlier by raising the
+-battery.low and -battery.critical fractions.
+
+	dockapp-battery -battery.low=0.25 -battery.critical=0.1
+
+Below the critical fraction the energy of a discharging battery blinks once a
+second.  The -battery.blink flag changes the interval, or disables blinking
+when zero.  The window is only redrawn for blinking below the threshold.
+
+	dockapp-battery -battery.blink=500ms
+
+While charging, a translucent fill rises from the battery's level to full every
+two seconds.  The -battery.charge.period flag changes the period of the
+animation, or shows only the static level when zero.
+
+	dockapp-battery -battery.charge.period=4s
+
+When the battery cannot be read the last known metrics continue to be
+displayed.  Once they are older than the -stale-after duration the battery is
+drawn in gray to indicate that the information is out of date.
+
+The battery is not polled or drawn while the window is unmapped or fully
+covered by other windows.  It is polled and drawn as soon as the window becomes
+visible again.  Disable this to keep polling while hidden.
+
+	dockapp-battery -pause.hidden=false
+
+The appearance of the battery across its whole range can be reviewed at once
+with the -selftest flag.  The battery is rendered while charging, discharging,
+full and empty, at several charge levels each, into a grid written to the
+-selftest.output image.  No window is created.
+
+	dockapp-battery -selftest -selftest.output=/tmp/battery.png
 
 Fonts
 
 Dockapp-battery attempts to locate fonts based on simple names like
-"DejaVuSans-Bold" or "Ubuntu-B". As an alternative any truetype font (.ttf)
-file can be specified through an absolute path.
+"DejaVuSans-Bold" or "Ubuntu-B", or by family and style names like "DejaVu Sans
+Bold". As an alternative any truetype (.ttf) or opentype (.otf) font file can
+be specified through an absolute path.  When the font cannot be located a font
+embedded in the program (Go Bold) is used instead.
 
 	dockapp-battery -text.font="$PWD/myfont.ttf"
 
+Fonts may instead be located using fontconfig, when it is installed, which
+accepts fontconfig patterns like "DejaVu Sans:bold" in addition to font names.
+Fontconfig always matches some font, which may not be the one intended.
+
+	dockapp-battery -fontconfig -text.font='DejaVu Sans:bold'
+
+The fonts which can be located are printed, along with their paths, when the
+-list-fonts flag is given.
+
+	dockapp-battery -list-fonts
+
+Each template may be rendered in its own font by giving a comma separated list
+of fonts to -text.fonts, one for each template argument.  An entry may have a
+size suffix and empty entries use the -text.font setting.
+
+	dockapp-battery -text.fonts='DejaVuSans-Bold,DejaVuSans:12' '{{percent .fraction}}' '{{.state}}'
+
+Text can be given an outline in a contrasting color to keep it legible when it
+is drawn over the battery graphic.  The outline is dark unless another color is
+given in hexadecimal notation.
+
+	dockapp-battery -text.outline -text.outline.color='#ffffff' -text.outline.width=1
+
+Text is centered in its text box unless the -text.align flag aligns it to the
+"left" or "right" edge, which may suit a fixed width percentage drawn beside
+the battery.
+
+	dockapp-battery -text.align=left '{{percent .fraction}}'
+
 BUG(bmatsuo):
-Font detection is flakey and done with globs.  Ideally a utility like
-fontconfig (fc-*) would be great but from what I've seen it's matching ability
-is pretty bad.
+Font detection is flakey and done with globs unless -fontconfig is given.
+Fontconfig's matching ability is pretty bad though.
 
 Geometry
 
@@ -60,6 +270,15 @@ top of the background.
 The above command renders the dockapp in a compact 40x20 rectangle with the
 percentage overlaid on the battery graphic.
 
+Rather than rotating templates through one text box, the window may contain
+several text boxes which each always display their own template.  Each
+-text.geometry flag is paired with the -text.format flag in the same position.
+Template arguments cannot be given with -text.format.
+
+	dockapp-battery -window.geometry=140x20 \
+		-text.geometry=50x20+22+0 -text.format='{{percent .fraction}}' \
+		-text.geometry=68x20+72+0 -text.format='{{durShort .remaining}}'
+
 Examples
 
 A minimal window that displays percent charged and the remaining time as a
@@ -85,6 +304,90 @@ messages.
 		{{else}}{{durShort .remaining}} until empty
 		{{end}}'
 
+Signals
+
+Dockapp-battery polls the battery once a minute or when the battery state
+changes.  Sending SIGUSR1 to the process causes it to poll the battery and
+redraw immediately, which may be useful from a resume hook.
+
+	pkill -USR1 dockapp-battery
+
+SIGINT and SIGTERM cause dockapp-battery to exit cleanly.  Profiles requested
+with the -cpuprofile and -memprofile flags are written on exit, and the
+-pprof.addr flag serves live profiles over HTTP.
+
+	dockapp-battery -cpuprofile=cpu.prof -pprof.addr=localhost:6060
+
+Bursts of updates are drawn as they arrive.  The -max-fps flag limits how many
+times per second the window is redrawn, reducing X traffic when updates are
+frequent.
+
+	dockapp-battery -max-fps=4
+
+Critical suspend
+
+The -critical-suspend flag suspends the system when the discharging battery
+reaches the given percent.  The window displays "suspend?" for the
+-critical-suspend.confirm duration before the system is suspended, and clicking
+the window cancels the suspension.  The system is suspended at most once each
+time the battery discharges, so it is not suspended again after resuming until
+line power has been connected.  The command run may be changed with the
+-critical-suspend.command flag.
+
+	dockapp-battery -critical-suspend=3 -critical-suspend.command='loginctl suspend'
+
+Polling continues while the window is hidden when -critical-suspend is given.
+
+Battery backends
+
+Batteries are read through upower by default on Linux.  Only the first
+battery is displayed unless the -battery.all flag is given, which combines
+every battery detected, like the internal and external packs of some laptops,
+into one.
+
+	dockapp-battery -battery.all
+
+On Linux systems without upower or D-Bus, such as minimal window manager setups
+and containers, the -battery.backend=sysfs flag reads the first battery in
+/sys/class/power_supply directly.
+
+	dockapp-battery -battery.backend=sysfs
+
+The -battery.backend=sys flag reads the battery with the native interface of
+the platform the program was built for: upower on Linux, pmset on macOS and
+GetSystemPowerStatus on Windows.  It is the default on platforms other than
+Linux.
+
+	dockapp-battery -battery.backend=sys
+
+Batteries which neither can read may be displayed by a command which prints
+their metrics.  With -battery.backend=exec the command given by -battery.cmd is
+run and restarted whenever it exits.  Each time it measures the battery the
+command prints a JSON object on its own line.  Only the fraction is required,
+times are given in seconds.
+
+	{"fraction": 0.85, "state": "Discharging", "until_empty": 9000, "until_full": null}
+
+The state is one of Charging, Discharging, Empty, Full, PendingCharge,
+PendingDischarge or Unknown.  Lines which cannot be parsed are logged and
+ignored.
+
+	dockapp-battery -battery.backend=exec -battery.cmd='/usr/local/bin/bmc-battery --interval=30'
+
+Conversely, the -emit=json flag prints each poll of the battery to stdout in
+the same format, with the additional metrics the battery reports, for scripts
+and status bars like i3blocks.  When the DISPLAY environment variable is not
+set no window is created and an X server is not required.
+
+	DISPLAY= dockapp-battery -emit=json
+
+The -mock flag replaces the battery with a scripted one, which is useful for
+screenshots and demonstrations.  Each poll reports the next entry of a comma
+separated list of fractions, each with an optional state, repeating the last.
+Sending SIGUSR1 advances to the next entry immediately.
+
+	dockapp-battery -mock=0.5:Charging,1:FullyCharged,0.05
+
 Help
 
 For command usage and other help run dockapp-battery with the -h flag.
@@ -93,122 +396,682 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
+	"io"
 	"log"
 	"math"
+	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"github.com/BurntSushi/xgb/xproto"
 	"github.com/BurntSushi/xgbutil"
 	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/battery"
 	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/creeperguage"
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/execguage"
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/sysfsguage"
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/sysguage"
 	"github.com/bmatsuo/dockapp-go/dockapp"
 	"github.com/bmatsuo/dockapp-go/geometry"
+	"github.com/bmatsuo/dockapp-go/imageutil"
 	"github.com/golang/freetype"
 	"github.com/golang/freetype/truetype"
+	xdraw "golang.org/x/image/draw"
 	"golang.org/x/image/font"
 	"golang.org/x/image/math/fixed"
+	"golang.org/x/text/language"
 )
 
-var defaultFormatters = []battery.MetricFormatter{
-	battery.MetricFormatFunc(battery.FormatState),
-	battery.MetricFormatFunc(battery.FormatPercent),
-	battery.MetricFormatFunc(battery.FormatRemaining),
+// defaultFormatters returns the formatters used when no templates are given.
+// The percentage is displayed with the given number of decimal places.
+func defaultFormatters(precision int) []battery.MetricFormatter {
+	percent := battery.MetricFormatter(battery.MetricFormatFunc(battery.FormatPercent))
+	if precision > 0 {
+		percent = battery.PercentFormatter{Precision: precision}
+	}
+	return []battery.MetricFormatter{
+		battery.MetricFormatFunc(battery.FormatState),
+		percent,
+		battery.MetricFormatFunc(battery.FormatRemaining),
+	}
 }
 
 func main() {
 	window := geometry.Flag("window.geometry", image.Rect(0, 0, 117, 20), "window geometry in pixels")
+	transparent := flag.Bool("window.transparent", false, "draw on a transparent background (requires a compositing manager)")
 	battRect := geometry.Flag("battery.geometry", image.Rect(0, 0, 21, 18).Add(image.Pt(1, 2)), "battery icon geometry in pixels")
 	borderThickness := flag.Int("border", 1, "battery border thickness in pixels")
-	textRect := geometry.Flag("text.geometry", image.Rect(0, 0, 95, 20).Add(image.Pt(22, 0)), "text box geometry in pixels")
+	iconTheme := flag.String("icon.theme", "", "draw the battery icon named by upower from the given icon theme (e.g. \"Adwaita\") instead of the battery graphic")
+	backend := flag.String("battery.backend", defaultBackend(), "source of battery metrics: \"upower\", \"sysfs\" (linux without upower), \"sys\" (the native interface of the platform) or \"exec\" (a command given by -battery.cmd)")
+	battAll := flag.Bool("battery.all", false, "combine every battery detected by upower into one (e.g. BAT0 and BAT1)")
+	backendCmd := flag.String("battery.cmd", "", "command printing battery metrics as JSON lines for -battery.backend=exec")
+	historyRect := geometry.Flag("history.geometry", image.Rectangle{}, "draw a sparkline of recent charge with one pixel column per poll (empty to disable)")
+	battMirror := flag.Bool("battery.mirror", false, "flip the battery graphic horizontally, with the cap on the right")
+	battVertical := flag.Bool("battery.vertical", false, "stand the battery graphic upright, with the cap on top")
+	battRound := flag.Bool("battery.round", false, "draw the battery body with anti-aliased rounded corners")
+	battRadius := flag.Float64("battery.radius", 3, "radius in pixels of the battery body's corners when -battery.round is given")
+	battLow := flag.Float64("battery.low", DefaultLowFraction, "fraction of capacity at or below which the battery is drawn in the palette's low color")
+	battCritical := flag.Float64("battery.critical", DefaultCriticalFraction, "fraction of capacity at or below which the battery is drawn in the palette's critical color")
+	battBlink := flag.Duration("battery.blink", time.Second, "interval at which a discharging battery below -battery.critical blinks (0 to disable)")
+	chargePeriod := flag.Duration("battery.charge.period", 2*time.Second, "period of the animation filling a charging battery (0 to disable)")
+	textRects := &geometryList{def: image.Rect(0, 0, 95, 20).Add(image.Pt(22, 0))}
+	flag.Var(textRects, "text.geometry", "text box geometry in pixels (repeat with -text.format for multiple text boxes)")
+	var textFormats stringList
+	flag.Var(&textFormats, "text.format", "template always drawn in the text box of the corresponding -text.geometry (may be repeated)")
 	textFont := flag.String("text.font", "DejaVuSans-Bold", "application text font")
 	textFontSize := flag.Float64("text.fontsize", 14, "application text font size")
+	textFonts := flag.String("text.fonts", "", "comma separated list of fonts (name[:size]) for each text template")
+	textOutline := flag.Bool("text.outline", false, "draw an outline around text")
+	textOutlineColor := flag.String("text.outline.color", "#000000", "text outline color when -text.outline is given")
+	textOutlineWidth := flag.Int("text.outline.width", 1, "text outline width in pixels")
+	mock := flag.String("mock", "", "comma separated list of fraction[:state] reported in turn by each poll in place of a battery (e.g. 0.5:Charging,0.05)")
+	emitFormat := flag.String("emit", "", "print each poll of the battery to stdout in the given format (\"json\"), without a window when DISPLAY is not set")
+	templateStrict := flag.Bool("template.strict", false, "draw "+battery.TemplateErrorString+" in place of a template which fails rather than the battery percentage")
+	textAlign := flag.String("text.align", "center", "horizontal alignment of text in its text box: \"left\", \"center\" or \"right\"")
+	textPad := flag.Bool("text.pad", false, "pad each text template to the width of the widest")
+	layoutName := flag.String("layout", "", "derive the battery and text geometry from the window (\"compact\")")
+	layoutRatio := flag.Float64("layout.ratio", 0, "fraction of the window width used for the battery in a compact layout (0 for a square)")
+	battHidden := flag.Bool("battery.hidden", false, "do not draw the battery graphic and use the whole window for text")
+	textHidden := flag.Bool("text.hidden", false, "do not draw text and use the whole window for the battery")
+	palette := flag.String("palette", "default", "colors used to draw the battery: \"default\" or \"cb\" (color blind friendly blue and orange)")
+	stallAfter := flag.Duration("stall.after", 10*time.Second, "log a warning when drawing the window takes longer than this (0 to disable)")
+	stallStacks := flag.Bool("stall.stacks", false, "log the stacks of all goroutines when drawing stalls")
+	criticalSuspend := flag.Float64("critical-suspend", 0, "suspend the system once when the discharging battery reaches this percent (0 to disable)")
+	criticalCommand := flag.String("critical-suspend.command", "systemctl suspend", "command run by -critical-suspend")
+	criticalConfirm := flag.Duration("critical-suspend.confirm", 30*time.Second, "time to click the window to cancel -critical-suspend before the command runs")
+	pauseHidden := flag.Bool("pause.hidden", true, "stop polling and drawing while the window is unmapped or fully obscured")
+	retries := flag.Int("x.retries", 5, "number of times to reconnect to the x server when the window cannot be drawn")
+	maxFPS := flag.Float64("max-fps", 0, "maximum number of times per second the window is redrawn (0 for no limit)")
+	jitter := flag.Float64("jitter", 0.05, "fraction of the polling interval by which polls are randomly offset (0 to disable)")
+	smoothing := flag.Float64("smoothing", 0.5, "weight from 0 to 1 given to previous estimates of the time remaining (0 to disable smoothing)")
+	staleAfter := flag.Duration("stale-after", 5*time.Minute, "draw the battery without color when metrics are older than this (0 to disable)")
 	textInterval := flag.Duration("text.interval", 7*time.Second+500*time.Millisecond, "interval to display each formatted text metric")
+	percentPrecision := flag.Int("percent.precision", 0, "decimal places in the percentage displayed when no templates are given")
+	textDurationStyle := flag.String("text.durationstyle", "clean", "style of the time remaining displayed when no templates are given: \"clean\" (1h23m), \"short\" (1h), \"days\" (1d4h) or \"colon\" (1:23)")
+	textFull := flag.String("text.full", battery.DefaultRemainingText.Full, "text displayed in place of the time remaining when the battery is full")
+	textEmpty := flag.String("text.empty", battery.DefaultRemainingText.Empty, "text displayed in place of the time remaining when the battery is empty")
+	textUnknown := flag.String("text.unknown", battery.DefaultRemainingText.Unknown, "text displayed when the time remaining is unknown")
+	locale := flag.String("locale", "en", "locale used to format numbers (e.g. \"fr\")")
+	selfTest := flag.Bool("selftest", false, "render the battery in each state at several charge levels to an image and exit")
+	selfTestOutput := flag.String("selftest.output", "dockapp-battery-selftest.png", "path of the png image written by -selftest")
+	fontconfig := flag.Bool("fontconfig", false, "locate fonts with fontconfig (fc-match) when it is installed")
+	listFonts := flag.Bool("list-fonts", false, "print the available fonts and exit")
+	pprofAddr := flag.String("pprof.addr", "", "serve net/http/pprof on the given address (e.g. localhost:6060)")
+	cpuprofile := flag.String("cpuprofile", "", "write a cpu profile to the given file on exit")
+	memprofile := flag.String("memprofile", "", "write a heap profile to the given file on exit")
 	flag.Parse()
 
-	// remaining arguments are text formatters to rotate between
+	if *fontconfig {
+		locateFont = LocateFontFC
+	}
+	if *listFonts {
+		printFonts(os.Stdout)
+		return
+	}
+
+	stopProfiling, err := startProfiling(*pprofAddr, *cpuprofile, *memprofile)
+	if err != nil {
+		log.Fatalf("profile: %v", err)
+	}
+	defer stopProfiling()
+
+	tag, err := language.Parse(*locale)
+	if err != nil {
+		log.Fatalf("locale: %v", err)
+	}
+	battery.SetLocale(tag)
+	battery.SetRemainingText(battery.RemainingText{
+		Full:    *textFull,
+		Empty:   *textEmpty,
+		Unknown: *textUnknown,
+	})
+	durationStyle, err := battery.ParseDurationStyle(*textDurationStyle)
+	if err != nil {
+		log.Fatalf("text: %v", err)
+	}
+	battery.SetDurationStyle(durationStyle)
+
+	// remaining arguments are text formatters to rotate between, unless each
+	// text box is given its own formatter.
+	templates := flag.Args()
+	textRect := textRects.Rects()[0]
+	if len(textFormats) > 0 {
+		if len(templates) > 0 {
+			log.Fatalf("template: arguments cannot be combined with -text.format")
+		}
+		if len(textRects.rects) != len(textFormats) {
+			log.Fatalf("text: %d geometries given for %d formats", len(textRects.rects), len(textFormats))
+		}
+		templates = textFormats
+	} else if len(textRects.rects) > 1 {
+		log.Fatalf("text: multiple geometries given without -text.format")
+	}
+	formatTemplate := battery.FormatMetricTemplate
+	if *templateStrict {
+		formatTemplate = battery.FormatMetricTemplateStrict
+	}
 	var formatters []battery.MetricFormatter
-	for _, tsrc := range flag.Args() {
-		t, err := battery.FormatMetricTemplate(tsrc)
+	for _, tsrc := range templates {
+		t, err := formatTemplate(tsrc)
 		if err != nil {
 			log.Fatalf("template: %v %q", err, tsrc)
 		}
 		formatters = append(formatters, t)
 	}
 	if len(formatters) == 0 {
-		formatters = append(formatters, defaultFormatters...)
+		formatters = append(formatters, defaultFormatters(*percentPrecision)...)
 	}
 
-	// Open the specified font.
-	ttfpath, err := LocateFont(*textFont)
-	if err != nil {
-		log.Fatalf("font: %v", err)
+	// associate formatters with any fonts given for them specifically.  fonts
+	// are associated first so that padding measures each formatter in its
+	// own font.
+	if *textFonts != "" {
+		specs := strings.Split(*textFonts, ",")
+		if len(specs) > len(formatters) {
+			log.Fatalf("font: more fonts than text templates")
+		}
+		for i, spec := range specs {
+			if spec == "" {
+				continue
+			}
+			style, err := parseTextStyle(spec)
+			if err != nil {
+				log.Fatalf("font: %v %q", err, spec)
+			}
+			formatters[i] = StyleFormatter(formatters[i], style)
+		}
 	}
-	font, err := ReadFontFile(ttfpath)
-	if err != nil {
-		log.Fatalf("font: %v", err)
+
+	if *textPad {
+		formatters = battery.AlignMetricFormatters(formatters...)
 	}
 
 	// configure the application window layout
 	layout := &AppLayout{
 		rect:      *window,
 		battRect:  *battRect,
-		textRect:  *textRect,
+		textRect:  textRect,
 		thickness: *borderThickness,
 		DPI:       72,
-		font:      font,
 		fontSize:  *textFontSize,
 	}
+	layout.mirror = *battMirror
+	layout.vertical = *battVertical
+	if *battRound {
+		if *battRadius <= 0 {
+			log.Fatalf("battery: radius must be positive")
+		}
+		layout.radius = *battRadius
+	}
+	switch *layoutName {
+	case "":
+	case "compact":
+		layout.battRect, layout.textRect = compactLayout(*window, *layoutRatio)
+	default:
+		log.Fatalf("layout: unknown layout %q", *layoutName)
+	}
+	if *battHidden {
+		layout.hideBattery = true
+		layout.battRect = image.Rectangle{}
+		if !isFlagSet("text.geometry") {
+			layout.textRect = *window
+		}
+	}
+	if *textHidden {
+		layout.hideText = true
+		layout.textRect = image.Rectangle{}
+		if !isFlagSet("battery.geometry") {
+			layout.battRect = *window
+		}
+	} else {
+		layout.font = openFont(*textFont)
+	}
+
+	// text boxes with their own formatters replace the rotating text box.
+	var textBoxes []TextBox
+	if len(textFormats) > 0 {
+		layout.textRect = image.Rectangle{}
+		for i, f := range formatters {
+			textBoxes = append(textBoxes, TextBox{Rect: textRects.rects[i], Formatter: f})
+		}
+		// the draw loop still requires a formatter though it is not drawn.
+		formatters = formatters[:1]
+	}
 
 	app := NewApp(layout)
+	app.TextBoxes = textBoxes
+	if !historyRect.Empty() {
+		app.History = NewHistory(*historyRect)
+	}
 	app.BatteryColor = defaultGrey
-
-	// Connect to the x server and create a dockapp window for the process.
-	X, err := xgbutil.NewConn()
+	pal, ok := palettes[*palette]
+	if !ok {
+		log.Fatalf("palette: unknown palette %q", *palette)
+	}
+	if *battCritical < 0 || *battCritical > *battLow || *battLow > 1 {
+		log.Fatalf("battery: thresholds must satisfy 0 <= -battery.critical <= -battery.low <= 1")
+	}
+	lowFrac, criticalFrac := *battLow, *battCritical
+	app.EnergyColor = func(metrics *battery.Metrics) color.Color {
+		return pal.ThresholdColor(metrics, lowFrac, criticalFrac)
+	}
+	app.BlinkInterval = *battBlink
+	app.ChargePeriod = *chargePeriod
+	app.Blinking = func(metrics *battery.Metrics) bool {
+		discharging := metrics.State == battery.Discharging || metrics.State == battery.Empty
+		return discharging && metrics.Fraction <= criticalFrac
+	}
+	if *iconTheme != "" {
+		app.Icons = NewIconTheme(*iconTheme)
+	}
+	if *textOutline {
+		app.OutlineColor, err = parseColor(*textOutlineColor)
+		if err != nil {
+			log.Fatalf("outline: %v", err)
+		}
+		app.OutlineWidth = *textOutlineWidth
+	}
+	app.TextAlign, err = parseTextAlign(*textAlign)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("text: %v", err)
+	}
+
+	if *selfTest {
+		err := writeSelfTest(*selfTestOutput, app, formatters[0])
+		if err != nil {
+			log.Fatalf("selftest: %v", err)
+		}
+		return
 	}
-	dockapp, err := dockapp.New(X, *window)
+
+	emit, err := parseEmit(*emitFormat)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("emit: %v", err)
 	}
-	defer dockapp.Destroy()
 
 	// begin profiling the battery.  prime the profile by immediately calling
 	// the Metrics method.
 	metricsc := make(chan *battery.Metrics, 1)
-	guage, err := creeperguage.NewCreeperBatteryGuage()
+	var guage battery.Guage
+	if *mock != "" {
+		script, err := parseMock(*mock)
+		if err != nil {
+			log.Fatalf("mock: %v", err)
+		}
+		guage = battery.NewMockGuage(script...)
+	} else {
+		guage, err = newGuage(*backend, *backendCmd, *battAll)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if g, ok := guage.(*execguage.ExternalGuage); ok {
+		defer g.Stop()
+	}
+	if *smoothing < 0 || *smoothing >= 1 {
+		log.Fatalf("smoothing: %v is not in the range [0, 1)", *smoothing)
+	}
+	var bguage battery.Guage = guage
+	if *smoothing > 0 {
+		bguage = battery.NewSmoothGuage(guage, *smoothing)
+	}
+	if *jitter < 0 || *jitter >= 1 {
+		log.Fatalf("jitter: %v is not in the range [0, 1)", *jitter)
+	}
+	batt := battery.NewProfiler(bguage)
+	batt.Jitter = *jitter
+	app.LastUpdated = batt.LastUpdated
+	app.StallAfter = *stallAfter
+	app.StallStacks = *stallStacks
+	app.StaleAfter = *staleAfter
+
+	// without a display metrics are emitted and no window is created.
+	if emit != nil && os.Getenv("DISPLAY") == "" {
+		emitted := make(chan *battery.Metrics, 1)
+		go batt.Start(time.Minute, emitted)
+		defer batt.Stop()
+		err := emit(os.Stdout, emitted)
+		if err != nil {
+			log.Fatalf("emit: %v", err)
+		}
+		return
+	}
+
+	// Connect to the x server and create a dockapp window for the process.
+	X, err := xgbutil.NewConn()
 	if err != nil {
 		log.Fatal(err)
 	}
-	batt := battery.NewProfiler(guage)
-	go batt.Start(time.Minute, metricsc)
+	newDockApp := dockapp.New
+	if *transparent {
+		newDockApp = dockapp.NewARGB
+		app.BackgroundColor = color.Transparent
+	}
+	dock, err := newDockApp(X, *window)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer dock.Destroy()
+
+	// the critical action examines each poll before it is drawn.  the action
+	// is displayed while it awaits confirmation and clicking the window
+	// cancels it (see below).
+	var critical *CriticalAction
+	if *criticalSuspend != 0 {
+		if *criticalSuspend < 0 || *criticalSuspend > 100 {
+			log.Fatalf("critical: %v is not a percent", *criticalSuspend)
+		}
+		command := strings.Fields(*criticalCommand)
+		if len(command) == 0 {
+			log.Fatalf("critical: no command")
+		}
+		critical = NewCriticalAction(*criticalSuspend/100, command, *criticalConfirm, log.Printf)
+		critical.Changed = batt.Refresh
+		app.Notice = critical.Notice
+	}
+
+	// each poll is emitted, recorded in the history and examined by the
+	// critical action before it is drawn.
+	var emitted chan *battery.Metrics
+	if emit != nil {
+		emitted = make(chan *battery.Metrics, 1)
+		go func() {
+			err := emit(os.Stdout, emitted)
+			if err != nil {
+				log.Printf("emit: %v", err)
+			}
+		}()
+	}
+	if critical != nil || app.History != nil || emitted != nil {
+		polled := make(chan *battery.Metrics, 1)
+		go func() {
+			for m := range polled {
+				if emitted != nil {
+					// a slow reader of stdout does not delay drawing.
+					select {
+					case emitted <- m:
+					default:
+					}
+				}
+				if critical != nil {
+					critical.Update(m)
+				}
+				if app.History != nil {
+					app.History.Add(m.Fraction)
+				}
+				metricsc <- m
+			}
+		}()
+		go batt.Start(time.Minute, polled)
+	} else {
+		go batt.Start(time.Minute, metricsc)
+	}
 	defer batt.Stop()
 
+	// poll the battery immediately upon receiving SIGUSR1.
+	notifyRefresh(batt.Refresh)
+
+	// stop polling and drawing while the window is hidden.  drawing resumes
+	// before polling so that the refreshed metrics are drawn.  polling
+	// continues when there is a critical action.
+	if *pauseHidden {
+		gate := new(drawGate)
+		app.Paused = gate.Paused
+		pausers := []dockapp.Pauser{gate}
+		if critical == nil {
+			// the critical action must see the battery discharge while the
+			// window is hidden.
+			pausers = append(pausers, batt)
+		}
+		go dockapp.PauseHidden(dock.Visibility(), pausers...)
+	}
+
+	// exit the event loop on SIGINT or SIGTERM so that deferred cleanup, like
+	// writing profiles, happens before the process exits.
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		s := <-quit
+		signal.Stop(quit)
+		log.Printf("signal received: %s", s)
+		dock.Quit()
+	}()
+
 	// rotate through all provided formatters (or the default set), sending
 	// them to the draw loop at the specified interval.
 	formatterc := make(chan battery.MetricFormatter, 1)
-	go battery.RotateMetricsFormat(*textInterval, formatterc, formatters...)
+	rotate := make(chan battery.RotateCommand, 1)
+	stopRotate := make(chan struct{})
+	defer close(stopRotate)
+	go battery.RotateMetricsFormatControl(*textInterval, formatterc, rotate, stopRotate, formatters...)
+
+	// a left click advances to the next formatter and a right click pauses
+	// rotation, unless the click cancels a critical action.
+	dock.OnButtonPress(func(ev xproto.ButtonPressEvent, pos image.Point) {
+		if critical != nil && critical.Cancel() {
+			return
+		}
+		var cmd battery.RotateCommand
+		switch ev.Detail {
+		case dockapp.ButtonLeft:
+			cmd = battery.RotateAdvance
+		case dockapp.ButtonRight:
+			cmd = battery.RotatePause
+		default:
+			return
+		}
+		select {
+		case rotate <- cmd:
+		default:
+		}
+	})
 
 	// begin the main draw loop. the draw loop receives updates in the form of
 	// new battery metrics and formatters.  The event loop will exit if the
-	// draw loop ever terminates.
-	go RunApp(dockapp, app, metricsc, formatterc)
+	// draw loop ever terminates.  the window is recreated on a new connection
+	// if the x server cannot draw it.
+	go func() {
+		defer dock.Quit()
+		RunApp(dockapp.NewWatchdog(dock, *retries, time.Second), app, *maxFPS, metricsc, formatterc)
+	}()
 
 	// finally map the window and start the main event loop
-	dockapp.Main()
+	dock.Main()
+}
+
+// parseMock parses a comma separated list of metrics for a mock battery.  Each
+// entry is a fraction with an optional ":state" suffix naming a battery.State
+// (e.g. "0.5:Charging").  The state of an entry without a suffix is
+// Discharging.
+func parseMock(s string) ([]*battery.Metrics, error) {
+	var script []*battery.Metrics
+	for _, entry := range strings.Split(s, ",") {
+		m := &battery.Metrics{State: battery.Discharging}
+		fraction := entry
+		if i := strings.Index(entry, ":"); i >= 0 {
+			state, err := battery.ParseState(entry[i+1:])
+			if err != nil {
+				return nil, err
+			}
+			m.State = state
+			fraction = entry[:i]
+		}
+		var err error
+		m.Fraction, err = strconv.ParseFloat(fraction, 64)
+		if err != nil || m.Fraction < 0 || m.Fraction > 1 {
+			return nil, fmt.Errorf("invalid fraction %q", fraction)
+		}
+		m.OnAC = battery.InferOnAC(m.State)
+		script = append(script, m)
+	}
+	return script, nil
+}
+
+// newGuage returns the battery.Guage for the named backend.  The exec backend
+// runs command, which is split into fields, and continues running it until
+// the process exits.  If all is true the upower backend combines every battery
+// it detects.
+func newGuage(backend, command string, all bool) (battery.Guage, error) {
+	if all && backend != "upower" {
+		return nil, fmt.Errorf("%s: batteries can only be combined with the upower backend", backend)
+	}
+	switch backend {
+	case "upower":
+		if all {
+			guages, err := creeperguage.NewCreeperBatteryGuages()
+			if err != nil {
+				return nil, err
+			}
+			var g []battery.Guage
+			for _, guage := range guages {
+				g = append(g, guage)
+			}
+			return battery.NewMultiGuage(g...), nil
+		}
+		return creeperguage.NewCreeperBatteryGuage()
+	case "sysfs":
+		return sysfsguage.NewSysfsGuage()
+	case "sys":
+		return sysguage.New()
+	case "exec":
+		args := strings.Fields(command)
+		if len(args) == 0 {
+			return nil, fmt.Errorf("exec: no command given by -battery.cmd")
+		}
+		g := execguage.New(args[0], args[1:]...)
+		err := g.Start()
+		if err != nil {
+			return nil, err
+		}
+		return g, nil
+	default:
+		return nil, fmt.Errorf("unknown battery backend %q", backend)
+	}
 }
 
-// RunApp runs the main loop for the application.
-func RunApp(dockapp *dockapp.DockApp, app *App, metrics <-chan *battery.Metrics, formatter <-chan battery.MetricFormatter) {
-	defer dockapp.Quit()
+// defaultBackend returns the default battery backend, which is upower on
+// Linux and the native interface of other platforms.
+func defaultBackend() string {
+	if runtime.GOOS == "linux" {
+		return "upower"
+	}
+	return "sys"
+}
+
+// fallbackFormatter is drawn in place of a formatter which fails.
+var fallbackFormatter battery.MetricFormatter = battery.MetricFormatFunc(battery.FormatPercent)
+
+// RunApp runs the main loop for the application.  When maxFPS is positive
+// the window is redrawn at most maxFPS times per second, always with the
+// latest metrics and formatter.  A formatter which returns an error, like a
+// template referencing a nonexistent field, is logged and the percentage is
+// drawn in its place.  While the latest metrics are animated, blinking or
+// charging, the window is redrawn for each frame of the animation.  RunApp
+// returns when either channel is closed.
+func RunApp(surface dockapp.Surface, app *App, maxFPS float64, metrics <-chan *battery.Metrics, formatter <-chan battery.MetricFormatter) {
+	var interval time.Duration
+	if maxFPS > 0 {
+		interval = time.Duration(float64(time.Second) / maxFPS)
+	}
+	stall := &stallDetector{
+		clock:     battery.SystemClock,
+		threshold: app.StallAfter,
+		stacks:    app.StallStacks,
+		logf:      log.Printf,
+	}
+	drawLoop(battery.SystemClock, interval, app.animation, metrics, formatter, func(m *battery.Metrics, f battery.MetricFormatter, elapsed time.Duration) {
+		if app.Paused != nil && app.Paused() {
+			return
+		}
+		app.setAnimation(m, elapsed)
+		if app.Notice != nil {
+			if notice := app.Notice(); notice != "" {
+				f = battery.MetricFormatFunc(func(*battery.Metrics) string { return notice })
+			}
+		}
+
+		// draw the widget to the screen.
+		stall.watch("draw", func() {
+			err := app.Draw(surface.Canvas(), m, f)
+			if err != nil {
+				log.Panic(err)
+			}
+			err = surface.FlushImage()
+			if err != nil {
+				log.Panic(err)
+			}
+		})
+	})
+}
+
+// drawGate is a dockapp.Pauser that pauses drawing.
+type drawGate struct {
+	paused int32
+}
+
+func (g *drawGate) Pause()  { atomic.StoreInt32(&g.paused, 1) }
+func (g *drawGate) Resume() { atomic.StoreInt32(&g.paused, 0) }
+
+// Paused returns true if drawing is paused.
+func (g *drawGate) Paused() bool {
+	return atomic.LoadInt32(&g.paused) != 0
+}
+
+// drawLoop calls draw with the latest metrics and formatter each time either
+// is received.  Updates received within interval of the previous draw are
+// coalesced into a single call to draw once the interval has elapsed.
+//
+// If animate is not nil and returns a positive frame interval for the latest
+// metrics draw is also called every frame, with the time elapsed since the
+// animation began.  The elapsed time is reset when the frame interval changes
+// and no timer runs while the metrics are not animated.  drawLoop returns when
+// either channel is closed.
+func drawLoop(clock battery.Clock, interval time.Duration, animate func(*battery.Metrics) time.Duration, metrics <-chan *battery.Metrics, formatter <-chan battery.MetricFormatter, draw func(m *battery.Metrics, f battery.MetricFormatter, elapsed time.Duration)) {
 	var m *battery.Metrics
 	var f battery.MetricFormatter
+	var last time.Time
+	var pending <-chan time.Time
+	var frame, elapsed time.Duration
+	var framec <-chan time.Time
+	redraw := func() {
+		last = clock.Now()
+		var d time.Duration
+		if animate != nil {
+			d = animate(m)
+		}
+		if d != frame {
+			frame, elapsed, framec = d, 0, nil
+		}
+		if frame > 0 && framec == nil {
+			framec = clock.After(frame)
+		}
+		draw(m, f, elapsed)
+	}
 	for {
+		var ok bool
 		select {
-		case m = <-metrics:
-		case f = <-formatter:
+		case m, ok = <-metrics:
+		case f, ok = <-formatter:
+		case <-pending:
+			pending = nil
+			redraw()
+			continue
+		case <-framec:
+			framec = nil
+			elapsed += frame
+			redraw()
+			continue
+		}
+		if !ok {
+			return
 		}
 		if m == nil {
 			log.Printf("nil metrics")
@@ -218,13 +1081,90 @@ func RunApp(dockapp *dockapp.DockApp, app *App, metrics <-chan *battery.Metrics,
 			log.Printf("nil formatter")
 			continue
 		}
-		// draw the widget to the screen.
-		err := app.Draw(dockapp.Canvas(), m, f)
+		if pending != nil {
+			continue
+		}
+		if !last.IsZero() {
+			wait := interval - clock.Now().Sub(last)
+			if wait > 0 {
+				pending = clock.After(wait)
+				continue
+			}
+		}
+		redraw()
+	}
+}
+
+// compactLayout divides window into a battery rectangle on the left and a
+// text rectangle using the remaining width.  The battery occupies the given
+// fraction of the window's width, or a square if ratio is zero.  The battery
+// graphic is inset by a pixel from its rectangle.
+func compactLayout(window image.Rectangle, ratio float64) (batt, text image.Rectangle) {
+	if ratio <= 0 {
+		ratio = float64(window.Dy()) / float64(window.Dx())
+	}
+	batt, text = geometry.SplitRatio(window, ratio)
+	return geometry.Contract(batt, 1), text
+}
+
+// isFlagSet returns true if the named flag was given on the command line.
+func isFlagSet(name string) bool {
+	var set bool
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// openFont locates and parses the named font.  If the font cannot be located
+// or parsed openFont falls back to the font embedded in the program.
+func openFont(name string) *truetype.Font {
+	font, err := LoadFont(name)
+	if err != nil {
+		log.Printf("font: %v (using %s)", err, DefaultFontName)
+		font, err = ReadDefaultFont()
+		if err != nil {
+			log.Fatalf("font: %v", err)
+		}
+	}
+	return font
+}
+
+// printFonts writes the name and path of each font that can be located to w.
+func printFonts(w io.Writer) {
+	for _, path := range ListFonts() {
+		ttf, err := ReadFontFile(path)
+		if err != nil {
+			log.Printf("font: %v %q", err, path)
+			continue
+		}
+		fmt.Fprintf(w, "%s → %s\n", FontName(ttf), path)
+	}
+}
+
+// parseTextStyle loads the font described by spec, a font name with an
+// optional ":size" suffix.  If the font cannot be located or parsed the
+// returned style uses the application font.
+func parseTextStyle(spec string) (*TextStyle, error) {
+	style := &TextStyle{}
+	name := spec
+	if i := strings.LastIndex(spec, ":"); i >= 0 {
+		size, err := strconv.ParseFloat(spec[i+1:], 64)
 		if err != nil {
-			log.Panic(err)
+			return nil, fmt.Errorf("invalid size")
 		}
-		dockapp.FlushImage()
+		name = spec[:i]
+		style.FontSize = size
+	}
+	var err error
+	style.Font, err = LoadFont(name)
+	if err != nil {
+		// the application font is used when the font is unusable.
+		log.Printf("font: %v (using the application font)", err)
 	}
+	return style, nil
 }
 
 // AppLayout is configuration the defines the relative geometries of
@@ -236,71 +1176,256 @@ type AppLayout struct {
 	font      *truetype.Font
 	fontSize  float64
 	DPI       float64
+
+	// hideText disables text rendering.  No font is required when text is
+	// hidden.
+	hideText bool
+
+	// hideBattery disables rendering of the battery graphic.
+	hideBattery bool
+
+	// mirror reflects the battery graphic horizontally, putting the cap on
+	// the right so that energy drains toward the right.
+	mirror bool
+
+	// vertical stands the battery graphic upright, putting the cap on top so
+	// that energy drains toward the top.  A mirrored vertical battery has its
+	// cap on the bottom.
+	vertical bool
+
+	// radius is the radius in pixels of the battery body's anti-aliased
+	// rounded corners.  When radius is zero the corners are square.
+	radius float64
+}
+
+// batteryVisible returns true if the battery graphic is rendered with the
+// layout.
+func (layout *AppLayout) batteryVisible() bool {
+	return !layout.hideBattery && !layout.battRect.Empty()
+}
+
+// textVisible returns true if text is rendered with the layout.
+func (layout *AppLayout) textVisible() bool {
+	return !layout.hideText && !layout.textRect.Empty()
 }
 
 // App is the battery dockapp.
 type App struct {
-	Layout       *AppLayout
-	BatteryColor color.Color
-	EnergyColor  func(*battery.Metrics) color.Color
+	Layout          *AppLayout
+	BackgroundColor color.Color
+	BatteryColor    color.Color
+	EnergyColor     func(*battery.Metrics) color.Color
+
+	// If LastUpdated is not nil and returns a time older than StaleAfter the
+	// metrics are considered stale and the battery energy is drawn without
+	// color.
+	LastUpdated func() time.Time
+	StaleAfter  time.Duration
+
+	// If Paused is not nil and returns true RunApp does not draw, as when the
+	// window is hidden.
+	Paused func() bool
+
+	// If BlinkInterval is positive and Blinking returns true for the metrics
+	// RunApp alternately draws and erases the battery's energy every
+	// BlinkInterval, as when the battery is critically low.
+	BlinkInterval time.Duration
+	Blinking      func(*battery.Metrics) bool
+
+	// If ChargePeriod is positive RunApp draws a charging battery with a
+	// translucent fill rising from its level to full every ChargePeriod.
+	ChargePeriod time.Duration
+
+	// If Notice is not nil and returns a non-empty string RunApp draws the
+	// string in place of the formatted metrics, as when a critical action
+	// awaits confirmation.
+	Notice func() string
+
+	// If StallAfter is positive RunApp logs a warning when drawing and
+	// flushing the window takes longer than StallAfter, followed by the
+	// stacks of all goroutines if StallStacks is true.
+	StallAfter  time.Duration
+	StallStacks bool
+
+	// TextBoxes are drawn in addition to the layout's text box, each with its
+	// own formatter.  TextBoxes are not drawn if the layout hides text.
+	TextBoxes []TextBox
+
+	// If History is not nil its sparkline of recent charge is drawn after
+	// the battery and beneath any text.
+	History *History
+
+	// If Icons is not nil the icon named by the metrics is drawn in place of
+	// the battery graphic.  The battery graphic is drawn when the metrics do
+	// not name an icon or the icon cannot be found.
+	Icons *IconTheme
+
+	OutlineColor color.Color
+	OutlineWidth int
+	TextAlign    TextAlign
+	blinkOff     bool
+	chargePhase  float64
 	maskBattery  image.Image
 	maskEnergy   image.Image
 	minEnergy    int
 	maxEnergy    int
 	tt           *freetype.Context
 	font         *font.Drawer
+	faces        map[TextStyle]font.Face
+	alignedCache alignedWidthCache
+	formatErrs   map[string]bool
+}
+
+// TextStyle describes the font used to render formatted text.  A nil Font or a
+// zero FontSize defers to the application layout.
+type TextStyle struct {
+	Font     *truetype.Font
+	FontSize float64
+}
+
+// StyleFormatter returns a MetricFormatter that is rendered with the given
+// style instead of the default application font.
+// If f is a battery.MaxMetricFormatter the returned MetricFormatter is too.
+func StyleFormatter(f battery.MetricFormatter, style *TextStyle) battery.MetricFormatter {
+	sf := &styledFormatter{f, style}
+	if _, ok := f.(battery.MaxMetricFormatter); ok {
+		return &styledMaxFormatter{sf}
+	}
+	return sf
+}
+
+type styledFormatter struct {
+	battery.MetricFormatter
+	style *TextStyle
+}
+
+// FormatError implements the battery.ErrorMetricFormatter interface.
+func (f *styledFormatter) FormatError(m *battery.Metrics) (string, error) {
+	return battery.FormatMetrics(f.MetricFormatter, m)
+}
+
+// styledMaxFormatter is a styledFormatter for a battery.MaxMetricFormatter.
+type styledMaxFormatter struct {
+	*styledFormatter
+}
+
+// MaxFormattedWidth implements the battery.MaxMetricFormatter interface.
+func (f *styledMaxFormatter) MaxFormattedWidth() string {
+	return f.MetricFormatter.(battery.MaxMetricFormatter).MaxFormattedWidth()
+}
+
+// formatterStyle returns the text style of f, with any unset fields taken from
+// the application layout, and the formatter styled by f.
+func (app *App) formatterStyle(f battery.MetricFormatter) (TextStyle, battery.MetricFormatter) {
+	switch sf := f.(type) {
+	case *styledFormatter:
+		return app.textStyle(sf.style), sf.MetricFormatter
+	case *styledMaxFormatter:
+		return app.textStyle(sf.style), sf.MetricFormatter
+	}
+	return app.textStyle(nil), f
 }
 
 // NewApp returns a new dockapp.
 func NewApp(layout *AppLayout) *App {
 	app := &App{
-		Layout:       layout,
-		BatteryColor: color.Black,
+		Layout:          layout,
+		BackgroundColor: color.White,
+		BatteryColor:    color.Black,
 	}
 	app.initLayout()
 	return app
 }
 
-var white = image.NewUniform(color.White)
 var black = image.NewUniform(color.Black)
 var transparent = image.NewUniform(color.Transparent)
 var opaque = image.NewUniform(color.Opaque)
 
-// initLayout constructs two masks for drawing the battery and the remaining
+// initLayout prepares the App to draw the components visible in its layout.
+func (app *App) initLayout() {
+	if app.Layout.batteryVisible() {
+		app.initBattery()
+	}
+	if app.Layout.textVisible() {
+		app.initText()
+	}
+}
+
+// initBattery constructs two masks for drawing the battery and the remaining
 // energy as well as sets the pixel bounds for drawing energy capacity.  the
 // masks allow for simplified space-fills and reduced chance of pixel gaps.
-func (app *App) initLayout() {
+func (app *App) initBattery() {
 	var zeropt image.Point
 
-	rectOutTop := image.Rectangle{Min: app.Layout.battRect.Min, Max: app.Layout.battRect.Min.Add(image.Point{2, 2})}
-	rectOutBottom := rectOutTop.Add(image.Point{Y: app.Layout.battRect.Size().Y - rectOutTop.Size().Y})
+	// a vertical battery is constructed horizontally in transposed
+	// coordinates, where its cap is on the left.
+	battRect := app.batteryRect()
+	rectOutTop := image.Rectangle{Min: battRect.Min, Max: battRect.Min.Add(image.Point{2, 2})}
+	rectOutBottom := rectOutTop.Add(image.Point{Y: battRect.Size().Y - rectOutTop.Size().Y})
 	capRect := image.Rectangle{
 		Min: image.Point{X: rectOutTop.Min.X, Y: rectOutTop.Max.Y},
 		Max: image.Point{X: rectOutBottom.Max.X, Y: rectOutBottom.Min.Y},
 	}
-	bodyRect := app.Layout.battRect
+	bodyRect := battRect
 	bodyRect.Min.X = capRect.Max.X
 
 	// energy will be drawn under the battery shell.  The only place where it
 	// is not safe to draw energy is outside the battery on the positive end.
-	energyMask := image.NewAlpha(app.Layout.battRect)
-	draw.Draw(energyMask, app.Layout.battRect, opaque, zeropt, draw.Over)
-	draw.Draw(energyMask, rectOutTop, transparent, zeropt, draw.Src)
-	draw.Draw(energyMask, rectOutBottom, transparent, zeropt, draw.Src)
-	app.maskEnergy = energyMask
+	energyMask := image.NewAlpha(battRect)
+	if app.Layout.radius > 0 {
+		// the cap is drawn square and joined to a body with rounded corners
+		// instead of cutting the corners out of a rectangle.
+		draw.Draw(energyMask, capRect, opaque, zeropt, draw.Src)
+		outer := roundedRectMask(bodyRect, app.Layout.radius)
+		draw.Draw(energyMask, bodyRect, outer, bodyRect.Min, draw.Over)
+	} else {
+		draw.Draw(energyMask, battRect, opaque, zeropt, draw.Over)
+		draw.Draw(energyMask, rectOutTop, transparent, zeropt, draw.Src)
+		draw.Draw(energyMask, rectOutBottom, transparent, zeropt, draw.Src)
+	}
 
 	// the body uses the same mask as the energy with additional transparency
 	// inside the battery's shell.  the mask construction is complex because
 	// area inside the cap may be exposed.
-	bodyMask := image.NewAlpha(app.Layout.battRect)
-	draw.Draw(bodyMask, app.Layout.battRect, energyMask, app.Layout.battRect.Min, draw.Over)
+	bodyMask := image.NewAlpha(battRect)
+	draw.Draw(bodyMask, battRect, energyMask, battRect.Min, draw.Over)
 	bodyMaskRect := shrinkRect(bodyRect, app.Layout.thickness)
-	draw.Draw(bodyMask, bodyMaskRect, transparent, zeropt, draw.Src)
+	if app.Layout.radius > 0 {
+		// the inside of the shell is rounded concentrically with the outside
+		// and its coverage is removed from the mask.
+		inner := roundedRectMask(bodyMaskRect, app.Layout.radius-float64(app.Layout.thickness))
+		draw.DrawMask(bodyMask, bodyMaskRect, transparent, zeropt, inner, bodyMaskRect.Min, draw.Src)
+	} else {
+		draw.Draw(bodyMask, bodyMaskRect, transparent, zeropt, draw.Src)
+	}
 	capMaskRect := shrinkRect(capRect, app.Layout.thickness)
 	capMaskRect.Max.X += 2 * app.Layout.thickness
 	draw.Draw(bodyMask, capMaskRect, transparent, zeropt, draw.Src)
+
+	// a mirrored battery is constructed as usual and then reflected, with the
+	// energy rect reflected as it is drawn.  a vertical battery is then
+	// transposed into place the same way.
+	if app.Layout.mirror {
+		energyMask = mirrorAlpha(energyMask)
+		bodyMask = mirrorAlpha(bodyMask)
+	}
+	if app.Layout.vertical {
+		energyMask = transposeAlpha(energyMask)
+		bodyMask = transposeAlpha(bodyMask)
+	}
+	app.maskEnergy = energyMask
 	app.maskBattery = bodyMask
 
+	// the rectangle in which energy is drawn needs to account for thickness to
+	// make the visible percentage more accurate.  after adjustment reduce the
+	// energy rect to account for the account of energy drained.  the energy
+	// mask makes computing Y bounds largely irrelevant.
+	app.minEnergy = capMaskRect.Min.X
+	app.maxEnergy = bodyMaskRect.Max.X
+}
+
+// initText prepares the App to render text using the layout's font.
+func (app *App) initText() {
 	// create a freetype.Context to render text.  each time the context is used
 	// it must have its SetDst method called.
 	app.tt = freetype.NewContext()
@@ -309,79 +1434,498 @@ func (app *App) initLayout() {
 	app.tt.SetDPI(app.Layout.DPI)
 	app.tt.SetFont(app.Layout.font)
 	app.tt.SetFontSize(app.Layout.fontSize)
-	ttopt := &truetype.Options{
-		Size: app.Layout.fontSize,
-		DPI:  app.Layout.DPI,
-	}
-	ttface := truetype.NewFace(app.Layout.font, ttopt)
+	app.faces = make(map[TextStyle]font.Face)
 	app.font = &font.Drawer{
 		Src:  black,
-		Face: ttface,
+		Face: app.face(app.textStyle(nil)),
 	}
-
-	// the rectangle in which energy is drawn needs to account for thickness to
-	// make the visible percentage more accurate.  after adjustment reduce the
-	// energy rect to account for the account of energy drained.  the energy
-	// mask makes computing Y bounds largely irrelevant.
-	app.minEnergy = capMaskRect.Min.X
-	app.maxEnergy = bodyMaskRect.Max.X
 }
 
 // Draw renders metrics in the application window with the given formatter.
 func (app *App) Draw(img draw.Image, metrics *battery.Metrics, f battery.MetricFormatter) error {
-	draw.Draw(img, app.Layout.rect, white, image.Point{}, draw.Over)
-	app.drawBattery(img, metrics)
-	return app.drawText(img, metrics, f)
+	bg := image.NewUniform(app.BackgroundColor)
+	draw.Draw(img, app.Layout.rect, bg, image.Point{}, draw.Src)
+	if app.Layout.batteryVisible() {
+		app.drawBattery(img, metrics)
+	}
+	if app.History != nil {
+		app.drawHistory(img, metrics)
+	}
+	if app.Layout.textVisible() {
+		err := app.drawText(img, app.Layout.textRect, metrics, f)
+		if err != nil {
+			return err
+		}
+	}
+	if app.Layout.hideText {
+		return nil
+	}
+	for _, box := range app.TextBoxes {
+		err := app.drawText(img, box.Rect, metrics, box.Formatter)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Render returns a newly allocated image of the application window with
+// metrics rendered using the given formatter.  Render is useful for
+// compositing the application into a larger image.
+func (app *App) Render(metrics *battery.Metrics, f battery.MetricFormatter) (*image.RGBA, error) {
+	img := image.NewRGBA(app.Layout.rect)
+	err := app.Draw(img, metrics, f)
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
 }
 
 func (app *App) drawBattery(img draw.Image, metrics *battery.Metrics) {
 	var zeropt image.Point
 
-	// shrink the rectangle in which energy is drawn to account for thickness
-	// and make the visible percentage more accurate.  after adjustment reduce
-	// the energy rect to account for the account of energy drained.
-	energyRect := app.Layout.battRect
-	energyRect.Min.X = app.minEnergy
-	energyRect.Max.X = app.maxEnergy
-	energySize := energyRect.Size()
-	drain := 1 - metrics.Fraction
-	drainSize := int(drain * float64(energySize.X))
-	energyRect.Min.X += drainSize
+	if app.Icons != nil && metrics.IconName != "" {
+		size := app.Layout.battRect.Dx()
+		if app.Layout.battRect.Dy() > size {
+			size = app.Layout.battRect.Dy()
+		}
+		icon, err := app.Icons.Icon(metrics.IconName, size)
+		if err == nil {
+			drawIcon(img, app.Layout.battRect, icon)
+			return
+		}
+	}
+
+	// draw the energy first and overlay the battery shell/border.  the
+	// energy is left out while a blinking battery is off.
+	if !app.blinkOff {
+		energyRect, boundary, partial := app.energyFillRect(metrics.Fraction)
+		energyColor := app.energyColor(metrics)
+		if app.chargePhase > 0 {
+			// the rising fill is drawn beneath the energy so it only
+			// shows beyond the battery's level.
+			rising, _, _ := app.energyFillRect(metrics.Fraction + (1-metrics.Fraction)*app.chargePhase)
+			draw.DrawMask(img, rising, image.NewUniform(scaleAlpha(energyColor, chargeAlpha)), zeropt, app.maskEnergy, rising.Min, draw.Over)
+		}
+		draw.DrawMask(img, energyRect, image.NewUniform(energyColor), zeropt, app.maskEnergy, energyRect.Min, draw.Over)
+		if !boundary.Empty() {
+			draw.DrawMask(img, boundary, image.NewUniform(scaleAlpha(energyColor, partial)), zeropt, app.maskEnergy, boundary.Min, draw.Over)
+		}
+	}
+	draw.DrawMask(img, app.Layout.battRect, image.NewUniform(app.BatteryColor), zeropt, app.maskBattery, app.Layout.battRect.Min, draw.Over)
+}
 
+// chargeFrames is the number of frames drawn each ChargePeriod and chargeAlpha
+// is the opacity of the rising fill drawn while charging.
+const (
+	chargeFrames = 20
+	chargeAlpha  = 0.4
+)
+
+// blinking returns true if the battery blinks with the given metrics.
+func (app *App) blinking(metrics *battery.Metrics) bool {
+	return app.BlinkInterval > 0 && app.Blinking != nil && app.Blinking(metrics)
+}
+
+// charging returns true if the battery is animated charging with the given
+// metrics.
+func (app *App) charging(metrics *battery.Metrics) bool {
+	return app.ChargePeriod > 0 && metrics.State == battery.Charging
+}
+
+// animation returns the interval between frames of the animation of a battery
+// with the given metrics, or zero if the battery is not animated.
+func (app *App) animation(metrics *battery.Metrics) time.Duration {
+	switch {
+	case app.blinking(metrics):
+		return app.BlinkInterval
+	case app.charging(metrics):
+		return app.ChargePeriod / chargeFrames
+	}
+	return 0
+}
+
+// setAnimation sets the animation phase of app to the frame drawn elapsed
+// into the animation of a battery with the given metrics.
+func (app *App) setAnimation(metrics *battery.Metrics, elapsed time.Duration) {
+	app.blinkOff, app.chargePhase = false, 0
+	switch {
+	case app.blinking(metrics):
+		app.blinkOff = (elapsed/app.BlinkInterval)%2 == 1
+	case app.charging(metrics):
+		app.chargePhase = float64(elapsed%app.ChargePeriod) / float64(app.ChargePeriod)
+	}
+}
+
+// energyColor returns the color of the battery's energy, which is
+// desaturated when the metrics are stale.
+func (app *App) energyColor(metrics *battery.Metrics) color.Color {
 	colorfn := app.EnergyColor
 	if colorfn == nil {
 		colorfn = DefaultEnergyColor
 	}
-	energyColor := colorfn(metrics)
+	c := colorfn(metrics)
+	if app.stale() {
+		c = desaturate(c)
+	}
+	return c
+}
 
-	// draw the energy first and overlay the battery shell/border.
-	draw.DrawMask(img, energyRect, image.NewUniform(energyColor), zeropt, app.maskEnergy, energyRect.Min, draw.Over)
-	draw.DrawMask(img, app.Layout.battRect, image.NewUniform(app.BatteryColor), zeropt, app.maskBattery, app.Layout.battRect.Min, draw.Over)
+// energyFillRect returns the rectangle completely filled with energy when the
+// battery holds the given fraction of its capacity.  The column (or row, for a
+// vertical battery) at the boundary of the filled rectangle is partially
+// filled, drawn with an alpha value proportional to the fraction of a pixel it
+// holds.  If no column is partially filled the returned boundary is empty.
+func (app *App) energyFillRect(fraction float64) (fill, boundary image.Rectangle, partial float64) {
+	// the rectangle in which energy is drawn was shrunk to account for
+	// thickness and make the visible percentage more accurate.  reduce it to
+	// the columns completely filled with energy, which drain toward the cap.
+	about := app.batteryRect()
+	fill = about
+	fill.Min.X = app.minEnergy
+	fill.Max.X = app.maxEnergy
+	energy := fraction * float64(fill.Dx())
+	full := int(energy)
+	partial = energy - float64(full)
+	fill.Min.X = fill.Max.X - full
+	if partial > 0 && fill.Min.X > app.minEnergy {
+		boundary = fill
+		boundary.Max.X = boundary.Min.X
+		boundary.Min.X--
+	}
+	if app.Layout.mirror {
+		fill = mirrorRect(fill, about)
+		boundary = mirrorRect(boundary, about)
+	}
+	if app.Layout.vertical {
+		fill = transposeRect(fill)
+		boundary = transposeRect(boundary)
+	}
+	return fill, boundary, partial
+}
+
+// batteryRect returns the rectangle in which the battery graphic is
+// constructed, the layout's battery rectangle transposed if it is vertical.
+func (app *App) batteryRect() image.Rectangle {
+	if app.Layout.vertical {
+		return transposeRect(app.Layout.battRect)
+	}
+	return app.Layout.battRect
+}
+
+// transposeRect reflects r across the line x = y.
+func transposeRect(r image.Rectangle) image.Rectangle {
+	return image.Rect(r.Min.Y, r.Min.X, r.Max.Y, r.Max.X)
+}
+
+// transposeAlpha returns a copy of m reflected across the line x = y.
+func transposeAlpha(m *image.Alpha) *image.Alpha {
+	b := m.Bounds()
+	transposed := image.NewAlpha(transposeRect(b))
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			transposed.SetAlpha(y, x, m.AlphaAt(x, y))
+		}
+	}
+	return transposed
 }
 
-func (app *App) drawText(img draw.Image, metrics *battery.Metrics, f battery.MetricFormatter) error {
-	// measure the text so that it can be centered within the text area.  if f
+// mirrorRect reflects r horizontally across the vertical center line of
+// about.  An empty rectangle is returned unchanged.
+func mirrorRect(r, about image.Rectangle) image.Rectangle {
+	if r.Empty() {
+		return r
+	}
+	minX := about.Min.X + about.Max.X - r.Max.X
+	maxX := about.Min.X + about.Max.X - r.Min.X
+	r.Min.X, r.Max.X = minX, maxX
+	return r
+}
+
+// mirrorAlpha returns a copy of m reflected horizontally within its bounds.
+func mirrorAlpha(m *image.Alpha) *image.Alpha {
+	b := m.Bounds()
+	mirrored := image.NewAlpha(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			mirrored.SetAlpha(b.Min.X+b.Max.X-1-x, y, m.AlphaAt(x, y))
+		}
+	}
+	return mirrored
+}
+
+// drawIcon scales icon to fit within r, preserving its aspect ratio, and draws
+// it centered in r.
+func drawIcon(img draw.Image, r image.Rectangle, icon image.Image) {
+	src := icon.Bounds()
+	scale := math.Min(float64(r.Dx())/float64(src.Dx()), float64(r.Dy())/float64(src.Dy()))
+	size := image.Pt(int(float64(src.Dx())*scale), int(float64(src.Dy())*scale))
+	min := r.Min.Add(r.Size().Sub(size).Div(2))
+	dst := image.Rectangle{Min: min, Max: min.Add(size)}
+	xdraw.CatmullRom.Scale(img, dst, icon, src, draw.Over, nil)
+}
+
+// stale returns true if the metrics being drawn are older than app.StaleAfter.
+func (app *App) stale() bool {
+	if app.LastUpdated == nil || app.StaleAfter <= 0 {
+		return false
+	}
+	updated := app.LastUpdated()
+	return updated.IsZero() || time.Since(updated) > app.StaleAfter
+}
+
+// scaleAlpha returns c with its opacity scaled by f.
+func scaleAlpha(c color.Color, f float64) color.Color {
+	r, g, b, a := c.RGBA()
+	return color.RGBA64{
+		R: uint16(float64(r) * f),
+		G: uint16(float64(g) * f),
+		B: uint16(float64(b) * f),
+		A: uint16(float64(a) * f),
+	}
+}
+
+// desaturate returns the gray with the same luminance and alpha as c.
+func desaturate(c color.Color) color.Color {
+	_, _, _, a := c.RGBA()
+	y := color.Gray16Model.Convert(c).(color.Gray16).Y
+	return color.RGBA64{R: y, G: y, B: y, A: uint16(a)}
+}
+
+// textStyle returns style with any unset fields taken from the application
+// layout.
+func (app *App) textStyle(style *TextStyle) TextStyle {
+	var s TextStyle
+	if style != nil {
+		s = *style
+	}
+	if s.Font == nil {
+		s.Font = app.Layout.font
+	}
+	if s.FontSize == 0 {
+		s.FontSize = app.Layout.fontSize
+	}
+	return s
+}
+
+// face returns a font.Face for style.  Faces are created lazily and cached
+// for the lifetime of the App.
+func (app *App) face(style TextStyle) font.Face {
+	face, ok := app.faces[style]
+	if !ok {
+		ttopt := &truetype.Options{
+			Size: style.FontSize,
+			DPI:  app.Layout.DPI,
+		}
+		face = truetype.NewFace(style.Font, ttopt)
+		app.faces[style] = face
+	}
+	return face
+}
+
+// drawText draws the text formatted by f in r, vertically centered and
+// horizontally aligned by app.TextAlign.  Text is clipped to r so that it does
+// not overlap other text boxes.
+func (app *App) drawText(img draw.Image, r image.Rectangle, metrics *battery.Metrics, f battery.MetricFormatter) error {
+	// the layout may not have a text box of its own.
+	if app.tt == nil {
+		app.initText()
+	}
+
+	// select the font face for the formatter before anything is measured.
+	falign, aligned := f.(battery.AlignedMetricFormatter)
+	if aligned {
+		f = falign.Unaligned()
+	}
+	style, f := app.formatterStyle(f)
+	app.font.Face = app.face(style)
+
+	// measure the text so that it can be aligned within the text area.  if f
 	// is a MaxMetricFormatter use it's MaxFormattedWidth method to determine
 	// the appropriate centering position so that a change in metric values
-	// (but not formatter) will have a smooth transition in the ui.
-	app.font.Dst = img
-	text := f.Format(metrics)
-	measuretext := text
-	if fmax, ok := f.(battery.MaxMetricFormatter); ok {
-		measuretext = fmax.MaxFormattedWidth()
-	}
-	xoffset := app.font.MeasureString(measuretext)
+	// (but not formatter) will have a smooth transition in the ui.  if f is
+	// an AlignedMetricFormatter the widest formatter in its set is used so
+	// that a change in formatter is smooth as well.
+	app.font.Dst = imageutil.SubImage(img, r)
+	text, ok := app.formatText(f, metrics)
+	if !ok {
+		f, aligned = fallbackFormatter, false
+	}
+	var xoffset fixed.Int26_6
+	if aligned {
+		xoffset = app.alignedWidth(falign, metrics)
+	} else if fmax, ok := f.(battery.MaxMetricFormatter); ok {
+		xoffset = app.font.MeasureString(fmax.MaxFormattedWidth())
+	} else {
+		xoffset = app.font.MeasureString(text)
+	}
 	ttwidth := int(xoffset >> 6)
-	ttheight := int(app.tt.PointToFixed(app.Layout.fontSize) >> 6)
-	padleft := (app.Layout.textRect.Size().X - ttwidth) / 2
-	padtop := (app.Layout.textRect.Size().Y - ttheight) / 2
-	x := app.Layout.textRect.Min.X + padleft
-	y := app.Layout.textRect.Max.Y - padtop
+	ttheight := int(app.tt.PointToFixed(style.FontSize) >> 6)
+	padleft := textPadLeft(app.TextAlign, r.Size().X, ttwidth)
+	padtop := (r.Size().Y - ttheight) / 2
+	x := r.Min.X + padleft
+	y := r.Max.Y - padtop
+	app.drawOutline(text, x, y)
 	app.font.Dot = fixed.P(x, y)
 	app.font.DrawString(text)
 	return nil
 }
 
+// drawOutline draws text at every offset within app.OutlineWidth pixels of
+// (x, y) in either direction using app.OutlineColor, so that wide outlines
+// have no gaps.  drawOutline does nothing if the App has no outline
+// configured.
+func (app *App) drawOutline(text string, x, y int) {
+	if app.OutlineColor == nil || app.OutlineWidth <= 0 {
+		return
+	}
+	src := app.font.Src
+	defer func() { app.font.Src = src }()
+	app.font.Src = image.NewUniform(app.OutlineColor)
+	w := app.OutlineWidth
+	for dy := -w; dy <= w; dy++ {
+		for dx := -w; dx <= w; dx++ {
+			if dx == 0 && dy == 0 {
+				continue
+			}
+			app.font.Dot = fixed.P(x+dx, y+dy)
+			app.font.DrawString(text)
+		}
+	}
+}
+
+// formatText formats metrics with f.  If f fails the error is logged, once for
+// each distinct error rather than each time f is drawn, and the text of
+// fallbackFormatter is returned along with false.
+func (app *App) formatText(f battery.MetricFormatter, metrics *battery.Metrics) (string, bool) {
+	text, err := battery.FormatMetrics(f, metrics)
+	if err == nil {
+		return text, true
+	}
+	if !app.formatErrs[err.Error()] {
+		if app.formatErrs == nil {
+			app.formatErrs = make(map[string]bool)
+		}
+		app.formatErrs[err.Error()] = true
+		log.Printf("format: %v (drawing percent)", err)
+	}
+	return fallbackFormatter.Format(metrics), false
+}
+
+// alignedWidth returns the width of the widest formatter in the set of f when
+// formatting metrics, each measured in its own font face.  The width is
+// computed once for each Metrics.
+func (app *App) alignedWidth(f battery.AlignedMetricFormatter, metrics *battery.Metrics) fixed.Int26_6 {
+	set := f.AlignedSet()
+	cache := &app.alignedCache
+	if cache.metrics == metrics && len(set) > 0 && len(cache.set) == len(set) && &cache.set[0] == &set[0] {
+		return cache.width
+	}
+	var width fixed.Int26_6
+	for i, s := range f.AlignedWidths(metrics) {
+		style, _ := app.formatterStyle(set[i])
+		if w := font.MeasureString(app.face(style), s); w > width {
+			width = w
+		}
+	}
+	*cache = alignedWidthCache{metrics, set, width}
+	return width
+}
+
+// alignedWidthCache holds the width computed by App.alignedWidth.
+type alignedWidthCache struct {
+	metrics *battery.Metrics
+	set     []battery.MetricFormatter
+	width   fixed.Int26_6
+}
+
+// TextAlign is the horizontal alignment of text within its text box.
+type TextAlign int
+
+// TextAlign values accepted by the -text.align flag.
+const (
+	AlignCenter TextAlign = iota
+	AlignLeft
+	AlignRight
+)
+
+// parseTextAlign returns the TextAlign named by s, "left", "center" or
+// "right".
+func parseTextAlign(s string) (TextAlign, error) {
+	switch s {
+	case "center":
+		return AlignCenter, nil
+	case "left":
+		return AlignLeft, nil
+	case "right":
+		return AlignRight, nil
+	default:
+		return AlignCenter, fmt.Errorf("unknown alignment %q", s)
+	}
+}
+
+// textPadLeft returns the space left of text ttwidth pixels wide aligned
+// within a text box width pixels wide.
+func textPadLeft(align TextAlign, width, ttwidth int) int {
+	switch align {
+	case AlignLeft:
+		return 0
+	case AlignRight:
+		return width - ttwidth
+	default:
+		return (width - ttwidth) / 2
+	}
+}
+
+// roundedRectMask returns a mask covering r with corners rounded to the given
+// radius.  Pixels on the arc of a corner are partially covered, with an alpha
+// value approximating the fraction of the pixel inside the circle.  The radius
+// is limited to half the width or height of r and a radius less than or equal
+// to zero covers r completely.
+func roundedRectMask(r image.Rectangle, radius float64) *image.Alpha {
+	mask := image.NewAlpha(r)
+	size := r.Size()
+	radius = math.Min(radius, float64(size.X)/2)
+	radius = math.Min(radius, float64(size.Y)/2)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			mask.SetAlpha(x, y, color.Alpha{A: uint8(255 * cornerCoverage(r, x, y, radius))})
+		}
+	}
+	return mask
+}
+
+// cornerCoverage returns the fraction of pixel (x, y) inside a rectangle r
+// with corners of the given radius.  Pixels away from the corners are
+// completely covered.
+func cornerCoverage(r image.Rectangle, x, y int, radius float64) float64 {
+	if radius <= 0 {
+		return 1
+	}
+	// the center of the pixel relative to the center of the nearest corner's
+	// circle.  the offset is zero along an axis where the pixel is not within
+	// radius of the edge.
+	px, py := float64(x)+0.5, float64(y)+0.5
+	var dx, dy float64
+	if left := float64(r.Min.X) + radius; px < left {
+		dx = left - px
+	} else if right := float64(r.Max.X) - radius; px > right {
+		dx = px - right
+	}
+	if top := float64(r.Min.Y) + radius; py < top {
+		dy = top - py
+	} else if bottom := float64(r.Max.Y) - radius; py > bottom {
+		dy = py - bottom
+	}
+	if dx == 0 || dy == 0 {
+		return 1
+	}
+	// a pixel whose center is within half a pixel of the arc is partially
+	// covered.
+	cov := radius - math.Hypot(dx, dy) + 0.5
+	return math.Max(0, math.Min(1, cov))
+}
+
 func shrinkRect(r image.Rectangle, delta int) image.Rectangle {
 	r.Min.X += delta
 	r.Min.Y += delta
@@ -390,21 +1934,114 @@ func shrinkRect(r image.Rectangle, delta int) image.Rectangle {
 	return r
 }
 
+// parseColor parses a color given in hexadecimal notation as "#rrggbb" or
+// "#rrggbbaa".  The leading '#' is optional.
+func parseColor(s string) (color.Color, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) != 6 && len(hex) != 8 {
+		return nil, fmt.Errorf("invalid color %q", s)
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	x, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid color %q", s)
+	}
+	c := color.NRGBA{
+		R: uint8(x >> 24),
+		G: uint8(x >> 16),
+		B: uint8(x >> 8),
+		A: uint8(x),
+	}
+	return c, nil
+}
+
 var defaultGrey = color.RGBA{R: 0xaa, G: 0xaa, B: 0xaa, A: 0xff}
 var defaultRed = color.RGBA{R: 0xff, G: 0x80, B: 0x80, A: 0xff}
+var defaultBrightRed = color.RGBA{R: 0xff, G: 0x20, B: 0x20, A: 0xff}
 var defaultGreen = color.RGBA{R: 0x80, G: 0xff, B: 0x80, A: 0xff}
 var defaultYellow = color.RGBA{R: 0xef, G: 0xef, B: 0x40, A: 0xff}
+var defaultLightGrey = color.RGBA{R: 0xd8, G: 0xd8, B: 0xd8, A: 0xff}
+
+// DefaultLowFraction and DefaultCriticalFraction are the battery fractions at
+// or below which a discharging battery is rendered with the Low and Critical
+// colors of a Palette.
+const (
+	DefaultLowFraction      = 0.15
+	DefaultCriticalFraction = 0.05
+)
+
+// Palette is a set of colors used to render battery "energy".  If Unknown is
+// nil a battery in an unknown state is rendered with the Normal or Low color.
+// If Critical is nil a critical battery is rendered with the Low color.
+type Palette struct {
+	Normal   color.Color
+	Charging color.Color
+	Low      color.Color
+	Critical color.Color
+	Unknown  color.Color
+}
+
+// DefaultPalette is the Palette used by DefaultEnergyColor.
+var DefaultPalette = Palette{
+	Normal:   defaultGreen,
+	Charging: defaultYellow,
+	Low:      defaultRed,
+	Critical: defaultBrightRed,
+	Unknown:  defaultLightGrey,
+}
+
+// ColorBlindPalette is a blue and orange Palette which remains distinguishable
+// to people with red-green color blindness.
+var ColorBlindPalette = Palette{
+	Normal:   color.RGBA{R: 0x56, G: 0xb4, B: 0xe9, A: 0xff},
+	Charging: color.RGBA{R: 0xf0, G: 0xe4, B: 0x42, A: 0xff},
+	Low:      color.RGBA{R: 0xe6, G: 0x9f, B: 0x00, A: 0xff},
+	Critical: color.RGBA{R: 0xd5, G: 0x5e, B: 0x00, A: 0xff},
+	Unknown:  defaultLightGrey,
+}
+
+// palettes maps the names accepted by the -palette flag to palettes.
+var palettes = map[string]Palette{
+	"default": DefaultPalette,
+	"cb":      ColorBlindPalette,
+}
+
+// EnergyColor returns the color in p for battery "energy" with the given
+// metrics, using DefaultLowFraction and DefaultCriticalFraction.  A battery
+// held at a charge threshold is rendered like a full battery rather than a
+// charging one.
+func (p Palette) EnergyColor(metrics *battery.Metrics) color.Color {
+	return p.ThresholdColor(metrics, DefaultLowFraction, DefaultCriticalFraction)
+}
+
+// ThresholdColor returns the color in p for battery "energy" with the given
+// metrics.  A battery which is not charging is rendered with the Low color
+// when its fraction is at or below low and the Critical color when it is at or
+// below critical.
+func (p Palette) ThresholdColor(metrics *battery.Metrics, low, critical float64) color.Color {
+	switch metrics.State {
+	case battery.Charging:
+		return p.Charging
+	case battery.Unknown:
+		if p.Unknown != nil {
+			return p.Unknown
+		}
+	}
+	if metrics.Fraction <= critical && p.Critical != nil {
+		return p.Critical
+	}
+	if metrics.Fraction <= low {
+		return p.Low
+	}
+	return p.Normal
+}
 
 // DefaultEnergyColor returns the default rendering color for battery "energy"
-// with the given metrics.
+// with the given metrics, from DefaultPalette.
 func DefaultEnergyColor(metrics *battery.Metrics) color.Color {
-	ecolor := defaultGreen
-	if metrics.State == battery.Charging || metrics.State == battery.PendingCharge {
-		ecolor = defaultYellow
-	} else if metrics.Fraction <= 0.15 {
-		ecolor = defaultRed
-	}
-	return ecolor
+	return DefaultPalette.EnergyColor(metrics)
 }
 
 type imageRecorder struct {
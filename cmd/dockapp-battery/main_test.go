@@ -0,0 +1,1160 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/battery"
+	"github.com/bmatsuo/dockapp-go/dockapp/dockapptest"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func testLayout(t *testing.T) *AppLayout {
+	ttf, err := truetype.Parse(gobold.TTF)
+	if err != nil {
+		t.Fatalf("font: %v", err)
+	}
+	layout := &AppLayout{
+		rect:      image.Rect(0, 0, 117, 20),
+		battRect:  image.Rect(0, 0, 21, 18).Add(image.Pt(1, 2)),
+		textRect:  image.Rect(0, 0, 95, 20).Add(image.Pt(22, 0)),
+		thickness: 1,
+		DPI:       72,
+		font:      ttf,
+		fontSize:  14,
+	}
+	return layout
+}
+
+func testMetrics(fraction float64, state battery.State) *battery.Metrics {
+	untilEmpty := 2 * time.Hour
+	untilFull := 30 * time.Minute
+	return &battery.Metrics{
+		Fraction:   fraction,
+		State:      state,
+		UntilEmpty: &untilEmpty,
+		UntilFull:  &untilFull,
+	}
+}
+
+// countColor returns the number of pixels in r that are exactly c.
+func countColor(img image.Image, r image.Rectangle, c color.Color) int {
+	r0, g0, b0, a0 := c.RGBA()
+	var n int
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			r1, g1, b1, a1 := img.At(x, y).RGBA()
+			if r0 == r1 && g0 == g1 && b0 == b1 && a0 == a1 {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func TestApp_outline(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	for i, test := range []struct {
+		width   int
+		outline bool
+	}{
+		{0, false},
+		{1, true},
+		{2, true},
+	} {
+		layout := testLayout(t)
+		app := NewApp(layout)
+		if test.width > 0 {
+			app.OutlineColor = red
+			app.OutlineWidth = test.width
+		}
+		img := image.NewRGBA(layout.rect)
+		f := battery.MetricFormatFunc(battery.FormatPercent)
+		err := app.Draw(img, testMetrics(0.5, battery.Discharging), f)
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		n := countColor(img, layout.textRect, red)
+		if test.outline && n == 0 {
+			t.Errorf("test %d: no outline pixels", i)
+		}
+		if !test.outline && n != 0 {
+			t.Errorf("test %d: unexpected outline pixels (%d)", i, n)
+		}
+	}
+}
+
+func TestApp_outlineGaps(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	for _, width := range []int{1, 2, 3} {
+		layout := testLayout(t)
+		f := battery.MetricFormatFunc(battery.FormatPercent)
+		m := testMetrics(0.5, battery.Discharging)
+		plain := image.NewRGBA(layout.rect)
+		err := NewApp(layout).Draw(plain, m, f)
+		if err != nil {
+			t.Fatalf("width %d: %v", width, err)
+		}
+		app := NewApp(layout)
+		app.OutlineColor = red
+		app.OutlineWidth = width
+		outlined := image.NewRGBA(layout.rect)
+		err = app.Draw(outlined, m, f)
+		if err != nil {
+			t.Fatalf("width %d: %v", width, err)
+		}
+
+		// every background pixel within width of a solid text pixel is
+		// covered entirely by the outline.
+		r := layout.textRect
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if plain.At(x, y) != (color.RGBA{A: 0xff}) {
+					continue
+				}
+				for dy := -width; dy <= width; dy++ {
+					for dx := -width; dx <= width; dx++ {
+						p := image.Pt(x+dx, y+dy)
+						if !p.In(r) || plain.At(p.X, p.Y) != plain.At(r.Min.X, r.Min.Y) {
+							continue
+						}
+						if outlined.At(p.X, p.Y) != red {
+							t.Errorf("width %d: gap at %v", width, p)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestApp_textStyle(t *testing.T) {
+	layout := testLayout(t)
+	app := NewApp(layout)
+	regular, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatalf("font: %v", err)
+	}
+	for i, test := range []struct {
+		style *TextStyle
+		font  *truetype.Font
+		size  float64
+	}{
+		{nil, layout.font, layout.fontSize},
+		{&TextStyle{}, layout.font, layout.fontSize},
+		{&TextStyle{FontSize: 9}, layout.font, 9},
+		{&TextStyle{Font: regular}, regular, layout.fontSize},
+		{&TextStyle{Font: regular, FontSize: 9}, regular, 9},
+	} {
+		style := app.textStyle(test.style)
+		if style.Font != test.font {
+			t.Errorf("test %d: unexpected font", i)
+		}
+		if style.FontSize != test.size {
+			t.Errorf("test %d: size %v (expected %v)", i, style.FontSize, test.size)
+		}
+	}
+}
+
+func TestApp_styledFormatter(t *testing.T) {
+	layout := testLayout(t)
+	text := battery.MetricFormatFunc(func(*battery.Metrics) string { return "100%" })
+	m := testMetrics(0.5, battery.Discharging)
+	white := color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	area := layout.textRect.Dx() * layout.textRect.Dy()
+
+	// smaller text covers fewer pixels.
+	var counts []int
+	for i, f := range []battery.MetricFormatter{
+		text,
+		StyleFormatter(text, &TextStyle{FontSize: layout.fontSize / 2}),
+	} {
+		if s := f.Format(m); s != "100%" {
+			t.Errorf("test %d: text %q", i, s)
+		}
+		img := image.NewRGBA(layout.rect)
+		err := NewApp(layout).Draw(img, m, f)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		counts = append(counts, area-countColor(img, layout.textRect, white))
+	}
+	if counts[1] == 0 || counts[1] >= counts[0] {
+		t.Errorf("styled text pixels %d (default font %d)", counts[1], counts[0])
+	}
+}
+
+func TestApp_alignedWidth(t *testing.T) {
+	layout := testLayout(t)
+	app := NewApp(layout)
+	app.initText()
+	text := battery.MetricFormatFunc(func(*battery.Metrics) string { return "100%" })
+	large := &TextStyle{FontSize: 2 * layout.fontSize}
+	m := testMetrics(0.5, battery.Discharging)
+
+	small := app.alignedWidth(battery.AlignMetricFormatters(text, text)[0].(battery.AlignedMetricFormatter), m)
+	f := battery.AlignMetricFormatters(text, StyleFormatter(text, large))
+	width := app.alignedWidth(f[0].(battery.AlignedMetricFormatter), m)
+	expect := font.MeasureString(app.face(app.textStyle(large)), "100%")
+	if width != expect {
+		t.Errorf("width %v (expected %v)", width, expect)
+	}
+	if width <= small {
+		t.Errorf("width %v not larger than the default face %v", width, small)
+	}
+
+	// every formatter in the set has the same width.
+	if w := app.alignedWidth(f[1].(battery.AlignedMetricFormatter), m); w != width {
+		t.Errorf("styled width %v (expected %v)", w, width)
+	}
+}
+
+func TestTextPadLeft(t *testing.T) {
+	for i, test := range []struct {
+		align   TextAlign
+		width   int
+		ttwidth int
+		pad     int
+	}{
+		{AlignCenter, 95, 35, 30},
+		{AlignCenter, 95, 34, 30},
+		{AlignLeft, 95, 35, 0},
+		{AlignRight, 95, 35, 60},
+		{AlignCenter, 20, 30, -5},
+		{AlignLeft, 20, 30, 0},
+		{AlignRight, 20, 30, -10},
+	} {
+		pad := textPadLeft(test.align, test.width, test.ttwidth)
+		if pad != test.pad {
+			t.Errorf("test %d: %d (expected %d)", i, pad, test.pad)
+		}
+	}
+}
+
+func TestParseTextAlign(t *testing.T) {
+	for i, test := range []struct {
+		s     string
+		align TextAlign
+		err   bool
+	}{
+		{"center", AlignCenter, false},
+		{"left", AlignLeft, false},
+		{"right", AlignRight, false},
+		{"middle", AlignCenter, true},
+		{"", AlignCenter, true},
+	} {
+		align, err := parseTextAlign(test.s)
+		if (err != nil) != test.err {
+			t.Errorf("test %d: err %v (expected error %v)", i, err, test.err)
+			continue
+		}
+		if align != test.align {
+			t.Errorf("test %d: %v (expected %v)", i, align, test.align)
+		}
+	}
+}
+
+func TestParseMock(t *testing.T) {
+	for i, test := range []struct {
+		s      string
+		script []*battery.Metrics
+		err    bool
+	}{
+		{"0.5", []*battery.Metrics{testMockMetrics(0.5, battery.Discharging)}, false},
+		{"0.5:Charging,1:fullycharged,0", []*battery.Metrics{
+			testMockMetrics(0.5, battery.Charging),
+			testMockMetrics(1, battery.FullyCharged),
+			testMockMetrics(0, battery.Discharging),
+		}, false},
+		{"", nil, true},
+		{"1.5", nil, true},
+		{"0.5:Full", nil, true},
+		{"half:Charging", nil, true},
+	} {
+		script, err := parseMock(test.s)
+		if (err != nil) != test.err {
+			t.Errorf("test %d: err %v (expected error %v)", i, err, test.err)
+			continue
+		}
+		if !reflect.DeepEqual(script, test.script) {
+			t.Errorf("test %d: %v (expected %v)", i, script, test.script)
+		}
+	}
+}
+
+func testMockMetrics(fraction float64, state battery.State) *battery.Metrics {
+	return &battery.Metrics{Fraction: fraction, State: state, OnAC: battery.InferOnAC(state)}
+}
+
+func TestParseColor(t *testing.T) {
+	for i, test := range []struct {
+		s   string
+		c   color.Color
+		err bool
+	}{
+		{"#ffffff", color.NRGBA{0xff, 0xff, 0xff, 0xff}, false},
+		{"102030", color.NRGBA{0x10, 0x20, 0x30, 0xff}, false},
+		{"#10203040", color.NRGBA{0x10, 0x20, 0x30, 0x40}, false},
+		{"#fff", nil, true},
+		{"#gggggg", nil, true},
+	} {
+		c, err := parseColor(test.s)
+		if test.err {
+			if err == nil {
+				t.Errorf("test %d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		if c != test.c {
+			t.Errorf("test %d: %v (expected %v)", i, c, test.c)
+		}
+	}
+}
+
+func TestApp_Render(t *testing.T) {
+	layout := testLayout(t)
+	layout.rect = layout.rect.Add(image.Pt(5, 7))
+	app := NewApp(layout)
+	f := battery.MetricFormatFunc(battery.FormatPercent)
+	img, err := app.Render(testMetrics(0.5, battery.Discharging), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != layout.rect {
+		t.Errorf("bounds: %v (expected %v)", img.Bounds(), layout.rect)
+	}
+	if n := countColor(img, layout.textRect, color.Black); n == 0 {
+		t.Errorf("no text rendered")
+	}
+}
+
+func TestApp_background(t *testing.T) {
+	for i, test := range []struct {
+		bg color.Color
+	}{
+		{color.White},
+		{color.Transparent},
+	} {
+		layout := testLayout(t)
+		layout.hideText = true
+		app := NewApp(layout)
+		app.BackgroundColor = test.bg
+		img, err := app.Render(testMetrics(0.5, battery.Discharging), battery.MetricFormatFunc(battery.FormatPercent))
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		// the window column left of the battery is only background.
+		r := image.Rect(0, 0, 1, layout.rect.Dy())
+		if n := countColor(img, r, test.bg); n != r.Dx()*r.Dy() {
+			t.Errorf("test %d: %d background pixels (expected %d)", i, n, r.Dx()*r.Dy())
+		}
+	}
+}
+
+func TestApp_textHidden(t *testing.T) {
+	layout := testLayout(t)
+	layout.font = nil
+	layout.hideText = true
+	layout.battRect = layout.rect
+	app := NewApp(layout)
+	if app.font != nil {
+		t.Errorf("font initialized")
+	}
+	f := battery.MetricFormatFunc(battery.FormatPercent)
+	img, err := app.Render(testMetrics(0.5, battery.Discharging), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countColor(img, layout.rect, defaultGreen); n == 0 {
+		t.Errorf("battery not drawn")
+	}
+
+	layout = testLayout(t)
+	layout.font = nil
+	layout.textRect = image.Rectangle{}
+	app = NewApp(layout)
+	_, err = app.Render(testMetrics(0.5, battery.Discharging), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApp_palette(t *testing.T) {
+	f := battery.MetricFormatFunc(battery.FormatPercent)
+	for i, test := range []struct {
+		palette string
+		m       *battery.Metrics
+		c       color.Color
+		not     color.Color
+	}{
+		{"default", testMetrics(0.5, battery.Discharging), defaultGreen, ColorBlindPalette.Normal},
+		{"cb", testMetrics(0.5, battery.Discharging), ColorBlindPalette.Normal, defaultGreen},
+		{"cb", testMetrics(0.5, battery.Charging), ColorBlindPalette.Charging, defaultYellow},
+		{"cb", testMetrics(0.1, battery.Discharging), ColorBlindPalette.Low, defaultRed},
+		{"default", testMetrics(0.5, battery.Unknown), defaultLightGrey, defaultGreen},
+		{"cb", testMetrics(0.1, battery.Unknown), defaultLightGrey, ColorBlindPalette.Low},
+	} {
+		layout := testLayout(t)
+		layout.hideText = true
+		app := NewApp(layout)
+		app.EnergyColor = palettes[test.palette].EnergyColor
+		img, err := app.Render(test.m, f)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		if n := countColor(img, layout.rect, test.c); n == 0 {
+			t.Errorf("test %d: energy not drawn in %v", i, test.c)
+		}
+		if n := countColor(img, layout.rect, test.not); n != 0 {
+			t.Errorf("test %d: %d pixels drawn in %v", i, n, test.not)
+		}
+	}
+}
+
+func TestPalette_ThresholdColor(t *testing.T) {
+	for i, test := range []struct {
+		p             Palette
+		low, critical float64
+		m             *battery.Metrics
+		c             color.Color
+	}{
+		{DefaultPalette, 0.15, 0.05, testMetrics(0.5, battery.Discharging), defaultGreen},
+		{DefaultPalette, 0.15, 0.05, testMetrics(0.16, battery.Discharging), defaultGreen},
+		{DefaultPalette, 0.15, 0.05, testMetrics(0.15, battery.Discharging), defaultRed},
+		{DefaultPalette, 0.15, 0.05, testMetrics(0.06, battery.Discharging), defaultRed},
+		{DefaultPalette, 0.15, 0.05, testMetrics(0.05, battery.Discharging), defaultBrightRed},
+		{DefaultPalette, 0.15, 0.05, testMetrics(0, battery.Discharging), defaultBrightRed},
+		{DefaultPalette, 0.15, 0.05, testMetrics(0.03, battery.Charging), defaultYellow},
+		{DefaultPalette, 0.15, 0.05, testMetrics(0.03, battery.Unknown), defaultLightGrey},
+		{DefaultPalette, 0.3, 0.1, testMetrics(0.25, battery.Discharging), defaultRed},
+		{DefaultPalette, 0.3, 0.1, testMetrics(0.1, battery.Discharging), defaultBrightRed},
+		{DefaultPalette, 0.3, 0, testMetrics(0.01, battery.Discharging), defaultRed},
+		{ColorBlindPalette, 0.15, 0.05, testMetrics(0.04, battery.Discharging), ColorBlindPalette.Critical},
+		{Palette{Normal: defaultGreen, Low: defaultRed}, 0.15, 0.05, testMetrics(0.04, battery.Discharging), defaultRed},
+	} {
+		c := test.p.ThresholdColor(test.m, test.low, test.critical)
+		if c != test.c {
+			t.Errorf("test %d: %v (expected %v)", i, c, test.c)
+		}
+	}
+}
+
+func TestApp_round(t *testing.T) {
+	for i, test := range []struct {
+		radius  float64
+		partial bool
+	}{
+		{0, false},
+		{3, true},
+		{6, true},
+	} {
+		layout := testLayout(t)
+		layout.hideText = true
+		layout.radius = test.radius
+		app := NewApp(layout)
+
+		// the corners of the body are transparent when rounded.
+		body := layout.battRect
+		body.Min.X += 2
+		corners := []image.Point{
+			body.Min,
+			{body.Max.X - 1, body.Min.Y},
+			{body.Min.X, body.Max.Y - 1},
+			body.Max.Sub(image.Pt(1, 1)),
+		}
+		for _, mask := range []image.Image{app.maskEnergy, app.maskBattery} {
+			mask := mask.(*image.Alpha)
+			for j, p := range corners {
+				a := mask.AlphaAt(p.X, p.Y).A
+				if test.radius > 0 && a != 0 {
+					t.Errorf("test %d: corner %d: alpha %d", i, j, a)
+				}
+				if test.radius == 0 && a != 0xff {
+					t.Errorf("test %d: corner %d: alpha %d", i, j, a)
+				}
+
+				// partially transparent pixels are drawn along the arc of
+				// each corner.
+				r := image.Rectangle{Min: p, Max: p.Add(image.Pt(1, 1))}
+				r = image.Rect(r.Min.X-4, r.Min.Y-4, r.Max.X+4, r.Max.Y+4).Intersect(body)
+				var partial int
+				for y := r.Min.Y; y < r.Max.Y; y++ {
+					for x := r.Min.X; x < r.Max.X; x++ {
+						a := mask.AlphaAt(x, y).A
+						if a != 0 && a != 0xff {
+							partial++
+						}
+					}
+				}
+				if test.partial && partial < 2 {
+					t.Errorf("test %d: corner %d: %d partially transparent pixels", i, j, partial)
+				}
+				if !test.partial && partial != 0 {
+					t.Errorf("test %d: corner %d: %d partially transparent pixels", i, j, partial)
+				}
+			}
+		}
+	}
+}
+
+func TestApp_mirror(t *testing.T) {
+	f := battery.MetricFormatFunc(battery.FormatPercent)
+	render := func(mirror bool, fraction float64) (*image.RGBA, *AppLayout) {
+		layout := testLayout(t)
+		layout.hideText = true
+		layout.mirror = mirror
+		app := NewApp(layout)
+		img, err := app.Render(testMetrics(fraction, battery.Discharging), f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return img, layout
+	}
+	for i, fraction := range []float64{0, 0.33, 0.5, 1} {
+		img, layout := render(false, fraction)
+		mirrored, _ := render(true, fraction)
+
+		// the mirrored battery is the reflection of the battery.
+		r := layout.battRect
+		var diff int
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if img.RGBAAt(x, y) != mirrored.RGBAAt(r.Min.X+r.Max.X-1-x, y) {
+					diff++
+				}
+			}
+		}
+		if diff != 0 {
+			t.Errorf("test %d: %d pixels differ from the reflection", i, diff)
+		}
+	}
+
+	// at half capacity the energy is on opposite sides of the battery.
+	for i, test := range []struct {
+		mirror bool
+		left   bool
+	}{
+		{false, false},
+		{true, true},
+	} {
+		img, layout := render(test.mirror, 0.5)
+		left, right := layout.battRect, layout.battRect
+		left.Max.X = left.Min.X + left.Dx()/2
+		right.Min.X = left.Max.X
+		nleft := countColor(img, left, defaultGreen)
+		nright := countColor(img, right, defaultGreen)
+		if test.left && nleft <= nright {
+			t.Errorf("test %d: %d energy pixels on the left, %d on the right", i, nleft, nright)
+		}
+		if !test.left && nleft >= nright {
+			t.Errorf("test %d: %d energy pixels on the left, %d on the right", i, nleft, nright)
+		}
+	}
+}
+
+func TestApp_energyFillRect(t *testing.T) {
+	for i, test := range []struct {
+		vertical bool
+		fraction float64
+		fill     image.Rectangle
+		boundary image.Rectangle
+	}{
+		{false, 0, image.Rect(21, 2, 21, 20), image.Rectangle{}},
+		{false, 0.5, image.Rect(12, 2, 21, 20), image.Rect(11, 2, 12, 20)},
+		{false, 1, image.Rect(2, 2, 21, 20), image.Rectangle{}},
+		{true, 0, image.Rect(2, 21, 20, 21), image.Rectangle{}},
+		{true, 0.5, image.Rect(2, 12, 20, 21), image.Rect(2, 11, 20, 12)},
+		{true, 1, image.Rect(2, 2, 20, 21), image.Rectangle{}},
+	} {
+		layout := testLayout(t)
+		layout.hideText = true
+		if test.vertical {
+			layout.vertical = true
+			layout.battRect = image.Rect(0, 0, 18, 21).Add(image.Pt(2, 1))
+		}
+		app := NewApp(layout)
+		fill, boundary, _ := app.energyFillRect(test.fraction)
+		if fill != test.fill {
+			t.Errorf("test %d: fill %v (expected %v)", i, fill, test.fill)
+		}
+		if boundary != test.boundary {
+			t.Errorf("test %d: boundary %v (expected %v)", i, boundary, test.boundary)
+		}
+	}
+}
+
+func TestApp_vertical(t *testing.T) {
+	f := battery.MetricFormatFunc(battery.FormatPercent)
+	for i, fraction := range []float64{0, 0.33, 0.5, 1} {
+		layout := testLayout(t)
+		layout.hideText = true
+		img, err := NewApp(layout).Render(testMetrics(fraction, battery.Discharging), f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vlayout := testLayout(t)
+		vlayout.hideText = true
+		vlayout.vertical = true
+		vlayout.battRect = image.Rect(0, 0, 18, 21).Add(image.Pt(2, 1))
+		vlayout.rect = image.Rect(0, 0, 20, 117)
+		vimg, err := NewApp(vlayout).Render(testMetrics(fraction, battery.Discharging), f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the vertical battery is the transposition of the battery.
+		r := layout.battRect
+		var diff int
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if img.RGBAAt(x, y) != vimg.RGBAAt(y, x) {
+					diff++
+				}
+			}
+		}
+		if diff != 0 {
+			t.Errorf("test %d: %d pixels differ from the transposition", i, diff)
+		}
+	}
+}
+
+func TestApp_batteryHidden(t *testing.T) {
+	layout := testLayout(t)
+	layout.hideBattery = true
+	app := NewApp(layout)
+	if app.maskBattery != nil || app.maskEnergy != nil {
+		t.Errorf("battery masks constructed")
+	}
+	f := battery.MetricFormatFunc(battery.FormatPercent)
+	img, err := app.Render(testMetrics(0.5, battery.Discharging), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countColor(img, layout.textRect, color.Black); n == 0 {
+		t.Errorf("text not drawn")
+	}
+	for y := layout.rect.Min.Y; y < layout.rect.Max.Y; y++ {
+		for x := layout.rect.Min.X; x < layout.rect.Max.X; x++ {
+			if image.Pt(x, y).In(layout.textRect) {
+				continue
+			}
+			r, g, b, _ := img.At(x, y).RGBA()
+			if r != 0xffff || g != 0xffff || b != 0xffff {
+				t.Fatalf("pixel drawn outside text region at (%d, %d)", x, y)
+			}
+		}
+	}
+}
+
+func TestCompactLayout(t *testing.T) {
+	for i, test := range []struct {
+		window image.Rectangle
+		ratio  float64
+		battDx int
+	}{
+		{image.Rect(0, 0, 80, 20), 0, 20},
+		{image.Rect(0, 0, 80, 20), 0.5, 40},
+		{image.Rect(10, 10, 110, 30), 0.25, 25},
+	} {
+		batt, text := compactLayout(test.window, test.ratio)
+		// the battery graphic is inset by a pixel.
+		outer := image.Rectangle{
+			Min: batt.Min.Sub(image.Pt(1, 1)),
+			Max: batt.Max.Add(image.Pt(1, 1)),
+		}
+		if outer.Dx() != test.battDx {
+			t.Errorf("test %d: battery width %d (expected %d)", i, outer.Dx(), test.battDx)
+		}
+		if outer.Union(text) != test.window {
+			t.Errorf("test %d: %v and %v do not cover %v", i, outer, text, test.window)
+		}
+		if outer.Overlaps(text) {
+			t.Errorf("test %d: %v overlaps %v", i, outer, text)
+		}
+		if outer.Max.X != text.Min.X {
+			t.Errorf("test %d: gap between %v and %v", i, outer, text)
+		}
+	}
+}
+
+// fakeClock is a battery.Clock whose time only changes when Advance is called.
+type fakeClock struct {
+	mut    sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+}
+
+type fakeTimer struct {
+	c    chan time.Time
+	when time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	t := fakeTimer{make(chan time.Time, 1), c.now.Add(d)}
+	c.timers = append(c.timers, t)
+	return t.c
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) battery.Ticker {
+	panic("not implemented")
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.now = c.now.Add(d)
+	timers := c.timers[:0]
+	for _, t := range c.timers {
+		if t.when.After(c.now) {
+			timers = append(timers, t)
+			continue
+		}
+		t.c <- t.when
+	}
+	c.timers = timers
+}
+
+func TestDrawLoop(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)}
+	metricsc := make(chan *battery.Metrics)
+	formatterc := make(chan battery.MetricFormatter)
+	drawn := make(chan *battery.Metrics, 10)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		drawLoop(clock, 100*time.Millisecond, nil, metricsc, formatterc, func(m *battery.Metrics, f battery.MetricFormatter, elapsed time.Duration) {
+			drawn <- m
+		})
+	}()
+	defer func() {
+		close(metricsc)
+		<-done
+	}()
+
+	expectDraw := func(step int, m *battery.Metrics) {
+		select {
+		case d := <-drawn:
+			if d != m {
+				t.Errorf("step %d: drew %v (expected %v)", step, d, m)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("step %d: no draw", step)
+		}
+	}
+	expectNoDraw := func(step int) {
+		select {
+		case d := <-drawn:
+			t.Errorf("step %d: unexpected draw %v", step, d)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	// the first complete update is drawn immediately.
+	m0 := testMetrics(0.5, battery.Discharging)
+	metricsc <- m0
+	formatterc <- battery.MetricFormatFunc(battery.FormatRemaining)
+	expectDraw(0, m0)
+
+	// a burst of updates is coalesced until the interval has elapsed.
+	burst := []*battery.Metrics{
+		testMetrics(0.4, battery.Discharging),
+		testMetrics(0.3, battery.Discharging),
+		testMetrics(0.2, battery.Discharging),
+	}
+	for _, m := range burst {
+		metricsc <- m
+	}
+	expectNoDraw(1)
+	clock.Advance(50 * time.Millisecond)
+	expectNoDraw(2)
+	clock.Advance(50 * time.Millisecond)
+	expectDraw(3, burst[len(burst)-1])
+	expectNoDraw(4)
+
+	// an update after a quiet period is drawn immediately.
+	clock.Advance(time.Second)
+	m1 := testMetrics(0.1, battery.Discharging)
+	metricsc <- m1
+	expectDraw(5, m1)
+}
+
+func TestDrawLoop_unlimited(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)}
+	metricsc := make(chan *battery.Metrics)
+	formatterc := make(chan battery.MetricFormatter, 1)
+	formatterc <- battery.MetricFormatFunc(battery.FormatRemaining)
+	var n int
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		drawLoop(clock, 0, nil, metricsc, formatterc, func(m *battery.Metrics, f battery.MetricFormatter, elapsed time.Duration) {
+			n++
+		})
+	}()
+	for i := 0; i < 5; i++ {
+		metricsc <- testMetrics(0.5, battery.Discharging)
+	}
+	close(metricsc)
+	<-done
+	if n != 5 {
+		t.Errorf("%d draws (expected 5)", n)
+	}
+}
+
+func TestDrawLoop_animate(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)}
+	metricsc := make(chan *battery.Metrics)
+	formatterc := make(chan battery.MetricFormatter, 1)
+	formatterc <- battery.MetricFormatFunc(battery.FormatRemaining)
+	type frame struct {
+		m       *battery.Metrics
+		elapsed time.Duration
+	}
+	drawn := make(chan frame, 10)
+	animate := func(m *battery.Metrics) time.Duration {
+		switch {
+		case m.Fraction <= 0.05:
+			return time.Second
+		case m.State == battery.Charging:
+			return 100 * time.Millisecond
+		}
+		return 0
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		drawLoop(clock, 0, animate, metricsc, formatterc, func(m *battery.Metrics, f battery.MetricFormatter, elapsed time.Duration) {
+			drawn <- frame{m, elapsed}
+		})
+	}()
+	defer func() {
+		close(metricsc)
+		<-done
+	}()
+
+	expectDraw := func(step int, m *battery.Metrics, elapsed time.Duration) {
+		select {
+		case d := <-drawn:
+			if d.m != m || d.elapsed != elapsed {
+				t.Errorf("step %d: drew %v at %v (expected %v at %v)", step, d.m, d.elapsed, m, elapsed)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("step %d: no draw", step)
+		}
+	}
+	expectNoDraw := func(step int) {
+		select {
+		case d := <-drawn:
+			t.Errorf("step %d: unexpected draw %v", step, d.m)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	// a battery which is not animated is only drawn when updated.
+	m0 := testMetrics(0.5, battery.Discharging)
+	metricsc <- m0
+	expectDraw(0, m0, 0)
+	clock.Advance(time.Second)
+	expectNoDraw(1)
+
+	// an animated battery is drawn each frame.
+	m1 := testMetrics(0.04, battery.Discharging)
+	metricsc <- m1
+	expectDraw(2, m1, 0)
+	clock.Advance(time.Second)
+	expectDraw(3, m1, time.Second)
+	clock.Advance(time.Second)
+	expectDraw(4, m1, 2*time.Second)
+
+	// the animation restarts when its frame interval changes.
+	m2 := testMetrics(0.5, battery.Charging)
+	metricsc <- m2
+	expectDraw(5, m2, 0)
+	clock.Advance(100 * time.Millisecond)
+	expectDraw(6, m2, 100*time.Millisecond)
+
+	// a battery which stops animating is drawn static.
+	m3 := testMetrics(0.5, battery.Discharging)
+	metricsc <- m3
+	expectDraw(7, m3, 0)
+	clock.Advance(time.Second)
+	expectNoDraw(8)
+}
+
+func TestApp_setAnimation(t *testing.T) {
+	for i, test := range []struct {
+		m        *battery.Metrics
+		elapsed  time.Duration
+		blinkOff bool
+		phase    float64
+	}{
+		{testMetrics(0.5, battery.Discharging), 3 * time.Second, false, 0},
+		{testMetrics(0.04, battery.Discharging), 0, false, 0},
+		{testMetrics(0.04, battery.Discharging), time.Second, true, 0},
+		{testMetrics(0.04, battery.Discharging), 2 * time.Second, false, 0},
+		{testMetrics(0.5, battery.Charging), 0, false, 0},
+		{testMetrics(0.5, battery.Charging), 500 * time.Millisecond, false, 0.25},
+		{testMetrics(0.5, battery.Charging), 2500 * time.Millisecond, false, 0.25},
+		{testMetrics(0.04, battery.Charging), time.Second, false, 0.5},
+	} {
+		app := NewApp(testLayout(t))
+		app.BlinkInterval = time.Second
+		app.Blinking = func(m *battery.Metrics) bool { return m.State == battery.Discharging && m.Fraction <= 0.05 }
+		app.ChargePeriod = 2 * time.Second
+		app.setAnimation(test.m, test.elapsed)
+		if app.blinkOff != test.blinkOff {
+			t.Errorf("test %d: blinkOff %v (expected %v)", i, app.blinkOff, test.blinkOff)
+		}
+		if app.chargePhase != test.phase {
+			t.Errorf("test %d: phase %v (expected %v)", i, app.chargePhase, test.phase)
+		}
+	}
+}
+
+func TestApp_chargePhase(t *testing.T) {
+	layout := testLayout(t)
+	layout.hideText = true
+	app := NewApp(layout)
+	m := testMetrics(0.25, battery.Charging)
+	f := battery.MetricFormatFunc(battery.FormatPercent)
+	static, err := app.Render(m, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.chargePhase = 0.5
+	img, err := app.Render(m, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	energy, _, _ := app.energyFillRect(m.Fraction)
+	rising, _, _ := app.energyFillRect(0.625)
+	var changed int
+	r := layout.rect
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if img.RGBAAt(x, y) == static.RGBAAt(x, y) {
+				continue
+			}
+			if !image.Pt(x, y).In(rising) || image.Pt(x, y).In(energy) {
+				t.Fatalf("pixel (%d, %d) changed outside the rising fill", x, y)
+			}
+			changed++
+		}
+	}
+	if changed == 0 {
+		t.Errorf("rising fill not drawn")
+	}
+}
+
+func TestApp_blinkOff(t *testing.T) {
+	layout := testLayout(t)
+	layout.hideText = true
+	app := NewApp(layout)
+	m := testMetrics(0.5, battery.Discharging)
+	f := battery.MetricFormatFunc(battery.FormatPercent)
+	c := app.energyColor(m)
+	img, err := app.Render(m, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countColor(img, layout.rect, c); n == 0 {
+		t.Errorf("energy not drawn in %v", c)
+	}
+	app.blinkOff = true
+	img, err = app.Render(m, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countColor(img, layout.rect, c); n != 0 {
+		t.Errorf("%d pixels drawn in %v while blinking off", n, c)
+	}
+}
+
+func TestApp_stale(t *testing.T) {
+	for i, test := range []struct {
+		age        time.Duration
+		staleAfter time.Duration
+		stale      bool
+	}{
+		{time.Minute, 5 * time.Minute, false},
+		{10 * time.Minute, 5 * time.Minute, true},
+		{10 * time.Minute, 0, false},
+	} {
+		layout := testLayout(t)
+		layout.hideText = true
+		app := NewApp(layout)
+		updated := time.Now().Add(-test.age)
+		app.LastUpdated = func() time.Time { return updated }
+		app.StaleAfter = test.staleAfter
+		img, err := app.Render(testMetrics(1, battery.Discharging), battery.MetricFormatFunc(battery.FormatPercent))
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		green := countColor(img, layout.rect, defaultGreen)
+		gray := countColor(img, layout.rect, color.RGBAModel.Convert(desaturate(defaultGreen)))
+		if test.stale && (green != 0 || gray == 0) {
+			t.Errorf("test %d: stale battery drawn in color (%d green, %d gray)", i, green, gray)
+		}
+		if !test.stale && (green == 0 || gray != 0) {
+			t.Errorf("test %d: fresh battery drawn without color (%d green, %d gray)", i, green, gray)
+		}
+	}
+}
+
+func TestApp_partialEnergy(t *testing.T) {
+	layout := testLayout(t)
+	layout.hideText = true
+	app := NewApp(layout)
+	app.BackgroundColor = color.Transparent
+	width := app.maxEnergy - app.minEnergy
+	y := (layout.battRect.Min.Y + layout.battRect.Max.Y) / 2
+	for i, test := range []struct {
+		full    int
+		partial float64
+	}{
+		{5, 0.25},
+		{5, 0.5},
+		{10, 0.75},
+		{0, 0.5},
+	} {
+		fraction := (float64(test.full) + test.partial) / float64(width)
+		img, err := app.Render(testMetrics(fraction, battery.Discharging), battery.MetricFormatFunc(battery.FormatPercent))
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		x := app.maxEnergy - test.full - 1
+		a := img.RGBAAt(x, y).A
+		expect := uint8(test.partial * 0xff)
+		if a < expect-1 || a > expect+1 {
+			t.Errorf("test %d: boundary alpha %d (expected %d)", i, a, expect)
+		}
+		if a := img.RGBAAt(x+1, y).A; test.full > 0 && a != 0xff {
+			t.Errorf("test %d: full alpha %d", i, a)
+		}
+		if a := img.RGBAAt(x-1, y).A; x-1 >= app.minEnergy && a != 0 {
+			t.Errorf("test %d: drained alpha %d", i, a)
+		}
+	}
+}
+
+// fakeGuage is a battery.Guage that always reports the same metrics.
+type fakeGuage struct {
+	m *battery.Metrics
+}
+
+func (g *fakeGuage) BatteryMetrics() (*battery.Metrics, error) {
+	return g.m, nil
+}
+
+func TestRunApp(t *testing.T) {
+	layout := testLayout(t)
+	app := NewApp(layout)
+	m := testMetrics(0.5, battery.Discharging)
+	f := battery.MetricFormatFunc(battery.FormatPercent)
+	expect, err := app.Render(m, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	surface := dockapptest.NewMemSurface(layout.rect)
+	batt := battery.NewProfiler(&fakeGuage{m})
+	metricsc := make(chan *battery.Metrics, 1)
+	go batt.Start(time.Hour, metricsc)
+	defer batt.Stop()
+	formatterc := make(chan battery.MetricFormatter, 1)
+	formatterc <- f
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		RunApp(surface, app, 0, metricsc, formatterc)
+	}()
+
+	select {
+	case <-surface.Flushed(0):
+	case <-time.After(time.Second):
+		t.Fatalf("no frame flushed")
+	}
+	close(formatterc)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("RunApp did not return")
+	}
+
+	frame := surface.Frames()[0]
+	r := layout.rect
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if frame.RGBAAt(x, y) != expect.RGBAAt(x, y) {
+				t.Fatalf("pixel (%d, %d): %v (expected %v)", x, y, frame.RGBAAt(x, y), expect.RGBAAt(x, y))
+			}
+		}
+	}
+}
+
+func TestRunApp_formatError(t *testing.T) {
+	layout := testLayout(t)
+	app := NewApp(layout)
+	m := testMetrics(0.5, battery.Discharging)
+	f, err := battery.FormatMetricTemplate("{{.doesnotexist.field}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect, err := app.Render(m, fallbackFormatter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	surface := dockapptest.NewMemSurface(layout.rect)
+	metricsc := make(chan *battery.Metrics, 1)
+	metricsc <- m
+	formatterc := make(chan battery.MetricFormatter, 1)
+	formatterc <- f
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		RunApp(surface, app, 0, metricsc, formatterc)
+	}()
+
+	select {
+	case <-surface.Flushed(0):
+	case <-time.After(time.Second):
+		t.Fatalf("no frame flushed")
+	}
+	close(formatterc)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("RunApp did not return")
+	}
+
+	frame := surface.Frames()[0]
+	r := layout.rect
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if frame.RGBAAt(x, y) != expect.RGBAAt(x, y) {
+				t.Fatalf("pixel (%d, %d): %v (expected %v)", x, y, frame.RGBAAt(x, y), expect.RGBAAt(x, y))
+			}
+		}
+	}
+}
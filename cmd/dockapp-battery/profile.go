@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	_ "net/http/pprof" // register handlers for -pprof.addr
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// startProfiling serves net/http/pprof handlers on addr and begins writing a
+// cpu profile to cpuprofile.  Empty arguments disable the corresponding
+// profiling.  The returned function stops the cpu profile and writes a heap
+// profile to memprofile, and must be called before the process exits for the
+// profiles to be complete.
+func startProfiling(addr, cpuprofile, memprofile string) (stop func(), err error) {
+	if addr != "" {
+		go func() {
+			err := http.ListenAndServe(addr, nil)
+			log.Printf("pprof: %v", err)
+		}()
+	}
+
+	var cpuf *os.File
+	if cpuprofile != "" {
+		cpuf, err = os.Create(cpuprofile)
+		if err != nil {
+			return nil, err
+		}
+		err = pprof.StartCPUProfile(cpuf)
+		if err != nil {
+			cpuf.Close()
+			return nil, fmt.Errorf("cpu profile: %v", err)
+		}
+	}
+
+	stop = func() {
+		if cpuf != nil {
+			pprof.StopCPUProfile()
+			err := cpuf.Close()
+			if err != nil {
+				log.Printf("cpu profile: %v", err)
+			}
+		}
+		if memprofile != "" {
+			err := writeHeapProfile(memprofile)
+			if err != nil {
+				log.Printf("memory profile: %v", err)
+			}
+		}
+	}
+	return stop, nil
+}
+
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	runtime.GC()
+	err = pprof.WriteHeapProfile(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+	"time"
+
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/battery"
+)
+
+// selfTestFractions and selfTestStates are the columns and rows of the image
+// rendered by SelfTest.
+var (
+	selfTestFractions = []float64{0, 0.05, 0.15, 0.5, 0.85, 1}
+	selfTestStates    = []battery.State{
+		battery.Charging,
+		battery.Discharging,
+		battery.FullyCharged,
+		battery.Empty,
+		battery.Unknown,
+	}
+)
+
+// selfTestMetrics returns metrics for a battery in the given state with the
+// given fraction of its capacity available.  The time remaining is made up so
+// that it varies with the fraction.
+func selfTestMetrics(state battery.State, fraction float64) *battery.Metrics {
+	m := &battery.Metrics{
+		Fraction: fraction,
+		State:    state,
+		OnAC:     battery.InferOnAC(state),
+	}
+	switch state {
+	case battery.Charging:
+		until := time.Duration((1 - fraction) * float64(2*time.Hour))
+		m.UntilFull = &until
+	case battery.Discharging:
+		until := time.Duration(fraction * float64(4*time.Hour))
+		m.UntilEmpty = &until
+	}
+	return m
+}
+
+// SelfTest renders the application in each of selfTestStates at each of
+// selfTestFractions, using formatter f, and returns a grid of the rendered
+// windows with one row per state.
+func SelfTest(app *App, f battery.MetricFormatter) (*image.RGBA, error) {
+	size := app.Layout.rect.Size()
+	grid := image.NewRGBA(image.Rect(0, 0, size.X*len(selfTestFractions), size.Y*len(selfTestStates)))
+	for row, state := range selfTestStates {
+		for col, fraction := range selfTestFractions {
+			img, err := app.Render(selfTestMetrics(state, fraction), f)
+			if err != nil {
+				return nil, err
+			}
+			cell := image.Rectangle{Max: size}.Add(image.Pt(col*size.X, row*size.Y))
+			draw.Draw(grid, cell, img, img.Bounds().Min, draw.Src)
+		}
+	}
+	return grid, nil
+}
+
+// writeSelfTest writes the image rendered by SelfTest to path as a PNG.
+func writeSelfTest(path string, app *App, f battery.MetricFormatter) error {
+	img, err := SelfTest(app, f)
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(out, img)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
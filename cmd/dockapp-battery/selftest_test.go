@@ -0,0 +1,86 @@
+package main
+
+import (
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/battery"
+)
+
+func TestSelfTest(t *testing.T) {
+	layout := testLayout(t)
+	layout.rect = layout.rect.Add(image.Pt(5, 7))
+	layout.battRect = layout.battRect.Add(image.Pt(5, 7))
+	layout.textRect = layout.textRect.Add(image.Pt(5, 7))
+	app := NewApp(layout)
+	f := battery.MetricFormatFunc(battery.FormatPercent)
+	grid, err := SelfTest(app, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := layout.rect.Size()
+	bounds := image.Rect(0, 0, size.X*len(selfTestFractions), size.Y*len(selfTestStates))
+	if grid.Bounds() != bounds {
+		t.Fatalf("bounds: %v (expected %v)", grid.Bounds(), bounds)
+	}
+	for row, state := range selfTestStates {
+		for col, fraction := range selfTestFractions {
+			img, err := app.Render(selfTestMetrics(state, fraction), f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			origin := image.Pt(col*size.X, row*size.Y)
+			if !sameImage(grid, origin, img) {
+				t.Errorf("%v %v: cell does not match rendered window", state, fraction)
+			}
+		}
+	}
+}
+
+func TestWriteSelfTest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dockapp-battery-selftest-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	layout := testLayout(t)
+	app := NewApp(layout)
+	path := filepath.Join(dir, "selftest.png")
+	err = writeSelfTest(path, app, battery.MetricFormatFunc(battery.FormatPercent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	cfg, err := png.DecodeConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := layout.rect.Size()
+	if cfg.Width != size.X*len(selfTestFractions) || cfg.Height != size.Y*len(selfTestStates) {
+		t.Errorf("size: %dx%d", cfg.Width, cfg.Height)
+	}
+}
+
+// sameImage returns true if img is drawn in grid with its minimum point at
+// origin.
+func sameImage(grid *image.RGBA, origin image.Point, img *image.RGBA) bool {
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			p := image.Pt(x, y).Sub(b.Min).Add(origin)
+			if grid.RGBAAt(p.X, p.Y) != img.RGBAAt(x, y) {
+				return false
+			}
+		}
+	}
+	return true
+}
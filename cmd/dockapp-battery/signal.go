@@ -0,0 +1,23 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyRefresh calls refresh each time the process receives SIGUSR1, so that
+// the battery can be polled on demand (e.g. after the system resumes from
+// suspension).
+func notifyRefresh(refresh func()) {
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, syscall.SIGUSR1)
+	go func() {
+		for range usr1 {
+			refresh()
+		}
+	}()
+}
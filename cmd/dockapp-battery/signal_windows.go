@@ -0,0 +1,4 @@
+package main
+
+// notifyRefresh does nothing because Windows has no SIGUSR1.
+func notifyRefresh(refresh func()) {}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/battery"
+)
+
+// stallDetector reports calls which take longer than a threshold, so that a
+// frozen window can be diagnosed.
+type stallDetector struct {
+	clock     battery.Clock
+	threshold time.Duration
+
+	// stacks causes the stacks of all goroutines to be logged with the report
+	// of a stall.
+	stacks bool
+	logf   func(format string, v ...interface{})
+}
+
+// watch calls fn, logging a warning if fn has not returned within the
+// threshold.  If the threshold is not positive fn is called without being
+// watched.
+func (d *stallDetector) watch(name string, fn func()) {
+	if d.threshold <= 0 {
+		fn()
+		return
+	}
+	done := make(chan struct{})
+	timeout := d.clock.After(d.threshold)
+	go func() {
+		select {
+		case <-done:
+		case <-timeout:
+			// fn may have returned just as the timeout fired.
+			select {
+			case <-done:
+				return
+			default:
+			}
+			d.logf("%s: stalled for more than %v", name, d.threshold)
+			if d.stacks {
+				d.logf("%s: goroutine stacks:\n%s", name, allStacks())
+			}
+		}
+	}()
+	fn()
+	close(done)
+}
+
+// allStacks returns the stacks of all goroutines.
+func allStacks() []byte {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
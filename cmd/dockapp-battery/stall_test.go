@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStallDetector(t *testing.T) {
+	const threshold = time.Second
+	for i, test := range []struct {
+		slow   bool
+		stacks bool
+		logs   []string
+	}{
+		{false, false, nil},
+		{false, true, nil},
+		{true, false, []string{"draw: stalled for more than 1s"}},
+		{true, true, []string{"draw: stalled for more than 1s", "draw: goroutine stacks:\ngoroutine "}},
+	} {
+		clock := &fakeClock{now: time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)}
+		logs := make(chan string, 10)
+		d := &stallDetector{
+			clock:     clock,
+			threshold: threshold,
+			stacks:    test.stacks,
+			logf: func(format string, v ...interface{}) {
+				logs <- fmt.Sprintf(format, v...)
+			},
+		}
+		d.watch("draw", func() {
+			if !test.slow {
+				return
+			}
+			// the draw does not return until the stall has been reported.
+			clock.Advance(threshold)
+			for j, prefix := range test.logs {
+				select {
+				case s := <-logs:
+					if !strings.HasPrefix(s, prefix) {
+						t.Errorf("test %d: log %d: %q (expected prefix %q)", i, j, s, prefix)
+					}
+				case <-time.After(time.Second):
+					t.Errorf("test %d: log %d: no stall reported", i, j)
+				}
+			}
+		})
+		clock.Advance(threshold)
+		select {
+		case s := <-logs:
+			t.Errorf("test %d: unexpected log %q", i, s)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestStallDetector_disabled(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)}
+	d := &stallDetector{clock: clock}
+	var called bool
+	d.watch("draw", func() { called = true })
+	if !called {
+		t.Errorf("fn not called")
+	}
+	if len(clock.timers) != 0 {
+		t.Errorf("%d timers started", len(clock.timers))
+	}
+}
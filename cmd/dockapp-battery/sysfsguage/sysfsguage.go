@@ -0,0 +1,242 @@
+/*
+Package sysfsguage provides a battery.Guage that reads the Linux power supply
+class in sysfs directly, so that batteries can be displayed without a running
+upower daemon or D-Bus.
+*/
+package sysfsguage
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/battery"
+)
+
+// PowerSupplyDir is the directory in which the kernel lists power supplies.
+const PowerSupplyDir = "/sys/class/power_supply"
+
+// SysfsGuage is a battery.Guage that reads the uevent file of a battery in
+// sysfs.  Batteries report either their energy, in µWh, and power, in µW, or
+// their charge, in µAh, and current, in µA.  Either is used to estimate the
+// time remaining.
+type SysfsGuage struct {
+	dir string
+	ac  string
+}
+
+// NewSysfsGuage detects batteries in PowerSupplyDir and returns a SysfsGuage
+// that reads the first.  If a line power supply is present it determines
+// whether the computer is on AC, otherwise that is inferred from the battery
+// state.
+func NewSysfsGuage() (*SysfsGuage, error) {
+	return newSysfsGuage(PowerSupplyDir)
+}
+
+func newSysfsGuage(root string) (*SysfsGuage, error) {
+	dirs, err := filepath.Glob(filepath.Join(root, "*"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(dirs)
+	g := &SysfsGuage{}
+	for _, dir := range dirs {
+		props, err := readUevent(dir)
+		if err != nil {
+			continue
+		}
+		switch props["TYPE"] {
+		case "Battery":
+			// peripherals like wireless mice report their own batteries.
+			if g.dir == "" && props["SCOPE"] != "Device" {
+				g.dir = dir
+			}
+		case "Mains":
+			if g.ac == "" {
+				g.ac = dir
+			}
+		}
+	}
+	if g.dir == "" {
+		return nil, fmt.Errorf("no batteries in %s", root)
+	}
+	return g, nil
+}
+
+// BatteryMetrics implements the battery.Guage interface.
+func (g *SysfsGuage) BatteryMetrics() (*battery.Metrics, error) {
+	props, err := readUevent(g.dir)
+	if err != nil {
+		return nil, err
+	}
+	m, err := ueventMetrics(props)
+	if err != nil {
+		return nil, err
+	}
+	if g.ac != "" {
+		ac, err := readUevent(g.ac)
+		if err != nil {
+			return nil, fmt.Errorf("line power: %v", err)
+		}
+		online := ac["ONLINE"] == "1"
+		m.OnAC = &online
+	}
+	if m.OnAC == nil {
+		m.OnAC = battery.InferOnAC(m.State)
+	}
+	return m, nil
+}
+
+// ueventMetrics returns the metrics described by the properties of a battery's
+// uevent file.
+func ueventMetrics(props map[string]string) (*battery.Metrics, error) {
+	if props["PRESENT"] == "0" {
+		return nil, fmt.Errorf("battery not present")
+	}
+	m := &battery.Metrics{
+		State: sysfsState(props["STATUS"]),
+	}
+
+	// batteries measure either energy and power or charge and current.
+	now, full, rate := prop(props, "ENERGY_NOW"), prop(props, "ENERGY_FULL"), prop(props, "POWER_NOW")
+	design := prop(props, "ENERGY_FULL_DESIGN")
+	if now == nil || full == nil {
+		now, full, rate = prop(props, "CHARGE_NOW"), prop(props, "CHARGE_FULL"), prop(props, "CURRENT_NOW")
+		design = prop(props, "CHARGE_FULL_DESIGN")
+	}
+	if e := prop(props, "ENERGY_FULL"); e != nil {
+		m.EnergyFull = *e / 1e6
+	}
+	if full != nil && design != nil && *design > 0 {
+		m.Health = *full / *design
+		if m.Health > 1 {
+			m.Health = 1
+		}
+	}
+	switch {
+	case now != nil && full != nil && *full > 0:
+		m.Fraction = *now / *full
+	case prop(props, "CAPACITY") != nil:
+		m.Fraction = *prop(props, "CAPACITY") / 100
+	default:
+		return nil, fmt.Errorf("unknown battery charge")
+	}
+	if m.Fraction > 1 {
+		m.Fraction = 1
+	}
+
+	// rates are reported as negative values by some batteries while
+	// discharging.
+	if rate != nil && *rate < 0 {
+		*rate = -*rate
+	}
+	if now != nil && full != nil && rate != nil && *rate > 0 {
+		switch m.State {
+		case battery.Discharging:
+			m.UntilEmpty = hours(*now / *rate)
+		case battery.Charging:
+			m.UntilFull = hours((*full - *now) / *rate)
+		}
+	}
+
+	if v := prop(props, "VOLTAGE_NOW"); v != nil && *v > 0 {
+		volts := *v / 1e6
+		m.Voltage = &volts
+		if i := prop(props, "CURRENT_NOW"); i != nil {
+			amps := *i / 1e6
+			m.Current = &amps
+		} else if p := prop(props, "POWER_NOW"); p != nil {
+			amps := *p / *v
+			m.Current = &amps
+		}
+		if m.Current != nil && *m.Current < 0 {
+			*m.Current = -*m.Current
+		}
+	}
+
+	// power is measured directly or derived from the current.
+	if p := prop(props, "POWER_NOW"); p != nil {
+		m.Power = math.Abs(*p / 1e6)
+	} else if m.Voltage != nil && m.Current != nil {
+		m.Power = *m.Voltage * *m.Current
+	}
+	if m.State == battery.Charging {
+		m.Power = -m.Power
+	}
+
+	// temperature is reported in tenths of a degree Celsius.
+	if temp := prop(props, "TEMP"); temp != nil {
+		m.Temperature = *temp / 10
+	}
+	return m, nil
+}
+
+// sysfsState returns the battery.State described by the status of a battery.
+func sysfsState(status string) battery.State {
+	switch status {
+	case "Charging":
+		return battery.Charging
+	case "Discharging":
+		return battery.Discharging
+	case "Full":
+		return battery.FullyCharged
+	case "Not charging":
+		// line power is connected but the battery is held below full.
+		return battery.PendingCharge
+	default:
+		return battery.Unknown
+	}
+}
+
+// prop returns the numeric value of the named property, or nil if it is
+// missing or malformed.
+func prop(props map[string]string, name string) *float64 {
+	s, ok := props[name]
+	if !ok {
+		return nil
+	}
+	x, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil
+	}
+	return &x
+}
+
+// hours returns a duration of h hours.
+func hours(h float64) *time.Duration {
+	d := time.Duration(h * float64(time.Hour))
+	return &d
+}
+
+// readUevent reads the uevent file in dir and returns its POWER_SUPPLY_
+// properties with the prefix removed.
+func readUevent(dir string) (map[string]string, error) {
+	f, err := os.Open(filepath.Join(dir, "uevent"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	props := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "POWER_SUPPLY_") {
+			continue
+		}
+		kv := strings.SplitN(strings.TrimPrefix(line, "POWER_SUPPLY_"), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		props[kv[0]] = kv[1]
+	}
+	if scanner.Err() != nil {
+		return nil, scanner.Err()
+	}
+	return props, nil
+}
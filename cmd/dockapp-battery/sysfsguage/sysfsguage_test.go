@@ -0,0 +1,98 @@
+package sysfsguage
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/battery"
+)
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func durPtr(d time.Duration) *time.Duration {
+	return &d
+}
+
+func floatPtr(x float64) *float64 {
+	return &x
+}
+
+func TestSysfsGuage(t *testing.T) {
+	for i, test := range []struct {
+		root string
+		m    *battery.Metrics
+	}{
+		{"energy", &battery.Metrics{
+			Fraction:    0.6,
+			State:       battery.Discharging,
+			UntilEmpty:  durPtr(3*time.Hour + 20*time.Minute),
+			Voltage:     floatPtr(12),
+			Current:     floatPtr(0.75),
+			Power:       9,
+			EnergyFull:  50,
+			Temperature: 31.5,
+			Health:      50.0 / 57,
+			OnAC:        boolPtr(false),
+		}},
+		{"charge", &battery.Metrics{
+			Fraction:  0.25,
+			State:     battery.Charging,
+			UntilFull: durPtr(90 * time.Minute),
+			Voltage:   floatPtr(8),
+			Current:   floatPtr(2),
+			Power:     -16,
+			Health:    0.8,
+			OnAC:      boolPtr(true),
+		}},
+		{"capacity", &battery.Metrics{
+			Fraction: 1,
+			State:    battery.FullyCharged,
+			OnAC:     boolPtr(true),
+		}},
+		{"none", nil},
+		{"missing", nil},
+	} {
+		g, err := newSysfsGuage(filepath.Join("testdata", test.root))
+		if test.m == nil {
+			if err == nil {
+				t.Errorf("test %d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		m, err := g.BatteryMetrics()
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(m, test.m) {
+			t.Errorf("test %d: %v (expected %v)", i, m, test.m)
+		}
+	}
+}
+
+func TestSysfsState(t *testing.T) {
+	for i, test := range []struct {
+		status string
+		state  battery.State
+	}{
+		{"Charging", battery.Charging},
+		{"Discharging", battery.Discharging},
+		{"Full", battery.FullyCharged},
+		{"Not charging", battery.PendingCharge},
+		{"Unknown", battery.Unknown},
+		{"", battery.Unknown},
+	} {
+		state := sysfsState(test.status)
+		if state != test.state {
+			t.Errorf("test %d: %v (expected %v)", i, state, test.state)
+		}
+	}
+}
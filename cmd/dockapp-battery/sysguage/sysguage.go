@@ -0,0 +1,152 @@
+/*
+Package sysguage provides a battery.Guage for the platform the program is
+built for.  On Linux batteries are read through upower, on Darwin by parsing
+the output of pmset, and on Windows through GetSystemPowerStatus.
+*/
+package sysguage
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/battery"
+)
+
+// ErrUnsupported is returned by New on platforms without a battery backend.
+var ErrUnsupported = fmt.Errorf("battery metrics are not supported on this platform")
+
+// matchPmsetBattery matches a battery line of `pmset -g batt`, capturing its
+// percentage, state, and time remaining.
+//
+//	 -InternalBattery-0 (id=4653155)	85%; discharging; 4:35 remaining present: true
+var matchPmsetBattery = regexp.MustCompile(`(\d+)%;\s*([^;]+);\s*(?:(\d+):(\d+) remaining)?`).FindSubmatch
+
+// parsePmset parses the output of `pmset -g batt` and returns the metrics of
+// the first battery listed.
+func parsePmset(p []byte) (*battery.Metrics, error) {
+	var m *battery.Metrics
+	var onAC *bool
+	scanner := bufio.NewScanner(bytes.NewReader(p))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "Now drawing from ") {
+			ac := strings.Contains(line, "'AC Power'")
+			onAC = &ac
+			continue
+		}
+		if m != nil {
+			continue
+		}
+		match := matchPmsetBattery(scanner.Bytes())
+		if match == nil {
+			continue
+		}
+		percent, err := strconv.Atoi(string(match[1]))
+		if err != nil {
+			return nil, fmt.Errorf("percent: %v", err)
+		}
+		m = &battery.Metrics{
+			Fraction: float64(percent) / 100,
+			State:    pmsetState(string(match[2])),
+		}
+		if match[3] != nil {
+			hours, _ := strconv.Atoi(string(match[3]))
+			minutes, _ := strconv.Atoi(string(match[4]))
+			remaining := time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute
+			switch m.State {
+			case battery.Charging:
+				m.UntilFull = &remaining
+			case battery.Discharging:
+				m.UntilEmpty = &remaining
+			}
+		}
+	}
+	if scanner.Err() != nil {
+		return nil, scanner.Err()
+	}
+	if m == nil {
+		return nil, fmt.Errorf("no batteries")
+	}
+	m.OnAC = onAC
+	if m.OnAC == nil {
+		m.OnAC = battery.InferOnAC(m.State)
+	}
+	return m, nil
+}
+
+// pmsetState returns the battery.State described by a pmset battery state.
+func pmsetState(s string) battery.State {
+	switch {
+	case s == "charging", s == "finishing charge":
+		return battery.Charging
+	case s == "discharging":
+		return battery.Discharging
+	case s == "charged":
+		return battery.FullyCharged
+	case strings.HasPrefix(s, "AC attached"):
+		return battery.PendingCharge
+	default:
+		return battery.Unknown
+	}
+}
+
+// powerStatus is the Windows SYSTEM_POWER_STATUS structure.
+type powerStatus struct {
+	ACLineStatus        byte
+	BatteryFlag         byte
+	BatteryLifePercent  byte
+	SystemStatusFlag    byte
+	BatteryLifeTime     uint32
+	BatteryFullLifeTime uint32
+}
+
+// SYSTEM_POWER_STATUS values.
+const (
+	acOffline      = 0
+	acOnline       = 1
+	batteryCharge  = 8
+	batteryNone    = 128
+	unknownByte    = 255
+	unknownSeconds = 0xFFFFFFFF
+)
+
+// powerStatusMetrics returns the metrics described by s.
+func powerStatusMetrics(s *powerStatus) (*battery.Metrics, error) {
+	if s.BatteryFlag != unknownByte && s.BatteryFlag&batteryNone != 0 {
+		return nil, fmt.Errorf("no batteries")
+	}
+	if s.BatteryLifePercent == unknownByte {
+		return nil, fmt.Errorf("unknown battery charge")
+	}
+	m := &battery.Metrics{
+		Fraction: float64(s.BatteryLifePercent) / 100,
+	}
+	switch s.ACLineStatus {
+	case acOnline:
+		onAC := true
+		m.OnAC = &onAC
+	case acOffline:
+		onAC := false
+		m.OnAC = &onAC
+	}
+	switch {
+	case s.BatteryFlag != unknownByte && s.BatteryFlag&batteryCharge != 0:
+		m.State = battery.Charging
+	case s.ACLineStatus == acOnline && s.BatteryLifePercent == 100:
+		m.State = battery.FullyCharged
+	case s.ACLineStatus == acOnline:
+		m.State = battery.PendingCharge
+	case s.ACLineStatus == acOffline:
+		m.State = battery.Discharging
+	}
+	if m.State == battery.Discharging && s.BatteryLifeTime != unknownSeconds {
+		untilEmpty := time.Duration(s.BatteryLifeTime) * time.Second
+		m.UntilEmpty = &untilEmpty
+	}
+	return m, nil
+}
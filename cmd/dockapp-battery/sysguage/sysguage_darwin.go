@@ -0,0 +1,29 @@
+package sysguage
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/battery"
+)
+
+// PmsetGuage is a battery.Guage that parses the output of `pmset -g batt`.
+type PmsetGuage struct{}
+
+// New returns a Guage that reads the system battery using pmset.
+func New() (battery.Guage, error) {
+	_, err := exec.LookPath("pmset")
+	if err != nil {
+		return nil, err
+	}
+	return &PmsetGuage{}, nil
+}
+
+// BatteryMetrics implements the battery.Guage interface.
+func (g *PmsetGuage) BatteryMetrics() (*battery.Metrics, error) {
+	p, err := exec.Command("pmset", "-g", "batt").Output()
+	if err != nil {
+		return nil, fmt.Errorf("pmset: %v", err)
+	}
+	return parsePmset(p)
+}
@@ -0,0 +1,11 @@
+package sysguage
+
+import (
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/battery"
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/creeperguage"
+)
+
+// New returns a Guage that reads the system battery through upower.
+func New() (battery.Guage, error) {
+	return creeperguage.NewCreeperBatteryGuage()
+}
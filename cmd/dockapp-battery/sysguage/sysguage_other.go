@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package sysguage
+
+import (
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/battery"
+)
+
+// New returns ErrUnsupported.
+func New() (battery.Guage, error) {
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,135 @@
+package sysguage
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/battery"
+)
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func durPtr(d time.Duration) *time.Duration {
+	return &d
+}
+
+func TestParsePmset(t *testing.T) {
+	for i, test := range []struct {
+		fixture string
+		m       *battery.Metrics
+	}{
+		{"pmset_discharging.txt", &battery.Metrics{
+			Fraction:   0.85,
+			State:      battery.Discharging,
+			UntilEmpty: durPtr(4*time.Hour + 35*time.Minute),
+			OnAC:       boolPtr(false),
+		}},
+		{"pmset_charging.txt", &battery.Metrics{
+			Fraction:  0.42,
+			State:     battery.Charging,
+			UntilFull: durPtr(time.Hour + 5*time.Minute),
+			OnAC:      boolPtr(true),
+		}},
+		{"pmset_charged.txt", &battery.Metrics{
+			Fraction: 1,
+			State:    battery.FullyCharged,
+			OnAC:     boolPtr(true),
+		}},
+		{"pmset_limit.txt", &battery.Metrics{
+			Fraction: 0.8,
+			State:    battery.PendingCharge,
+			OnAC:     boolPtr(true),
+		}},
+		{"pmset_noestimate.txt", &battery.Metrics{
+			Fraction: 0.63,
+			State:    battery.Discharging,
+			OnAC:     boolPtr(false),
+		}},
+		{"pmset_nobattery.txt", nil},
+	} {
+		p, err := ioutil.ReadFile(filepath.Join("testdata", test.fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := parsePmset(p)
+		if test.m == nil {
+			if err == nil {
+				t.Errorf("test %d: expected an error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(m, test.m) {
+			t.Errorf("test %d: %s (expected %s)", i, metricsString(m), metricsString(test.m))
+		}
+	}
+}
+
+func TestPowerStatusMetrics(t *testing.T) {
+	for i, test := range []struct {
+		s *powerStatus
+		m *battery.Metrics
+	}{
+		{&powerStatus{ACLineStatus: acOffline, BatteryFlag: 1, BatteryLifePercent: 75, BatteryLifeTime: 3600}, &battery.Metrics{
+			Fraction:   0.75,
+			State:      battery.Discharging,
+			UntilEmpty: durPtr(time.Hour),
+			OnAC:       boolPtr(false),
+		}},
+		{&powerStatus{ACLineStatus: acOffline, BatteryFlag: 2, BatteryLifePercent: 20, BatteryLifeTime: unknownSeconds}, &battery.Metrics{
+			Fraction: 0.2,
+			State:    battery.Discharging,
+			OnAC:     boolPtr(false),
+		}},
+		{&powerStatus{ACLineStatus: acOnline, BatteryFlag: batteryCharge | 1, BatteryLifePercent: 90, BatteryLifeTime: unknownSeconds}, &battery.Metrics{
+			Fraction: 0.9,
+			State:    battery.Charging,
+			OnAC:     boolPtr(true),
+		}},
+		{&powerStatus{ACLineStatus: acOnline, BatteryFlag: 1, BatteryLifePercent: 100, BatteryLifeTime: unknownSeconds}, &battery.Metrics{
+			Fraction: 1,
+			State:    battery.FullyCharged,
+			OnAC:     boolPtr(true),
+		}},
+		{&powerStatus{ACLineStatus: acOnline, BatteryFlag: 1, BatteryLifePercent: 80, BatteryLifeTime: unknownSeconds}, &battery.Metrics{
+			Fraction: 0.8,
+			State:    battery.PendingCharge,
+			OnAC:     boolPtr(true),
+		}},
+		{&powerStatus{ACLineStatus: unknownByte, BatteryFlag: unknownByte, BatteryLifePercent: 50, BatteryLifeTime: unknownSeconds}, &battery.Metrics{
+			Fraction: 0.5,
+		}},
+		{&powerStatus{ACLineStatus: acOnline, BatteryFlag: batteryNone, BatteryLifePercent: unknownByte}, nil},
+	} {
+		m, err := powerStatusMetrics(test.s)
+		if test.m == nil {
+			if err == nil {
+				t.Errorf("test %d: expected an error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(m, test.m) {
+			t.Errorf("test %d: %s (expected %s)", i, metricsString(m), metricsString(test.m))
+		}
+	}
+}
+
+func metricsString(m *battery.Metrics) string {
+	s := m.State.String() + " " + battery.FormatPercent(m) + " " + battery.FormatRemaining(m)
+	if m.OnAC != nil {
+		s += " " + battery.FormatPowerSource(m)
+	}
+	return s
+}
@@ -0,0 +1,34 @@
+package sysguage
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/battery"
+)
+
+var procGetSystemPowerStatus = syscall.NewLazyDLL("kernel32.dll").NewProc("GetSystemPowerStatus")
+
+// PowerStatusGuage is a battery.Guage that calls GetSystemPowerStatus.
+type PowerStatusGuage struct{}
+
+// New returns a Guage that reads the system battery using
+// GetSystemPowerStatus.
+func New() (battery.Guage, error) {
+	err := procGetSystemPowerStatus.Find()
+	if err != nil {
+		return nil, err
+	}
+	return &PowerStatusGuage{}, nil
+}
+
+// BatteryMetrics implements the battery.Guage interface.
+func (g *PowerStatusGuage) BatteryMetrics() (*battery.Metrics, error) {
+	var s powerStatus
+	ok, _, err := procGetSystemPowerStatus.Call(uintptr(unsafe.Pointer(&s)))
+	if ok == 0 {
+		return nil, fmt.Errorf("GetSystemPowerStatus: %v", err)
+	}
+	return powerStatusMetrics(&s)
+}
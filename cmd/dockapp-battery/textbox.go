@@ -0,0 +1,67 @@
+package main
+
+import (
+	"image"
+	"strings"
+
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/battery"
+	"github.com/bmatsuo/dockapp-go/geometry"
+)
+
+// TextBox is a region of the window in which text is drawn using a fixed
+// formatter, independent of the formatters rotated through the layout's text
+// box.
+type TextBox struct {
+	Rect      image.Rectangle
+	Formatter battery.MetricFormatter
+}
+
+// geometryList is a flag.Value holding the geometry given by each use of a
+// flag.  If the flag is not given the list holds only its default.
+type geometryList struct {
+	def   image.Rectangle
+	rects []image.Rectangle
+}
+
+// Rects returns the geometries given for the flag, or its default.
+func (l *geometryList) Rects() []image.Rectangle {
+	if len(l.rects) == 0 {
+		return []image.Rectangle{l.def}
+	}
+	return l.rects
+}
+
+func (l *geometryList) String() string {
+	if l == nil {
+		return ""
+	}
+	var s []string
+	for _, r := range l.Rects() {
+		s = append(s, geometry.Format(r))
+	}
+	return strings.Join(s, ",")
+}
+
+func (l *geometryList) Set(s string) error {
+	r, err := geometry.Parse(s)
+	if err != nil {
+		return err
+	}
+	l.rects = append(l.rects, r)
+	return nil
+}
+
+// stringList is a flag.Value holding the value given by each use of a flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/color"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bmatsuo/dockapp-go/cmd/dockapp-battery/battery"
+)
+
+func TestApp_TextBoxes(t *testing.T) {
+	text := func(s string) battery.MetricFormatter {
+		return battery.MetricFormatFunc(func(*battery.Metrics) string { return s })
+	}
+	left := image.Rect(22, 0, 60, 20)
+	right := image.Rect(60, 0, 117, 20)
+	for i, test := range []struct {
+		boxes    []TextBox
+		hideText bool
+		drawn    []image.Rectangle
+	}{
+		{nil, false, nil},
+		{[]TextBox{{left, text("50%")}}, false, []image.Rectangle{left}},
+		{[]TextBox{{left, text("50%")}, {right, text("2h")}}, false, []image.Rectangle{left, right}},
+		{[]TextBox{{left, text("50%")}, {right, text("")}}, false, []image.Rectangle{left}},
+		{[]TextBox{{left, text("50%")}, {right, text("2h")}}, true, nil},
+
+		// text wider than its box is clipped.
+		{[]TextBox{{right, text("WWWWWWWWWWWWWWWW")}}, false, []image.Rectangle{right}},
+	} {
+		layout := testLayout(t)
+		layout.textRect = image.Rectangle{}
+		layout.hideText = test.hideText
+		app := NewApp(layout)
+		app.TextBoxes = test.boxes
+		img, err := app.Render(testMetrics(0.5, battery.Discharging), text("ignored"))
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		var total int
+		for _, r := range test.drawn {
+			n := countColor(img, r, color.Black)
+			if n == 0 {
+				t.Errorf("test %d: no text drawn in %v", i, r)
+			}
+			total += n
+		}
+		textArea := image.Rect(22, 0, 117, 20)
+		if n := countColor(img, textArea, color.Black); n != total {
+			t.Errorf("test %d: %d text pixels (expected %d)", i, n, total)
+		}
+	}
+}
+
+func TestApp_TextBoxes_formatError(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	f, err := battery.FormatMetricTemplate("{{.doesnotexist.field}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	box := image.Rect(60, 0, 117, 20)
+	layout := testLayout(t)
+	layout.textRect = image.Rectangle{}
+	m := testMetrics(0.5, battery.Discharging)
+
+	expect := NewApp(layout)
+	expect.TextBoxes = []TextBox{{box, fallbackFormatter}}
+	expectImg, err := expect.Render(m, fallbackFormatter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := NewApp(layout)
+	app.TextBoxes = []TextBox{{box, f}}
+	for i := 0; i < 3; i++ {
+		img, err := app.Render(m, fallbackFormatter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if countColor(img, box, color.Black) == 0 {
+			t.Fatalf("render %d: no text drawn in %v", i, box)
+		}
+		for y := box.Min.Y; y < box.Max.Y; y++ {
+			for x := box.Min.X; x < box.Max.X; x++ {
+				if img.RGBAAt(x, y) != expectImg.RGBAAt(x, y) {
+					t.Fatalf("render %d: pixel (%d, %d): %v (expected %v)", i, x, y, img.RGBAAt(x, y), expectImg.RGBAAt(x, y))
+				}
+			}
+		}
+	}
+	if n := strings.Count(buf.String(), "format:"); n != 1 {
+		t.Errorf("format error logged %d times (expected 1):\n%s", n, buf.String())
+	}
+}
+
+func TestTextBoxFlags(t *testing.T) {
+	def := image.Rect(0, 0, 95, 20)
+	for i, test := range []struct {
+		args    []string
+		rects   []image.Rectangle
+		formats stringList
+	}{
+		{nil, []image.Rectangle{def}, nil},
+		{[]string{"-g=10x20+5+0"}, []image.Rectangle{image.Rect(5, 0, 15, 20)}, nil},
+		{
+			[]string{"-g=10x20", "-f={{.state}}", "-g=30x20+10+0", "-f=x"},
+			[]image.Rectangle{image.Rect(0, 0, 10, 20), image.Rect(10, 0, 40, 20)},
+			stringList{"{{.state}}", "x"},
+		},
+	} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		rects := &geometryList{def: def}
+		var formats stringList
+		fs.Var(rects, "g", "")
+		fs.Var(&formats, "f", "")
+		err := fs.Parse(test.args)
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(rects.Rects(), test.rects) {
+			t.Errorf("test %d: geometries %v (expected %v)", i, rects.Rects(), test.rects)
+		}
+		if !reflect.DeepEqual(formats, test.formats) {
+			t.Errorf("test %d: formats %q (expected %q)", i, formats, test.formats)
+		}
+	}
+
+	var rects geometryList
+	if err := rects.Set("nonsense"); err == nil {
+		t.Errorf("invalid geometry accepted")
+	}
+}
@@ -2,13 +2,17 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"log"
+	"math"
+	"math/rand"
 	"os"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -20,13 +24,26 @@ type CPU interface {
 	FracUtil() float64
 }
 
-// Constants for CPU mode indices in a Time.InMode value.
+// Constants for CPU mode indices in a Time.InMode value, in the order of the
+// fields of /proc/stat.  Older kernels report fewer modes.
 const (
-	ModeIdle = 3
+	ModeUser = iota
+	ModeNice
+	ModeSystem
+	ModeIdle
+	ModeIOWait
+	ModeIRQ
+	ModeSoftIRQ
+	ModeSteal
+	ModeGuest
+	ModeGuestNice
 )
 
 // Delta returns channel that receives deltas in Time values received over c.
-// The returned channel is closed afer c is closed.
+// The returned channel is closed afer c is closed.  Delta takes ownership of
+// the slices received over c and recycles them for future polls once they are
+// no longer needed.  The deltas sent are newly allocated and never recycled,
+// so consumers may retain them.
 func Delta(c <-chan []*Time) <-chan []*Time {
 	d := make(chan []*Time)
 	go func() {
@@ -40,12 +57,17 @@ func Delta(c <-chan []*Time) <-chan []*Time {
 				if !ok {
 					return
 				}
-				tdelta = append([]*Time(nil), tnew...)
 				if told != nil {
-					for i, t := range told {
-						tdelta[i] = tdelta[i].Sub(t)
+					n := len(tnew)
+					if len(told) < n {
+						n = len(told)
+					}
+					tdelta = make([]*Time, n)
+					for i := range tdelta {
+						tdelta[i] = tnew[i].Sub(told[i])
 					}
 					_d = d
+					putTimes(told)
 				}
 				told = tnew
 			case _d <- tdelta:
@@ -57,25 +79,122 @@ func Delta(c <-chan []*Time) <-chan []*Time {
 	return d
 }
 
+// Window returns a channel that receives the sum of the last n deltas
+// received over c for each core, so that utilization is averaged over a
+// sliding window of n polls rather than measured over a single poll.  Cores
+// are matched by name.  Only cores present in the latest delta are sent and a
+// core which was absent from earlier deltas is summed over the deltas which
+// contain it.  Window retains the deltas received over c, which must not be
+// modified.  The returned channel is closed after c is closed.  If n is less
+// than two c is returned.
+func Window(c <-chan []*Time, n int) <-chan []*Time {
+	if n < 2 {
+		return c
+	}
+	w := make(chan []*Time)
+	go func() {
+		defer close(w)
+		var window [][]*Time
+		var sum []*Time
+		var _w chan []*Time
+		for {
+			select {
+			case d, ok := <-c:
+				if !ok {
+					return
+				}
+				if len(window) == n {
+					copy(window, window[1:])
+					window = window[:n-1]
+				}
+				window = append(window, d)
+				sum = sumWindow(window)
+				_w = w
+			case _w <- sum:
+				_w = nil
+			}
+		}
+	}()
+	return w
+}
+
+// sumWindow returns the sum of the time spent in each mode by the cores in
+// the latest deltas of window.
+func sumWindow(window [][]*Time) []*Time {
+	latest := window[len(window)-1]
+	sum := make([]*Time, len(latest))
+	index := make(map[string]int, len(latest))
+	for i, t := range latest {
+		sum[i] = &Time{name: t.name, Aggregate: t.Aggregate, InMode: make([]int64, len(t.InMode))}
+		index[t.name] = i
+	}
+	for _, times := range window {
+		for _, t := range times {
+			i, ok := index[t.name]
+			if !ok {
+				continue
+			}
+			for mode, dur := range t.InMode {
+				if mode < len(sum[i].InMode) {
+					sum[i].InMode[mode] += dur
+				}
+			}
+		}
+	}
+	return sum
+}
+
+// timePool recycles the slices read by Pollers, along with their Time values
+// and InMode slices, so that polling does not allocate once warmed up.
+var timePool sync.Pool
+
+// getTimes returns a recycled slice for use with readTimeInto, or nil if none
+// is available.
+func getTimes() []*Time {
+	if p, ok := timePool.Get().(*[]*Time); ok {
+		return *p
+	}
+	return nil
+}
+
+// putTimes recycles times.  The caller must not use times, or any Time values
+// in it, after calling putTimes.
+func putTimes(times []*Time) {
+	timePool.Put(&times)
+}
+
 // Poller periodically measures CPU utilization.
 type Poller struct {
-	tick  *time.Ticker
-	C     chan []*Time
-	stop  chan struct{}
-	times []*Time
+	dur    time.Duration
+	jitter float64
+	rand   func() float64
+	C      chan []*Time
+	stop   chan struct{}
+	times  []*Time
+	mut    sync.Mutex
+	paused bool
 }
 
 // Poll returns a new Poller that has begun polling CPU utilization.
 func Poll(dur time.Duration) (*Poller, error) {
+	return PollJitter(dur, 0)
+}
+
+// PollJitter is like Poll but each poll is randomly offset by up to the
+// fraction jitter of dur, so that many processes started at once do not all
+// poll at the same time.
+func PollJitter(dur time.Duration, jitter float64) (*Poller, error) {
 	timesInit, err := ReadTime()
 	if err != nil {
 		return nil, err
 	}
 	p := &Poller{
-		tick:  time.NewTicker(dur),
-		C:     make(chan []*Time, 1),
-		stop:  make(chan struct{}),
-		times: timesInit,
+		dur:    dur,
+		jitter: jitter,
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())).Float64,
+		C:      make(chan []*Time, 1),
+		stop:   make(chan struct{}),
+		times:  timesInit,
 	}
 	go p.loop()
 	return p, nil
@@ -83,81 +202,197 @@ func Poll(dur time.Duration) (*Poller, error) {
 
 // Stop stops polling for CPU utilization.
 func (p *Poller) Stop() {
-	p.tick.Stop()
 	close(p.stop)
 }
 
-func (p *Poller) poll() bool {
-	times, err := ReadTime()
+// interval returns the time to wait before the next poll.  interval must only
+// be called by the polling loop.
+func (p *Poller) interval() time.Duration {
+	if p.jitter <= 0 {
+		return p.dur
+	}
+	return p.dur + time.Duration((2*p.rand()-1)*p.jitter*float64(p.dur))
+}
+
+// Pause causes p to skip polling until Resume is called.  Utilization measured
+// after resuming covers the entire time p was paused.
+func (p *Poller) Pause() {
+	p.mut.Lock()
+	p.paused = true
+	p.mut.Unlock()
+}
+
+// Resume resumes polling after a call to Pause.
+func (p *Poller) Resume() {
+	p.mut.Lock()
+	p.paused = false
+	p.mut.Unlock()
+}
+
+func (p *Poller) isPaused() bool {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	return p.paused
+}
+
+// poll reads the current cpu times into a recycled slice.  If the previous
+// times were never sent they are recycled, otherwise ownership of them passed
+// to their receiver.
+func (p *Poller) poll(sent bool) bool {
+	times, err := readTimeFile("/proc/stat", getTimes())
 	if err != nil {
 		log.Printf("cpumon: %v", err)
 		return false
 	}
+	if !sent {
+		putTimes(p.times)
+	}
 	p.times = times
 	return true
 }
 
 func (p *Poller) loop() {
 	defer close(p.C)
+	tick := time.NewTimer(p.interval())
+	defer tick.Stop()
 	var c chan []*Time
+	sent := false
 	for {
 		select {
 		case <-p.stop:
 			return
-		case <-p.tick.C:
-			if p.poll() {
+		case <-tick.C:
+			tick.Reset(p.interval())
+			if p.isPaused() {
+				continue
+			}
+			if p.poll(sent) {
 				c = p.C
+				sent = false
 			}
 		case c <- p.times:
 			c = nil
+			sent = true
 		}
 	}
 }
 
-// Time is a measurement of the time spent in each CPU mode.
+// Time is a measurement of the time spent in each CPU mode.  Aggregate is true
+// for the line of /proc/stat summarizing all cores.
 type Time struct {
-	name   string
-	InMode []int64
+	name      string
+	Aggregate bool
+	InMode    []int64
 }
 
 // ReadTime opens /proc/stat and reads the times each CPU has spent in each of
 // their modes.
 func ReadTime() ([]*Time, error) {
-	stat, err := os.Open("/proc/stat")
+	return readTimeFile("/proc/stat", nil)
+}
+
+func readTimeFile(path string, buf []*Time) ([]*Time, error) {
+	stat, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer stat.Close()
-	return readTime(stat)
+	return readTimeInto(stat, buf)
 }
 
-var matchStatCPU = regexp.MustCompile(`^cpu\d*\s`).Match
-
 func readTime(r io.Reader) ([]*Time, error) {
-	var times []*Time
+	return readTimeInto(r, nil)
+}
+
+// readTimeInto is like readTime but reuses the Time values and InMode slices
+// of buf, including those beyond its length, and returns a slice of buf when
+// its capacity is sufficient.
+func readTimeInto(r io.Reader, buf []*Time) ([]*Time, error) {
+	buf = buf[:cap(buf)]
+	var n int
 	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
-		if !matchStatCPU(scanner.Bytes()) {
+		line := scanner.Bytes()
+		nameLen := statCPUName(line)
+		if nameLen == 0 {
 			continue
 		}
-		pieces := strings.Fields(scanner.Text())
-		t := &Time{
-			name: pieces[0],
+		if n == len(buf) {
+			buf = append(buf, nil)
 		}
-		times = append(times, t)
-		for _, piece := range pieces[1:] {
-			count, err := strconv.ParseInt(piece, 10, 64)
-			if err != nil {
-				return nil, fmt.Errorf("unable to parse line: %q", scanner.Bytes())
-			}
-			t.InMode = append(t.InMode, count)
+		if buf[n] == nil {
+			buf[n] = new(Time)
 		}
-
+		err := parseStatCPU(buf[n], line, nameLen)
+		if err != nil {
+			return nil, err
+		}
+		n++
 	}
 	if scanner.Err() != nil {
 		return nil, scanner.Err()
 	}
-	return times, nil
+	if n == 0 {
+		return nil, nil
+	}
+	return buf[:n], nil
+}
+
+// statCPUName returns the length of the cpu name beginning line, matching
+// `^cpu\d*\s`.  If line does not describe a cpu statCPUName returns zero.
+func statCPUName(line []byte) int {
+	if !bytes.HasPrefix(line, []byte("cpu")) {
+		return 0
+	}
+	n := len("cpu")
+	for n < len(line) && '0' <= line[n] && line[n] <= '9' {
+		n++
+	}
+	if n == len(line) || !isStatSpace(line[n]) {
+		return 0
+	}
+	return n
+}
+
+// parseStatCPU parses a cpu line from /proc/stat with a name of length n into
+// t, reusing its name and InMode slice when possible.  Fields are parsed in
+// place to avoid allocating intermediate strings.
+func parseStatCPU(t *Time, line []byte, n int) error {
+	if t.name != string(line[:n]) {
+		t.name = string(line[:n])
+	}
+	t.Aggregate = n == len("cpu")
+	fields := line[n:]
+	var count int
+	for i := range fields {
+		if !isStatSpace(fields[i]) && (i == 0 || isStatSpace(fields[i-1])) {
+			count++
+		}
+	}
+	if cap(t.InMode) < count {
+		t.InMode = make([]int64, 0, count)
+	}
+	t.InMode = t.InMode[:0]
+	for i := 0; i < len(fields); {
+		if isStatSpace(fields[i]) {
+			i++
+			continue
+		}
+		var x int64
+		for ; i < len(fields) && !isStatSpace(fields[i]); i++ {
+			c := fields[i]
+			if c < '0' || '9' < c || x > (math.MaxInt64-9)/10 {
+				return fmt.Errorf("unable to parse line: %q", line)
+			}
+			x = x*10 + int64(c-'0')
+		}
+		t.InMode = append(t.InMode, x)
+	}
+	return nil
+}
+
+func isStatSpace(c byte) bool {
+	return c == ' ' || c == '\t'
 }
 
 // Name returns the name of the CPU corresponding to t.
@@ -168,8 +403,9 @@ func (t *Time) Name() string {
 // Sub returns the difference of time measurements in t and t2.
 func (t *Time) Sub(t2 *Time) *Time {
 	t3 := &Time{
-		name:   t.name,
-		InMode: append([]int64(nil), t.InMode...),
+		name:      t.name,
+		Aggregate: t.Aggregate,
+		InMode:    append([]int64(nil), t.InMode...),
 	}
 	for i, dur := range t2.InMode {
 		t3.InMode[i] -= dur
@@ -188,6 +424,14 @@ func (t *Time) Frac(mode int) float64 {
 	return idle / total
 }
 
+// FracIn is like Frac but returns zero if t does not report the given mode.
+func (t *Time) FracIn(mode int) float64 {
+	if mode < 0 || mode >= len(t.InMode) {
+		return 0
+	}
+	return t.Frac(mode)
+}
+
 // FracUtil implements the CPU interface.
 func (t *Time) FracUtil() float64 {
 	return 1 - t.Frac(ModeIdle)
@@ -216,6 +460,10 @@ func FilterCPU(cpus <-chan []CPU, ignore []string) <-chan []CPU {
 	if len(ignore) == 0 {
 		return cpus
 	}
+	ignored := make(map[string]bool, len(ignore))
+	for _, name := range ignore {
+		ignored[name] = true
+	}
 
 	c := make(chan []CPU)
 	go func() {
@@ -223,12 +471,10 @@ func FilterCPU(cpus <-chan []CPU, ignore []string) <-chan []CPU {
 		for cpus := range cpus {
 			var _cpus []CPU
 			for _, t := range cpus {
-				for _, name := range ignore {
-					if t.Name() == name {
-						continue
-					}
-					_cpus = append(_cpus, t)
+				if ignored[t.Name()] {
+					continue
 				}
+				_cpus = append(_cpus, t)
 			}
 			cpus = _cpus
 			c <- cpus
@@ -237,3 +483,140 @@ func FilterCPU(cpus <-chan []CPU, ignore []string) <-chan []CPU {
 
 	return c
 }
+
+// Smooth returns a channel that receives the cores received over cpus with
+// their utilization replaced by an exponential moving average.  Each average
+// is the sum of the previous average weighted by factor and the latest
+// utilization weighted by 1-factor, so that larger factors give more stable
+// but less responsive utilization.  Cores are matched by name and the average
+// of a core begins with its first utilization.  The returned channel is closed
+// after cpus is closed.
+func Smooth(cpus <-chan []CPU, factor float64) <-chan []CPU {
+	c := make(chan []CPU)
+	go func() {
+		defer close(c)
+		avg := make(map[string]float64)
+		for cpus := range cpus {
+			smoothed := make([]CPU, len(cpus))
+			next := make(map[string]float64, len(cpus))
+			for i, cpu := range cpus {
+				util := clampFrac(cpu.FracUtil())
+				if prev, ok := avg[cpu.Name()]; ok {
+					util = factor*prev + (1-factor)*util
+				}
+				next[cpu.Name()] = util
+				smoothed[i] = smoothCPU(cpu, util)
+			}
+			avg = next
+			c <- smoothed
+		}
+	}()
+	return c
+}
+
+// smoothCPU returns cpu with its utilization replaced by util.  If cpu is a
+// ModeCPU the result is too.
+func smoothCPU(cpu CPU, util float64) CPU {
+	if mcpu, ok := cpu.(ModeCPU); ok {
+		return smoothedModeCPU{mcpu, util}
+	}
+	return smoothedCPU{cpu, util}
+}
+
+type smoothedCPU struct {
+	CPU
+	util float64
+}
+
+func (cpu smoothedCPU) FracUtil() float64 {
+	return cpu.util
+}
+
+type smoothedModeCPU struct {
+	ModeCPU
+	util float64
+}
+
+func (cpu smoothedModeCPU) FracUtil() float64 {
+	return cpu.util
+}
+
+// SelectCPU passes either the aggregate of all cores or the individual cores
+// in slices received over the cpus chan.  If total is true only the aggregate
+// is passed, otherwise only the individual cores are.
+func SelectCPU(cpus <-chan []CPU, total bool) <-chan []CPU {
+	c := make(chan []CPU)
+	go func() {
+		defer close(c)
+		for cpus := range cpus {
+			var _cpus []CPU
+			for _, t := range cpus {
+				if isAggregate(t) == total {
+					_cpus = append(_cpus, t)
+				}
+			}
+			c <- _cpus
+		}
+	}()
+	return c
+}
+
+// isAggregate returns true if cpu summarizes all cores.
+func isAggregate(cpu CPU) bool {
+	if t, ok := cpu.(*Time); ok {
+		return t.Aggregate
+	}
+	return cpu.Name() == IgnoreTotal
+}
+
+// IgnoreTotal is the name of the aggregate line in /proc/stat summarizing all
+// cores.
+const IgnoreTotal = "cpu"
+
+var matchIgnoreRange = regexp.MustCompile(`^cpu(\d+)-(\d+)$`).FindStringSubmatch
+
+// ParseIgnore parses a comma separated list of cpus to ignore, returning the
+// names of the cpus for use with FilterCPU.  Entries may be cpu names (e.g.
+// "cpu3"), inclusive ranges of cores (e.g. "cpu0-3"), or the keyword "total"
+// which ignores the aggregate of all cores.  The returned names are unique and
+// in the order they first appear.
+func ParseIgnore(s string) ([]string, error) {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if entry == "total" {
+			add(IgnoreTotal)
+			continue
+		}
+		m := matchIgnoreRange(entry)
+		if m == nil {
+			add(entry)
+			continue
+		}
+		first, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid range %q: %v", entry, err)
+		}
+		last, err := strconv.Atoi(m[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid range %q: %v", entry, err)
+		}
+		if last < first {
+			return nil, fmt.Errorf("invalid range %q", entry)
+		}
+		for i := first; i <= last; i++ {
+			add("cpu" + strconv.Itoa(i))
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseIgnore(t *testing.T) {
+	for i, test := range []struct {
+		s     string
+		names []string
+		err   bool
+	}{
+		{"cpu0,cpu3", []string{"cpu0", "cpu3"}, false},
+		{"cpu0-2,cpu5", []string{"cpu0", "cpu1", "cpu2", "cpu5"}, false},
+		{"total", []string{"cpu"}, false},
+		{"total,cpu1", []string{"cpu", "cpu1"}, false},
+		{"cpu0-2,cpu1-3", []string{"cpu0", "cpu1", "cpu2", "cpu3"}, false},
+		{"cpu1,cpu1,cpu0-1", []string{"cpu1", "cpu0"}, false},
+		{"cpu2-2", []string{"cpu2"}, false},
+		{" cpu0 , ,cpu1", []string{"cpu0", "cpu1"}, false},
+		{"cpu3-1", nil, true},
+	} {
+		names, err := ParseIgnore(test.s)
+		if (err != nil) != test.err {
+			t.Errorf("test %d: err %v (expected error %v)", i, err, test.err)
+			continue
+		}
+		if !reflect.DeepEqual(names, test.names) {
+			t.Errorf("test %d: %q (expected %q)", i, names, test.names)
+		}
+	}
+}
+
+func TestFilterCPU(t *testing.T) {
+	var cpus []CPU
+	for _, name := range []string{"cpu", "cpu0", "cpu1", "cpu2", "cpu3"} {
+		cpus = append(cpus, &Time{name: name})
+	}
+	for i, test := range []struct {
+		ignore []string
+		names  []string
+	}{
+		{nil, []string{"cpu", "cpu0", "cpu1", "cpu2", "cpu3"}},
+		{[]string{"cpu"}, []string{"cpu0", "cpu1", "cpu2", "cpu3"}},
+		{[]string{"cpu0", "cpu3"}, []string{"cpu", "cpu1", "cpu2"}},
+		{[]string{"cpu1", "cpu1"}, []string{"cpu", "cpu0", "cpu2", "cpu3"}},
+	} {
+		c := make(chan []CPU, 1)
+		c <- cpus
+		close(c)
+		var names []string
+		for _, cpu := range <-FilterCPU(c, test.ignore) {
+			names = append(names, cpu.Name())
+		}
+		if !reflect.DeepEqual(names, test.names) {
+			t.Errorf("test %d: %q (expected %q)", i, names, test.names)
+		}
+	}
+}
+
+// TestFilterCPU_once checks that each core is passed through at most once
+// regardless of the number of ignored cores.
+func TestFilterCPU_once(t *testing.T) {
+	var cpus []CPU
+	for _, name := range []string{"cpu0", "cpu1", "cpu2"} {
+		cpus = append(cpus, &Time{name: name})
+	}
+	for i, test := range []struct {
+		ignore []string
+		names  []string
+	}{
+		{[]string{"cpu0", "cpu2"}, []string{"cpu1"}},
+		{[]string{"cpu1"}, []string{"cpu0", "cpu2"}},
+		{[]string{"cpu3", "cpu4", "cpu5"}, []string{"cpu0", "cpu1", "cpu2"}},
+	} {
+		c := make(chan []CPU, 1)
+		c <- cpus
+		close(c)
+		var names []string
+		for _, cpu := range <-FilterCPU(c, test.ignore) {
+			names = append(names, cpu.Name())
+		}
+		if !reflect.DeepEqual(names, test.names) {
+			t.Errorf("test %d: %q (expected %q)", i, names, test.names)
+		}
+	}
+}
+
+func TestSelectCPU(t *testing.T) {
+	cpus := []CPU{
+		&Time{name: "cpu", Aggregate: true},
+		&Time{name: "cpu0"},
+		&Time{name: "cpu1"},
+	}
+	for i, test := range []struct {
+		total bool
+		names []string
+	}{
+		{false, []string{"cpu0", "cpu1"}},
+		{true, []string{"cpu"}},
+	} {
+		c := make(chan []CPU, 1)
+		c <- cpus
+		close(c)
+		var names []string
+		for _, cpu := range <-SelectCPU(c, test.total) {
+			names = append(names, cpu.Name())
+		}
+		if !reflect.DeepEqual(names, test.names) {
+			t.Errorf("test %d: %q (expected %q)", i, names, test.names)
+		}
+	}
+}
+
+func TestSmooth(t *testing.T) {
+	cpus := make(chan []CPU)
+	c := Smooth(cpus, 0.5)
+	send := func(util float64) float64 {
+		cpus <- []CPU{fracCPU{"cpu0", util}}
+		smoothed := <-c
+		if len(smoothed) != 1 || smoothed[0].Name() != "cpu0" {
+			t.Fatalf("cores %v", smoothed)
+		}
+		return smoothed[0].FracUtil()
+	}
+
+	if util := send(0); util != 0 {
+		t.Errorf("initial utilization %v (expected 0)", util)
+	}
+	prev := 0.0
+	for i := 0; i < 20; i++ {
+		util := send(1)
+		if util <= prev || util > 1 {
+			t.Errorf("poll %d: utilization %v does not converge from %v", i, util, prev)
+		}
+		prev = util
+	}
+	if 1-prev > 1e-5 {
+		t.Errorf("utilization %v did not converge to 1", prev)
+	}
+	close(cpus)
+	if _, ok := <-c; ok {
+		t.Errorf("received after close")
+	}
+
+	// modes are still available for stacking after smoothing.
+	cpus = make(chan []CPU, 1)
+	cpus <- []CPU{&Time{name: "cpu0", InMode: []int64{1, 0, 0, 1}}}
+	close(cpus)
+	smoothed := <-Smooth(cpus, 0.5)
+	if _, ok := smoothed[0].(ModeCPU); !ok {
+		t.Errorf("smoothed Time is not a ModeCPU")
+	}
+}
+
+func TestPoller_interval(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i, test := range []struct {
+		jitter   float64
+		min, max time.Duration
+	}{
+		{0, time.Second, time.Second},
+		{0.1, 900 * time.Millisecond, 1100 * time.Millisecond},
+		{0.5, 500 * time.Millisecond, 1500 * time.Millisecond},
+	} {
+		p := &Poller{dur: time.Second, jitter: test.jitter, rand: r.Float64}
+		seen := make(map[time.Duration]bool)
+		for j := 0; j < 100; j++ {
+			d := p.interval()
+			if d < test.min || d > test.max {
+				t.Errorf("test %d: interval %v not in [%v, %v]", i, d, test.min, test.max)
+			}
+			seen[d] = true
+		}
+		if test.jitter > 0 && len(seen) < 2 {
+			t.Errorf("test %d: intervals do not vary", i)
+		}
+	}
+}
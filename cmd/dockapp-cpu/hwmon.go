@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Default sysfs locations of hardware sensors and cpu topology.
+const (
+	DefaultHwmonDir = "/sys/class/hwmon"
+	DefaultCPUDir   = "/sys/devices/system/cpu"
+)
+
+// coretemp sensor labels that identify the temperature of a physical package.
+var packageLabels = []string{"Package id ", "Physical id "}
+
+// ReadPackageTemps reads the coretemp sensors found in the hwmon directory dir
+// and returns the temperature of each physical cpu package, in degrees
+// Celsius, keyed by package id.  If no coretemp sensors exist ReadPackageTemps
+// returns an empty map.
+func ReadPackageTemps(dir string) (map[int]float64, error) {
+	temps := make(map[int]float64)
+	hwmons, err := filepath.Glob(filepath.Join(dir, "hwmon*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, hwmon := range hwmons {
+		name, err := readSysfs(filepath.Join(hwmon, "name"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if name != "coretemp" {
+			continue
+		}
+		inputs, err := filepath.Glob(filepath.Join(hwmon, "temp*_input"))
+		if err != nil {
+			return nil, err
+		}
+		for _, input := range inputs {
+			id, ok, err := readPackageLabel(strings.TrimSuffix(input, "_input") + "_label")
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			milli, err := readSysfsInt(input)
+			if err != nil {
+				return nil, err
+			}
+			temps[id] = float64(milli) / 1000
+		}
+	}
+	return temps, nil
+}
+
+// readPackageLabel reads a sensor label and returns the package id it names.
+// If the label does not exist or does not name a package readPackageLabel
+// returns false.
+func readPackageLabel(path string) (id int, ok bool, err error) {
+	label, err := readSysfs(path)
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	for _, prefix := range packageLabels {
+		if strings.HasPrefix(label, prefix) {
+			id, err = strconv.Atoi(strings.TrimPrefix(label, prefix))
+			if err != nil {
+				return 0, false, fmt.Errorf("%s: %v", path, err)
+			}
+			return id, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// ReadCorePackages returns the physical package id of each core described in
+// the cpu directory dir, keyed by core name (e.g. "cpu0").
+func ReadCorePackages(dir string) (map[string]int, error) {
+	packages := make(map[string]int)
+	paths, err := filepath.Glob(filepath.Join(dir, "cpu[0-9]*", "topology", "physical_package_id"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		id, err := readSysfsInt(path)
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.Base(filepath.Dir(filepath.Dir(path)))
+		packages[name] = int(id)
+	}
+	return packages, nil
+}
+
+func readSysfs(path string) (string, error) {
+	p, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(p)), nil
+}
+
+func readSysfsInt(path string) (int64, error) {
+	s, err := readSysfs(path)
+	if err != nil {
+		return 0, err
+	}
+	x, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", path, err)
+	}
+	return x, nil
+}
+
+// Thermometer reports the temperature of cpu cores using coretemp hwmon
+// sensors.  A Thermometer is safe to use from multiple goroutines.
+type Thermometer struct {
+	hwmonDir string
+	packages map[string]int
+	mut      sync.Mutex
+	temps    map[int]float64
+}
+
+// NewThermometer returns a Thermometer that reads sensors in hwmonDir and maps
+// cores to packages using the topology in cpuDir.  Update must be called
+// before the Thermometer reports temperatures.
+func NewThermometer(hwmonDir, cpuDir string) (*Thermometer, error) {
+	packages, err := ReadCorePackages(cpuDir)
+	if err != nil {
+		return nil, err
+	}
+	th := &Thermometer{
+		hwmonDir: hwmonDir,
+		packages: packages,
+	}
+	return th, nil
+}
+
+// Update reads the current package temperatures.
+func (th *Thermometer) Update() error {
+	temps, err := ReadPackageTemps(th.hwmonDir)
+	if err != nil {
+		return err
+	}
+	th.mut.Lock()
+	th.temps = temps
+	th.mut.Unlock()
+	return nil
+}
+
+// Temp returns the temperature of the package containing the named core.  The
+// aggregate "cpu" reports the temperature of the hottest package.  When a
+// core's package is unknown the temperature of the only package is used.  If
+// no temperature is known for the core Temp returns false.
+func (th *Thermometer) Temp(name string) (float64, bool) {
+	th.mut.Lock()
+	defer th.mut.Unlock()
+	if name == IgnoreTotal {
+		var max float64
+		for _, t := range th.temps {
+			if t > max {
+				max = t
+			}
+		}
+		return max, len(th.temps) > 0
+	}
+	id, ok := th.packages[name]
+	if !ok {
+		if len(th.temps) != 1 {
+			return 0, false
+		}
+		for id = range th.temps {
+		}
+	}
+	t, ok := th.temps[id]
+	return t, ok
+}
+
+// TempRenderer is a Renderer implementation that tints the image drawn by
+// Renderer toward Color as a core's temperature rises from Min to Max degrees
+// Celsius.  Cores with an unknown temperature are not tinted.
+type TempRenderer struct {
+	Temp     func(name string) (float64, bool)
+	Min, Max float64
+	Color    color.Color
+	Renderer Renderer
+}
+
+// RenderCPU implements the Renderer interface.
+func (tr *TempRenderer) RenderCPU(img draw.Image, cpu CPU) {
+	tr.Renderer.RenderCPU(img, cpu)
+	t, ok := tr.Temp(cpu.Name())
+	if !ok {
+		return
+	}
+	frac := (t - tr.Min) / (tr.Max - tr.Min)
+	if frac <= 0 {
+		return
+	}
+	if frac > 1 {
+		frac = 1
+	}
+	mask := image.NewUniform(color.Alpha{A: uint8(frac * 0xff)})
+	draw.DrawMask(img, img.Bounds(), image.NewUniform(tr.Color), image.ZP, mask, image.ZP, draw.Over)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// withSysfs writes files, keyed by path relative to a temporary directory,
+// and returns the directory along with a function to remove it.
+func withSysfs(t *testing.T, files map[string]string) (dir string, cleanup func()) {
+	dir, err := ioutil.TempDir("", "dockapp-cpu-sysfs-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(path, []byte(data), 0644)
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestReadPackageTemps(t *testing.T) {
+	for i, test := range []struct {
+		files map[string]string
+		temps map[int]float64
+	}{
+		{nil, map[int]float64{}},
+		{
+			map[string]string{
+				"hwmon0/name":        "acpitz\n",
+				"hwmon0/temp1_input": "27800\n",
+			},
+			map[int]float64{},
+		},
+		{
+			map[string]string{
+				"hwmon0/name":        "acpitz\n",
+				"hwmon0/temp1_input": "27800\n",
+				"hwmon1/name":        "coretemp\n",
+				"hwmon1/temp1_input": "45000\n",
+				"hwmon1/temp1_label": "Package id 0\n",
+				"hwmon1/temp2_input": "43000\n",
+				"hwmon1/temp2_label": "Core 0\n",
+				"hwmon1/temp3_input": "44000\n",
+				"hwmon1/temp3_label": "Core 1\n",
+			},
+			map[int]float64{0: 45},
+		},
+		{
+			map[string]string{
+				"hwmon1/name":        "coretemp\n",
+				"hwmon1/temp1_input": "45500\n",
+				"hwmon1/temp1_label": "Package id 0\n",
+				"hwmon2/name":        "coretemp\n",
+				"hwmon2/temp1_input": "61000\n",
+				"hwmon2/temp1_label": "Physical id 1\n",
+				"hwmon2/temp2_input": "60000\n",
+			},
+			map[int]float64{0: 45.5, 1: 61},
+		},
+	} {
+		dir, cleanup := withSysfs(t, test.files)
+		temps, err := ReadPackageTemps(dir)
+		cleanup()
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(temps, test.temps) {
+			t.Errorf("test %d: %v (expected %v)", i, temps, test.temps)
+		}
+	}
+}
+
+func TestThermometer(t *testing.T) {
+	hwmon, cleanup := withSysfs(t, map[string]string{
+		"hwmon0/name":        "coretemp\n",
+		"hwmon0/temp1_input": "45000\n",
+		"hwmon0/temp1_label": "Package id 0\n",
+		"hwmon1/name":        "coretemp\n",
+		"hwmon1/temp1_input": "70000\n",
+		"hwmon1/temp1_label": "Package id 1\n",
+	})
+	defer cleanup()
+	cpu, cleanup := withSysfs(t, map[string]string{
+		"cpu0/topology/physical_package_id": "0\n",
+		"cpu1/topology/physical_package_id": "1\n",
+	})
+	defer cleanup()
+
+	th, err := NewThermometer(hwmon, cpu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := th.Temp("cpu0"); ok {
+		t.Errorf("temperature known before update")
+	}
+	err = th.Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range []struct {
+		name string
+		temp float64
+		ok   bool
+	}{
+		{"cpu0", 45, true},
+		{"cpu1", 70, true},
+		{"cpu", 70, true},
+		{"cpu2", 0, false},
+	} {
+		temp, ok := th.Temp(test.name)
+		if ok != test.ok {
+			t.Errorf("test %d: ok %v (expected %v)", i, ok, test.ok)
+		}
+		if temp != test.temp {
+			t.Errorf("test %d: %v (expected %v)", i, temp, test.temp)
+		}
+	}
+}
+
+func TestThermometer_noTopology(t *testing.T) {
+	hwmon, cleanup := withSysfs(t, map[string]string{
+		"hwmon0/name":        "coretemp\n",
+		"hwmon0/temp1_input": "52000\n",
+		"hwmon0/temp1_label": "Package id 0\n",
+	})
+	defer cleanup()
+	th, err := NewThermometer(hwmon, filepath.Join(hwmon, "missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = th.Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+	temp, ok := th.Temp("cpu3")
+	if !ok || temp != 52 {
+		t.Errorf("temp %v %v (expected 52 true)", temp, ok)
+	}
+}
+
+type fracCPU struct {
+	name string
+	frac float64
+}
+
+func (c fracCPU) Name() string      { return c.name }
+func (c fracCPU) FracUtil() float64 { return c.frac }
+
+type fillRenderer struct {
+	c color.Color
+}
+
+func (r fillRenderer) RenderCPU(img draw.Image, cpu CPU) {
+	draw.Draw(img, img.Bounds(), image.NewUniform(r.c), image.ZP, draw.Src)
+}
+
+func TestTempRenderer(t *testing.T) {
+	temps := map[string]float64{"cpu0": 40, "cpu1": 70, "cpu2": 100}
+	tr := &TempRenderer{
+		Temp: func(name string) (float64, bool) {
+			t, ok := temps[name]
+			return t, ok
+		},
+		Min:      50,
+		Max:      90,
+		Color:    color.RGBA{R: 0xff, A: 0xff},
+		Renderer: fillRenderer{color.RGBA{G: 0xff, A: 0xff}},
+	}
+	for i, test := range []struct {
+		name string
+		c    color.RGBA
+	}{
+		{"cpu0", color.RGBA{G: 0xff, A: 0xff}},
+		{"cpu1", color.RGBA{R: 0x7f, G: 0x80, A: 0xff}},
+		{"cpu2", color.RGBA{R: 0xff, A: 0xff}},
+		{"cpu3", color.RGBA{G: 0xff, A: 0xff}},
+	} {
+		img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+		tr.RenderCPU(img, fracCPU{test.name, 0.5})
+		c := img.RGBAAt(1, 1)
+		if c != test.c {
+			t.Errorf("test %d: %v (expected %v)", i, c, test.c)
+		}
+	}
+}
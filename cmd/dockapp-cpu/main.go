@@ -9,6 +9,62 @@ A minimal window with custom geometry:
 
 	dockapp-cpu -window.geometry=40x20
 
+A bar is drawn for each core.  The aggregate utilization of all cores may be
+drawn as a single bar instead.
+
+	dockapp-cpu -total
+
+Cores are ignored by name or by range.
+
+	dockapp-cpu -ignore=cpu0-1
+
+Each core's number may be drawn under its bar.  Labels that are wider than
+their bar are omitted.
+
+	dockapp-cpu -window.geometry=40x30 -labels
+
+Bars may be tinted as the temperature of their cpu package rises, as reported
+by coretemp hwmon sensors.  Without sensors bars are not tinted.
+
+	dockapp-cpu -temp -temp.min=50 -temp.max=90
+
+Bars may be divided into the time spent in user mode (green), in the kernel
+(red) and waiting for I/O (blue), so that a machine which is bound by I/O is
+easily distinguished from one which is bound by cpu.
+
+	dockapp-cpu -stacked
+
+Utilization is polled once a second by default.  Utilization measured over a
+short interval is noisy.  Bars may instead show the average utilization over a
+sliding window of the most recent polls.
+
+	dockapp-cpu -interval=250ms -sample.window=2s
+
+Alternatively, utilization may be smoothed by an exponential moving average
+which gives the previous average the weight of the -smooth factor and the
+latest poll the remainder.  Smoothing trades responsiveness for stability, the
+closer the factor is to 1 the more slowly bars respond to changes.
+
+	dockapp-cpu -interval=250ms -smooth=0.75
+
+Bars are colored from green to red by default, which is hard to distinguish for
+people with red-green color blindness.  The -palette flag selects a blue to
+orange gradient instead.
+
+	dockapp-cpu -palette=cb
+
+Utilization can be drawn in a terminal instead of an x window, for example on
+a server over ssh.  Each core is drawn as a colored block character which is
+updated in place.
+
+	dockapp-cpu -term
+
+Polling stops while the window is unmapped or fully covered by other windows
+and the utilization drawn when it becomes visible covers the time it was
+hidden.  Disable this to keep polling while hidden.
+
+	dockapp-cpu -pause.hidden=false
+
 Help
 
 For command usage and other help run dockapp-battery with the -h flag.
@@ -30,6 +86,12 @@ import (
 	"github.com/BurntSushi/xgbutil"
 	"github.com/bmatsuo/dockapp-go/dockapp"
 	"github.com/bmatsuo/dockapp-go/geometry"
+	"github.com/bmatsuo/dockapp-go/imageutil"
+	"github.com/bmatsuo/dockapp-go/render"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/math/fixed"
 )
 
 func main() {
@@ -40,44 +102,130 @@ func main() {
 		panic("show me the stacks")
 	}()
 	window := geometry.Flag("window.geometry", image.Rect(0, 0, 100, 20), "window geometry in pixels")
-	ignore := flag.String("ignore", "", "comma separated list of cpus to ignore")
+	ignore := flag.String("ignore", "", "comma separated list of cpus (e.g. cpu3), ranges (e.g. cpu0-3), or \"total\" to ignore")
+	interval := flag.Duration("interval", time.Second, "time between polls of cpu utilization")
+	smooth := flag.Float64("smooth", 0, "weight in the range [0, 1) of the previous average in an exponential moving average of utilization (0 to disable)")
+	jitter := flag.Float64("jitter", 0.05, "fraction of the polling interval by which polls are randomly offset (0 to disable)")
+	total := flag.Bool("total", false, "draw the aggregate utilization of all cores as a single bar instead of a bar for each core")
+	labels := flag.Bool("labels", false, "label each bar with its core number")
+	labelSize := flag.Float64("labels.fontsize", 8, "label font size")
+	pauseHidden := flag.Bool("pause.hidden", true, "stop polling while the window is unmapped or fully obscured")
+	palette := flag.String("palette", "default", "colors used to draw bars: \"default\" or \"cb\" (color blind friendly blue and orange)")
+	retries := flag.Int("x.retries", 5, "number of times to reconnect to the x server when the window cannot be drawn")
+	term := flag.Bool("term", false, "draw utilization in the terminal using ANSI colors instead of an x window")
+	sampleWindow := flag.Duration("sample.window", time.Second, "duration over which utilization is averaged, in multiples of the polling interval")
+	stacked := flag.Bool("stacked", false, "divide bars into user, system, and iowait time")
+	temp := flag.Bool("temp", false, "tint bars by package temperature (requires coretemp sensors)")
+	tempMin := flag.Float64("temp.min", 50, "temperature in degrees Celsius at which bars begin to be tinted")
+	tempMax := flag.Float64("temp.max", 90, "temperature in degrees Celsius at which bars are fully tinted")
 	flag.Parse()
 
-	poll, err := Poll(time.Second)
+	if *jitter < 0 || *jitter >= 1 {
+		log.Fatalf("jitter: %v is not in the range [0, 1)", *jitter)
+	}
+	if *interval <= 0 {
+		log.Fatalf("interval: %v is not positive", *interval)
+	}
+	if *smooth < 0 || *smooth >= 1 {
+		log.Fatalf("smooth: %v is not in the range [0, 1)", *smooth)
+	}
+	poll, err := PollJitter(*interval, *jitter)
 	if err != nil {
 		log.Fatal(err)
 	}
-	delta := Delta(poll.C)
-	deltaCPU := TimeToCPU(delta)
+	delta := Window(Delta(poll.C), int(*sampleWindow / *interval))
+	deltaCPU := SelectCPU(TimeToCPU(delta), *total)
+	if *smooth > 0 {
+		deltaCPU = Smooth(deltaCPU, *smooth)
+	}
 	if *ignore != "" {
-		ignores := strings.Split(*ignore, ",")
+		ignores, err := ParseIgnore(*ignore)
+		if err != nil {
+			log.Fatalf("ignore: %v", err)
+		}
 		deltaCPU = FilterCPU(deltaCPU, ignores)
 	}
 
+	gradient, ok := palettes[*palette]
+	if !ok {
+		log.Fatalf("palette: unknown palette %q", *palette)
+	}
 	app := NewApp()
-
-	// Connect to the x server and create a dockapp window for the process.
-	X, err := xgbutil.NewConn()
-	if err != nil {
-		log.Fatal(err)
+	app.Renderer = NewBarRenderer(gradient)
+	if *stacked && *temp {
+		log.Fatalf("stacked: bars cannot be tinted by temperature")
+	}
+	if *stacked {
+		app.Renderer = NewStackedBarRenderer(DefaultStackedRenderer)
+	}
+	if *temp {
+		th, err := NewThermometer(DefaultHwmonDir, DefaultCPUDir)
+		if err != nil {
+			log.Fatalf("temperature: %v", err)
+		}
+		err = th.Update()
+		if err != nil {
+			log.Printf("temperature: %v", err)
+		}
+		go func() {
+			for range time.Tick(time.Second) {
+				err := th.Update()
+				if err != nil {
+					log.Printf("temperature: %v", err)
+				}
+			}
+		}()
+		app.Renderer = NewBarRenderer(&TempRenderer{
+			Temp:     th.Temp,
+			Min:      *tempMin,
+			Max:      *tempMax,
+			Color:    color.RGBA{R: 0xff, G: 0x40, A: 0xff},
+			Renderer: gradient,
+		})
+	}
+	if *labels {
+		ttf, err := truetype.Parse(goregular.TTF)
+		if err != nil {
+			log.Fatalf("font: %v", err)
+		}
+		app.LabelFace = truetype.NewFace(ttf, &truetype.Options{Size: *labelSize})
 	}
 
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
 
-	dockapp, err := dockapp.New(X, *window)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer dockapp.Destroy()
-	defer dockapp.Quit()
-	// map the window and start the main event loop
-	go dockapp.Main()
+	if *term {
+		// draw to the terminal instead of an x window.
+		grad := gradient.(*SimpleGradient)
+		r := NewTermRenderer(os.Stdout, &render.Gradient{C1: grad.C1, C2: grad.C2})
+		go RunTerm(r, app, deltaCPU)
+	} else {
+		// Connect to the x server and create a dockapp window for the
+		// process.
+		X, err := xgbutil.NewConn()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		dock, err := dockapp.New(X, *window)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer dock.Destroy()
+		defer dock.Quit()
+		// map the window and start the main event loop
+		go dock.Main()
+
+		if *pauseHidden {
+			go dockapp.PauseHidden(dock.Visibility(), poll)
+		}
 
-	// begin the main draw loop. the draw loop receives updates in the form of
-	// new battery metrics and formatters.  The event loop will exit if the
-	// draw loop ever terminates.
-	go RunApp(dockapp, app, deltaCPU)
+		// begin the main draw loop. the draw loop receives updates in the
+		// form of new battery metrics and formatters.  The event loop will
+		// exit if the draw loop ever terminates.  the window is recreated on
+		// a new connection if the x server cannot draw it.
+		go RunApp(dockapp.NewWatchdog(dock, *retries, time.Second), app, deltaCPU)
+	}
 
 	var timeout <-chan time.Time
 	for {
@@ -98,12 +246,16 @@ func main() {
 }
 
 // RunApp is the main loop for the application.
-func RunApp(dockapp *dockapp.DockApp, app *App, delta <-chan []CPU) {
+func RunApp(surface dockapp.Surface, app *App, delta <-chan []CPU) {
 	defer close(app.done)
 
-	img := dockapp.Canvas()
+	img := surface.Canvas()
 	app.Draw(img, nil)
-	dockapp.FlushImage()
+	err := surface.FlushImage()
+	if err != nil {
+		log.Printf("flush: %v", err)
+		return
+	}
 
 	var cpus []CPU
 	var ok bool
@@ -133,16 +285,23 @@ func RunApp(dockapp *dockapp.DockApp, app *App, delta <-chan []CPU) {
 		}
 
 		// draw the widget to the screen.
-		app.Draw(dockapp.Canvas(), cpus)
-		dockapp.FlushImage()
+		app.Draw(surface.Canvas(), cpus)
+		err := surface.FlushImage()
+		if err != nil {
+			log.Printf("flush: %v", err)
+			return
+		}
 	}
 }
 
-// App graphically renders CPU utilization.
+// App graphically renders CPU utilization.  If LabelFace is not nil each
+// core's number is drawn under its bar in LabelColor (white by default).
 type App struct {
 	done       chan struct{}
 	Background image.Image
 	Renderer   Renderer
+	LabelFace  font.Face
+	LabelColor color.Color
 }
 
 // NewApp returns a newly created App.
@@ -166,7 +325,9 @@ func (app *App) renderCPU(img draw.Image, cpu CPU) {
 	r.RenderCPU(img, cpu)
 }
 
-// Draw renders the given cpu cores on img.
+// Draw renders the given cpu cores on img.  The cores divide the width of img
+// as evenly as possible, and cores which would be less than a pixel wide are
+// not drawn.
 func (app *App) Draw(img draw.Image, cpus []CPU) {
 	rect := img.Bounds()
 	bg := app.Background
@@ -175,81 +336,79 @@ func (app *App) Draw(img draw.Image, cpus []CPU) {
 	}
 	draw.Draw(img, rect, bg, bg.Bounds().Min, draw.Over)
 
-	if len(cpus) == 0 {
-		return
+	var strip image.Rectangle
+	if app.LabelFace != nil {
+		rect, strip = labelStrip(rect, app.LabelFace.Metrics())
 	}
 
-	cpuDx := rect.Dx() / len(cpus)
-	ptIncr := image.Point{X: cpuDx}
-	ptDelta := image.Point{}
-	rectDx := image.Rectangle{
-		Min: rect.Min,
-		Max: rect.Max,
-	}
-	rectDx.Max.X = rect.Min.X + cpuDx
-	for _, cpu := range cpus {
-		irect := image.Rectangle{
-			Min: rectDx.Min.Add(ptDelta),
-			Max: rectDx.Max.Add(ptDelta),
+	for i, irect := range geometry.Split(rect, len(cpus)) {
+		if irect.Empty() {
+			continue
+		}
+		subimg := imageutil.SubImage(img, irect)
+		app.renderCPU(subimg, cpus[i])
+		if !strip.Empty() {
+			lrect := image.Rect(irect.Min.X, strip.Min.Y, irect.Max.X, strip.Max.Y)
+			app.drawLabel(img, lrect, cpuLabel(cpus[i]))
 		}
-		subimg := SubImage(img, irect)
-		app.renderCPU(subimg, cpu)
-
-		ptDelta = ptDelta.Add(ptIncr)
 	}
 }
 
-// Renderer draws a core's utilization in an image.
-type Renderer interface {
-	RenderCPU(draw.Image, CPU)
-}
-
-// Border is a Renderer implementation.
-type Border struct {
-	Size     int
-	Color    color.Color
-	Renderer Renderer
-}
-
-// RenderCPU implements the Renderer interface.
-func (b *Border) RenderCPU(img draw.Image, cpu CPU) {
-	rect := img.Bounds()
-	interior := geometry.Contract(rect, b.Size)
-	mask := MaskInside(interior)
-	draw.DrawMask(img, rect, image.NewUniform(b.Color), image.ZP, mask, rect.Min, draw.Over)
-	sub := SubImage(img, interior)
-	b.Renderer.RenderCPU(sub, cpu)
+// drawLabel draws text centered in r.  If text does not fit within r nothing
+// is drawn.
+func (app *App) drawLabel(img draw.Image, r image.Rectangle, text string) {
+	c := app.LabelColor
+	if c == nil {
+		c = color.White
+	}
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(c),
+		Face: app.LabelFace,
+	}
+	dot, ok := labelDot(r, d.MeasureString(text), app.LabelFace.Metrics())
+	if !ok {
+		return
+	}
+	d.Dot = dot
+	d.DrawString(text)
 }
 
-// BackgroundRenderer is a Renderer implementation.
-type BackgroundRenderer struct {
-	Color    color.Color
-	Renderer Renderer
+// cpuLabel returns the label for cpu, its core number.
+func cpuLabel(cpu CPU) string {
+	return strings.TrimPrefix(cpu.Name(), "cpu")
 }
 
-// RenderCPU implements the Renderer interface.
-func (bg *BackgroundRenderer) RenderCPU(img draw.Image, cpu CPU) {
-	draw.Draw(img, img.Bounds(), image.NewUniform(bg.Color), image.ZP, draw.Over)
-	bg.Renderer.RenderCPU(img, cpu)
+// labelStrip divides r into an area for bars and a strip along its bottom edge
+// tall enough for labels in a face with metrics m.  If r is not tall enough to
+// hold both labelStrip returns r and an empty strip.
+func labelStrip(r image.Rectangle, m font.Metrics) (bars, strip image.Rectangle) {
+	height := (m.Ascent + m.Descent).Ceil()
+	if height >= r.Dy() {
+		return r, image.Rectangle{}
+	}
+	bars, strip = r, r
+	bars.Max.Y -= height
+	strip.Min.Y = bars.Max.Y
+	return bars, strip
 }
 
-// FractionRenderer is a Renderer implementation.
-type FractionRenderer struct {
-	Horizontal bool
-	Renderer   Renderer
+// labelDot returns the point at which text with the given advance width must
+// be drawn to center it within r, for a face with metrics m.  If the text is
+// wider than r labelDot returns false.
+func labelDot(r image.Rectangle, advance fixed.Int26_6, m font.Metrics) (fixed.Point26_6, bool) {
+	if advance.Ceil() > r.Dx() {
+		return fixed.Point26_6{}, false
+	}
+	height := m.Ascent + m.Descent
+	x := fixed.I(r.Min.X) + (fixed.I(r.Dx())-advance)/2
+	y := fixed.I(r.Min.Y) + (fixed.I(r.Dy())-height)/2 + m.Ascent
+	return fixed.Point26_6{X: x, Y: y}, true
 }
 
-// RenderCPU implements the Renderer interface.
-func (frac *FractionRenderer) RenderCPU(img draw.Image, cpu CPU) {
-	rect := img.Bounds()
-
-	utilized := cpu.FracUtil()
-	utilizedHeight := int(float64(rect.Dy()) * utilized)
-	yoffset := rect.Dy() - utilizedHeight
-	rect.Min = rect.Min.Add(image.Pt(0, yoffset))
-	img = SubImage(img, rect)
-
-	frac.Renderer.RenderCPU(img, cpu)
+// Renderer draws a core's utilization in an image.
+type Renderer interface {
+	RenderCPU(draw.Image, CPU)
 }
 
 // SimpleGradient is a Renderer implementation.
@@ -259,104 +418,78 @@ type SimpleGradient struct {
 
 // RenderCPU implents the RendererImplementation.
 func (grad *SimpleGradient) RenderCPU(img draw.Image, cpu CPU) {
+	g := &render.Gradient{C1: grad.C1, C2: grad.C2}
+	g.Render(img, CPUSource(cpu))
+}
 
-	r1, g1, b1, a1 := grad.C1.RGBA()
-	r2, g2, b2, a2 := grad.C2.RGBA()
-
-	const M = 0xFFFF
-	m := uint32(cpu.FracUtil() * float64(M))
-	// The resultant red value is a blend of dstr and srcr, and ranges in [0, M].
-	// The calculation for green, blue and alpha is similar.
-	r := (r1*(M-m) + r2*m) / M
-	g := (g1*(M-m) + g2*m) / M
-	b := (b1*(M-m) + b2*m) / M
-	a := (a1*(M-m) + a2*m) / M
-
-	utilColor := color.RGBA64{
-		R: uint16(r),
-		G: uint16(g),
-		B: uint16(b),
-		A: uint16(a),
-	}
-
-	draw.Draw(img, img.Bounds(), image.NewUniform(utilColor), image.ZP, draw.Over)
+// SourceRenderer is a Renderer implementation that draws cores using a
+// render.Renderer.
+type SourceRenderer struct {
+	Renderer render.Renderer
 }
 
-// DefaultRenderer is the default Renderer implementation used to render CPU
-// utilization.
-var DefaultRenderer Renderer = &BackgroundRenderer{
-	Color: color.White,
-	Renderer: &Border{
-		Size:  1,
-		Color: color.Black,
-		Renderer: &FractionRenderer{
-			Renderer: &SimpleGradient{
-				C1: color.RGBA{G: 0xff, A: 0xff},
-				C2: color.RGBA{R: 0xff, A: 0xff},
-			},
-		},
-	},
+// RenderCPU implements the Renderer interface.
+func (r *SourceRenderer) RenderCPU(img draw.Image, cpu CPU) {
+	r.Renderer.Render(img, CPUSource(cpu))
 }
 
-// SubImage produces a subimage of img as seen through r.  Attempts to draw
-// outside of r (or img) have no effect.
-func SubImage(img draw.Image, r image.Rectangle) draw.Image {
-	r = img.Bounds().Intersect(r)
-	return &drawSubImage{img, r}
+// cpuSourceRenderer is a render.Renderer that draws the core of a Source
+// returned by CPUSource using a Renderer, so that Renderers can be wrapped by
+// those of package render.
+type cpuSourceRenderer struct {
+	Renderer Renderer
 }
 
-type drawSubImage struct {
-	img draw.Image
-	r   image.Rectangle
+// Render implements the render.Renderer interface.
+func (r cpuSourceRenderer) Render(img draw.Image, src render.Source) {
+	r.Renderer.RenderCPU(img, src.(cpuSource).cpu)
 }
 
-func (img *drawSubImage) ColorModel() color.Model {
-	return img.img.ColorModel()
+// CPUSource returns a render.Source measuring the utilization of cpu and
+// labeled by its core number.
+func CPUSource(cpu CPU) render.Source {
+	return cpuSource{cpu}
 }
 
-func (img *drawSubImage) Bounds() image.Rectangle {
-	return img.r
+type cpuSource struct {
+	cpu CPU
 }
 
-func (img *drawSubImage) At(x, y int) color.Color {
-	if image.Pt(x, y).In(img.r) {
-		return img.img.At(x, y)
-	}
-	panic("color at out of bounds index")
+func (s cpuSource) Fraction() float64 {
+	return s.cpu.FracUtil()
 }
 
-func (img *drawSubImage) Set(x, y int, c color.Color) {
-	if image.Pt(x, y).In(img.r) {
-		img.img.Set(x, y, c)
-	}
+func (s cpuSource) Label() string {
+	return cpuLabel(s.cpu)
 }
 
-// Mask is an Image implementation that masks over/around a rectangle.
-type Mask struct {
-	image.Image
-	R      image.Rectangle
-	Inside bool
+// DefaultRenderer is the default Renderer implementation used to render CPU
+// utilization.
+var DefaultRenderer = NewBarRenderer(DefaultGradient)
+
+// DefaultGradient colors the bars drawn by DefaultRenderer.
+var DefaultGradient Renderer = &SimpleGradient{
+	C1: color.RGBA{G: 0xff, A: 0xff},
+	C2: color.RGBA{R: 0xff, A: 0xff},
 }
 
-// MaskInside returns Mask image that is transparent inside r.
-func MaskInside(r image.Rectangle) *Mask {
-	return &Mask{image.Opaque, r, true}
+// ColorBlindGradient colors bars from blue to orange, which remain
+// distinguishable to people with red-green color blindness.
+var ColorBlindGradient Renderer = &SimpleGradient{
+	C1: color.RGBA{R: 0x00, G: 0x72, B: 0xb2, A: 0xff},
+	C2: color.RGBA{R: 0xe6, G: 0x9f, B: 0x00, A: 0xff},
 }
 
-// MaskOutside returns Mask image that is transparent outside r.
-func MaskOutside(r image.Rectangle) *Mask {
-	return &Mask{image.Opaque, r, false}
+// palettes maps the names accepted by the -palette flag to the gradients
+// coloring bars.
+var palettes = map[string]Renderer{
+	"default": DefaultGradient,
+	"cb":      ColorBlindGradient,
 }
 
-// At returns either m.Image.At(x, y) or color.Transparent depending on if
-// point (x, y) is masked.
-func (m *Mask) At(x, y int) color.Color {
-	inR := image.Pt(x, y).In(m.R)
-	if inR && m.Inside {
-		return color.Transparent
-	}
-	if !inR && !m.Inside {
-		return color.Transparent
-	}
-	return m.Image.At(x, y)
+// NewBarRenderer returns a Renderer that draws a bordered bar filled by fill
+// in proportion to a core's utilization.
+func NewBarRenderer(fill Renderer) Renderer {
+	return &SourceRenderer{render.NewBar(cpuSourceRenderer{fill})}
 }
+
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+	"time"
+
+	"github.com/bmatsuo/dockapp-go/dockapp/dockapptest"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+func TestLabelStrip(t *testing.T) {
+	m := font.Metrics{Ascent: fixed.I(6), Descent: fixed.I(2)}
+	for i, test := range []struct {
+		r     image.Rectangle
+		bars  image.Rectangle
+		strip image.Rectangle
+	}{
+		{image.Rect(0, 0, 40, 30), image.Rect(0, 0, 40, 22), image.Rect(0, 22, 40, 30)},
+		{image.Rect(5, 5, 45, 35), image.Rect(5, 5, 45, 27), image.Rect(5, 27, 45, 35)},
+		{image.Rect(0, 0, 40, 8), image.Rect(0, 0, 40, 8), image.Rectangle{}},
+	} {
+		bars, strip := labelStrip(test.r, m)
+		if bars != test.bars {
+			t.Errorf("test %d: bars %v (expected %v)", i, bars, test.bars)
+		}
+		if strip != test.strip {
+			t.Errorf("test %d: strip %v (expected %v)", i, strip, test.strip)
+		}
+	}
+}
+
+func TestLabelDot(t *testing.T) {
+	m := font.Metrics{Ascent: fixed.I(6), Descent: fixed.I(2)}
+	for i, test := range []struct {
+		r       image.Rectangle
+		advance fixed.Int26_6
+		dot     fixed.Point26_6
+		ok      bool
+	}{
+		{image.Rect(0, 22, 10, 30), fixed.I(4), fixed.P(3, 28), true},
+		{image.Rect(10, 22, 20, 30), fixed.I(4), fixed.P(13, 28), true},
+		{image.Rect(0, 20, 10, 30), fixed.I(10), fixed.P(0, 27), true},
+		{image.Rect(0, 22, 10, 30), fixed.I(11), fixed.Point26_6{}, false},
+		{image.Rect(0, 22, 5, 30), fixed.I(5) + 1, fixed.Point26_6{}, false},
+	} {
+		dot, ok := labelDot(test.r, test.advance, m)
+		if ok != test.ok {
+			t.Errorf("test %d: ok %v (expected %v)", i, ok, test.ok)
+		}
+		if dot != test.dot {
+			t.Errorf("test %d: dot %v (expected %v)", i, dot, test.dot)
+		}
+	}
+}
+
+func TestCPUSource(t *testing.T) {
+	src := CPUSource(fracCPU{"cpu3", 0.25})
+	if src.Fraction() != 0.25 {
+		t.Errorf("fraction %v (expected 0.25)", src.Fraction())
+	}
+	if src.Label() != "3" {
+		t.Errorf("label %q (expected %q)", src.Label(), "3")
+	}
+}
+
+func TestRunApp(t *testing.T) {
+	surface := dockapptest.NewMemSurface(image.Rect(0, 0, 64, 64))
+	app := NewApp()
+	delta := make(chan []CPU)
+	go RunApp(surface, app, delta)
+	delta <- []CPU{fracCPU{"cpu0", 0.25}, fracCPU{"cpu1", 1}}
+	close(delta)
+	select {
+	case <-app.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("RunApp did not return")
+	}
+
+	frames := surface.Frames()
+	if len(frames) != 2 {
+		t.Fatalf("%d frames (expected 2)", len(frames))
+	}
+	if frames[0].Pix[len(frames[0].Pix)/2] != 0 {
+		t.Errorf("initial frame is not blank")
+	}
+	var lit bool
+	for _, x := range frames[1].Pix {
+		if x != 0 && x != 0xff {
+			lit = true
+		}
+	}
+	if !lit {
+		t.Errorf("cpus not drawn")
+	}
+}
+
+// rectRenderer records the bounds of the images cores are rendered in.
+type rectRenderer struct {
+	rects []image.Rectangle
+}
+
+func (r *rectRenderer) RenderCPU(img draw.Image, cpu CPU) {
+	r.rects = append(r.rects, img.Bounds())
+}
+
+func TestApp_Draw(t *testing.T) {
+	for i, test := range []struct {
+		n      int
+		widths []int
+	}{
+		{0, nil},
+		{1, []int{10}},
+		{3, []int{4, 3, 3}},
+		{4, []int{3, 3, 2, 2}},
+		{12, []int{1, 1, 1, 1, 1, 1, 1, 1, 1, 1}},
+	} {
+		var cpus []CPU
+		for j := 0; j < test.n; j++ {
+			cpus = append(cpus, fracCPU{fmt.Sprint("cpu", j), 0.5})
+		}
+		r := &rectRenderer{}
+		app := NewApp()
+		app.Renderer = r
+		img := image.NewRGBA(image.Rect(5, 0, 15, 8))
+		app.Draw(img, cpus)
+		if len(r.rects) != len(test.widths) {
+			t.Errorf("test %d: %d cores drawn (expected %d)", i, len(r.rects), len(test.widths))
+			continue
+		}
+		x := img.Bounds().Min.X
+		for j, rect := range r.rects {
+			if rect.Min.X != x || rect.Dx() != test.widths[j] || rect.Dy() != img.Bounds().Dy() {
+				t.Errorf("test %d: core %d: %v", i, j, rect)
+			}
+			x = rect.Max.X
+		}
+	}
+}
+
+func TestPalettes(t *testing.T) {
+	for i, test := range []struct {
+		palette string
+		c       color.RGBA
+	}{
+		{"default", color.RGBA{R: 0xff, A: 0xff}},
+		{"cb", color.RGBA{R: 0xe6, G: 0x9f, A: 0xff}},
+	} {
+		img := image.NewRGBA(image.Rect(0, 0, 10, 20))
+		NewBarRenderer(palettes[test.palette]).RenderCPU(img, fracCPU{"cpu0", 1})
+		if c := img.RGBAAt(5, 10); c != test.c {
+			t.Errorf("test %d: %v (expected %v)", i, c, test.c)
+		}
+	}
+}
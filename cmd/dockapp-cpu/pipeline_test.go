@@ -0,0 +1,126 @@
+package main
+
+import (
+	"math"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// waitGoroutines waits for the number of running goroutines to fall to n,
+// failing the test if it does not do so promptly.
+func waitGoroutines(t *testing.T, n int) {
+	timeout := time.After(time.Second)
+	for runtime.NumGoroutine() > n {
+		select {
+		case <-timeout:
+			t.Fatalf("%d goroutines running (expected %d)", runtime.NumGoroutine(), n)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func testTimes(idle int64) []*Time {
+	return []*Time{
+		{name: "cpu", InMode: []int64{10, 0, 10, idle}},
+		{name: "cpu0", InMode: []int64{10, 0, 10, idle}},
+	}
+}
+
+func TestPipeline_close(t *testing.T) {
+	for i, ignore := range [][]string{nil, {"cpu"}} {
+		n := runtime.NumGoroutine()
+		times := make(chan []*Time)
+		cpus := FilterCPU(TimeToCPU(Delta(times)), ignore)
+		times <- testTimes(10)
+		times <- testTimes(30)
+		select {
+		case <-cpus:
+		case <-time.After(time.Second):
+			t.Fatalf("test %d: no cpus", i)
+		}
+		close(times)
+		for range cpus {
+		}
+		waitGoroutines(t, n)
+	}
+}
+
+func TestDelta_close(t *testing.T) {
+	n := runtime.NumGoroutine()
+	times := make(chan []*Time)
+	d := Delta(times)
+	close(times)
+	if _, ok := <-d; ok {
+		t.Errorf("delta received after close")
+	}
+	waitGoroutines(t, n)
+}
+
+func TestPoller_Stop(t *testing.T) {
+	n := runtime.NumGoroutine()
+	p, err := Poll(time.Millisecond)
+	if err != nil {
+		t.Skip(err)
+	}
+	<-p.C
+	p.Stop()
+	for range p.C {
+	}
+	waitGoroutines(t, n)
+}
+
+func TestWindow(t *testing.T) {
+	// delta returns a delta for the named core with the given time spent
+	// busy and idle.
+	delta := func(name string, busy, idle int64) *Time {
+		return &Time{name: name, InMode: []int64{busy, 0, 0, idle}}
+	}
+	type frac struct {
+		name string
+		util float64
+	}
+
+	n := runtime.NumGoroutine()
+	deltas := make(chan []*Time)
+	w := Window(deltas, 3)
+	for i, test := range []struct {
+		deltas []*Time
+		util   []frac
+	}{
+		{[]*Time{delta("cpu0", 10, 0)}, []frac{{"cpu0", 1}}},
+		{[]*Time{delta("cpu0", 0, 10), delta("cpu1", 5, 5)}, []frac{{"cpu0", 0.5}, {"cpu1", 0.5}}},
+		{[]*Time{delta("cpu0", 0, 10), delta("cpu1", 10, 0)}, []frac{{"cpu0", 1.0 / 3}, {"cpu1", 0.75}}},
+		{[]*Time{delta("cpu0", 0, 10)}, []frac{{"cpu0", 0}}},
+		{[]*Time{delta("cpu1", 0, 10), delta("cpu0", 10, 0)}, []frac{{"cpu1", 0.5}, {"cpu0", 1.0 / 3}}},
+	} {
+		deltas <- test.deltas
+		var sum []*Time
+		select {
+		case sum = <-w:
+		case <-time.After(time.Second):
+			t.Fatalf("test %d: no window received", i)
+		}
+		if len(sum) != len(test.util) {
+			t.Errorf("test %d: %d cores (expected %d)", i, len(sum), len(test.util))
+			continue
+		}
+		for j, f := range test.util {
+			if sum[j].Name() != f.name {
+				t.Errorf("test %d: core %d: %q (expected %q)", i, j, sum[j].Name(), f.name)
+			}
+			if util := sum[j].FracUtil(); math.Abs(util-f.util) > 1e-9 {
+				t.Errorf("test %d: %s: utilization %v (expected %v)", i, f.name, util, f.util)
+			}
+		}
+	}
+	close(deltas)
+	if _, ok := <-w; ok {
+		t.Errorf("window received after close")
+	}
+	waitGoroutines(t, n)
+
+	if c := make(chan []*Time); Window(c, 1) != (<-chan []*Time)(c) {
+		t.Errorf("window of one poll is not c")
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestReadTime(t *testing.T) {
+	for i, test := range []struct {
+		stat  string
+		times []*Time
+		err   bool
+	}{
+		{"", nil, false},
+		{
+			"cpu  10 0 20 300 4 0 1 0 0 0\ncpu0 5 0 10 150 2 0 1 0 0 0\ncpu1 5 0 10 150 2 0 0 0 0 0\nintr 1 2 3\nctxt 100\n",
+			[]*Time{
+				{name: "cpu", Aggregate: true, InMode: []int64{10, 0, 20, 300, 4, 0, 1, 0, 0, 0}},
+				{name: "cpu0", InMode: []int64{5, 0, 10, 150, 2, 0, 1, 0, 0, 0}},
+				{name: "cpu1", InMode: []int64{5, 0, 10, 150, 2, 0, 0, 0, 0, 0}},
+			},
+			false,
+		},
+		{"cpu0\t1  2 3 4\n", []*Time{{name: "cpu0", InMode: []int64{1, 2, 3, 4}}}, false},
+		{"cpufreq 1 2\ncpu2 1 2 3 4", []*Time{{name: "cpu2", InMode: []int64{1, 2, 3, 4}}}, false},
+		{"cpu0 1 x 3 4\n", nil, true},
+		{"cpu0 1 -2 3 4\n", nil, true},
+		{"cpu0 1 99999999999999999999 3 4\n", nil, true},
+	} {
+		times, err := readTime(strings.NewReader(test.stat))
+		if (err != nil) != test.err {
+			t.Errorf("test %d: err %v (expected error %v)", i, err, test.err)
+			continue
+		}
+		if !reflect.DeepEqual(times, test.times) {
+			t.Errorf("test %d: %v (expected %v)", i, times, test.times)
+		}
+	}
+}
+
+func TestReadTime_aggregate(t *testing.T) {
+	stat, err := ioutil.ReadFile("testdata/stat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	times, err := readTime(bytes.NewReader(stat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(times) < 2 {
+		t.Fatalf("%d cpus read", len(times))
+	}
+	for i, tm := range times {
+		aggregate := tm.Name() == "cpu"
+		if tm.Aggregate != aggregate {
+			t.Errorf("cpu %d: %s: aggregate %v (expected %v)", i, tm.Name(), tm.Aggregate, aggregate)
+		}
+	}
+	if !times[0].Aggregate {
+		t.Errorf("first line is not the aggregate")
+	}
+}
+
+// BenchmarkReadTime measures parsing of a /proc/stat captured from a 64 core
+// machine.  Parsing fields in place rather than with strings.Fields and
+// strconv.ParseInt reduced the cost of each poll.
+//
+//	before	111276 ns/op	43162 B/op	527 allocs/op
+//	after	 35098 ns/op	14912 B/op	202 allocs/op
+func BenchmarkReadTime(b *testing.B) {
+	stat, err := ioutil.ReadFile("testdata/stat")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := readTime(bytes.NewReader(stat))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkReadTimeInto measures parsing into a buffer recycled from a
+// previous poll, as a Poller does.
+//
+//	readTime	39179 ns/op	14968 B/op	205 allocs/op
+//	readTimeInto	24001 ns/op	 4144 B/op	  2 allocs/op
+func BenchmarkReadTimeInto(b *testing.B) {
+	stat, err := ioutil.ReadFile("testdata/stat")
+	if err != nil {
+		b.Fatal(err)
+	}
+	buf, err := readTime(bytes.NewReader(stat))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf, err = readTimeInto(bytes.NewReader(stat), buf)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestReadTimeInto_allocs(t *testing.T) {
+	stat, err := ioutil.ReadFile("testdata/stat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := readTime(bytes.NewReader(stat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := append([]*Time(nil), buf...)
+	for i, tm := range expect {
+		expect[i] = &Time{name: tm.name, Aggregate: tm.Aggregate, InMode: append([]int64(nil), tm.InMode...)}
+	}
+	r := bytes.NewReader(stat)
+	allocs := testing.AllocsPerRun(10, func() {
+		r.Reset(stat)
+		buf, err = readTimeInto(r, buf)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the scanner's buffer is allocated.
+	if allocs > 2 {
+		t.Errorf("%v allocations reading into a warm buffer", allocs)
+	}
+	if !reflect.DeepEqual(buf, expect) {
+		t.Errorf("times read into a reused buffer differ")
+	}
+}
+
+// TestDelta_recycle sends Delta slices read into recycled buffers and checks
+// that every delta is correct, so that no buffer is reused while in use.  It
+// is most useful when run with the race detector.
+func TestDelta_recycle(t *testing.T) {
+	const n = 100
+	// each mode changes by a different function of i so that any delta
+	// computed from mismatched or overwritten polls is detected.
+	stat := func(i int64) string {
+		modes := strconv.FormatInt(i, 10) + " 0 " + strconv.FormatInt(i*i, 10) + " " + strconv.FormatInt(i*i*i, 10)
+		return "cpu  " + modes + "\ncpu0 " + modes + "\n"
+	}
+	times := make(chan []*Time, 1)
+	d := Delta(times)
+	go func() {
+		defer close(times)
+		for i := 0; i < n; i++ {
+			tm, err := readTimeInto(strings.NewReader(stat(int64(i))), getTimes())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			times <- tm
+		}
+	}()
+	var deltas int
+	for delta := range d {
+		for _, tm := range delta {
+			// deltas may be skipped by a slow receiver so the poll is
+			// identified by its delta.
+			i := (tm.InMode[2] + 1) / 2
+			if tm.InMode[0] != 1 || tm.InMode[3] != i*i*i-(i-1)*(i-1)*(i-1) {
+				t.Fatalf("delta %d: %v", deltas, tm.InMode)
+			}
+		}
+		deltas++
+		// retain the delta and check it is not modified by later polls.
+		if deltas == 1 {
+			defer func(tm *Time, expect []int64) {
+				if !reflect.DeepEqual(tm.InMode, expect) {
+					t.Errorf("retained delta modified: %v (expected %v)", tm.InMode, expect)
+				}
+			}(delta[0], append([]int64(nil), delta[0].InMode...))
+		}
+	}
+	if deltas == 0 {
+		t.Errorf("no deltas")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/bmatsuo/dockapp-go/imageutil"
+	"github.com/bmatsuo/dockapp-go/render"
+)
+
+// ModeCPU is a CPU that measures the fraction of time spent in each of its
+// modes, like a Time.
+type ModeCPU interface {
+	CPU
+	FracIn(mode int) float64
+}
+
+// StackedRenderer is a Renderer implementation that stacks the time a core
+// spends in user, system and iowait modes from the bottom of an image, so that
+// a machine bound by I/O is easily distinguished from one bound by cpu.  The
+// segments are scaled so that together they fill the utilized fraction of the
+// image.  Cores which are not a ModeCPU are drawn entirely in User.
+type StackedRenderer struct {
+	User   color.Color // user and nice modes
+	System color.Color // system, irq and softirq modes
+	IOWait color.Color
+}
+
+// RenderCPU implements the Renderer interface.
+func (s *StackedRenderer) RenderCPU(img draw.Image, cpu CPU) {
+	util := clampFrac(cpu.FracUtil())
+	segments := []float64{1, 0, 0}
+	if mcpu, ok := cpu.(ModeCPU); ok {
+		segments = []float64{
+			mcpu.FracIn(ModeUser) + mcpu.FracIn(ModeNice),
+			mcpu.FracIn(ModeSystem) + mcpu.FracIn(ModeIRQ) + mcpu.FracIn(ModeSoftIRQ),
+			mcpu.FracIn(ModeIOWait),
+		}
+	}
+	var sum float64
+	for _, f := range segments {
+		sum += f
+	}
+	if !(sum > 0) {
+		return
+	}
+
+	rect := img.Bounds()
+	colors := []color.Color{s.User, s.System, s.IOWait}
+	var cum float64
+	bottom := rect.Max.Y
+	for i, f := range segments {
+		cum += f / sum * util
+		top := rect.Max.Y - int(cum*float64(rect.Dy())+0.5)
+		seg := image.Rect(rect.Min.X, top, rect.Max.X, bottom)
+		if !seg.Empty() {
+			sub := imageutil.SubImage(img, seg)
+			draw.Draw(sub, sub.Bounds(), image.NewUniform(colors[i]), image.ZP, draw.Over)
+		}
+		bottom = top
+	}
+}
+
+// DefaultStackedRenderer colors user time green, system time red and iowait
+// blue.
+var DefaultStackedRenderer Renderer = &StackedRenderer{
+	User:   color.RGBA{G: 0xff, A: 0xff},
+	System: color.RGBA{R: 0xff, A: 0xff},
+	IOWait: color.RGBA{R: 0x40, G: 0x80, B: 0xff, A: 0xff},
+}
+
+// NewStackedBarRenderer returns a Renderer that draws a bordered bar filled by
+// stacked, which is expected to fill only the utilized fraction of the bar
+// itself, like a StackedRenderer.
+func NewStackedBarRenderer(stacked Renderer) Renderer {
+	return &SourceRenderer{&render.Background{
+		Color: color.White,
+		Renderer: &render.Border{
+			Size:     1,
+			Color:    color.Black,
+			Renderer: cpuSourceRenderer{stacked},
+		},
+	}}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/bmatsuo/dockapp-go/imageutil"
+)
+
+func TestTime_FracIn(t *testing.T) {
+	tm := &Time{name: "cpu0", InMode: []int64{4, 0, 2, 10, 4}}
+	for i, test := range []struct {
+		mode int
+		frac float64
+	}{
+		{ModeUser, 0.2},
+		{ModeNice, 0},
+		{ModeSystem, 0.1},
+		{ModeIdle, 0.5},
+		{ModeIOWait, 0.2},
+		{ModeSteal, 0},
+		{-1, 0},
+	} {
+		if f := tm.FracIn(test.mode); math.Abs(f-test.frac) > 1e-9 {
+			t.Errorf("test %d: %v (expected %v)", i, f, test.frac)
+		}
+	}
+}
+
+func TestStackedRenderer(t *testing.T) {
+	user := color.RGBA{G: 0xff, A: 0xff}
+	system := color.RGBA{R: 0xff, A: 0xff}
+	iowait := color.RGBA{B: 0xff, A: 0xff}
+	r := &StackedRenderer{User: user, System: system, IOWait: iowait}
+	for i, test := range []struct {
+		cpu    CPU
+		colors []color.RGBA // from the top of the image down
+	}{
+		{
+			// idle 50%, and user, system, and iowait in the ratio 2:1:2
+			&Time{InMode: []int64{3, 1, 1, 10, 4, 1}},
+			[]color.RGBA{{}, {}, {}, {}, {}, iowait, iowait, system, user, user},
+		},
+		{
+			// steal time is utilization shared among the segments.
+			&Time{InMode: []int64{2, 0, 0, 5, 0, 0, 0, 3}},
+			[]color.RGBA{{}, {}, {}, {}, {}, user, user, user, user, user},
+		},
+		{
+			&Time{InMode: []int64{0, 0, 0, 10}},
+			[]color.RGBA{{}, {}, {}, {}, {}, {}, {}, {}, {}, {}},
+		},
+		{
+			fracCPU{"cpu0", 0.3},
+			[]color.RGBA{{}, {}, {}, {}, {}, {}, {}, user, user, user},
+		},
+	} {
+		img := image.NewRGBA(image.Rect(0, 0, 20, 20))
+		// draw within a clipped region to check that drawing is clipped.
+		r.RenderCPU(imageutil.SubImage(img, image.Rect(5, 10, 7, 20)), test.cpu)
+		for j, c := range test.colors {
+			if got := img.RGBAAt(5, 10+j); got != c {
+				t.Errorf("test %d: y=%d: %v (expected %v)", i, 10+j, got, c)
+			}
+		}
+		if got := img.RGBAAt(7, 19); got != (color.RGBA{}) {
+			t.Errorf("test %d: drawn outside clipped region: %v", i, got)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"io"
+	"log"
+
+	"github.com/bmatsuo/dockapp-go/render"
+)
+
+// termBlocks are the characters used to draw utilization in a terminal, from
+// idle to saturated.
+var termBlocks = []rune(" ▁▂▃▄▅▆▇█")
+
+// ANSI control sequences used by TermRenderer.
+const (
+	termClearLine = "\r\x1b[K"
+	termReset     = "\x1b[0m"
+)
+
+// TermRenderer draws cpu utilization in a terminal as a row of block
+// characters, one for each core, colored by a gradient using the terminal's
+// 256 color palette.  Each row replaces the previous one in place.
+type TermRenderer struct {
+	W        io.Writer
+	Gradient *render.Gradient
+	buf      bytes.Buffer
+}
+
+// NewTermRenderer returns a TermRenderer that writes to w and colors cores
+// using grad.
+func NewTermRenderer(w io.Writer, grad *render.Gradient) *TermRenderer {
+	return &TermRenderer{W: w, Gradient: grad}
+}
+
+// Render writes a row for cpus to r.W, replacing the row previously written.
+func (r *TermRenderer) Render(cpus []CPU) error {
+	r.buf.Reset()
+	r.buf.WriteString(termClearLine)
+	for _, cpu := range cpus {
+		f := clampFrac(cpu.FracUtil())
+		fmt.Fprintf(&r.buf, "\x1b[38;5;%dm", ansi256(r.Gradient.Color(f)))
+		r.buf.WriteRune(termBlocks[int(f*float64(len(termBlocks)-1)+0.5)])
+	}
+	r.buf.WriteString(termReset)
+	_, err := r.W.Write(r.buf.Bytes())
+	return err
+}
+
+// End moves the cursor past the last row written, leaving it visible.
+func (r *TermRenderer) End() error {
+	_, err := io.WriteString(r.W, "\n")
+	return err
+}
+
+// clampFrac restricts f to the range [0, 1].  Utilization is NaN when a core
+// has not accumulated any time, which is treated as idle.
+func clampFrac(f float64) float64 {
+	if !(f > 0) {
+		return 0
+	}
+	if f > 1 {
+		return 1
+	}
+	return f
+}
+
+// ansi256 returns the index of the color nearest to c in the 6x6x6 color cube
+// of the 256 color ANSI palette.
+func ansi256(c color.Color) int {
+	r, g, b, _ := color.NRGBAModel.Convert(c).RGBA()
+	return 16 + 36*cubeIndex(r>>8) + 6*cubeIndex(g>>8) + cubeIndex(b>>8)
+}
+
+// cubeIndex returns the nearest level of the ANSI color cube, whose levels
+// are 0, 95, 135, 175, 215, and 255, to the 8-bit color component v.
+func cubeIndex(v uint32) int {
+	if v < 48 {
+		return 0
+	}
+	if v < 115 {
+		return 1
+	}
+	return int((v - 35) / 40)
+}
+
+// RunTerm is the main loop for the application when drawing to a terminal.
+func RunTerm(r *TermRenderer, app *App, delta <-chan []CPU) {
+	defer close(app.done)
+	defer r.End()
+	for cpus := range delta {
+		err := r.Render(cpus)
+		if err != nil {
+			log.Printf("terminal: %v", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/bmatsuo/dockapp-go/render"
+)
+
+func TestTermRenderer(t *testing.T) {
+	grad := &render.Gradient{
+		C1: color.RGBA{G: 0xff, A: 0xff},
+		C2: color.RGBA{R: 0xff, A: 0xff},
+	}
+	var buf bytes.Buffer
+	r := NewTermRenderer(&buf, grad)
+	for i, test := range []struct {
+		cpus []CPU
+		s    string
+	}{
+		{nil, "\r\x1b[K\x1b[0m"},
+		{[]CPU{fracCPU{"cpu0", 0}}, "\r\x1b[K\x1b[38;5;46m \x1b[0m"},
+		{[]CPU{fracCPU{"cpu0", 1}, fracCPU{"cpu1", 0.5}}, "\r\x1b[K\x1b[38;5;196m█\x1b[38;5;100m▄\x1b[0m"},
+		{[]CPU{fracCPU{"cpu0", math.NaN()}, fracCPU{"cpu1", 1.5}}, "\r\x1b[K\x1b[38;5;46m \x1b[38;5;196m█\x1b[0m"},
+	} {
+		buf.Reset()
+		err := r.Render(test.cpus)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		if buf.String() != test.s {
+			t.Errorf("test %d: %q (expected %q)", i, buf.String(), test.s)
+		}
+	}
+}
+
+func TestAnsi256(t *testing.T) {
+	for i, test := range []struct {
+		c color.Color
+		n int
+	}{
+		{color.Black, 16},
+		{color.White, 231},
+		{color.RGBA{R: 0xff, A: 0xff}, 196},
+		{color.RGBA{R: 95, G: 135, B: 175, A: 0xff}, 16 + 36 + 12 + 3},
+		{color.RGBA{R: 47, G: 48, B: 114, A: 0xff}, 16 + 6 + 1},
+	} {
+		n := ansi256(test.c)
+		if n != test.n {
+			t.Errorf("test %d: %d (expected %d)", i, n, test.n)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+/*
+Command dockapp-mem is a simple memory utilization indicator dockapp for
+Openbox.  Memory statistics from /proc/meminfo are displayed as two bars, the
+fraction of memory that is not available and the fraction of swap in use.
+
+Examples
+
+A minimal window with custom geometry:
+
+	dockapp-mem -window.geometry=20x20
+
+The swap bar is hidden on machines without swap, or when it is not wanted.
+
+	dockapp-mem -swap=false
+
+Polling stops while the window is unmapped or fully covered by other windows.
+Disable this to keep polling while hidden.
+
+	dockapp-mem -pause.hidden=false
+
+Help
+
+For command usage and other help run dockapp-mem with the -h flag.
+*/
+package main
+
+import (
+	"flag"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/BurntSushi/xgbutil"
+	"github.com/bmatsuo/dockapp-go/dockapp"
+	"github.com/bmatsuo/dockapp-go/geometry"
+	"github.com/bmatsuo/dockapp-go/imageutil"
+	"github.com/bmatsuo/dockapp-go/render"
+)
+
+func main() {
+	window := geometry.Flag("window.geometry", image.Rect(0, 0, 20, 20), "window geometry in pixels")
+	swap := flag.Bool("swap", true, "draw a bar for swap usage next to the memory bar")
+	interval := flag.Duration("interval", time.Second, "time between polls of /proc/meminfo")
+	pauseHidden := flag.Bool("pause.hidden", true, "stop polling while the window is unmapped or fully obscured")
+	retries := flag.Int("x.retries", 5, "number of times to reconnect to the x server when the window cannot be drawn")
+	flag.Parse()
+
+	if *interval <= 0 {
+		log.Fatalf("interval: %v is not positive", *interval)
+	}
+	_, err := ReadMemInfo()
+	if err != nil {
+		log.Fatal(err)
+	}
+	poll := Poll(*interval, ReadMemInfo)
+
+	app := NewApp()
+	app.Swap = *swap
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+
+	// Connect to the x server and create a dockapp window for the process.
+	X, err := xgbutil.NewConn()
+	if err != nil {
+		log.Fatal(err)
+	}
+	dock, err := dockapp.New(X, *window)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer dock.Destroy()
+	defer dock.Quit()
+	// map the window and start the main event loop
+	go dock.Main()
+
+	if *pauseHidden {
+		go dockapp.PauseHidden(dock.Visibility(), poll)
+	}
+
+	// begin the main draw loop.  the window is recreated on a new
+	// connection if the x server cannot draw it.
+	go RunApp(dockapp.NewWatchdog(dock, *retries, time.Second), app, poll.C)
+
+	var timeout <-chan time.Time
+	for {
+		select {
+		case s := <-sig:
+			signal.Stop(sig)
+
+			log.Printf("signal received: %s", s)
+
+			poll.Stop()
+			timeout = time.After(time.Second)
+		case <-timeout:
+			panic("timeout")
+		case <-app.Done():
+			return
+		}
+	}
+}
+
+// RunApp is the main loop for the application.
+func RunApp(surface dockapp.Surface, app *App, meminfo <-chan MemInfo) {
+	defer close(app.done)
+
+	app.Draw(surface.Canvas(), MemInfo{})
+	err := surface.FlushImage()
+	if err != nil {
+		log.Printf("flush: %v", err)
+		return
+	}
+
+	for m := range meminfo {
+		app.Draw(surface.Canvas(), m)
+		err := surface.FlushImage()
+		if err != nil {
+			log.Printf("flush: %v", err)
+			return
+		}
+	}
+}
+
+// App graphically renders memory utilization.  If Swap is true a bar for swap
+// is drawn to the right of the bar for memory.
+type App struct {
+	done       chan struct{}
+	Background image.Image
+	Renderer   render.Renderer
+	Swap       bool
+}
+
+// NewApp returns a newly created App.
+func NewApp() *App {
+	app := &App{
+		done: make(chan struct{}),
+	}
+	return app
+}
+
+// Done returns a channel than is closed when the app has shut down.
+func (app *App) Done() <-chan struct{} {
+	return app.done
+}
+
+// Draw renders m on img.  The bars divide the width of img as evenly as
+// possible.
+func (app *App) Draw(img draw.Image, m MemInfo) {
+	rect := img.Bounds()
+	bg := app.Background
+	if bg == nil {
+		bg = image.Black
+	}
+	draw.Draw(img, rect, bg, bg.Bounds().Min, draw.Over)
+
+	r := app.Renderer
+	if r == nil {
+		r = DefaultRenderer
+	}
+	srcs := []render.Source{render.Fraction{F: m.MemUsed(), Text: "mem"}}
+	if app.Swap {
+		srcs = append(srcs, render.Fraction{F: m.SwapUsed(), Text: "swap"})
+	}
+	for i, irect := range geometry.Split(rect, len(srcs)) {
+		if irect.Empty() {
+			continue
+		}
+		r.Render(imageutil.SubImage(img, irect), srcs[i])
+	}
+}
+
+// DefaultRenderer is the Renderer used to draw bars when App.Renderer is nil.
+// Bars are colored from green to red like those of dockapp-cpu.
+var DefaultRenderer = render.NewBar(&render.Gradient{
+	C1: color.RGBA{G: 0xff, A: 0xff},
+	C2: color.RGBA{R: 0xff, A: 0xff},
+})
+
+// Poller periodically measures memory utilization.
+type Poller struct {
+	C      chan MemInfo
+	dur    time.Duration
+	read   func() (MemInfo, error)
+	stop   chan struct{}
+	mut    sync.Mutex
+	paused bool
+}
+
+// Poll returns a new Poller that sends the result of read over its channel
+// every dur.  Errors reading are logged.  The channel is closed when Stop is
+// called.
+func Poll(dur time.Duration, read func() (MemInfo, error)) *Poller {
+	p := &Poller{
+		C:    make(chan MemInfo, 1),
+		dur:  dur,
+		read: read,
+		stop: make(chan struct{}),
+	}
+	go p.loop()
+	return p
+}
+
+// Stop stops polling for memory utilization.
+func (p *Poller) Stop() {
+	close(p.stop)
+}
+
+// Pause causes p to skip polling until Resume is called.
+func (p *Poller) Pause() {
+	p.mut.Lock()
+	p.paused = true
+	p.mut.Unlock()
+}
+
+// Resume resumes polling after a call to Pause.
+func (p *Poller) Resume() {
+	p.mut.Lock()
+	p.paused = false
+	p.mut.Unlock()
+}
+
+func (p *Poller) isPaused() bool {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	return p.paused
+}
+
+func (p *Poller) loop() {
+	defer close(p.C)
+	tick := time.NewTicker(p.dur)
+	defer tick.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-tick.C:
+		}
+		if p.isPaused() {
+			continue
+		}
+		m, err := p.read()
+		if err != nil {
+			log.Printf("meminfo: %v", err)
+			continue
+		}
+		// a slow receiver only sees the latest measurement.
+		select {
+		case <-p.C:
+		default:
+		}
+		p.C <- m
+	}
+}
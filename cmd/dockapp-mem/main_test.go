@@ -0,0 +1,90 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+	"time"
+
+	"github.com/bmatsuo/dockapp-go/dockapp/dockapptest"
+)
+
+// filledHeight returns the number of green pixels in column x of img.
+func filledHeight(img *image.RGBA, x int) int {
+	n := 0
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		c := img.RGBAAt(x, y)
+		if c.G > 0 && c.B == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func TestApp_Draw(t *testing.T) {
+	m := MemInfo{MemTotal: 4, MemAvailable: 2, SwapTotal: 4, SwapFree: 4}
+	for i, test := range []struct {
+		swap   bool
+		filled []int // filled pixels at x = 5 and x = 15
+	}{
+		{true, []int{9, 0}},
+		{false, []int{9, 9}},
+	} {
+		app := NewApp()
+		app.Swap = test.swap
+		img := image.NewRGBA(image.Rect(0, 0, 20, 20))
+		app.Draw(img, m)
+		for j, x := range []int{5, 15} {
+			if n := filledHeight(img, x); n != test.filled[j] {
+				t.Errorf("test %d: %d pixels filled at x=%d (expected %d)", i, n, x, test.filled[j])
+			}
+		}
+		if !test.swap {
+			continue
+		}
+		// the border separating the bars.
+		if c := img.RGBAAt(10, 5); c != (color.RGBA{A: 0xff}) {
+			t.Errorf("test %d: border %v", i, c)
+		}
+	}
+}
+
+func TestRunApp(t *testing.T) {
+	surface := dockapptest.NewMemSurface(image.Rect(0, 0, 20, 20))
+	app := NewApp()
+	c := make(chan MemInfo, 1)
+	go RunApp(surface, app, c)
+	c <- MemInfo{MemTotal: 4, MemAvailable: 2}
+	close(c)
+	select {
+	case <-app.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("app did not finish")
+	}
+	frames := surface.Frames()
+	if len(frames) != 2 {
+		t.Fatalf("%d frames flushed (expected 2)", len(frames))
+	}
+	if n := filledHeight(frames[0], 10); n != 0 {
+		t.Errorf("%d pixels filled initially (expected 0)", n)
+	}
+	if n := filledHeight(frames[1], 10); n != 9 {
+		t.Errorf("%d pixels filled (expected 9)", n)
+	}
+}
+
+func TestPoller(t *testing.T) {
+	n := 0
+	p := Poll(time.Millisecond, func() (MemInfo, error) {
+		n++
+		return MemInfo{MemTotal: uint64(n)}, nil
+	})
+	m1 := <-p.C
+	m2 := <-p.C
+	if m2.MemTotal <= m1.MemTotal {
+		t.Errorf("%d not polled after %d", m2.MemTotal, m1.MemTotal)
+	}
+	p.Stop()
+	for range p.C {
+	}
+}
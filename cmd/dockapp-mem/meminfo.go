@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// MemInfo is a measurement of memory and swap usage from /proc/meminfo.  Sizes
+// are in kB.
+type MemInfo struct {
+	MemTotal     uint64
+	MemAvailable uint64
+	SwapTotal    uint64
+	SwapFree     uint64
+}
+
+// MemUsed returns the fraction of memory that is not available.
+func (m MemInfo) MemUsed() float64 {
+	return usedFraction(m.MemTotal, m.MemAvailable)
+}
+
+// SwapUsed returns the fraction of swap in use.  SwapUsed returns zero when
+// there is no swap.
+func (m MemInfo) SwapUsed() float64 {
+	return usedFraction(m.SwapTotal, m.SwapFree)
+}
+
+func usedFraction(total, free uint64) float64 {
+	if total == 0 || free >= total {
+		return 0
+	}
+	return float64(total-free) / float64(total)
+}
+
+// ReadMemInfo reads /proc/meminfo.
+func ReadMemInfo() (MemInfo, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return MemInfo{}, err
+	}
+	defer f.Close()
+	return readMemInfo(f)
+}
+
+// readMemInfo parses the contents of /proc/meminfo.  MemTotal and MemAvailable
+// are required.  Swap fields are zero when they are missing.
+func readMemInfo(r io.Reader) (MemInfo, error) {
+	var m MemInfo
+	fields := map[string]*uint64{
+		"MemTotal":     &m.MemTotal,
+		"MemAvailable": &m.MemAvailable,
+		"SwapTotal":    &m.SwapTotal,
+		"SwapFree":     &m.SwapFree,
+	}
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		ptr, ok := fields[kv[0]]
+		if !ok {
+			continue
+		}
+		value := strings.TrimSuffix(strings.TrimSpace(kv[1]), " kB")
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return MemInfo{}, fmt.Errorf("meminfo: %s: %v", kv[0], err)
+		}
+		*ptr = n
+		seen[kv[0]] = true
+	}
+	if scanner.Err() != nil {
+		return MemInfo{}, scanner.Err()
+	}
+	for _, name := range []string{"MemTotal", "MemAvailable"} {
+		if !seen[name] {
+			return MemInfo{}, fmt.Errorf("meminfo: missing %s", name)
+		}
+	}
+	return m, nil
+}
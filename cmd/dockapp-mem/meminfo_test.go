@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReadMemInfo(t *testing.T) {
+	f, err := os.Open("testdata/meminfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	m, err := readMemInfo(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := MemInfo{
+		MemTotal:     16318148,
+		MemAvailable: 8159074,
+		SwapTotal:    2097148,
+		SwapFree:     1572861,
+	}
+	if m != expect {
+		t.Errorf("%+v (expected %+v)", m, expect)
+	}
+	if m.MemUsed() != 0.5 {
+		t.Errorf("memory used %v", m.MemUsed())
+	}
+	if m.SwapUsed() != 0.25 {
+		t.Errorf("swap used %v", m.SwapUsed())
+	}
+}
+
+func TestReadMemInfo_partial(t *testing.T) {
+	for i, test := range []struct {
+		meminfo string
+		m       MemInfo
+		err     bool
+	}{
+		{"MemTotal: 100 kB\nMemAvailable: 25 kB\n", MemInfo{MemTotal: 100, MemAvailable: 25}, false},
+		{"MemTotal: 100 kB\nMemAvailable: 25 kB\nSwapTotal: 0 kB\nSwapFree: 0 kB\n", MemInfo{MemTotal: 100, MemAvailable: 25}, false},
+		{"MemTotal: 100 kB\nMemFree: 25 kB\n", MemInfo{}, true},
+		{"MemTotal: 100 kB\nMemAvailable: lots\n", MemInfo{}, true},
+		{"", MemInfo{}, true},
+	} {
+		m, err := readMemInfo(strings.NewReader(test.meminfo))
+		if (err != nil) != test.err {
+			t.Errorf("test %d: err %v (expected error %v)", i, err, test.err)
+			continue
+		}
+		if m != test.m {
+			t.Errorf("test %d: %+v (expected %+v)", i, m, test.m)
+		}
+	}
+}
+
+func TestMemInfo_used(t *testing.T) {
+	for i, test := range []struct {
+		m    MemInfo
+		mem  float64
+		swap float64
+	}{
+		{MemInfo{}, 0, 0},
+		{MemInfo{MemTotal: 4, MemAvailable: 1, SwapTotal: 4, SwapFree: 4}, 0.75, 0},
+		{MemInfo{MemTotal: 4, MemAvailable: 5, SwapTotal: 4, SwapFree: 0}, 0, 1},
+	} {
+		if f := test.m.MemUsed(); f != test.mem {
+			t.Errorf("test %d: memory %v (expected %v)", i, f, test.mem)
+		}
+		if f := test.m.SwapUsed(); f != test.swap {
+			t.Errorf("test %d: swap %v (expected %v)", i, f, test.swap)
+		}
+	}
+}
@@ -5,52 +5,312 @@ import (
 	"image"
 	"image/draw"
 	"log"
+	"sync"
 
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
 	"github.com/BurntSushi/xgbutil"
 	"github.com/BurntSushi/xgbutil/icccm"
-	"github.com/BurntSushi/xgbutil/xevent"
 	"github.com/BurntSushi/xgbutil/xgraphics"
 	"github.com/BurntSushi/xgbutil/xwindow"
+	"github.com/bmatsuo/dockapp-go/imageutil"
 )
 
+// Surface is an image displayed by a dockapp.  Changes drawn to the Canvas are
+// not displayed until FlushImage is called.  DockApp implements Surface, and
+// package dockapptest provides an implementation for testing draw loops
+// without an x server.
+type Surface interface {
+	Canvas() draw.Image
+	FlushImage() error
+	Bounds() image.Rectangle
+}
+
 // DockApp holds references to an xwindow.Window and ximage.Image for the
 // process and executes the x11 main event loop.
 type DockApp struct {
+	mut  sync.Mutex
+	rect image.Rectangle
+	quit bool
+
 	x   *xgbutil.XUtil
 	img *xgraphics.Image
 	win *xwindow.Window
+
+	// argb windows have a 32-bit visual and their own colormap and graphics
+	// context matching the depth of the window.
+	argb bool
+	cmap xproto.Colormap
+	gc   xproto.Gcontext
+
+	visc  chan bool
+	input inputHandlers
+
+	// testConn replaces the x connection used by Main in tests.
+	testConn conn
+
+	// replaced is signaled when the connection is replaced or Quit is called.
+	replaced chan struct{}
+}
+
+// conn is the connection to the x server as used by Main.
+type conn interface {
+	// Map maps the dockapp window to the display.
+	Map()
+	// WaitForEvent blocks until an event or error is received.  Both are nil
+	// after the connection is closed.
+	WaitForEvent() (xgb.Event, xgb.Error)
+	// Wake causes a blocked call to WaitForEvent to return.
+	Wake()
+}
+
+// xconn is the conn of a DockApp's window.
+type xconn struct {
+	x   *xgbutil.XUtil
+	win *xwindow.Window
+}
+
+func (c xconn) Map() {
+	c.win.Map()
+}
+
+func (c xconn) WaitForEvent() (xgb.Event, xgb.Error) {
+	return c.x.Conn().WaitForEvent()
+}
+
+// Wake sends the window a client message.  The message is otherwise ignored
+// by the event loop.
+func (c xconn) Wake() {
+	recoverX(func() {
+		ev := xproto.ClientMessageEvent{
+			Format: 32,
+			Window: c.win.Id,
+			Data:   xproto.ClientMessageDataUnionData32New(make([]uint32, 5)),
+		}
+		xproto.SendEvent(c.x.Conn(), false, c.win.Id, xproto.EventMaskNoEvent, string(ev.Bytes()))
+	})
+}
+
+// conn returns the current connection.  The caller must hold app.mut.
+func (app *DockApp) conn() conn {
+	if app.testConn != nil {
+		return app.testConn
+	}
+	return xconn{app.x, app.win}
 }
 
 // Main maps the dockapp window to the display and runs the main x event loop.
+// When the connection is lost Main waits for it to be replaced by Reconnect,
+// then the new window is mapped and its event loop run in turn.  Main returns
+// after Quit is called.
 func (app *DockApp) Main() {
-	app.win.Map()
-	xevent.Main(app.x)
+	for {
+		app.mut.Lock()
+		c, quit, replaced := app.conn(), app.quit, app.replacedChan()
+		app.mut.Unlock()
+		if quit {
+			return
+		}
+		recoverX(c.Map)
+		app.eventLoop(c)
+		<-replaced
+	}
+}
+
+// replacedChan returns the channel signaled by signalReplaced.  The caller
+// must hold app.mut.
+func (app *DockApp) replacedChan() chan struct{} {
+	if app.replaced == nil {
+		app.replaced = make(chan struct{}, 1)
+	}
+	return app.replaced
+}
+
+// signalReplaced wakes Main after its event loop returns, so that it runs the
+// event loop of a new connection or returns after Quit.  The caller must hold
+// app.mut.
+func (app *DockApp) signalReplaced() {
+	select {
+	case app.replacedChan() <- struct{}{}:
+	default:
+	}
+}
+
+// eventLoop reads events from c until Quit is called or the connection is
+// closed.  Unlike xevent.Main, eventLoop does not exit the process when the
+// connection is closed, so that the connection can be replaced.  No xevent
+// callbacks are run, X errors are logged, changes in the window's visibility
+// are sent over app.visc and the callbacks registered for input events are
+// run.
+func (app *DockApp) eventLoop(c conn) {
+	var vis visibility
+	for !app.quitting() {
+		ev, err := c.WaitForEvent()
+		if ev == nil && err == nil {
+			return
+		}
+		if err != nil {
+			log.Printf("x error: %v", err)
+			continue
+		}
+		if visible, changed := vis.update(ev); changed {
+			app.notifyVisible(visible)
+		}
+		app.handleInput(ev)
+	}
 }
 
 // Canvas returns a an image to be drawn to the screen dockapp window.  After
 // drawing to the returned image FlushImage must be called in order to reflect
-// the changes on the display.
+// the changes on the display.  The canvas is replaced when Reconnect is
+// called.
 func (app *DockApp) Canvas() draw.Image {
+	app.mut.Lock()
+	defer app.mut.Unlock()
 	return app.img
 }
 
-// Quit terminates the main event loop.
+// Bounds returns the bounds of the dockapp window's Canvas.
+func (app *DockApp) Bounds() image.Rectangle {
+	return app.rect
+}
+
+// Sub returns a view of the canvas bounded by r, so that independent widgets
+// can share a window by each drawing to their own rectangle.  Sub must be
+// called again after Reconnect, which replaces the canvas.
+func (app *DockApp) Sub(r image.Rectangle) draw.Image {
+	return imageutil.SubImage(app.Canvas(), r)
+}
+
+func (app *DockApp) quitting() bool {
+	app.mut.Lock()
+	defer app.mut.Unlock()
+	return app.quit
+}
+
+// Quit terminates the main event loop.  The loop is woken so that Main returns
+// even when no events are pending.
 func (app *DockApp) Quit() {
-	xevent.Quit(app.x)
+	app.mut.Lock()
+	app.quit = true
+	c := app.conn()
+	app.signalReplaced()
+	app.mut.Unlock()
+	c.Wake()
 }
 
 // Destroy releases window and image resources associated with the dockapp.
-// Destroy does not close the underlying connection with the x server.
+// Destroy does not close the underlying connection with the x server.  If the
+// connection has been lost Destroy logs a message and returns.
 func (app *DockApp) Destroy() {
+	app.mut.Lock()
+	defer app.mut.Unlock()
+	recoverX(app.destroy)
+}
+
+func (app *DockApp) destroy() {
 	app.img.Destroy()
 	app.win.Destroy()
+	if app.argb {
+		xproto.FreeGC(app.x.Conn(), app.gc)
+		xproto.FreeColormap(app.x.Conn(), app.cmap)
+	}
 }
 
 // FlushImage writes dockapp window data and updates the screen with the
-// contents of app.Canvas().
-func (app *DockApp) FlushImage() {
-	app.img.XDraw()
-	app.img.XPaint(app.win.Id)
+// contents of app.Canvas().  FlushImage waits for the x server to process
+// its requests and returns any error encountered, including the loss of the
+// connection.
+func (app *DockApp) FlushImage() (err error) {
+	app.mut.Lock()
+	defer app.mut.Unlock()
+
+	// xgb panics when requests are made on a connection it closed after
+	// losing the server.
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("connection lost: %v", e)
+		}
+	}()
+
+	if app.argb {
+		err = app.drawARGB()
+	} else {
+		err = app.img.XDrawChecked()
+	}
+	if err != nil {
+		return err
+	}
+	return xproto.ClearAreaChecked(app.x.Conn(), false, app.win.Id, 0, 0, 0, 0).Check()
+}
+
+// Reconnect replaces the connection to the x server along with the window and
+// image of the dockapp, which are recreated as they were by New or NewARGB.
+// The previous resources are released on a best effort basis because the
+// previous connection may already be lost.  The new canvas is blank and must
+// be redrawn.
+func (app *DockApp) Reconnect() error {
+	x, err := xgbutil.NewConn()
+	if err != nil {
+		return err
+	}
+	create := New
+	if app.argb {
+		create = NewARGB
+	}
+	next, err := create(x, app.rect)
+	if err != nil {
+		x.Conn().Close()
+		return err
+	}
+
+	app.mut.Lock()
+	prev := &DockApp{x: app.x, img: app.img, win: app.win, argb: app.argb, cmap: app.cmap, gc: app.gc}
+	app.x, app.img, app.win = next.x, next.img, next.win
+	app.argb, app.cmap, app.gc = next.argb, next.cmap, next.gc
+	app.signalReplaced()
+	app.mut.Unlock()
+
+	// closing the previous connection ends its event loop in Main.
+	recoverX(prev.destroy)
+	recoverX(prev.x.Conn().Close)
+	return nil
+}
+
+// recoverX calls fn, recovering from the panic which occurs when a request is
+// made on a connection that has been closed.
+func recoverX(fn func()) {
+	defer func() {
+		if e := recover(); e != nil {
+			log.Printf("x connection: %v", e)
+		}
+	}()
+	fn()
+}
+
+// drawARGB writes the canvas to its 32-bit pixmap.  The xgraphics package
+// assumes images have the depth of the root window so the pixmap data is
+// written here instead of using app.img.XDraw.  The canvas holds
+// premultiplied BGRA pixels, the format expected of a 32-bit TrueColor visual.
+func (app *DockApp) drawARGB() error {
+	r := app.img.Bounds()
+	width := r.Dx()
+	rowsPer := (xgbutil.MaxReqSize - 28) / (width * 4)
+	for y := 0; y < r.Dy(); y += rowsPer {
+		rows := rowsPer
+		if y+rows > r.Dy() {
+			rows = r.Dy() - y
+		}
+		data := app.img.Pix[y*app.img.Stride : (y+rows)*app.img.Stride]
+		err := xproto.PutImageChecked(app.x.Conn(), xproto.ImageFormatZPixmap,
+			xproto.Drawable(app.img.Pixmap), app.gc,
+			uint16(width), uint16(rows), int16(r.Min.X), int16(r.Min.Y+y),
+			0, 32, data).Check()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // New allocates and initializes a new DockApp.  NewDockApp does not initialize
@@ -64,29 +324,162 @@ func New(x *xgbutil.XUtil, rect image.Rectangle) (*DockApp, error) {
 	}
 	win.Create(x.RootWin(), 0, 0, rect.Size().X, rect.Size().Y, 0)
 
-	// Set WM hints so that Openbox puts the window into the dock.
-	hints := &icccm.Hints{
-		Flags:        icccm.HintState | icccm.HintIconWindow,
-		InitialState: icccm.StateWithdrawn,
-		IconWindow:   win.Id,
-		WindowGroup:  win.Id,
+	err = setHints(x, win)
+	if err == nil {
+		err = listen(win)
+	}
+	if err != nil {
+		win.Destroy()
+		return nil, err
+	}
+	img := xgraphics.New(x, rect)
+	err = img.XSurfaceSet(win.Id)
+	if err != nil {
+		img.Destroy()
+		win.Destroy()
+		return nil, fmt.Errorf("xsurface set: %v", err)
+	}
+	app := &DockApp{
+		rect: rect,
+		x:    x,
+		img:  img,
+		win:  win,
+		visc: make(chan bool, 1),
+	}
+	return app, nil
+}
+
+// NewARGB is like New but creates a window with a 32-bit ARGB visual so that
+// the alpha channel of the canvas is composited with whatever is behind the
+// window.  Transparency requires a running compositing manager.  If the X
+// server provides no ARGB visual NewARGB logs a message and returns an opaque
+// DockApp as New would.
+func NewARGB(x *xgbutil.XUtil, rect image.Rectangle) (*DockApp, error) {
+	visual, ok := argbVisual(x)
+	if !ok {
+		log.Printf("no 32-bit visual available (using an opaque window)")
+		return New(x, rect)
+	}
+	conn := x.Conn()
+
+	cmap, err := xproto.NewColormapId(conn)
+	if err != nil {
+		return nil, fmt.Errorf("colormap: %v", err)
+	}
+	err = xproto.CreateColormapChecked(conn, xproto.ColormapAllocNone, cmap, x.RootWin(), visual).Check()
+	if err != nil {
+		return nil, fmt.Errorf("colormap: %v", err)
+	}
+
+	// A window with a depth differing from its parent must be given a border
+	// pixel and colormap explicitly.
+	win, err := xwindow.Generate(x)
+	if err != nil {
+		xproto.FreeColormap(conn, cmap)
+		return nil, fmt.Errorf("generate window: %v", err)
+	}
+	err = xproto.CreateWindowChecked(conn, 32, win.Id, x.RootWin(),
+		0, 0, uint16(rect.Dx()), uint16(rect.Dy()), 0,
+		xproto.WindowClassInputOutput, visual,
+		xproto.CwBackPixel|xproto.CwBorderPixel|xproto.CwColormap,
+		[]uint32{0, 0, uint32(cmap)}).Check()
+	if err != nil {
+		xproto.FreeColormap(conn, cmap)
+		return nil, fmt.Errorf("create window: %v", err)
+	}
+
+	err = setHints(x, win)
+	if err == nil {
+		err = listen(win)
 	}
-	err = icccm.WmHintsSet(x, win.Id, hints)
 	if err != nil {
 		win.Destroy()
-		return nil, fmt.Errorf("wm hints: %v", err)
+		xproto.FreeColormap(conn, cmap)
+		return nil, err
 	}
+
+	// The pixmap and graphics context must have the depth of the window.
 	img := xgraphics.New(x, rect)
+	pix, err := xproto.NewPixmapId(conn)
+	if err == nil {
+		err = xproto.CreatePixmapChecked(conn, 32, pix, xproto.Drawable(win.Id),
+			uint16(rect.Dx()), uint16(rect.Dy())).Check()
+	}
+	if err != nil {
+		win.Destroy()
+		xproto.FreeColormap(conn, cmap)
+		return nil, fmt.Errorf("pixmap: %v", err)
+	}
+	img.Pixmap = pix
+	gc, err := xproto.NewGcontextId(conn)
+	if err == nil {
+		err = xproto.CreateGCChecked(conn, gc, xproto.Drawable(pix), 0, nil).Check()
+	}
+	if err != nil {
+		img.Destroy()
+		win.Destroy()
+		xproto.FreeColormap(conn, cmap)
+		return nil, fmt.Errorf("graphics context: %v", err)
+	}
 	err = img.XSurfaceSet(win.Id)
 	if err != nil {
+		xproto.FreeGC(conn, gc)
 		img.Destroy()
 		win.Destroy()
+		xproto.FreeColormap(conn, cmap)
 		return nil, fmt.Errorf("xsurface set: %v", err)
 	}
 	app := &DockApp{
-		x:   x,
-		img: img,
-		win: win,
+		rect: rect,
+		x:    x,
+		img:  img,
+		win:  win,
+		argb: true,
+		cmap: cmap,
+		gc:   gc,
+		visc: make(chan bool, 1),
 	}
 	return app, nil
 }
+
+// argbVisual returns a 32-bit TrueColor visual for the default screen of x.
+// If no such visual exists argbVisual returns false.
+func argbVisual(x *xgbutil.XUtil) (xproto.Visualid, bool) {
+	for _, depth := range x.Screen().AllowedDepths {
+		if depth.Depth != 32 {
+			continue
+		}
+		for _, visual := range depth.Visuals {
+			if visual.Class == xproto.VisualClassTrueColor {
+				return visual.VisualId, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// listen selects the events which determine the visibility of win and the
+// input events for which callbacks may be registered.
+func listen(win *xwindow.Window) error {
+	err := win.Listen(xproto.EventMaskVisibilityChange, xproto.EventMaskStructureNotify,
+		xproto.EventMaskButtonPress, xproto.EventMaskButtonRelease, xproto.EventMaskKeyPress)
+	if err != nil {
+		return fmt.Errorf("listen: %v", err)
+	}
+	return nil
+}
+
+// setHints sets WM hints so that Openbox puts the window into the dock.
+func setHints(x *xgbutil.XUtil, win *xwindow.Window) error {
+	hints := &icccm.Hints{
+		Flags:        icccm.HintState | icccm.HintIconWindow,
+		InitialState: icccm.StateWithdrawn,
+		IconWindow:   win.Id,
+		WindowGroup:  win.Id,
+	}
+	err := icccm.WmHintsSet(x, win.Id, hints)
+	if err != nil {
+		return fmt.Errorf("wm hints: %v", err)
+	}
+	return nil
+}
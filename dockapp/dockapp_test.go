@@ -0,0 +1,136 @@
+package dockapp
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/xgb"
+)
+
+// testConn is a conn without an x server.  No events are ever received.  A
+// closed testConn behaves like a lost connection, WaitForEvent returns nil
+// and requests panic.
+type testConn struct {
+	mapped chan struct{}
+	wake   chan struct{}
+	closed bool
+
+	mut  sync.Mutex
+	maps int
+}
+
+func newTestConn() *testConn {
+	return &testConn{
+		mapped: make(chan struct{}, 1),
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+func (c *testConn) Map() {
+	c.mut.Lock()
+	c.maps++
+	maps := c.maps
+	c.mut.Unlock()
+	if c.closed && maps > 1 {
+		panic("send on closed channel")
+	}
+	select {
+	case c.mapped <- struct{}{}:
+	default:
+	}
+}
+
+func (c *testConn) numMaps() int {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.maps
+}
+
+func (c *testConn) WaitForEvent() (xgb.Event, xgb.Error) {
+	if c.closed {
+		return nil, nil
+	}
+	<-c.wake
+	return testEvent{}, nil
+}
+
+func (c *testConn) Wake() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+type testEvent struct{}
+
+func (testEvent) Bytes() []byte  { return nil }
+func (testEvent) String() string { return "test event" }
+
+func TestDockApp_Quit(t *testing.T) {
+	c := newTestConn()
+	app := &DockApp{testConn: c}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		app.Main()
+	}()
+
+	select {
+	case <-c.mapped:
+	case <-time.After(time.Second):
+		t.Fatalf("window not mapped")
+	}
+	select {
+	case <-done:
+		t.Fatalf("Main returned before Quit")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	app.Quit()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Main did not return after Quit")
+	}
+}
+
+func TestDockApp_Main_lost(t *testing.T) {
+	lost := newTestConn()
+	lost.closed = true
+	app := &DockApp{testConn: lost}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		app.Main()
+	}()
+
+	// Main waits for a new connection instead of mapping the lost one again.
+	select {
+	case <-lost.mapped:
+	case <-time.After(time.Second):
+		t.Fatalf("window not mapped")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := lost.numMaps(); n != 1 {
+		t.Errorf("lost connection mapped %d times", n)
+	}
+
+	next := newTestConn()
+	app.mut.Lock()
+	app.testConn = next
+	app.signalReplaced()
+	app.mut.Unlock()
+	select {
+	case <-next.mapped:
+	case <-time.After(time.Second):
+		t.Fatalf("new window not mapped")
+	}
+
+	app.Quit()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Main did not return after Quit")
+	}
+}
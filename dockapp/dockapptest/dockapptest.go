@@ -0,0 +1,74 @@
+/*
+Package dockapptest provides an in-memory dockapp.Surface so that the draw
+loops of dockapps can be tested without a connection to an x server.
+*/
+package dockapptest
+
+import (
+	"image"
+	"image/draw"
+	"sync"
+)
+
+// MemSurface is a dockapp.Surface that records a copy of its canvas each time
+// FlushImage is called.  MemSurface is safe to flush from one goroutine while
+// its frames are inspected from another.
+type MemSurface struct {
+	img    *image.RGBA
+	mut    sync.Mutex
+	frames []*image.RGBA
+	notify chan struct{}
+}
+
+// NewMemSurface returns a MemSurface with a canvas of the given bounds.
+func NewMemSurface(rect image.Rectangle) *MemSurface {
+	return &MemSurface{
+		img:    image.NewRGBA(rect),
+		notify: make(chan struct{}),
+	}
+}
+
+// Canvas implements the dockapp.Surface interface.  The canvas must only be
+// drawn to by the goroutine calling FlushImage.
+func (s *MemSurface) Canvas() draw.Image {
+	return s.img
+}
+
+// Bounds implements the dockapp.Surface interface.
+func (s *MemSurface) Bounds() image.Rectangle {
+	return s.img.Bounds()
+}
+
+// FlushImage implements the dockapp.Surface interface.  FlushImage never
+// returns an error.
+func (s *MemSurface) FlushImage() error {
+	frame := image.NewRGBA(s.img.Bounds())
+	draw.Draw(frame, frame.Bounds(), s.img, frame.Bounds().Min, draw.Src)
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.frames = append(s.frames, frame)
+	close(s.notify)
+	s.notify = make(chan struct{})
+	return nil
+}
+
+// Frames returns the frames flushed so far, in order.
+func (s *MemSurface) Frames() []*image.RGBA {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return append([]*image.RGBA(nil), s.frames...)
+}
+
+// Flushed returns a channel that is closed immediately if more than n frames
+// have been flushed, and otherwise when the next frame is flushed.
+func (s *MemSurface) Flushed(n int) <-chan struct{} {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if len(s.frames) > n {
+		c := make(chan struct{})
+		close(c)
+		return c
+	}
+	return s.notify
+}
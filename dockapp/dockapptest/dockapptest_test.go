@@ -0,0 +1,50 @@
+package dockapptest
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+	"time"
+)
+
+func TestMemSurface(t *testing.T) {
+	s := NewMemSurface(image.Rect(0, 0, 4, 2))
+	if s.Bounds() != image.Rect(0, 0, 4, 2) {
+		t.Errorf("bounds: %v", s.Bounds())
+	}
+	flushed := s.Flushed(0)
+	colors := []color.RGBA{
+		{R: 0xff, A: 0xff},
+		{G: 0xff, A: 0xff},
+	}
+	for _, c := range colors {
+		draw.Draw(s.Canvas(), s.Bounds(), image.NewUniform(c), image.ZP, draw.Src)
+		s.FlushImage()
+	}
+	select {
+	case <-flushed:
+	case <-time.After(time.Second):
+		t.Errorf("flush not notified")
+	}
+	select {
+	case <-s.Flushed(1):
+	default:
+		t.Errorf("flushed frames not notified")
+	}
+	select {
+	case <-s.Flushed(2):
+		t.Errorf("unflushed frame notified")
+	default:
+	}
+
+	frames := s.Frames()
+	if len(frames) != len(colors) {
+		t.Fatalf("%d frames (expected %d)", len(frames), len(colors))
+	}
+	for i, c := range colors {
+		if frames[i].RGBAAt(3, 1) != c {
+			t.Errorf("frame %d: %v (expected %v)", i, frames[i].RGBAAt(3, 1), c)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package dockapp
+
+import (
+	"image"
+
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+// Mouse buttons reported in the Detail of an xproto.ButtonPressEvent.
+const (
+	ButtonLeft   xproto.Button = 1
+	ButtonMiddle xproto.Button = 2
+	ButtonRight  xproto.Button = 3
+)
+
+// inputHandlers are the callbacks registered for input events.
+type inputHandlers struct {
+	buttonPress   []func(ev xproto.ButtonPressEvent, pos image.Point)
+	buttonRelease []func(ev xproto.ButtonReleaseEvent, pos image.Point)
+	keyPress      []func(ev xproto.KeyPressEvent, pos image.Point)
+}
+
+// OnButtonPress registers fn to be called each time a mouse button is pressed
+// over the dockapp window with the position of the pointer relative to the
+// window.  Input callbacks are run by the event loop in the order they were
+// registered and must not block.  Callbacks remain registered when the
+// dockapp reconnects.
+func (app *DockApp) OnButtonPress(fn func(ev xproto.ButtonPressEvent, pos image.Point)) {
+	app.mut.Lock()
+	defer app.mut.Unlock()
+	app.input.buttonPress = append(app.input.buttonPress, fn)
+}
+
+// OnButtonRelease is like OnButtonPress but fn is called each time a mouse
+// button is released.
+func (app *DockApp) OnButtonRelease(fn func(ev xproto.ButtonReleaseEvent, pos image.Point)) {
+	app.mut.Lock()
+	defer app.mut.Unlock()
+	app.input.buttonRelease = append(app.input.buttonRelease, fn)
+}
+
+// OnKeyPress is like OnButtonPress but fn is called each time a key is pressed
+// while the dockapp window has the keyboard focus.
+func (app *DockApp) OnKeyPress(fn func(ev xproto.KeyPressEvent, pos image.Point)) {
+	app.mut.Lock()
+	defer app.mut.Unlock()
+	app.input.keyPress = append(app.input.keyPress, fn)
+}
+
+// handleInput runs the callbacks registered for ev, if it is an input event.
+func (app *DockApp) handleInput(ev interface{}) {
+	app.mut.Lock()
+	h := app.input
+	app.mut.Unlock()
+	switch ev := ev.(type) {
+	case xproto.ButtonPressEvent:
+		for _, fn := range h.buttonPress {
+			fn(ev, image.Pt(int(ev.EventX), int(ev.EventY)))
+		}
+	case xproto.ButtonReleaseEvent:
+		for _, fn := range h.buttonRelease {
+			fn(ev, image.Pt(int(ev.EventX), int(ev.EventY)))
+		}
+	case xproto.KeyPressEvent:
+		for _, fn := range h.keyPress {
+			fn(ev, image.Pt(int(ev.EventX), int(ev.EventY)))
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package dockapp
+
+import (
+	"image"
+	"reflect"
+	"testing"
+
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+func TestDockApp_handleInput(t *testing.T) {
+	app := &DockApp{}
+	app.handleInput(xproto.ButtonPressEvent{Detail: ButtonLeft}) // no callbacks
+
+	var events []string
+	app.OnButtonPress(func(ev xproto.ButtonPressEvent, pos image.Point) {
+		events = append(events, "press "+string('0'+rune(ev.Detail))+" "+pos.String())
+	})
+	app.OnButtonPress(func(ev xproto.ButtonPressEvent, pos image.Point) {
+		events = append(events, "press again")
+	})
+	app.OnButtonRelease(func(ev xproto.ButtonReleaseEvent, pos image.Point) {
+		events = append(events, "release "+string('0'+rune(ev.Detail))+" "+pos.String())
+	})
+	app.OnKeyPress(func(ev xproto.KeyPressEvent, pos image.Point) {
+		events = append(events, "key "+pos.String())
+	})
+	for _, ev := range []interface{}{
+		xproto.ButtonPressEvent{Detail: ButtonLeft, EventX: 3, EventY: 4},
+		xproto.ButtonReleaseEvent{Detail: ButtonLeft, EventX: 5, EventY: 6},
+		xproto.ExposeEvent{},
+		xproto.KeyPressEvent{Detail: 38, EventX: 1, EventY: 2},
+		xproto.ButtonPressEvent{Detail: ButtonRight},
+	} {
+		app.handleInput(ev)
+	}
+	expect := []string{
+		"press 1 (3,4)",
+		"press again",
+		"release 1 (5,6)",
+		"key (1,2)",
+		"press 3 (0,0)",
+		"press again",
+	}
+	if !reflect.DeepEqual(events, expect) {
+		t.Errorf("events %q (expected %q)", events, expect)
+	}
+}
@@ -0,0 +1,79 @@
+package dockapp
+
+import (
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+// Pauser is implemented by types which do periodic work, like polling, that
+// may be suspended while a dockapp is hidden.
+type Pauser interface {
+	Pause()
+	Resume()
+}
+
+// PauseHidden pauses each of p when false is received over visible and
+// resumes them when true is received.  PauseHidden returns when visible is
+// closed.
+//
+//	go dockapp.PauseHidden(app.Visibility(), poller)
+func PauseHidden(visible <-chan bool, p ...Pauser) {
+	for v := range visible {
+		for _, p := range p {
+			if v {
+				p.Resume()
+			} else {
+				p.Pause()
+			}
+		}
+	}
+}
+
+// Visibility returns a channel that receives the visibility of the dockapp
+// window each time it changes.  The window is hidden when it is unmapped or
+// fully obscured by other windows (e.g. when the dock is on another
+// workspace).  Only the latest visibility is kept if it is not received
+// promptly.
+func (app *DockApp) Visibility() <-chan bool {
+	return app.visc
+}
+
+// notifyVisible sends visible over app.visc, replacing any value which has
+// not been received.  notifyVisible must only be called by the event loop.
+func (app *DockApp) notifyVisible(visible bool) {
+	select {
+	case <-app.visc:
+	default:
+	}
+	app.visc <- visible
+}
+
+// visibility tracks whether a window is visible from the events it receives.
+// A window is initially hidden because it is unmapped.
+type visibility struct {
+	mapped   bool
+	obscured bool
+}
+
+func (v *visibility) visible() bool {
+	return v.mapped && !v.obscured
+}
+
+// update applies ev to the visibility of the window and returns whether it is
+// visible and whether that changed.  Events which do not affect visibility
+// are ignored.
+func (v *visibility) update(ev xgb.Event) (visible, changed bool) {
+	prev := v.visible()
+	switch ev := ev.(type) {
+	case xproto.MapNotifyEvent:
+		v.mapped = true
+	case xproto.UnmapNotifyEvent:
+		v.mapped = false
+		v.obscured = false
+	case xproto.VisibilityNotifyEvent:
+		v.obscured = ev.State == xproto.VisibilityFullyObscured
+	default:
+		return prev, false
+	}
+	return v.visible(), v.visible() != prev
+}
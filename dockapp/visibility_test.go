@@ -0,0 +1,84 @@
+package dockapp
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+func TestVisibility(t *testing.T) {
+	var (
+		mapped     = xproto.MapNotifyEvent{}
+		unmapped   = xproto.UnmapNotifyEvent{}
+		obscured   = xproto.VisibilityNotifyEvent{State: xproto.VisibilityFullyObscured}
+		partial    = xproto.VisibilityNotifyEvent{State: xproto.VisibilityPartiallyObscured}
+		unobscured = xproto.VisibilityNotifyEvent{State: xproto.VisibilityUnobscured}
+		other      = xproto.ExposeEvent{}
+	)
+	var vis visibility
+	for i, test := range []struct {
+		ev      xgb.Event
+		visible bool
+		changed bool
+	}{
+		{other, false, false},
+		{unobscured, false, false},
+		{mapped, true, true},
+		{partial, true, false},
+		{obscured, false, true},
+		{other, false, false},
+		{obscured, false, false},
+		{unobscured, true, true},
+		{unmapped, false, true},
+		{obscured, false, false},
+		{mapped, false, false},
+		{partial, true, true},
+		{mapped, true, false},
+	} {
+		visible, changed := vis.update(test.ev)
+		if visible != test.visible {
+			t.Errorf("test %d: visible %v (expected %v)", i, visible, test.visible)
+		}
+		if changed != test.changed {
+			t.Errorf("test %d: changed %v (expected %v)", i, changed, test.changed)
+		}
+	}
+}
+
+type countPauser struct {
+	paused  int
+	resumed int
+}
+
+func (p *countPauser) Pause()  { p.paused++ }
+func (p *countPauser) Resume() { p.resumed++ }
+
+func TestPauseHidden(t *testing.T) {
+	app := &DockApp{visc: make(chan bool, 1)}
+	p1, p2 := &countPauser{}, &countPauser{}
+	done := make(chan struct{})
+	visc := make(chan bool)
+	go func() {
+		defer close(done)
+		PauseHidden(visc, p1, p2)
+	}()
+
+	// only the latest visibility is kept when it is not received.
+	app.notifyVisible(true)
+	app.notifyVisible(false)
+	if v := <-app.Visibility(); v {
+		t.Errorf("received stale visibility")
+	}
+
+	for _, v := range []bool{false, true, false} {
+		visc <- v
+	}
+	close(visc)
+	<-done
+	for i, p := range []*countPauser{p1, p2} {
+		if p.paused != 2 || p.resumed != 1 {
+			t.Errorf("test %d: paused %d resumed %d (expected 2 and 1)", i, p.paused, p.resumed)
+		}
+	}
+}
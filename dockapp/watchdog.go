@@ -0,0 +1,79 @@
+package dockapp
+
+import (
+	"image"
+	"image/draw"
+	"log"
+	"time"
+)
+
+// Reconnecter is a Surface whose connection to the display can be
+// reestablished after flushing fails.  DockApp implements Reconnecter.
+type Reconnecter interface {
+	Surface
+
+	// Reconnect replaces the connection to the display.  The canvas may be
+	// replaced by a blank one.
+	Reconnect() error
+}
+
+// Watchdog is a Surface that reconnects its underlying Surface when flushing
+// fails.  After reconnecting the contents of the previous canvas are drawn to
+// the new canvas and flushed again, so the display does not need to be redrawn
+// by the caller.
+type Watchdog struct {
+	Surface Reconnecter
+
+	// Retries is the number of times Surface is reconnected during a call to
+	// FlushImage before its error is returned.
+	Retries int
+
+	// Delay is the time waited before each attempt to reconnect, giving the
+	// display time to recover.
+	Delay time.Duration
+}
+
+// NewWatchdog returns a Watchdog which reconnects s up to retries times per
+// flush, waiting delay before each attempt.
+func NewWatchdog(s Reconnecter, retries int, delay time.Duration) *Watchdog {
+	return &Watchdog{
+		Surface: s,
+		Retries: retries,
+		Delay:   delay,
+	}
+}
+
+// Canvas implements the Surface interface.
+func (w *Watchdog) Canvas() draw.Image {
+	return w.Surface.Canvas()
+}
+
+// Bounds implements the Surface interface.
+func (w *Watchdog) Bounds() image.Rectangle {
+	return w.Surface.Bounds()
+}
+
+// FlushImage implements the Surface interface.  If the underlying Surface
+// fails to flush after all retries the last error encountered is returned.
+func (w *Watchdog) FlushImage() error {
+	err := w.Surface.FlushImage()
+	if err == nil {
+		return nil
+	}
+	frame := image.NewRGBA(w.Surface.Bounds())
+	draw.Draw(frame, frame.Bounds(), w.Surface.Canvas(), frame.Bounds().Min, draw.Src)
+	for i := 0; i < w.Retries; i++ {
+		log.Printf("flush: %v (reconnecting)", err)
+		time.Sleep(w.Delay)
+		err = w.Surface.Reconnect()
+		if err != nil {
+			continue
+		}
+		draw.Draw(w.Surface.Canvas(), frame.Bounds(), frame, frame.Bounds().Min, draw.Src)
+		err = w.Surface.FlushImage()
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,89 @@
+package dockapp
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/bmatsuo/dockapp-go/dockapp/dockapptest"
+)
+
+var (
+	errFlush     = errors.New("flush failed")
+	errReconnect = errors.New("no display")
+)
+
+// failSurface is a Reconnecter which fails to flush a number of times.  When
+// reconnected its canvas is cleared.
+type failSurface struct {
+	*dockapptest.MemSurface
+	fails        int
+	reconnects   int
+	reconnectErr error
+}
+
+func (s *failSurface) FlushImage() error {
+	if s.fails > 0 {
+		s.fails--
+		return errFlush
+	}
+	return s.MemSurface.FlushImage()
+}
+
+func (s *failSurface) Reconnect() error {
+	s.reconnects++
+	if s.reconnectErr != nil {
+		return s.reconnectErr
+	}
+	draw.Draw(s.Canvas(), s.Bounds(), image.Transparent, image.ZP, draw.Src)
+	return nil
+}
+
+func TestWatchdog(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	for i, test := range []struct {
+		fails        int
+		retries      int
+		reconnectErr error
+		reconnects   int
+		err          error
+	}{
+		{0, 2, nil, 0, nil},
+		{1, 2, nil, 1, nil},
+		{2, 2, nil, 2, nil},
+		{3, 2, nil, 2, errFlush},
+		{1, 0, nil, 0, errFlush},
+		{1, 2, errReconnect, 2, errReconnect},
+	} {
+		s := &failSurface{
+			MemSurface:   dockapptest.NewMemSurface(image.Rect(0, 0, 4, 4)),
+			fails:        test.fails,
+			reconnectErr: test.reconnectErr,
+		}
+		w := NewWatchdog(s, test.retries, 0)
+		draw.Draw(w.Canvas(), w.Bounds(), image.NewUniform(red), image.ZP, draw.Src)
+		err := w.FlushImage()
+		if err != test.err {
+			t.Errorf("test %d: error %v (expected %v)", i, err, test.err)
+		}
+		if s.reconnects != test.reconnects {
+			t.Errorf("test %d: %d reconnects (expected %d)", i, s.reconnects, test.reconnects)
+		}
+		frames := s.Frames()
+		if test.err != nil {
+			if len(frames) != 0 {
+				t.Errorf("test %d: %d frames flushed", i, len(frames))
+			}
+			continue
+		}
+		if len(frames) != 1 {
+			t.Errorf("test %d: %d frames flushed (expected 1)", i, len(frames))
+			continue
+		}
+		if c := frames[0].RGBAAt(2, 2); c != red {
+			t.Errorf("test %d: flushed %v (expected %v)", i, c, red)
+		}
+	}
+}
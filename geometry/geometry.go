@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"image"
 	"strconv"
+	"strings"
 	"unicode"
 
 	"github.com/bmatsuo/go-lexer"
@@ -31,9 +32,75 @@ func Contract4(r image.Rectangle, xmin, ymin, xmax, ymax int) image.Rectangle {
 	}
 }
 
+// Expand returns a rectangle resulting from expanding r by n on each side.  It
+// is the inverse of Contract.
+func Expand(r image.Rectangle, n int) image.Rectangle {
+	return Expand2(r, n, n)
+}
+
+// Expand2 returns a rectangle resulting from expanding r by x in each side and
+// y on top and bottom.  The rectangle returned by Expand2 has the same center
+// of mass as r.
+func Expand2(r image.Rectangle, x, y int) image.Rectangle {
+	return Expand4(r, x, y, x, y)
+}
+
+// Expand4 returns a rectangle resulting from subtracting image.Pt(xmin, ymin)
+// from r.Min and adding image.Pt(xmax, ymax) to r.Max.
+func Expand4(r image.Rectangle, xmin, ymin, xmax, ymax int) image.Rectangle {
+	return Contract4(r, -xmin, -ymin, -xmax, -ymax)
+}
+
+// Split divides r horizontally into n rectangles of equal height and nearly
+// equal width which tile r from left to right.  When the width of r is not
+// divisible by n the remaining pixels are distributed one each to the leftmost
+// rectangles.  Split returns nil if n is not positive.
+func Split(r image.Rectangle, n int) []image.Rectangle {
+	if n <= 0 {
+		return nil
+	}
+	rects := make([]image.Rectangle, n)
+	dx, rem := r.Dx()/n, r.Dx()%n
+	x := r.Min.X
+	for i := range rects {
+		w := dx
+		if i < rem {
+			w++
+		}
+		rects[i] = image.Rect(x, r.Min.Y, x+w, r.Max.Y)
+		x += w
+	}
+	return rects
+}
+
+// SplitRatio divides r horizontally into two rectangles which tile r.  The
+// left rectangle has a width of approximately ratio times the width of r.
+// The ratio is clamped to the range [0, 1].
+func SplitRatio(r image.Rectangle, ratio float64) (left, right image.Rectangle) {
+	if ratio < 0 {
+		ratio = 0
+	}
+	if ratio > 1 {
+		ratio = 1
+	}
+	x := r.Min.X + int(ratio*float64(r.Dx())+0.5)
+	left = image.Rect(r.Min.X, r.Min.Y, x, r.Max.Y)
+	right = image.Rect(x, r.Min.Y, r.Max.X, r.Max.Y)
+	return left, right
+}
+
 // Parse returns an image.Rectangle corresponding to the given geometry string.
+// The width and height of the geometry must be positive.
 func Parse(geom string) (rect image.Rectangle, err error) {
-	return parseGeometry(geom)
+	return parseGeometry(geom, nil)
+}
+
+// ParseRelative is like Parse but dimensions may be given as a percentage of
+// the corresponding dimension of ref (e.g. "50%x20" or "100%x10%+0+0").
+// Percentages are rounded down to a whole number of pixels.  Offsets are
+// always in pixels.
+func ParseRelative(geom string, ref image.Rectangle) (rect image.Rectangle, err error) {
+	return parseGeometry(geom, &ref)
 }
 
 // Format renders the given image.Rectangle as a geometry string.
@@ -80,11 +147,20 @@ type flagValue struct {
 	rect *image.Rectangle
 }
 
+// String returns an empty string for an empty rectangle, so that optional
+// geometries can be disabled by an empty flag value.
 func (v *flagValue) String() string {
+	if v.rect == nil || v.rect.Empty() {
+		return ""
+	}
 	return Format(*v.rect)
 }
 
 func (v *flagValue) Set(s string) error {
+	if s == "" {
+		*v.rect = image.ZR
+		return nil
+	}
 	rect, err := Parse(s)
 	if err != nil {
 		return err
@@ -93,17 +169,30 @@ func (v *flagValue) Set(s string) error {
 	return nil
 }
 
-func parseGeometry(s string) (image.Rectangle, error) {
+// parseGeometry parses the geometry s.  If ref is nil dimensions given as
+// percentages are an error.
+func parseGeometry(s string, ref *image.Rectangle) (image.Rectangle, error) {
 	lex := lexer.New(lexGeometry, s)
 
-	xdim, err := _parseInt(lex.Next())
+	var xref, yref *int
+	if ref != nil {
+		dx, dy := ref.Dx(), ref.Dy()
+		xref, yref = &dx, &dy
+	}
+	xdim, err := _parseDimension(lex.Next(), xref)
 	if err != nil {
 		return image.ZR, err
 	}
-	ydim, err := _parseInt(lex.Next())
+	ydim, err := _parseDimension(lex.Next(), yref)
 	if err != nil {
 		return image.ZR, err
 	}
+	if xdim <= 0 {
+		return image.ZR, fmt.Errorf("geometry: width must be positive")
+	}
+	if ydim <= 0 {
+		return image.ZR, fmt.Errorf("geometry: height must be positive")
+	}
 	xoffset, err := _parseInt(lex.Next())
 	if err == errEOF {
 		r := image.Rect(0, 0, xdim, ydim)
@@ -132,6 +221,26 @@ func parseGeometry(s string) (image.Rectangle, error) {
 
 var errEOF = fmt.Errorf("EOF")
 
+// _parseDimension parses a dimension in pixels or, if ref is not nil, a
+// percentage of ref pixels.
+func _parseDimension(item *lexer.Item, ref *int) (int, error) {
+	err := item.Err()
+	if err != nil {
+		return 0, err
+	}
+	if !strings.HasSuffix(item.Value, "%") {
+		return _parseInt(item)
+	}
+	if ref == nil {
+		return 0, fmt.Errorf("geometry: percentage %q requires a reference geometry", item.Value)
+	}
+	pct, err := strconv.ParseInt(strings.TrimSuffix(item.Value, "%"), 10, 0)
+	if err != nil {
+		return 0, err
+	}
+	return int(pct) * *ref / 100, nil
+}
+
 func _parseInt(item *lexer.Item) (int, error) {
 	err := item.Err()
 	if err != nil {
@@ -185,10 +294,15 @@ func lexOffset(lex *lexer.Lexer) lexer.StateFn {
 	return nil
 }
 
+// _lexDimension lexes a dimension in pixels, or a percentage when followed by
+// '%'.  A negative sign is accepted so that the dimension may be rejected with
+// a clear error when parsed.
 func _lexDimension(lex *lexer.Lexer) bool {
+	lex.Accept("-")
 	if lex.AcceptRunFunc(unicode.IsDigit) == 0 {
 		return false
 	}
+	lex.Accept("%")
 	lex.Emit(itemDimension)
 	return true
 }
@@ -7,6 +7,97 @@ import (
 	"testing"
 )
 
+func TestExpand(t *testing.T) {
+	for i, test := range []struct {
+		r      image.Rectangle
+		n      int
+		expand image.Rectangle
+	}{
+		{image.Rect(0, 0, 10, 5), 0, image.Rect(0, 0, 10, 5)},
+		{image.Rect(0, 0, 10, 5), 1, image.Rect(-1, -1, 11, 6)},
+		{image.Rect(2, 3, 12, 8), 2, image.Rect(0, 1, 14, 10)},
+		{image.Rectangle{}, 1, image.Rect(-1, -1, 1, 1)},
+	} {
+		r := Expand(test.r, test.n)
+		if r != test.expand {
+			t.Errorf("test %d: %v (expected %v)", i, r, test.expand)
+		}
+		if r := Expand(Contract(test.r, test.n), test.n); r != test.r {
+			t.Errorf("test %d: expanded contraction %v (expected %v)", i, r, test.r)
+		}
+	}
+}
+
+func TestExpand4(t *testing.T) {
+	for i, test := range []struct {
+		r                      image.Rectangle
+		xmin, ymin, xmax, ymax int
+		expand                 image.Rectangle
+	}{
+		{image.Rect(0, 0, 10, 5), 0, 0, 0, 0, image.Rect(0, 0, 10, 5)},
+		{image.Rect(0, 0, 10, 5), 1, 2, 3, 4, image.Rect(-1, -2, 13, 9)},
+	} {
+		r := Expand4(test.r, test.xmin, test.ymin, test.xmax, test.ymax)
+		if r != test.expand {
+			t.Errorf("test %d: %v (expected %v)", i, r, test.expand)
+		}
+		c := Contract4(r, test.xmin, test.ymin, test.xmax, test.ymax)
+		if c != test.r {
+			t.Errorf("test %d: contracted %v (expected %v)", i, c, test.r)
+		}
+	}
+	if r := Expand2(image.Rect(0, 0, 10, 5), 1, 2); r != image.Rect(-1, -2, 11, 7) {
+		t.Errorf("expand2: %v", r)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	for i, test := range []struct {
+		r     image.Rectangle
+		n     int
+		rects []image.Rectangle
+	}{
+		{image.Rect(0, 0, 10, 5), 0, nil},
+		{image.Rect(0, 0, 10, 5), 1, []image.Rectangle{image.Rect(0, 0, 10, 5)}},
+		{image.Rect(0, 0, 10, 5), 2, []image.Rectangle{image.Rect(0, 0, 5, 5), image.Rect(5, 0, 10, 5)}},
+		{image.Rect(1, 2, 11, 7), 3, []image.Rectangle{image.Rect(1, 2, 5, 7), image.Rect(5, 2, 8, 7), image.Rect(8, 2, 11, 7)}},
+		{image.Rect(0, 0, 2, 5), 3, []image.Rectangle{image.Rect(0, 0, 1, 5), image.Rect(1, 0, 2, 5), image.Rect(2, 0, 2, 5)}},
+	} {
+		rects := Split(test.r, test.n)
+		if len(rects) != len(test.rects) {
+			t.Errorf("test %d: %v", i, rects)
+			continue
+		}
+		for j := range rects {
+			if rects[j] != test.rects[j] {
+				t.Errorf("test %d: rect %d %v (expected %v)", i, j, rects[j], test.rects[j])
+			}
+		}
+	}
+}
+
+func TestSplitRatio(t *testing.T) {
+	for i, test := range []struct {
+		r     image.Rectangle
+		ratio float64
+		left  image.Rectangle
+		right image.Rectangle
+	}{
+		{image.Rect(0, 0, 10, 5), 0.5, image.Rect(0, 0, 5, 5), image.Rect(5, 0, 10, 5)},
+		{image.Rect(2, 0, 12, 5), 0.25, image.Rect(2, 0, 5, 5), image.Rect(5, 0, 12, 5)},
+		{image.Rect(0, 0, 10, 5), -1, image.Rect(0, 0, 0, 5), image.Rect(0, 0, 10, 5)},
+		{image.Rect(0, 0, 10, 5), 2, image.Rect(0, 0, 10, 5), image.Rect(10, 0, 10, 5)},
+	} {
+		left, right := SplitRatio(test.r, test.ratio)
+		if left != test.left {
+			t.Errorf("test %d: left %v (expected %v)", i, left, test.left)
+		}
+		if right != test.right {
+			t.Errorf("test %d: right %v (expected %v)", i, right, test.right)
+		}
+	}
+}
+
 func TestParse(t *testing.T) {
 	for i, test := range []struct {
 		s string
@@ -15,8 +106,9 @@ func TestParse(t *testing.T) {
 		{"1x2", image.Rect(0, 0, 1, 2)},
 		{"1x2+3+4", image.Rect(3, 4, 4, 6)},
 		{"1x2-3-4", image.Rect(-3, -4, -2, -2)},
+		{"20x10-30-40", image.Rect(-30, -40, -10, -30)},
 	} {
-		r, err := parseGeometry(test.s)
+		r, err := parseGeometry(test.s, nil)
 		if err != nil {
 			t.Errorf("test %d: %v", i, err)
 		}
@@ -37,8 +129,65 @@ func TestParse_error(t *testing.T) {
 		{"1x1x1", "x offset"},
 		{"1x1+1", "y offset"},
 		{"1x1+1+1+1", "end of input"},
+		{"50%x20", "reference"},
+		{"20x50%", "reference"},
+		{"0x20", "width must be positive"},
+		{"20x0", "height must be positive"},
+		{"0x0+1+1", "width must be positive"},
+		{"-1x20", "width must be positive"},
+		{"20x-1", "height must be positive"},
+		{"-x20", "width"},
 	} {
-		r, err := parseGeometry(test.s)
+		r, err := parseGeometry(test.s, nil)
+		if err == nil {
+			t.Errorf("test %d: expected error %q", i, test.errtext)
+		} else if !strings.Contains(err.Error(), test.errtext) {
+			t.Errorf("test %d: expected %q %v", i, test.errtext, err)
+		}
+		if r != image.ZR {
+			t.Errorf("test %d: %v", i, r)
+		}
+	}
+}
+
+func TestParseRelative(t *testing.T) {
+	ref := image.Rect(10, 10, 110, 30)
+	for i, test := range []struct {
+		s string
+		r image.Rectangle
+	}{
+		{"1x2", image.Rect(0, 0, 1, 2)},
+		{"1x2+3+4", image.Rect(3, 4, 4, 6)},
+		{"50%x20", image.Rect(0, 0, 50, 20)},
+		{"20x50%", image.Rect(0, 0, 20, 10)},
+		{"100%x10%+0+0", image.Rect(0, 0, 100, 2)},
+		{"33%x33%-1+2", image.Rect(-1, 2, 32, 8)},
+	} {
+		r, err := ParseRelative(test.s, ref)
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+		}
+		if r != test.r {
+			t.Errorf("test %d: %v (expected %v)", i, r, test.r)
+		}
+	}
+}
+
+func TestParseRelative_error(t *testing.T) {
+	ref := image.Rect(0, 0, 100, 20)
+	for i, test := range []struct {
+		s       string
+		errtext string
+	}{
+		{"50%%x20", "'x'"},
+		{"%x20", "width"},
+		{"50x%", "height"},
+		{"50x20+1%+1", "y offset"},
+		{"50x20%%", "x offset"},
+		{"0%x20", "width must be positive"},
+		{"50x4%", "height must be positive"},
+	} {
+		r, err := ParseRelative(test.s, ref)
 		if err == nil {
 			t.Errorf("test %d: expected error %q", i, test.errtext)
 		} else if !strings.Contains(err.Error(), test.errtext) {
@@ -80,12 +229,24 @@ func TestFlag(t *testing.T) {
 	if *r2 != image.Rect(1, 1, 2, 2) {
 		t.Errorf("r2: %#v", r2)
 	}
+
+	// an empty value disables a geometry.
+	err = fs.Parse([]string{"-t1="})
+	if err != nil {
+		t.Errorf("parse error: %v", err)
+	}
+	if *r1 != image.ZR {
+		t.Errorf("r1: %#v", *r1)
+	}
+	if s := fs.Lookup("t1").Value.String(); s != "" {
+		t.Errorf("r1 string: %q", s)
+	}
 }
 
 func BenchmarkParse(b *testing.B) {
 	expect := image.Rect(1920, 0, 1920+1920, 1080)
 	for i := 0; i < b.N; i++ {
-		geom, err := parseGeometry("1920x1080+1920+0")
+		geom, err := parseGeometry("1920x1080+1920+0", nil)
 		if err != nil {
 			b.Fatal(err)
 		}
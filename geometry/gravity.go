@@ -0,0 +1,78 @@
+package geometry
+
+import (
+	"fmt"
+	"image"
+	"strings"
+)
+
+// Gravity is a point of a container to which a rectangle is anchored.
+type Gravity int
+
+// Gravity values name the corners, edges and center of a container.
+const (
+	NorthWest Gravity = iota
+	North
+	NorthEast
+	West
+	Center
+	East
+	SouthWest
+	South
+	SouthEast
+)
+
+var gravityNames = map[string]Gravity{
+	"NW": NorthWest,
+	"N":  North,
+	"NE": NorthEast,
+	"W":  West,
+	"C":  Center,
+	"E":  East,
+	"SW": SouthWest,
+	"S":  South,
+	"SE": SouthEast,
+}
+
+// ParseGravity returns the Gravity with the given abbreviation: N, S, E, W,
+// NE, NW, SE, SW, or C for the center.
+func ParseGravity(s string) (Gravity, error) {
+	g, ok := gravityNames[s]
+	if !ok {
+		return 0, fmt.Errorf("geometry: unknown gravity %q", s)
+	}
+	return g, nil
+}
+
+// Anchor returns a rectangle the size of r anchored to container by g, and
+// then translated by r.Min.
+func (g Gravity) Anchor(r image.Rectangle, container image.Rectangle) image.Rectangle {
+	col, row := int(g)%3, int(g)/3
+	p := container.Min
+	p.X += col * (container.Dx() - r.Dx()) / 2
+	p.Y += row * (container.Dy() - r.Dy()) / 2
+	return image.Rectangle{Max: r.Size()}.Add(p).Add(r.Min)
+}
+
+// Resolve parses a geometry which may be followed by a gravity (e.g.
+// "40x20@NE" or "50%x100%-1+0@E") and returns the rectangle it describes
+// within container.  Dimensions may be percentages of container, as with
+// ParseRelative.  The rectangle is anchored to container by its gravity and
+// then offset.  Without a gravity the rectangle is anchored to the top left
+// corner of container.
+func Resolve(geom string, container image.Rectangle) (image.Rectangle, error) {
+	g := NorthWest
+	if i := strings.Index(geom, "@"); i >= 0 {
+		var err error
+		g, err = ParseGravity(geom[i+1:])
+		if err != nil {
+			return image.ZR, err
+		}
+		geom = geom[:i]
+	}
+	r, err := ParseRelative(geom, container)
+	if err != nil {
+		return image.ZR, err
+	}
+	return g.Anchor(r, container), nil
+}
@@ -0,0 +1,63 @@
+package geometry
+
+import (
+	"image"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	container := image.Rect(10, 20, 110, 60)
+	for i, test := range []struct {
+		geom string
+		r    image.Rectangle
+	}{
+		{"40x20", image.Rect(10, 20, 50, 40)},
+		{"40x20+1+2", image.Rect(11, 22, 51, 42)},
+		{"40x20@NW", image.Rect(10, 20, 50, 40)},
+		{"40x20@N", image.Rect(40, 20, 80, 40)},
+		{"40x20@NE", image.Rect(70, 20, 110, 40)},
+		{"40x20@W", image.Rect(10, 30, 50, 50)},
+		{"40x20@C", image.Rect(40, 30, 80, 50)},
+		{"40x20@E", image.Rect(70, 30, 110, 50)},
+		{"40x20@SW", image.Rect(10, 40, 50, 60)},
+		{"40x20@S", image.Rect(40, 40, 80, 60)},
+		{"40x20@SE", image.Rect(70, 40, 110, 60)},
+		{"40x20-1-1@SE", image.Rect(69, 39, 109, 59)},
+		{"50%x100%@E", image.Rect(60, 20, 110, 60)},
+		{"41x21@C", image.Rect(39, 29, 80, 50)},
+	} {
+		r, err := Resolve(test.geom, container)
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		if r != test.r {
+			t.Errorf("test %d: %v (expected %v)", i, r, test.r)
+		}
+	}
+}
+
+func TestResolve_error(t *testing.T) {
+	container := image.Rect(0, 0, 100, 40)
+	for i, test := range []struct {
+		geom    string
+		errtext string
+	}{
+		{"40x20@", "gravity"},
+		{"40x20@ne", "gravity"},
+		{"40x20@NNE", "gravity"},
+		{"40x20@NE@N", "gravity"},
+		{"40@NE", "'x'"},
+	} {
+		r, err := Resolve(test.geom, container)
+		if err == nil {
+			t.Errorf("test %d: expected error %q", i, test.errtext)
+		} else if !strings.Contains(err.Error(), test.errtext) {
+			t.Errorf("test %d: expected %q %v", i, test.errtext, err)
+		}
+		if r != image.ZR {
+			t.Errorf("test %d: %v", i, r)
+		}
+	}
+}
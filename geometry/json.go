@@ -0,0 +1,41 @@
+package geometry
+
+import (
+	"encoding/json"
+	"image"
+)
+
+// Geometry is an image.Rectangle that is encoded in JSON as a geometry string
+// (e.g. "38x18+1+1"), so that geometries may be embedded in structs decoded
+// by the encoding/json package.  An empty rectangle, which disables optional
+// geometries, is encoded as an empty string.
+type Geometry struct {
+	image.Rectangle
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (g Geometry) MarshalJSON() ([]byte, error) {
+	if g.Empty() {
+		return json.Marshal("")
+	}
+	return json.Marshal(Format(g.Rectangle))
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (g *Geometry) UnmarshalJSON(b []byte) error {
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return err
+	}
+	if s == "" {
+		g.Rectangle = image.ZR
+		return nil
+	}
+	r, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	g.Rectangle = r
+	return nil
+}
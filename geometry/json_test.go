@@ -0,0 +1,58 @@
+package geometry
+
+import (
+	"encoding/json"
+	"image"
+	"testing"
+)
+
+func TestGeometry_JSON(t *testing.T) {
+	for i, test := range []struct {
+		r    image.Rectangle
+		json string
+	}{
+		{image.Rect(1, 2, 3, 4), `{"window":"2x2+1+2"}`},
+		{image.Rect(0, 0, 38, 18), `{"window":"38x18"}`},
+		{image.Rect(-3, -4, -2, -2), `{"window":"1x2-3-4"}`},
+		{image.ZR, `{"window":""}`},
+	} {
+		type config struct {
+			Window Geometry `json:"window"`
+		}
+		b, err := json.Marshal(config{Geometry{test.r}})
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		if string(b) != test.json {
+			t.Errorf("test %d: %s (expected %s)", i, b, test.json)
+		}
+		var c config
+		err = json.Unmarshal(b, &c)
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		if c.Window.Rectangle != test.r {
+			t.Errorf("test %d: %v (expected %v)", i, c.Window.Rectangle, test.r)
+		}
+	}
+}
+
+func TestGeometry_UnmarshalJSON_error(t *testing.T) {
+	for i, s := range []string{
+		`"1x1+1"`,
+		`"abc"`,
+		`12`,
+		`{"x": 1}`,
+	} {
+		g := Geometry{image.Rect(1, 1, 2, 2)}
+		err := json.Unmarshal([]byte(s), &g)
+		if err == nil {
+			t.Errorf("test %d: expected error", i)
+		}
+		if g.Rectangle != image.Rect(1, 1, 2, 2) {
+			t.Errorf("test %d: modified %v", i, g.Rectangle)
+		}
+	}
+}
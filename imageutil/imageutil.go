@@ -0,0 +1,75 @@
+/*
+Package imageutil provides image types which are useful when composing the
+graphics of dockapps.
+*/
+package imageutil
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// SubImage produces a subimage of img as seen through r.  Attempts to draw
+// outside of r (or img) have no effect, and the color of any point outside
+// of r is transparent.
+func SubImage(img draw.Image, r image.Rectangle) draw.Image {
+	r = img.Bounds().Intersect(r)
+	return &drawSubImage{img, r}
+}
+
+type drawSubImage struct {
+	img draw.Image
+	r   image.Rectangle
+}
+
+func (img *drawSubImage) ColorModel() color.Model {
+	return img.img.ColorModel()
+}
+
+func (img *drawSubImage) Bounds() image.Rectangle {
+	return img.r
+}
+
+func (img *drawSubImage) At(x, y int) color.Color {
+	if image.Pt(x, y).In(img.r) {
+		return img.img.At(x, y)
+	}
+	return img.img.ColorModel().Convert(color.Transparent)
+}
+
+func (img *drawSubImage) Set(x, y int, c color.Color) {
+	if image.Pt(x, y).In(img.r) {
+		img.img.Set(x, y, c)
+	}
+}
+
+// Mask is an Image implementation that masks over/around a rectangle.
+type Mask struct {
+	image.Image
+	R      image.Rectangle
+	Inside bool
+}
+
+// MaskInside returns Mask image that is transparent inside r.
+func MaskInside(r image.Rectangle) *Mask {
+	return &Mask{image.Opaque, r, true}
+}
+
+// MaskOutside returns Mask image that is transparent outside r.
+func MaskOutside(r image.Rectangle) *Mask {
+	return &Mask{image.Opaque, r, false}
+}
+
+// At returns either m.Image.At(x, y) or color.Transparent depending on if
+// point (x, y) is masked.
+func (m *Mask) At(x, y int) color.Color {
+	inR := image.Pt(x, y).In(m.R)
+	if inR && m.Inside {
+		return color.Transparent
+	}
+	if !inR && !m.Inside {
+		return color.Transparent
+	}
+	return m.Image.At(x, y)
+}
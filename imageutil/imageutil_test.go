@@ -0,0 +1,86 @@
+package imageutil
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestSubImage(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	for i, test := range []struct {
+		r      image.Rectangle
+		bounds image.Rectangle
+	}{
+		{image.Rect(1, 1, 3, 3), image.Rect(1, 1, 3, 3)},
+		{image.Rect(2, 0, 8, 2), image.Rect(2, 0, 4, 2)},
+		{image.Rect(-2, -2, 1, 1), image.Rect(0, 0, 1, 1)},
+		{image.Rect(5, 5, 6, 6), image.Rectangle{}},
+	} {
+		img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+		sub := SubImage(img, test.r)
+		if sub.Bounds() != test.bounds {
+			t.Errorf("test %d: bounds %v (expected %v)", i, sub.Bounds(), test.bounds)
+		}
+
+		// fill a region larger than the image through the subimage.
+		draw.Draw(sub, image.Rect(-4, -4, 8, 8), image.NewUniform(red), image.ZP, draw.Src)
+		for x := -1; x <= 4; x++ {
+			sub.Set(x, 0, red)
+		}
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				expect := color.RGBA{}
+				if image.Pt(x, y).In(test.bounds) {
+					expect = red
+				}
+				if c := img.RGBAAt(x, y); c != expect {
+					t.Errorf("test %d: (%d, %d) %v (expected %v)", i, x, y, c, expect)
+				}
+			}
+		}
+	}
+}
+
+func TestSubImage_At(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(img, img.Bounds(), image.NewUniform(red), image.ZP, draw.Src)
+	sub := SubImage(img, image.Rect(1, 1, 3, 3))
+	for i, test := range []struct {
+		x, y int
+		c    color.Color
+	}{
+		{1, 1, red},
+		{2, 2, red},
+		{0, 0, color.RGBA{}},
+		{3, 1, color.RGBA{}},
+		{-5, 10, color.RGBA{}},
+	} {
+		if c := sub.At(test.x, test.y); c != test.c {
+			t.Errorf("test %d: (%d, %d) %v (expected %v)", i, test.x, test.y, c, test.c)
+		}
+	}
+}
+
+func TestMask(t *testing.T) {
+	r := image.Rect(1, 1, 3, 3)
+	for i, test := range []struct {
+		mask   *Mask
+		pt     image.Point
+		opaque bool
+	}{
+		{MaskInside(r), image.Pt(1, 1), false},
+		{MaskInside(r), image.Pt(0, 0), true},
+		{MaskInside(r), image.Pt(3, 3), true},
+		{MaskOutside(r), image.Pt(2, 2), true},
+		{MaskOutside(r), image.Pt(0, 2), false},
+		{MaskOutside(r), image.Pt(3, 1), false},
+	} {
+		_, _, _, a := test.mask.At(test.pt.X, test.pt.Y).RGBA()
+		if (a == 0xffff) != test.opaque || (a != 0 && a != 0xffff) {
+			t.Errorf("test %d: %v alpha %#x (opaque %v)", i, test.pt, a, test.opaque)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/bmatsuo/dockapp-go/geometry"
+	"github.com/bmatsuo/dockapp-go/imageutil"
+)
+
+// Border is a Renderer that draws a border of width Size around the image
+// drawn by Renderer.
+type Border struct {
+	Size     int
+	Color    color.Color
+	Renderer Renderer
+}
+
+// Render implements the Renderer interface.
+func (b *Border) Render(img draw.Image, src Source) {
+	rect := img.Bounds()
+	interior := geometry.Contract(rect, b.Size)
+	mask := imageutil.MaskInside(interior)
+	draw.DrawMask(img, rect, image.NewUniform(b.Color), image.ZP, mask, rect.Min, draw.Over)
+	b.Renderer.Render(imageutil.SubImage(img, interior), src)
+}
+
+// Background is a Renderer that fills an image with Color before drawing
+// Renderer.
+type Background struct {
+	Color    color.Color
+	Renderer Renderer
+}
+
+// Render implements the Renderer interface.
+func (bg *Background) Render(img draw.Image, src Source) {
+	draw.Draw(img, img.Bounds(), image.NewUniform(bg.Color), image.ZP, draw.Over)
+	bg.Renderer.Render(img, src)
+}
+
+// FractionBar is a Renderer that draws Renderer in the bottom of an image, in
+// proportion to the fraction of a Source.
+type FractionBar struct {
+	Renderer Renderer
+}
+
+// Render implements the Renderer interface.
+func (frac *FractionBar) Render(img draw.Image, src Source) {
+	rect := img.Bounds()
+	rect.Min.Y = rect.Max.Y - int(float64(rect.Dy())*src.Fraction())
+	frac.Renderer.Render(imageutil.SubImage(img, rect), src)
+}
+
+// NewBar returns a Renderer that draws a bordered bar filled by fill in
+// proportion to the fraction of a Source.
+func NewBar(fill Renderer) Renderer {
+	return &Background{
+		Color: color.White,
+		Renderer: &Border{
+			Size:  1,
+			Color: color.Black,
+			Renderer: &FractionBar{
+				Renderer: fill,
+			},
+		},
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Package render draws measurements that are a fraction of some capacity, like
+the utilization of a cpu core or the charge of a battery, independent of where
+the measurements come from.
+*/
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Source is a measurement of a fraction of some capacity.  Fraction returns a
+// value from 0.0 to 1.0 and Label returns a short human readable name or
+// description of the measurement.
+type Source interface {
+	Fraction() float64
+	Label() string
+}
+
+// Renderer draws a Source in an image.
+type Renderer interface {
+	Render(draw.Image, Source)
+}
+
+// RendererFunc is a function that implements the Renderer interface.
+type RendererFunc func(draw.Image, Source)
+
+// Render implements the Renderer interface.
+func (fn RendererFunc) Render(img draw.Image, src Source) {
+	fn(img, src)
+}
+
+// Fraction is a Source with a constant value.
+type Fraction struct {
+	F    float64
+	Text string
+}
+
+// Fraction implements the Source interface.
+func (f Fraction) Fraction() float64 {
+	return f.F
+}
+
+// Label implements the Source interface.
+func (f Fraction) Label() string {
+	return f.Text
+}
+
+// Gradient is a Renderer that fills an image with a color blended from C1 to
+// C2 in proportion to the fraction of a Source.
+type Gradient struct {
+	C1, C2 color.Color
+}
+
+// Render implements the Renderer interface.
+func (grad *Gradient) Render(img draw.Image, src Source) {
+	draw.Draw(img, img.Bounds(), image.NewUniform(grad.Color(src.Fraction())), image.ZP, draw.Over)
+}
+
+// Color returns the color blended from grad.C1 to grad.C2 by fraction f.
+func (grad *Gradient) Color(f float64) color.Color {
+	r1, g1, b1, a1 := grad.C1.RGBA()
+	r2, g2, b2, a2 := grad.C2.RGBA()
+
+	const M = 0xFFFF
+	m := uint32(f * float64(M))
+	// The resultant red value is a blend of dstr and srcr, and ranges in [0, M].
+	// The calculation for green, blue and alpha is similar.
+	r := (r1*(M-m) + r2*m) / M
+	g := (g1*(M-m) + g2*m) / M
+	b := (b1*(M-m) + b2*m) / M
+	a := (a1*(M-m) + a2*m) / M
+
+	return color.RGBA64{
+		R: uint16(r),
+		G: uint16(g),
+		B: uint16(b),
+		A: uint16(a),
+	}
+}
@@ -0,0 +1,68 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestGradient(t *testing.T) {
+	grad := &Gradient{
+		C1: color.RGBA{G: 0xff, A: 0xff},
+		C2: color.RGBA{R: 0xff, A: 0xff},
+	}
+	for i, test := range []struct {
+		f float64
+		c color.RGBA
+	}{
+		{0, color.RGBA{G: 0xff, A: 0xff}},
+		{0.5, color.RGBA{R: 0x7f, G: 0x80, A: 0xff}},
+		{1, color.RGBA{R: 0xff, A: 0xff}},
+	} {
+		img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+		grad.Render(img, Fraction{F: test.f})
+		c := img.RGBAAt(1, 1)
+		if c != test.c {
+			t.Errorf("test %d: %v (expected %v)", i, c, test.c)
+		}
+	}
+}
+
+func TestNewBar(t *testing.T) {
+	fill := &Gradient{
+		C1: color.RGBA{G: 0xff, A: 0xff},
+		C2: color.RGBA{G: 0xff, A: 0xff},
+	}
+	bar := NewBar(fill)
+	for i, test := range []struct {
+		f      float64
+		filled int
+	}{
+		{0, 0},
+		{0.5, 4},
+		{1, 8},
+	} {
+		img := image.NewRGBA(image.Rect(0, 0, 4, 10))
+		bar.Render(img, Fraction{F: test.f})
+		if c := img.RGBAAt(0, 0); c != (color.RGBA{A: 0xff}) {
+			t.Errorf("test %d: border %v", i, c)
+		}
+		filled := 0
+		for y := 1; y < 9; y++ {
+			c := img.RGBAAt(2, y)
+			switch c {
+			case color.RGBA{G: 0xff, A: 0xff}:
+				filled++
+			case color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}:
+				if filled > 0 {
+					t.Errorf("test %d: background %v below fill", i, c)
+				}
+			default:
+				t.Errorf("test %d: color %v at y=%d", i, c, y)
+			}
+		}
+		if filled != test.filled {
+			t.Errorf("test %d: %d pixels filled (expected %d)", i, filled, test.filled)
+		}
+	}
+}